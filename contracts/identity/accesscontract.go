@@ -18,6 +18,17 @@ import (
 //		1: error
 func (ci *ContractIdentity) CreateAccess(ctx contractapi.TransactionContextInterface, request model.AccessCreateRequest) (*model.AccessResponse, error) {
 	log.Printf("[%s][CreateAccess]", ctx.GetStub().GetChannelID())
+
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityRoleAdmin); err != nil {
+		return nil, err
+	}
+	return putAccess(ctx, request)
+}
+
+// putAccess stores the access of a contract, used by InitLedger with the functions of
+// the identity contract
+func putAccess(ctx contractapi.TransactionContextInterface, request model.AccessCreateRequest) (*model.AccessResponse, error) {
 	lowerNonSpace := lus.NormalizeString(request.ContractName)
 
 	key, err := ctx.GetStub().CreateCompositeKey(AccessDocType, []string{lowerNonSpace})
@@ -38,7 +49,7 @@ func (ci *ContractIdentity) CreateAccess(ctx contractapi.TransactionContextInter
 	// JSON encoding
 	accessJE, _ := json.Marshal(access)
 
-	if err := ctx.GetStub().PutState(key, accessJE); err != nil {
+	if err := putAudited(ctx, AccessDocType, access.ID, key, accessJE); err != nil {
 		return nil, fmt.Errorf("access %s could not be created: %v", request.ContractName, err)
 	}
 	return &model.AccessResponse{
@@ -64,7 +75,7 @@ func (ci *ContractIdentity) GetAccess(ctx contractapi.TransactionContextInterfac
 	} else if key == "" {
 		return nil, fmt.Errorf("no state found for %s", request.ID)
 	}
-	item, err := ctx.GetStub().GetState(key)
+	item, err := getDocument(ctx, AccessDocType, key)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get: %v", err)
 	} else if item == nil {
@@ -82,33 +93,30 @@ func (ci *ContractIdentity) GetAccess(ctx contractapi.TransactionContextInterfac
 	}, nil
 }
 
-// GetAccesses get all access
+// GetAccesses get a page of the access entries, in ID order
 //
 // Arguments:
-//		0: request model.RichQuerySelector
+//		0: ListRequest
 // Returns:
-//		0: *model.PaginatedQueryResponse
+//		0: AccessesResponse
 //		1: error
-func (ci *ContractIdentity) GetAccesses(ctx contractapi.TransactionContextInterface, request model.QueryPaginator) (*model.PaginatedQueryResponse, error) {
+func (ci *ContractIdentity) GetAccesses(ctx contractapi.TransactionContextInterface, request ListRequest) (*AccessesResponse, error) {
 	log.Printf("[%s][GetAccesses]", ctx.GetStub().GetChannelID())
 
-	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(AccessDocType, []string{}, int32(request.PageSize), request.Bookmark)
+	records, bookmark, err := listPage(ctx, AccessDocType, []string{}, request, listFields(AccessDocType), func(_ string, value []byte) (interface{}, error) {
+		var item model.Access
+		if err := json.Unmarshal(value, &item); err != nil {
+			return nil, err
+		}
+		return &item, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer resultsIterator.Close()
 
-	var items = make([]interface{}, 0)
-	for resultsIterator.HasNext() {
-		responseRange, err := resultsIterator.Next()
-		if responseRange == nil {
-			return nil, err
-		}
-		var item model.Access
-		err = json.Unmarshal(responseRange.Value, &item)
-		if err != nil {
-			return nil, err
-		}
+	var items = make([]model.AccessResponse, 0, len(records))
+	for _, record := range records {
+		item := record.(*model.Access)
 		items = append(items, model.AccessResponse{
 			DocType:           item.DocType,
 			ID:                item.ID,
@@ -116,11 +124,10 @@ func (ci *ContractIdentity) GetAccesses(ctx contractapi.TransactionContextInterf
 			ContractFunctions: lus.MapToSlice(item.ContractFunctions),
 		})
 	}
-
-	return &model.PaginatedQueryResponse{
+	return &AccessesResponse{
 		Records:             items,
-		FetchedRecordsCount: responseMetadata.FetchedRecordsCount,
-		Bookmark:            responseMetadata.Bookmark,
+		FetchedRecordsCount: int32(len(items)),
+		Bookmark:            bookmark,
 	}, nil
 }
 
@@ -132,7 +139,7 @@ func (ci *ContractIdentity) updateAccess(ctx contractapi.TransactionContextInter
 		return err
 	}
 
-	role, err := ctx.GetStub().GetState(key)
+	role, err := getDocument(ctx, AccessDocType, key)
 	if err != nil {
 		return fmt.Errorf("failed to get a role: %v", err)
 	} else if role == nil {
@@ -153,7 +160,7 @@ func (ci *ContractIdentity) updateAccess(ctx contractapi.TransactionContextInter
 	if err != nil {
 		return err
 	}
-	if err := ctx.GetStub().PutState(key, accessJE); err != nil {
+	if err := putAudited(ctx, AccessDocType, accessJD.ID, key, accessJE); err != nil {
 		return fmt.Errorf("role %s could not be updated: %v", accessJD.ID, err)
 	}
 
@@ -163,7 +170,11 @@ func (ci *ContractIdentity) updateAccess(ctx contractapi.TransactionContextInter
 // deleteAccess
 func (ci *ContractIdentity) deleteAccess(ctx contractapi.TransactionContextInterface, request model.GetRequest) error {
 	log.Printf("[%s][deleteAccess]", ctx.GetStub().GetChannelID())
-	if err := lus.DeleteIndex(ctx.GetStub(), AccessDocType, []string{request.ID}, true); err != nil {
+	key, err := ctx.GetStub().CreateCompositeKey(AccessDocType, []string{request.ID})
+	if err != nil {
+		return err
+	}
+	if err := deleteAudited(ctx, AccessDocType, request.ID, key); err != nil {
 		return err
 	}
 
@@ -0,0 +1,398 @@
+package identity
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"log"
+)
+
+// Admin capabilities, each one is a ledger role scoped to an MSP.
+// The mutating functions declare the capability they need with assertCapability.
+const (
+	CapabilityIdentityAdmin = "IdentityAdmin" // create, update and delete participants
+	CapabilityIssuerAdmin   = "IssuerAdmin"   // create, renew and delete issuers
+	CapabilityRoleAdmin     = "RoleAdmin"     // roles, access policies, separation-of-duty rules and admin grants
+	CapabilityQueryAdmin    = "QueryAdmin"    // raw CouchDB selectors of QueryAssetsBy and QueryAssetsWithPagination
+	CapabilityAuditor       = "Auditor"       // audit trail and its export
+	CapabilitySchemaAdmin   = "SchemaAdmin"   // schema migrations of the stored documents
+)
+
+// CapabilityChannelAdmin channel-wide capability, the global config and the status of any
+// organization. Its role is not scoped to an MSP, the members are qualified with their
+// MSP (mspID:member), and it is granted to the first admin that runs InitLedger
+const CapabilityChannelAdmin = "ChannelAdmin"
+
+// channelScope MSP ID of the channel-wide admin roles
+const channelScope = "~channel"
+
+var capabilities = []string{CapabilityIdentityAdmin, CapabilityIssuerAdmin, CapabilityRoleAdmin, CapabilityQueryAdmin, CapabilityAuditor, CapabilitySchemaAdmin}
+
+// AdminRole members of an MSP that hold an admin capability. A member is the
+// client identity ID (x509::subject::issuer) or the DID bound to the client certificate.
+type AdminRole struct {
+	DocType    string   `json:"docType"`
+	MspID      string   `json:"mspID"`
+	Capability string   `json:"capability"`
+	Members    []string `json:"members"`
+}
+
+// AdminGrantRequest grant or revoke a capability in the MSP of the caller
+type AdminGrantRequest struct {
+	Capability string `json:"capability"`
+	Member     string `json:"member"` // client identity ID or participant DID
+}
+
+// ChannelAdminRequest grant or revoke the channel admin capability to a member of an MSP
+type ChannelAdminRequest struct {
+	MspID  string `json:"mspID"`
+	Member string `json:"member"` // client identity ID or participant DID
+}
+
+// GrantAdminCapability adds a member to an admin role of the caller's MSP
+//
+// Arguments:
+//		0: AdminGrantRequest
+// Returns:
+//		0: AdminRole
+//		1: error
+func (ci *ContractIdentity) GrantAdminCapability(ctx contractapi.TransactionContextInterface, request AdminGrantRequest) (*AdminRole, error) {
+	log.Printf("[%s][GrantAdminCapability]", ctx.GetStub().GetChannelID())
+
+	if err := ci.assertCapability(ctx, CapabilityRoleAdmin); err != nil {
+		return nil, err
+	}
+	if request.Member == "" {
+		return nil, fmt.Errorf(lus.ErrorRequiredParameter, "member")
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf(lus.ErrorGetMSPID, err)
+	}
+	return ci.grantCapability(ctx, mspID, request.Capability, request.Member)
+}
+
+// RevokeAdminCapability removes a member from an admin role of the caller's MSP,
+// the last RoleAdmin of an MSP can not be revoked
+func (ci *ContractIdentity) RevokeAdminCapability(ctx contractapi.TransactionContextInterface, request AdminGrantRequest) (*AdminRole, error) {
+	log.Printf("[%s][RevokeAdminCapability]", ctx.GetStub().GetChannelID())
+
+	if err := ci.assertCapability(ctx, CapabilityRoleAdmin); err != nil {
+		return nil, err
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf(lus.ErrorGetMSPID, err)
+	}
+	role, err := getAdminRole(ctx, mspID, request.Capability)
+	if err != nil {
+		return nil, err
+	}
+	if !lus.Contains(role.Members, request.Member) {
+		return nil, fmt.Errorf("%s does not hold %s in %s", request.Member, request.Capability, mspID)
+	}
+
+	members := make([]string, 0, len(role.Members))
+	for _, member := range role.Members {
+		if member != request.Member {
+			members = append(members, member)
+		}
+	}
+	if request.Capability == CapabilityRoleAdmin && len(members) == 0 {
+		return nil, fmt.Errorf("the last %s of %s can not be revoked", CapabilityRoleAdmin, mspID)
+	}
+	role.Members = members
+
+	if err := putAdminRole(ctx, role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// GetAdminRoles get the admin roles of the caller's MSP
+func (ci *ContractIdentity) GetAdminRoles(ctx contractapi.TransactionContextInterface) ([]AdminRole, error) {
+	log.Printf("[%s][GetAdminRoles]", ctx.GetStub().GetChannelID())
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf(lus.ErrorGetMSPID, err)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(AdminDocType, []string{mspID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var items = make([]AdminRole, 0)
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if responseRange == nil {
+			return nil, err
+		}
+
+		roleJE, err := migrateDocument(AdminDocType, responseRange.Value)
+		if err != nil {
+			return nil, err
+		}
+		var role AdminRole
+		if err = json.Unmarshal(roleJE, &role); err != nil {
+			return nil, err
+		}
+		items = append(items, role)
+	}
+	return items, nil
+}
+
+// GrantChannelAdmin adds a member of an MSP to the channel admins, only a channel admin
+// can grant it
+//
+// Arguments:
+//		0: ChannelAdminRequest
+// Returns:
+//		0: AdminRole
+//		1: error
+func (ci *ContractIdentity) GrantChannelAdmin(ctx contractapi.TransactionContextInterface, request ChannelAdminRequest) (*AdminRole, error) {
+	log.Printf("[%s][GrantChannelAdmin]", ctx.GetStub().GetChannelID())
+
+	if err := ci.assertChannelAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if request.MspID == "" {
+		return nil, fmt.Errorf(lus.ErrorRequiredParameter, "mspID")
+	} else if request.Member == "" {
+		return nil, fmt.Errorf(lus.ErrorRequiredParameter, "member")
+	}
+
+	role, err := getAdminRole(ctx, channelScope, CapabilityChannelAdmin)
+	if err != nil {
+		return nil, err
+	}
+	member := channelMember(request.MspID, request.Member)
+	if lus.Contains(role.Members, member) {
+		return role, nil
+	}
+	role.Members = append(role.Members, member)
+	// sorted, the document must be the same across all endorsers
+	sort.Strings(role.Members)
+
+	if err := putAdminRole(ctx, role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// RevokeChannelAdmin removes a member of an MSP from the channel admins, the last
+// channel admin can not be revoked
+//
+// Arguments:
+//		0: ChannelAdminRequest
+// Returns:
+//		0: AdminRole
+//		1: error
+func (ci *ContractIdentity) RevokeChannelAdmin(ctx contractapi.TransactionContextInterface, request ChannelAdminRequest) (*AdminRole, error) {
+	log.Printf("[%s][RevokeChannelAdmin]", ctx.GetStub().GetChannelID())
+
+	if err := ci.assertChannelAdmin(ctx); err != nil {
+		return nil, err
+	}
+	role, err := getAdminRole(ctx, channelScope, CapabilityChannelAdmin)
+	if err != nil {
+		return nil, err
+	}
+	member := channelMember(request.MspID, request.Member)
+	if !lus.Contains(role.Members, member) {
+		return nil, fmt.Errorf("%s of %s does not hold %s", request.Member, request.MspID, CapabilityChannelAdmin)
+	}
+
+	members := make([]string, 0, len(role.Members))
+	for _, m := range role.Members {
+		if m != member {
+			members = append(members, m)
+		}
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("the last %s can not be revoked", CapabilityChannelAdmin)
+	}
+	role.Members = members
+
+	if err := putAdminRole(ctx, role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// GetChannelAdmins get the channel admins, the members are qualified with their MSP
+func (ci *ContractIdentity) GetChannelAdmins(ctx contractapi.TransactionContextInterface) (*AdminRole, error) {
+	log.Printf("[%s][GetChannelAdmins]", ctx.GetStub().GetChannelID())
+	return getAdminRole(ctx, channelScope, CapabilityChannelAdmin)
+}
+
+// bootstrapAdminRoles grants every capability of the caller's MSP to the caller, only
+// if the MSP has no RoleAdmin yet, and the channel admin capability if nobody holds
+// it. It is the only place where the OU=admin check is used.
+func (ci *ContractIdentity) bootstrapAdminRoles(ctx contractapi.TransactionContextInterface) error {
+	// check if client-node is connected as admin
+	if err := lus.AssertAdmin(ctx); err != nil {
+		return fmt.Errorf(err.Error())
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf(lus.ErrorGetMSPID, err)
+	}
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return err
+	}
+	roleAdmin, err := getAdminRole(ctx, mspID, CapabilityRoleAdmin)
+	if err != nil {
+		return err
+	} else if len(roleAdmin.Members) > 0 {
+		log.Printf("[%s][bootstrapAdminRoles] %s already bootstrapped", ctx.GetStub().GetChannelID(), mspID)
+	} else {
+		for _, capability := range capabilities {
+			if _, err := ci.grantCapability(ctx, mspID, capability, clientID); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the channel admin is the first RoleAdmin that runs InitLedger, also on the
+	// channels bootstrapped before the capability existed
+	channelAdmin, err := getAdminRole(ctx, channelScope, CapabilityChannelAdmin)
+	if err != nil {
+		return err
+	} else if len(channelAdmin.Members) > 0 {
+		return nil
+	}
+	if err := ci.assertCapability(ctx, CapabilityRoleAdmin); err != nil {
+		return nil
+	}
+	channelAdmin.Members = []string{channelMember(mspID, clientID)}
+	return putAdminRole(ctx, channelAdmin)
+}
+
+// assertCapability returns an error if the caller does not hold the admin capability in its MSP
+func (ci *ContractIdentity) assertCapability(ctx contractapi.TransactionContextInterface, capability string) error {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf(lus.ErrorGetMSPID, err)
+	}
+	role, err := getAdminRole(ctx, mspID, capability)
+	if err != nil {
+		return err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return err
+	}
+	if lus.Contains(role.Members, clientID) {
+		return nil
+	}
+
+	did, err := callerDid(ctx)
+	if err != nil {
+		return err
+	}
+	if did != "" && lus.Contains(role.Members, did) {
+		return nil
+	}
+	return fmt.Errorf(lus.ErrorMissingCapability, capability, mspID)
+}
+
+// assertChannelAdmin returns an error if the caller does not hold the channel admin capability
+func (ci *ContractIdentity) assertChannelAdmin(ctx contractapi.TransactionContextInterface) error {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf(lus.ErrorGetMSPID, err)
+	}
+	role, err := getAdminRole(ctx, channelScope, CapabilityChannelAdmin)
+	if err != nil {
+		return err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return err
+	}
+	if lus.Contains(role.Members, channelMember(mspID, clientID)) {
+		return nil
+	}
+
+	did, err := callerDid(ctx)
+	if err != nil {
+		return err
+	}
+	if did != "" && lus.Contains(role.Members, channelMember(mspID, did)) {
+		return nil
+	}
+	return fmt.Errorf(lus.ErrorMissingCapability, CapabilityChannelAdmin, "the channel")
+}
+
+// channelMember member of a channel-wide admin role
+func channelMember(mspID, member string) string {
+	return mspID + ":" + member
+}
+
+func (ci *ContractIdentity) grantCapability(ctx contractapi.TransactionContextInterface, mspID, capability, member string) (*AdminRole, error) {
+	if !lus.Contains(capabilities, capability) {
+		return nil, fmt.Errorf("invalid capability %s, expected one of %v", capability, capabilities)
+	}
+	role, err := getAdminRole(ctx, mspID, capability)
+	if err != nil {
+		return nil, err
+	}
+	if lus.Contains(role.Members, member) {
+		return role, nil
+	}
+	role.Members = append(role.Members, member)
+	// sorted, the document must be the same across all endorsers
+	sort.Strings(role.Members)
+
+	if err := putAdminRole(ctx, role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// getAdminRole returns the admin role, with no members if it is not stored yet
+func getAdminRole(ctx contractapi.TransactionContextInterface, mspID, capability string) (*AdminRole, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(AdminDocType, []string{mspID, capability})
+	if err != nil {
+		return nil, err
+	}
+	item, err := getDocument(ctx, AdminDocType, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get admin role %s: %v", capability, err)
+	}
+
+	role := &AdminRole{DocType: AdminDocType, MspID: mspID, Capability: capability, Members: make([]string, 0)}
+	if item != nil {
+		if err = json.Unmarshal(item, role); err != nil {
+			return nil, err
+		}
+	}
+	return role, nil
+}
+
+func putAdminRole(ctx contractapi.TransactionContextInterface, role *AdminRole) error {
+	key, err := ctx.GetStub().CreateCompositeKey(AdminDocType, []string{role.MspID, role.Capability})
+	if err != nil {
+		return err
+	}
+	// JSON encoding
+	roleJE, err := json.Marshal(role)
+	if err != nil {
+		return err
+	}
+	if err := putAudited(ctx, AdminDocType, role.MspID+":"+role.Capability, key, roleJE); err != nil {
+		return fmt.Errorf("admin role %s could not be stored: %v", role.Capability, err)
+	}
+	return nil
+}
@@ -0,0 +1,381 @@
+package identity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/didauth"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/jsondiff"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/statecache"
+	"log"
+)
+
+// Audit actions
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// auditTimeLayout fixed width UTC timestamp of the audit keys, sorted by time
+const auditTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// AuditRecord mutation of an entity by a transaction. The changes are the RFC 6902 JSON
+// Patch from the stored document before the transaction to the document after it
+type AuditRecord struct {
+	DocType    string               `json:"docType"`
+	TxID       string               `json:"txId"`
+	Timestamp  string               `json:"timestamp"` // transaction timestamp, RFC3339 UTC
+	Function   string               `json:"function"`
+	CallerID   string               `json:"callerID"` // client identity ID
+	CallerDid  string               `json:"callerDid,omitempty" metadata:",optional"`
+	MspID      string               `json:"mspID"`
+	EntityType string               `json:"entityType"` // doc type of the entity
+	EntityID   string               `json:"entityId"`
+	Action     string               `json:"action"`
+	Changes    []jsondiff.Operation `json:"changes"`
+}
+
+// AuditTrailRequest audit records of an entity, an actor and a time range, the
+// records are sorted by entity and time, or by time for an actor
+type AuditTrailRequest struct {
+	EntityType string `json:"entityType,omitempty" metadata:",optional"` // doc type, ex: did.participant
+	EntityID   string `json:"entityId,omitempty" metadata:",optional"`   // requires entityType
+	Actor      string `json:"actor,omitempty" metadata:",optional"`      // caller DID or client identity ID
+	From       string `json:"from,omitempty" metadata:",optional"`       // RFC3339, inclusive
+	To         string `json:"to,omitempty" metadata:",optional"`         // RFC3339, exclusive
+	PageSize   int    `json:"pageSize"`
+	Bookmark   string `json:"bookmark,omitempty" metadata:",optional"`
+}
+
+// AuditTrailResponse page of audit records
+type AuditTrailResponse struct {
+	Records             []AuditRecord `json:"records"`
+	FetchedRecordsCount int32         `json:"fetchedRecordsCount"`
+	Bookmark            string        `json:"bookmark"`
+}
+
+// AuditExport page of audit records as JSON Lines. The chaincode signs the digest of
+// the lines of every page with its assertion key, the organization that exports the
+// file can countersign it, see tools/auditsign
+type AuditExport struct {
+	Lines               string `json:"lines"` // one audit record per line
+	Sha256              string `json:"sha256"`
+	FetchedRecordsCount int32  `json:"fetchedRecordsCount"`
+	Bookmark            string `json:"bookmark"`
+	Jws                 string `json:"jws"` // AuditExportClaims signed by the chaincode assertion key
+}
+
+// AuditExportClaims claims of the JWS of an export page, the bookmarks chain the pages
+type AuditExportClaims struct {
+	Issuer              string `json:"iss"`    // channel of the chaincode
+	Sha256              string `json:"sha256"` // hex SHA-256 of the lines
+	FetchedRecordsCount int32  `json:"fetchedRecordsCount"`
+	PreviousBookmark    string `json:"previousBookmark"` // bookmark of the request
+	Bookmark            string `json:"bookmark"`
+	IssuedAt            int64  `json:"iat"`
+}
+
+// GetAuditTrail get a page of the audit records
+//
+// Arguments:
+//		0: AuditTrailRequest
+// Returns:
+//		0: AuditTrailResponse
+//		1: error
+func (ci *ContractIdentity) GetAuditTrail(ctx contractapi.TransactionContextInterface, request AuditTrailRequest) (*AuditTrailResponse, error) {
+	log.Printf("[%s][GetAuditTrail]", ctx.GetStub().GetChannelID())
+
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityAuditor); err != nil {
+		return nil, err
+	}
+	records, bookmark, err := auditTrail(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditTrailResponse{
+		Records:             records,
+		FetchedRecordsCount: int32(len(records)),
+		Bookmark:            bookmark,
+	}, nil
+}
+
+// ExportAuditTrail export a page of the audit records as JSON Lines, signed by the
+// chaincode assertion key. The export is a query, it is signed by one peer
+//
+// Arguments:
+//		0: AuditTrailRequest
+// Returns:
+//		0: AuditExport
+//		1: error
+func (ci *ContractIdentity) ExportAuditTrail(ctx contractapi.TransactionContextInterface, request AuditTrailRequest) (*AuditExport, error) {
+	log.Printf("[%s][ExportAuditTrail]", ctx.GetStub().GetChannelID())
+
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityAuditor); err != nil {
+		return nil, err
+	}
+	if assertionKey == nil {
+		return nil, fmt.Errorf("the chaincode has no assertion key")
+	}
+	records, bookmark, err := auditTrail(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines strings.Builder
+	for _, record := range records {
+		recordJE, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		lines.Write(recordJE)
+		lines.WriteByte('\n')
+	}
+	sum := sha256.Sum256([]byte(lines.String()))
+	export := &AuditExport{
+		Lines:               lines.String(),
+		Sha256:              hex.EncodeToString(sum[:]),
+		FetchedRecordsCount: int32(len(records)),
+		Bookmark:            bookmark,
+	}
+
+	txTime, err := currentTxTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := json.Marshal(AuditExportClaims{
+		Issuer:              ctx.GetStub().GetChannelID(),
+		Sha256:              export.Sha256,
+		FetchedRecordsCount: export.FetchedRecordsCount,
+		PreviousBookmark:    request.Bookmark,
+		Bookmark:            export.Bookmark,
+		IssuedAt:            txTime.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if export.Jws, err = didauth.Sign(claims, assertionKey); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// auditTrail returns a page of the audit records of the request
+func auditTrail(ctx contractapi.TransactionContextInterface, request AuditTrailRequest) ([]AuditRecord, string, error) {
+	if request.EntityID != "" && request.EntityType == "" {
+		return nil, "", fmt.Errorf(lus.ErrorRequiredParameter, "entityType")
+	}
+	var from, to time.Time
+	var err error
+	if request.From != "" {
+		if from, err = lus.ParseRFC3339toTime(request.From); err != nil {
+			return nil, "", fmt.Errorf("invalid from: %v", err)
+		}
+	}
+	if request.To != "" {
+		if to, err = lus.ParseRFC3339toTime(request.To); err != nil {
+			return nil, "", fmt.Errorf("invalid to: %v", err)
+		}
+	}
+
+	// the records of an entity, of an actor or all of them
+	objectType, attributes := AuditDocType, []string{}
+	if request.EntityType != "" {
+		attributes = append(attributes, request.EntityType)
+		if request.EntityID != "" {
+			attributes = append(attributes, request.EntityID)
+		}
+	} else if request.Actor != "" {
+		objectType, attributes = ObjectTypeAuditActor, []string{request.Actor}
+	}
+
+	// the time follows the entity ID and the actor in the keys, the time range of their
+	// records is the range of the keys. The records of a doc type or of every entity
+	// are sorted by entity, their time range is filtered
+	var start, end string
+	timeKeyed := request.EntityID != "" || objectType == ObjectTypeAuditActor
+	if timeKeyed {
+		prefix, err := ctx.GetStub().CreateCompositeKey(objectType, attributes)
+		if err != nil {
+			return nil, "", err
+		}
+		if !from.IsZero() {
+			start = prefix + from.UTC().Format(auditTimeLayout)
+		}
+		if !to.IsZero() {
+			end = prefix + to.UTC().Format(auditTimeLayout)
+		}
+	}
+
+	page := ListRequest{PageSize: request.PageSize, Bookmark: request.Bookmark}
+	items, bookmark, err := listRange(ctx, objectType, attributes, start, end, page, nil, func(_ string, value []byte) (interface{}, error) {
+		if objectType == ObjectTypeAuditActor {
+			// the actor index stores the key of the record
+			if value, err = ctx.GetStub().GetState(string(value)); err != nil {
+				return nil, err
+			} else if value == nil {
+				return nil, nil
+			}
+		}
+		var record AuditRecord
+		if err := json.Unmarshal(value, &record); err != nil {
+			return nil, err
+		}
+		if request.Actor != "" && record.CallerID != request.Actor && record.CallerDid != request.Actor {
+			return nil, nil
+		}
+		if !timeKeyed && (!from.IsZero() || !to.IsZero()) {
+			timestamp, err := lus.ParseRFC3339toTime(record.Timestamp)
+			if err != nil {
+				return nil, err
+			}
+			if timestamp.Before(from) || (!to.IsZero() && !timestamp.Before(to)) {
+				return nil, nil
+			}
+		}
+		return &record, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var records = make([]AuditRecord, 0, len(items))
+	for _, item := range items {
+		records = append(records, *item.(*AuditRecord))
+	}
+	return records, bookmark, nil
+}
+
+// getAuditRecord returns the audit record of the change of an entity by a transaction,
+// nil if it does not exist
+func getAuditRecord(ctx contractapi.TransactionContextInterface, entityType, entityID string, txTime time.Time, txID string) (*AuditRecord, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(AuditDocType, []string{entityType, entityID, txTime.UTC().Format(auditTimeLayout), txID})
+	if err != nil {
+		return nil, err
+	}
+	recordJE, err := ctx.GetStub().GetState(key)
+	if err != nil || recordJE == nil {
+		return nil, err
+	}
+	var record AuditRecord
+	if err := json.Unmarshal(recordJE, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// putAudited stores the document of an entity, stamped with its schema version, and
+// records the audit of the change
+func putAudited(ctx contractapi.TransactionContextInterface, entityType, entityID, key string, value []byte) error {
+	before, err := statecache.GetCommittedState(ctx.GetStub(), key)
+	if err != nil {
+		return err
+	}
+	if value, err = stampDocument(entityType, value); err != nil {
+		return fmt.Errorf("%s %s: %v", entityType, entityID, err)
+	}
+	if err := ctx.GetStub().PutState(key, value); err != nil {
+		return err
+	}
+	return recordAudit(ctx, entityType, entityID, before, value)
+}
+
+// deleteAudited deletes the document of an entity and records the audit of the change
+func deleteAudited(ctx contractapi.TransactionContextInterface, entityType, entityID, key string) error {
+	before, err := statecache.GetCommittedState(ctx.GetStub(), key)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().DelState(key); err != nil {
+		return err
+	}
+	return recordAudit(ctx, entityType, entityID, before, nil)
+}
+
+// recordAudit writes the audit record of the change of an entity. The record is keyed by
+// the transaction, the last change of an entity in a transaction is the one recorded,
+// and its diff is from the committed document
+func recordAudit(ctx contractapi.TransactionContextInterface, entityType, entityID string, before, after []byte) error {
+	action := AuditUpdate
+	switch {
+	case len(before) == 0 && len(after) == 0:
+		return nil
+	case len(before) == 0:
+		action = AuditCreate
+	case len(after) == 0:
+		action = AuditDelete
+	}
+	changes, err := jsondiff.Diff(before, after)
+	if err != nil {
+		return fmt.Errorf("audit of %s %s: %v", entityType, entityID, err)
+	} else if len(changes) == 0 {
+		return nil
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return err
+	}
+	txTime := time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).UTC()
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf(lus.ErrorGetMSPID, err)
+	}
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return err
+	}
+	did, err := callerDid(ctx)
+	if err != nil {
+		return err
+	}
+	fcn, _ := ctx.GetStub().GetFunctionAndParameters()
+
+	record := AuditRecord{
+		DocType:    AuditDocType,
+		TxID:       ctx.GetStub().GetTxID(),
+		Timestamp:  txTime.Format(time.RFC3339Nano),
+		Function:   lus.TransactionName(fcn),
+		CallerID:   clientID,
+		CallerDid:  did,
+		MspID:      mspID,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Action:     action,
+		Changes:    changes,
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(AuditDocType, []string{entityType, entityID, txTime.Format(auditTimeLayout), record.TxID})
+	if err != nil {
+		return err
+	}
+	// JSON encoding
+	recordJE, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(key, recordJE); err != nil {
+		return fmt.Errorf("audit of %s %s could not be stored: %v", entityType, entityID, err)
+	}
+
+	actors := []string{clientID}
+	if did != "" && did != clientID {
+		actors = append(actors, did)
+	}
+	for _, actor := range actors {
+		actorKey, err := ctx.GetStub().CreateCompositeKey(ObjectTypeAuditActor, []string{actor, txTime.Format(auditTimeLayout), entityType, entityID, record.TxID})
+		if err != nil {
+			return err
+		}
+		if err := ctx.GetStub().PutState(actorKey, []byte(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
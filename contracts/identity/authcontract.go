@@ -0,0 +1,414 @@
+package identity
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/didauth"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	"log"
+)
+
+const (
+	defaultChallengeTTL = 300  // seconds
+	maxChallengeTTL     = 3600 // seconds
+	assertionTTL        = 300  // seconds
+)
+
+// assertionKey signs the assertions of GetAuthAssertion, see SetAssertionKey
+var assertionKey crypto.Signer
+
+// challengeKey HMAC key of the challenges, derived from the assertion key
+var challengeKey []byte
+
+// SetAssertionKey sets the key that signs the authentication assertions,
+// main loads it from CHAINCODE_ASSERTION_KEY. The assertions are signed by the query
+// GetAuthAssertion on one peer, the signatures do not need to be deterministic
+func SetAssertionKey(key crypto.Signer) error {
+	if _, err := didauth.SigningAlgorithm(key.Public()); err != nil {
+		return err
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("the assertion key can not be exported: %v", err)
+	}
+	sum := sha256.Sum256(append([]byte("didauth challenge key"), pkcs8...))
+	assertionKey, challengeKey = key, sum[:]
+	return nil
+}
+
+// AuthChallenge challenge bound to a DID and an audience, see didauth
+type AuthChallenge struct {
+	DocType     string `json:"docType"`
+	ID          string `json:"id"` // ID of the transaction that created the challenge
+	Did         string `json:"did"`
+	Audience    string `json:"audience"`
+	Challenge   string `json:"challenge"`
+	Time        string `json:"time"`
+	ExpiresTime string `json:"expiresTime"`
+	// set by VerifyAuthResponse, the challenge can not be answered again
+	VerifiedTxID         string `json:"verifiedTxId,omitempty" metadata:",optional"`
+	VerifiedTime         string `json:"verifiedTime,omitempty" metadata:",optional"`
+	VerifiedBy           string `json:"verifiedBy,omitempty" metadata:",optional"` // MSP qualified client that submitted the response
+	AssertionExpiresTime string `json:"assertionExpiresTime,omitempty" metadata:",optional"`
+}
+
+// AuthChallengeRequest
+type AuthChallengeRequest struct {
+	Did      string `json:"did"`
+	Audience string `json:"audience"`                           // application that requests the authentication
+	TTL      int    `json:"ttl,omitempty" metadata:",optional"` // seconds, 300 by default
+}
+
+// AuthChallengesDeleted result of a page of DeleteExpiredAuthChallenges
+type AuthChallengesDeleted struct {
+	Scanned  int    `json:"scanned"`
+	Deleted  int    `json:"deleted"`
+	Bookmark string `json:"bookmark"`
+}
+
+// AuthResponseRequest
+type AuthResponseRequest struct {
+	ChallengeID string `json:"challengeId"`
+	Jws         string `json:"jws"` // didauth.ResponsePayload signed by the participant key
+}
+
+// CreateAuthChallenge records a challenge that the participant must sign to prove
+// control of its key. The challenge is a HMAC of the transaction under a key derived
+// from the assertion key, so it is random to the clients and has the same value across
+// all endorsers.
+//
+// Arguments:
+//		0: AuthChallengeRequest
+// Returns:
+//		0: AuthChallenge
+//		1: error
+func (ci *ContractIdentity) CreateAuthChallenge(ctx contractapi.TransactionContextInterface, request AuthChallengeRequest) (*AuthChallenge, error) {
+	log.Printf("[%s][CreateAuthChallenge]", ctx.GetStub().GetChannelID())
+
+	if assertionKey == nil {
+		return nil, fmt.Errorf("the chaincode has no assertion key")
+	}
+	if request.Did == "" {
+		return nil, fmt.Errorf(lus.ErrorRequiredParameter, "did")
+	}
+	if request.Audience == "" {
+		return nil, fmt.Errorf(lus.ErrorRequiredParameter, "audience")
+	}
+	ttl := request.TTL
+	if ttl == 0 {
+		ttl = defaultChallengeTTL
+	} else if ttl < 0 || ttl > maxChallengeTTL {
+		return nil, fmt.Errorf("invalid ttl %d, expected a value between 1 and %d seconds", ttl, maxChallengeTTL)
+	}
+
+	participant, err := findParticipant(ctx, request.Did)
+	if err != nil {
+		return nil, err
+	} else if participant == nil {
+		return nil, fmt.Errorf(lus.ErrorDefaultNotExist, request.Did)
+	} else if !participant.Active {
+		return nil, fmt.Errorf("participant %s is not active", request.Did)
+	}
+
+	// timestamp when the transaction was created, the same for every endorser
+	txTime, err := currentTxTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	txID := ctx.GetStub().GetTxID()
+	mac := hmac.New(sha256.New, challengeKey)
+	mac.Write([]byte(txID + "\x00" + request.Did + "\x00" + request.Audience))
+	challenge := &AuthChallenge{
+		DocType:     AuthChallengeDocType,
+		ID:          txID,
+		Did:         request.Did,
+		Audience:    request.Audience,
+		Challenge:   hex.EncodeToString(mac.Sum(nil)),
+		Time:        txTime.Format(time.RFC3339),
+		ExpiresTime: txTime.Add(time.Duration(ttl) * time.Second).Format(time.RFC3339),
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(AuthChallengeDocType, []string{challenge.ID})
+	if err != nil {
+		return nil, err
+	}
+	// JSON encoding
+	challengeJE, err := json.Marshal(challenge)
+	if err != nil {
+		return nil, err
+	}
+	if err := putAudited(ctx, AuthChallengeDocType, challenge.ID, key, challengeJE); err != nil {
+		return nil, fmt.Errorf("challenge for %s could not be stored: %v", request.Did, err)
+	}
+	return challenge, nil
+}
+
+// VerifyAuthResponse checks the JWS over the challenge against the key of the
+// participant and consumes the challenge, it can not be answered twice. It must be
+// submitted, the assertion is returned by GetAuthAssertion once it is committed.
+//
+// Arguments:
+//		0: AuthResponseRequest
+// Returns:
+//		0: AuthChallenge
+//		1: error
+func (ci *ContractIdentity) VerifyAuthResponse(ctx contractapi.TransactionContextInterface, request AuthResponseRequest) (*AuthChallenge, error) {
+	log.Printf("[%s][VerifyAuthResponse]", ctx.GetStub().GetChannelID())
+
+	if assertionKey == nil {
+		return nil, fmt.Errorf("the chaincode has no assertion key")
+	}
+
+	challenge, err := ci.GetAuthChallenge(ctx, model.GetRequest{ID: request.ChallengeID})
+	if err != nil {
+		return nil, err
+	}
+	if challenge.VerifiedTxID != "" {
+		return nil, fmt.Errorf("challenge %s was already answered in the transaction %s", challenge.ID, challenge.VerifiedTxID)
+	}
+
+	// timestamp of the proposal, the challenge must not be expired
+	txTime, err := currentTxTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	challengeTime, err := lus.ParseRFC3339toTime(challenge.Time)
+	if err != nil {
+		return nil, err
+	}
+	expiresTime, err := lus.ParseRFC3339toTime(challenge.ExpiresTime)
+	if err != nil {
+		return nil, err
+	}
+	if txTime.Before(challengeTime) {
+		return nil, fmt.Errorf("the response is timestamped before the challenge %s", challenge.ID)
+	} else if txTime.After(expiresTime) {
+		return nil, fmt.Errorf("challenge %s expired at %s", challenge.ID, challenge.ExpiresTime)
+	}
+
+	participant, err := findParticipant(ctx, challenge.Did)
+	if err != nil {
+		return nil, err
+	} else if participant == nil {
+		return nil, fmt.Errorf(lus.ErrorDefaultNotExist, challenge.Did)
+	} else if !participant.Active {
+		return nil, fmt.Errorf("participant %s is not active", challenge.Did)
+	}
+
+	payload, err := lus.VerifySignature(request.Jws, participant.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	var response didauth.ResponsePayload
+	if err = json.Unmarshal(payload, &response); err != nil {
+		return nil, fmt.Errorf(lus.ErrorParseJWS)
+	}
+	if response.ChallengeID != challenge.ID || response.Challenge != challenge.Challenge ||
+		response.Did != challenge.Did || response.Audience != challenge.Audience {
+		return nil, fmt.Errorf("the response does not match the challenge %s", challenge.ID)
+	}
+
+	verifiedBy, err := qualifiedClientID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	challenge.VerifiedTxID = ctx.GetStub().GetTxID()
+	challenge.VerifiedTime = txTime.Format(time.RFC3339)
+	challenge.VerifiedBy = verifiedBy
+	challenge.AssertionExpiresTime = txTime.Add(assertionTTL * time.Second).Format(time.RFC3339)
+
+	key, err := ctx.GetStub().CreateCompositeKey(AuthChallengeDocType, []string{challenge.ID})
+	if err != nil {
+		return nil, err
+	}
+	// JSON encoding
+	challengeJE, err := json.Marshal(challenge)
+	if err != nil {
+		return nil, err
+	}
+	if err := putAudited(ctx, AuthChallengeDocType, challenge.ID, key, challengeJE); err != nil {
+		return nil, fmt.Errorf("challenge %s could not be consumed: %v", challenge.ID, err)
+	}
+	return challenge, nil
+}
+
+// GetAuthAssertion returns the assertion of a challenge answered by VerifyAuthResponse,
+// signed by the chaincode assertion key. The challenge is read from the committed state,
+// so the assertion is only issued once the response is committed, and only to the
+// client that submitted it.
+//
+// Arguments:
+//		0: GetRequest, the ID of the challenge
+// Returns:
+//		0: didauth.Assertion
+//		1: error
+func (ci *ContractIdentity) GetAuthAssertion(ctx contractapi.TransactionContextInterface, request model.GetRequest) (*didauth.Assertion, error) {
+	log.Printf("[%s][GetAuthAssertion]", ctx.GetStub().GetChannelID())
+
+	if assertionKey == nil {
+		return nil, fmt.Errorf("the chaincode has no assertion key")
+	}
+
+	challenge, err := ci.GetAuthChallenge(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if challenge.VerifiedTxID == "" {
+		return nil, fmt.Errorf("challenge %s has no committed response, submit VerifyAuthResponse first", challenge.ID)
+	}
+	client, err := qualifiedClientID(ctx)
+	if err != nil {
+		return nil, err
+	} else if client != challenge.VerifiedBy {
+		return nil, fmt.Errorf("the response to the challenge %s was submitted by another client", challenge.ID)
+	}
+
+	txTime, err := currentTxTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	issuedAt, err := lus.ParseRFC3339toTime(challenge.VerifiedTime)
+	if err != nil {
+		return nil, err
+	}
+	expires, err := lus.ParseRFC3339toTime(challenge.AssertionExpiresTime)
+	if err != nil {
+		return nil, err
+	}
+	if txTime.After(expires) {
+		return nil, fmt.Errorf("the assertion of the challenge %s expired at %s", challenge.ID, challenge.AssertionExpiresTime)
+	}
+
+	claims, err := json.Marshal(didauth.AssertionClaims{
+		Issuer:      ctx.GetStub().GetChannelID(),
+		Subject:     challenge.Did,
+		Audience:    challenge.Audience,
+		ChallengeID: challenge.ID,
+		IssuedAt:    issuedAt.Unix(),
+		ExpiresAt:   expires.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	jws, err := didauth.Sign(claims, assertionKey)
+	if err != nil {
+		return nil, err
+	}
+	return &didauth.Assertion{
+		Did:         challenge.Did,
+		Audience:    challenge.Audience,
+		ExpiresTime: challenge.AssertionExpiresTime,
+		Jws:         jws,
+	}, nil
+}
+
+// DeleteExpiredAuthChallenges deletes a page of the challenges expired before the
+// transaction, repeat it with the returned bookmark until it is empty
+//
+// Arguments:
+//		0: ListRequest
+// Returns:
+//		0: AuthChallengesDeleted
+//		1: error
+func (ci *ContractIdentity) DeleteExpiredAuthChallenges(ctx contractapi.TransactionContextInterface, request ListRequest) (*AuthChallengesDeleted, error) {
+	log.Printf("[%s][DeleteExpiredAuthChallenges]", ctx.GetStub().GetChannelID())
+
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityIdentityAdmin); err != nil {
+		return nil, err
+	}
+	txTime, err := currentTxTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	type storedChallenge struct {
+		key       string
+		challenge AuthChallenge
+	}
+	records, bookmark, err := scanPage(ctx, AuthChallengeDocType, []string{}, request, nil, func(key string, value []byte) (interface{}, error) {
+		stored := &storedChallenge{key: key}
+		if err := json.Unmarshal(value, &stored.challenge); err != nil {
+			return nil, err
+		}
+		return stored, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := &AuthChallengesDeleted{Scanned: len(records), Bookmark: bookmark}
+	for _, record := range records {
+		stored := record.(*storedChallenge)
+		// an answered challenge is kept until its assertion expires
+		expiresTime := stored.challenge.ExpiresTime
+		if stored.challenge.AssertionExpiresTime > expiresTime {
+			expiresTime = stored.challenge.AssertionExpiresTime
+		}
+		expired, err := lus.ParseRFC3339toTime(expiresTime)
+		if err != nil {
+			return nil, err
+		} else if !txTime.After(expired) {
+			continue
+		}
+		if err := deleteAudited(ctx, AuthChallengeDocType, stored.challenge.ID, stored.key); err != nil {
+			return nil, err
+		}
+		deleted.Deleted++
+	}
+	return deleted, nil
+}
+
+// GetAuthChallenge
+func (ci *ContractIdentity) GetAuthChallenge(ctx contractapi.TransactionContextInterface, request model.GetRequest) (*AuthChallenge, error) {
+	log.Printf("[%s][GetAuthChallenge]", ctx.GetStub().GetChannelID())
+
+	key, err := ctx.GetStub().CreateCompositeKey(AuthChallengeDocType, []string{request.ID})
+	if err != nil {
+		return nil, err
+	}
+	item, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get challenge %s: %v", request.ID, err)
+	} else if item == nil {
+		return nil, fmt.Errorf(lus.ErrorDefaultNotExist, request.ID)
+	}
+
+	var challenge AuthChallenge
+	if err = json.Unmarshal(item, &challenge); err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// currentTxTime returns the timestamp of the transaction, set by the client and the
+// same for every endorser
+func currentTxTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	txTimestamp, err := lus.GetTxTimestampRFC3339(ctx.GetStub())
+	if err != nil {
+		return time.Time{}, err
+	}
+	return lus.ParseRFC3339toTime(txTimestamp)
+}
+
+// qualifiedClientID client identity ID of the caller qualified with its MSP
+func qualifiedClientID(ctx contractapi.TransactionContextInterface) (string, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf(lus.ErrorGetMSPID, err)
+	}
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", err
+	}
+	return mspID + ":" + clientID, nil
+}
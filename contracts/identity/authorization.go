@@ -0,0 +1,162 @@
+package identity
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/attrmgr"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/abac"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	"log"
+)
+
+// CallerDidAttribute Fabric CA attribute that binds a client certificate to a participant DID
+const CallerDidAttribute = "did"
+
+// AuthorizeTransaction is the authorization hook, it is called before every
+// transaction of the contract (see hooks.BeforeTransactionHandler).
+// It evaluates the ABAC policy stored for the invoked function, if any.
+func AuthorizeTransaction(ctx contractapi.TransactionContextInterface) error {
+	fcn, _ := ctx.GetStub().GetFunctionAndParameters()
+	function := lus.TransactionName(fcn)
+
+	policy, err := getPolicy(ctx, function)
+	if err != nil {
+		return err
+	} else if policy == nil {
+		// functions without policy are not restricted by ABAC
+		return nil
+	}
+
+	subject, err := callerSubject(ctx)
+	if err != nil {
+		return err
+	}
+	allowed, err := abac.Evaluate(&policy.Expr, *subject, nil)
+	if err != nil {
+		return fmt.Errorf("invalid policy for %s: %v", function, err)
+	}
+	if !allowed {
+		log.Printf("[%s][AuthorizeTransaction] denied %s to %s", ctx.GetStub().GetChannelID(), function, subject.MspID)
+		return fmt.Errorf(lus.ErrorAccessDenied, function)
+	}
+	return nil
+}
+
+// callerDid returns the DID of the participant bound to the client certificate, by
+// the did attribute or else by the public key index, or an empty string if the
+// certificate is not bound to a participant
+func callerDid(ctx contractapi.TransactionContextInterface) (string, error) {
+	did, found, err := ctx.GetClientIdentity().GetAttributeValue(CallerDidAttribute)
+	if err != nil {
+		return "", err
+	} else if found {
+		return did, nil
+	}
+
+	cert, err := ctx.GetClientIdentity().GetX509Certificate()
+	if err != nil || cert == nil {
+		return "", err
+	}
+	fingerprint, err := lus.PublicKeyFingerprintOf(cert.PublicKey)
+	if err != nil {
+		return "", nil
+	}
+	return getPublicKeyDid(ctx, fingerprint)
+}
+
+// callerSubject collects the attributes of the invoking client used by the ABAC policies
+func callerSubject(ctx contractapi.TransactionContextInterface) (*abac.Subject, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf(lus.ErrorGetMSPID, err)
+	}
+
+	certAttrs := make(map[string]string)
+	cert, err := ctx.GetClientIdentity().GetX509Certificate()
+	if err != nil {
+		return nil, err
+	}
+	if cert != nil {
+		attrs, err := attrmgr.New().GetAttributesFromCert(cert)
+		if err != nil {
+			return nil, err
+		}
+		certAttrs = attrs.Attrs
+	}
+
+	subject := &abac.Subject{MspID: mspID, CertAttributes: certAttrs}
+
+	did, err := callerDid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if did != "" {
+		participant, err := findParticipant(ctx, did)
+		if err != nil {
+			return nil, err
+		}
+		if participant != nil {
+			decryptParticipant(ctx, participant)
+		}
+		subject.ParticipantAttributes = participantAttributes(participant)
+	}
+	return subject, nil
+}
+
+// findParticipant returns the participant with the given DID, or nil if it does not exist
+func findParticipant(ctx contractapi.TransactionContextInterface, did string) (*model.Participant, error) {
+	compositeKeyID, err := ctx.GetStub().CreateCompositeKey(ParticipantDocType, []string{did})
+	if err != nil {
+		return nil, err
+	}
+	identityBytes, err := getDocument(ctx, ParticipantDocType, compositeKeyID)
+	if err != nil {
+		return nil, fmt.Errorf(lus.ErrorGetIdentity, compositeKeyID)
+	} else if identityBytes == nil {
+		return nil, nil
+	}
+
+	var participant model.Participant
+	if err = json.Unmarshal(identityBytes, &participant); err != nil {
+		return nil, err
+	}
+	return &participant, nil
+}
+
+// participantAttributes flattens the stored participant attributes, the certificate
+// subject attributes have priority over the extra attributes with the same name
+func participantAttributes(participant *model.Participant) map[string]string {
+	if participant == nil {
+		return nil
+	}
+	attrs := make(map[string]string)
+	for name, value := range participant.AttrsExtras {
+		attrs[name] = value
+	}
+	standard := map[string]string{
+		"did":                participant.Did,
+		"mspID":              participant.MspID,
+		"issuerId":           participant.IssuerID,
+		"name":               participant.Attrs.Name,
+		"dni":                participant.Attrs.DNI,
+		"company":            participant.Attrs.Company,
+		"position":           participant.Attrs.Position,
+		"country":            participant.Attrs.Country,
+		"province":           participant.Attrs.Province,
+		"locality":           participant.Attrs.Locality,
+		"organizationalUnit": participant.Attrs.OrganizationalUnit,
+	}
+	for name, value := range standard {
+		if value != "" {
+			attrs[name] = value
+		}
+	}
+	if participant.Active {
+		attrs["active"] = "true"
+	} else {
+		attrs["active"] = "false"
+	}
+	return attrs
+}
@@ -0,0 +1,102 @@
+package identity
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"log"
+)
+
+// Config chaincode configuration, it is stored in the ledger so every peer uses the same values
+type Config struct {
+	DocType          string `json:"docType,omitempty" metadata:",optional"`
+	AutogenerateDid  bool   `json:"autogenerateDid"`  // did is sent by the dapp, it is not generated by the chaincode
+	RestoreGraceDays int    `json:"restoreGraceDays"` // days a deleted participant can be restored
+	RetentionDays    int    `json:"retentionDays"`    // days a deleted participant is kept before it can be purged
+	// the personal values of a new participant must be encrypted with the data key of the
+	// transient map, true by default, it is required so it is never disabled by omission
+	EncryptPersonalData bool `json:"encryptPersonalData"`
+	// couchdb or leveldb, empty the searches try a rich query and use the composite keys on LevelDB
+	StateDatabase string `json:"stateDatabase,omitempty" metadata:",optional"`
+}
+
+// defaultConfig used while no configuration is stored in the ledger
+var defaultConfig = Config{
+	AutogenerateDid:     false,
+	RestoreGraceDays:    30,
+	RetentionDays:       365,
+	EncryptPersonalData: true,
+}
+
+// GetConfig get the chaincode configuration
+func (ci *ContractIdentity) GetConfig(ctx contractapi.TransactionContextInterface) (*Config, error) {
+	log.Printf("[%s][GetConfig]", ctx.GetStub().GetChannelID())
+
+	return getConfig(ctx)
+}
+
+// UpdateConfig replaces the chaincode configuration, it applies to every org of the
+// channel and requires the ChannelAdmin capability
+//
+// Arguments:
+//		0: Config
+// Returns:
+//		0: Config
+//		1: error
+func (ci *ContractIdentity) UpdateConfig(ctx contractapi.TransactionContextInterface, request Config) (*Config, error) {
+	log.Printf("[%s][UpdateConfig]", ctx.GetStub().GetChannelID())
+
+	// channel admin capability required
+	if err := ci.assertChannelAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	if request.RestoreGraceDays < 0 {
+		return nil, fmt.Errorf("restoreGraceDays can not be negative")
+	}
+	if request.RetentionDays < request.RestoreGraceDays {
+		return nil, fmt.Errorf("retentionDays (%d) can not be lower than restoreGraceDays (%d)", request.RetentionDays, request.RestoreGraceDays)
+	}
+	switch request.StateDatabase {
+	case "", StateDatabaseCouchDB, StateDatabaseLevelDB:
+	default:
+		return nil, fmt.Errorf("invalid stateDatabase %s, expected %s or %s", request.StateDatabase, StateDatabaseCouchDB, StateDatabaseLevelDB)
+	}
+	request.DocType = ConfigDocType
+
+	key, err := ctx.GetStub().CreateCompositeKey(ConfigDocType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	// JSON encoding
+	configJE, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	if err := putAudited(ctx, ConfigDocType, "", key, configJE); err != nil {
+		return nil, fmt.Errorf("config could not be stored: %v", err)
+	}
+	return &request, nil
+}
+
+// getConfig returns the stored configuration, or the default one
+func getConfig(ctx contractapi.TransactionContextInterface) (*Config, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(ConfigDocType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	item, err := getDocument(ctx, ConfigDocType, key)
+	if err != nil {
+		return nil, fmt.Errorf(lus.ErrorGetIdentity, key)
+	}
+
+	config := defaultConfig
+	config.DocType = ConfigDocType
+	if item != nil {
+		if err = json.Unmarshal(item, &config); err != nil {
+			return nil, err
+		}
+	}
+	return &config, nil
+}
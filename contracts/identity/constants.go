@@ -2,10 +2,19 @@ package identity
 
 // docType
 const (
-	ParticipantDocType = "did.participant"
-	RoleDocType        = "did.role"
-	AccessDocType      = "did.access"
-	IssuerDocType      = "did.issuer"
+	ParticipantDocType   = "did.participant"
+	RoleDocType          = "did.role"
+	AccessDocType        = "did.access"
+	IssuerDocType        = "did.issuer"
+	SodRuleDocType       = "did.sod.rule"
+	SodActivityDocType   = "did.sod.activity"
+	PolicyDocType        = "did.policy"
+	AdminDocType         = "did.admin"
+	OrganizationDocType  = "did.organization"
+	AuthChallengeDocType = "did.authchallenge"
+	ConfigDocType        = "did.config"
+	ErasureDocType       = "did.erasure"
+	AuditDocType         = "did.audit"
 )
 
 const (
@@ -13,6 +22,10 @@ const (
 	Deleted = "deleted"
 
 	// objectType
-	ObjectTypeParticipantDeleted   = ParticipantDocType + "~" + Deleted + "~did" // use to index deleted participant
-	ObjectTypeIssuerByDefault      = IssuerDocType + ":default~uuid"
+	ObjectTypeParticipantDeleted = ParticipantDocType + "~" + Deleted + "~did" // use to index deleted participant
+	ObjectTypeIssuerByDefault    = IssuerDocType + ":default~uuid"
+	ObjectTypeParticipantPubKey  = ParticipantDocType + ".pubkey"  // use to index the participant by the SHA-256 of its SPKI
+	ObjectTypeParticipantBy      = ParticipantDocType + ".by"      // secondary indexes of the participant, name~value~did, used on LevelDB
+	ObjectTypeParticipantDataKey = ParticipantDocType + ".datakey" // use to index the data keys by their SHA-256, kept in PersonalDataCollection
+	ObjectTypeAuditActor         = AuditDocType + ".actor"         // audit records of an actor, actor~time~entityType~entityId~txId
 )
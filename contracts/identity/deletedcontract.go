@@ -0,0 +1,291 @@
+package identity
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/migration"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	"log"
+)
+
+// DeletedParticipant tombstone of a deleted participant, stored in the deleted
+// index with a frozen copy of the participant
+type DeletedParticipant struct {
+	model.ParticipantDeletedPayload
+	Did          string            `json:"did"`
+	Participant  model.Participant `json:"participant"`  // frozen copy, empty in tombstones written before the soft-delete
+	RestoreUntil string            `json:"restoreUntil"` // the participant can be restored until this time
+	PurgeAfter   string            `json:"purgeAfter"`   // the participant can be purged after this time
+	// schema version of the frozen copy, 0 in tombstones written before the versioning
+	ParticipantSchemaVersion int `json:"participantSchemaVersion,omitempty" metadata:",optional"`
+}
+
+// DeletedParticipantsResponse page of deleted participants
+type DeletedParticipantsResponse struct {
+	Records             []DeletedParticipant `json:"records"`
+	FetchedRecordsCount int32                `json:"fetchedRecordsCount"`
+	Bookmark            string               `json:"bookmark"`
+}
+
+// RestoreParticipant puts back the frozen copy of a deleted participant, it is
+// only allowed within the restore grace period of the config
+func (ci *ContractIdentity) RestoreParticipant(ctx contractapi.TransactionContextInterface, request model.ParticipantGetRequest) (*model.Participant, error) {
+	log.Printf("[%s][RestoreParticipant]", ctx.GetStub().GetChannelID())
+
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityIdentityAdmin); err != nil {
+		return nil, err
+	}
+
+	deleted, err := ci.getDeletedParticipant(ctx, request.Did)
+	if err != nil {
+		return nil, err
+	}
+	if err := assertSameMsp(ctx, deleted.MspID); err != nil {
+		return nil, err
+	}
+	if deleted.Participant.Did == "" {
+		return nil, fmt.Errorf("participant %s was deleted without a frozen copy, it can not be restored", request.Did)
+	}
+	if expired, err := txAfter(ctx, deleted.RestoreUntil); err != nil {
+		return nil, err
+	} else if expired {
+		return nil, fmt.Errorf("the grace period to restore %s ended at %s", request.Did, deleted.RestoreUntil)
+	}
+
+	// the participant consumes again a slot of its organization
+	if err := reserveParticipantSlot(ctx, deleted.Participant.MspID, deleted.Participant.Did); err != nil {
+		return nil, err
+	}
+
+	// the frozen copy is migrated from the schema version it was deleted with
+	identityEncode, _ := json.Marshal(deleted.Participant)
+	if identityEncode, err = migration.WithVersion(identityEncode, deleted.ParticipantSchemaVersion); err != nil {
+		return nil, err
+	}
+	if identityEncode, err = migrateDocument(ParticipantDocType, identityEncode); err != nil {
+		return nil, err
+	}
+	var participant model.Participant
+	if err := json.Unmarshal(identityEncode, &participant); err != nil {
+		return nil, err
+	}
+	if err := bindPublicKey(ctx, participant.Did, participant.PublicKey); err != nil {
+		return nil, err
+	}
+	participantKey, err := ctx.GetStub().CreateCompositeKey(ParticipantDocType, []string{participant.Did})
+	if err != nil {
+		return nil, err
+	}
+	if err := putAudited(ctx, ParticipantDocType, participant.Did, participantKey, identityEncode); err != nil {
+		return nil, fmt.Errorf("failed to restore identity %s: %v", participant.Did, err)
+	}
+	if err := indexParticipant(ctx, nil, &participant); err != nil {
+		return nil, err
+	}
+	if err := deleteDeletedParticipant(ctx, participant.Did); err != nil {
+		return nil, err
+	}
+	return &participant, nil
+}
+
+// PurgeParticipant removes permanently a deleted participant, it is only allowed
+// after the retention period of the config. The data key is purged as EraseParticipant
+// does, the personal values of the history can not be decrypted anymore
+func (ci *ContractIdentity) PurgeParticipant(ctx contractapi.TransactionContextInterface, request model.ParticipantGetRequest) error {
+	log.Printf("[%s][PurgeParticipant]", ctx.GetStub().GetChannelID())
+
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityIdentityAdmin); err != nil {
+		return err
+	}
+
+	deleted, err := ci.getDeletedParticipant(ctx, request.Did)
+	if err != nil {
+		return err
+	}
+	if err := assertSameMsp(ctx, deleted.MspID); err != nil {
+		return err
+	}
+	if retained, err := txAfter(ctx, deleted.PurgeAfter); err != nil {
+		return err
+	} else if !retained {
+		return fmt.Errorf("participant %s is retained until %s", request.Did, deleted.PurgeAfter)
+	}
+	// a deleted key would still be readable from the private history of the peers
+	if err := ctx.GetStub().PurgePrivateData(PersonalDataCollection, request.Did); err != nil {
+		return fmt.Errorf("failed to purge the data key of %s: %v", request.Did, err)
+	}
+	return deleteDeletedParticipant(ctx, request.Did)
+}
+
+// GetDeletedParticipant
+func (ci *ContractIdentity) GetDeletedParticipant(ctx contractapi.TransactionContextInterface, request model.ParticipantGetRequest) (*DeletedParticipant, error) {
+	log.Printf("[%s][GetDeletedParticipant]", ctx.GetStub().GetChannelID())
+
+	return ci.getDeletedParticipant(ctx, request.Did)
+}
+
+// GetDeletedParticipants get a page of the deleted participants of the deleted index
+//
+// Arguments:
+//		0: ListRequest
+// Returns:
+//		0: DeletedParticipantsResponse
+//		1: error
+func (ci *ContractIdentity) GetDeletedParticipants(ctx contractapi.TransactionContextInterface, request ListRequest) (*DeletedParticipantsResponse, error) {
+	log.Printf("[%s][GetDeletedParticipants]", ctx.GetStub().GetChannelID())
+
+	records, bookmark, err := listPage(ctx, ObjectTypeParticipantDeleted, []string{Deleted}, request, []string{"callerID", "did", "mspID"}, func(key string, value []byte) (interface{}, error) {
+		return unmarshalDeletedParticipant(ctx, key, value)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var items = make([]DeletedParticipant, 0, len(records))
+	for _, record := range records {
+		items = append(items, *record.(*DeletedParticipant))
+	}
+	return &DeletedParticipantsResponse{
+		Records:             items,
+		FetchedRecordsCount: int32(len(items)),
+		Bookmark:            bookmark,
+	}, nil
+}
+
+// tombstoneParticipant writes the tombstone of the participant in the deleted index
+func tombstoneParticipant(ctx contractapi.TransactionContextInterface, participant *model.Participant, payload model.ParticipantDeletedPayload) error {
+	config, err := getConfig(ctx)
+	if err != nil {
+		return err
+	}
+	deletedTime, err := lus.ParseRFC3339toTime(payload.Time)
+	if err != nil {
+		return err
+	}
+
+	deleted := &DeletedParticipant{
+		ParticipantDeletedPayload: payload,
+		Did:                       participant.Did,
+		Participant:               *participant,
+		RestoreUntil:              deletedTime.AddDate(0, 0, config.RestoreGraceDays).Format(time.RFC3339),
+		PurgeAfter:                deletedTime.AddDate(0, 0, config.RetentionDays).Format(time.RFC3339),
+		ParticipantSchemaVersion:  schemaMigrations.Version(ParticipantDocType),
+	}
+
+	return putDeletedParticipant(ctx, deleted)
+}
+
+func putDeletedParticipant(ctx contractapi.TransactionContextInterface, deleted *DeletedParticipant) error {
+	deletedKey, err := ctx.GetStub().CreateCompositeKey(ObjectTypeParticipantDeleted, []string{Deleted, deleted.Did})
+	if err != nil {
+		return err
+	}
+	// JSON encoding of payload
+	deletedJE, _ := json.Marshal(deleted)
+	if err := putAudited(ctx, ObjectTypeParticipantDeleted, deleted.Did, deletedKey, deletedJE); err != nil {
+		return fmt.Errorf("could not create deleted index %v: %v", deletedKey, err)
+	}
+	return nil
+}
+
+// deleteDeletedParticipant removes the tombstone of the participant from the deleted index
+func deleteDeletedParticipant(ctx contractapi.TransactionContextInterface, did string) error {
+	deletedKey, err := ctx.GetStub().CreateCompositeKey(ObjectTypeParticipantDeleted, []string{Deleted, did})
+	if err != nil {
+		return err
+	}
+	return deleteAudited(ctx, ObjectTypeParticipantDeleted, did, deletedKey)
+}
+
+// isTombstoned returns true if the DID is in the deleted index
+func isTombstoned(ctx contractapi.TransactionContextInterface, did string) (bool, error) {
+	deletedKey, err := ctx.GetStub().CreateCompositeKey(ObjectTypeParticipantDeleted, []string{Deleted, did})
+	if err != nil {
+		return false, err
+	}
+	item, err := ctx.GetStub().GetState(deletedKey)
+	if err != nil {
+		return false, fmt.Errorf(lus.ErrorGetIdentity, did)
+	}
+	return item != nil, nil
+}
+
+func (ci *ContractIdentity) getDeletedParticipant(ctx contractapi.TransactionContextInterface, did string) (*DeletedParticipant, error) {
+	deletedKey, err := ctx.GetStub().CreateCompositeKey(ObjectTypeParticipantDeleted, []string{Deleted, did})
+	if err != nil {
+		return nil, err
+	}
+	item, err := ctx.GetStub().GetState(deletedKey)
+	if err != nil {
+		return nil, fmt.Errorf(lus.ErrorGetIdentity, did)
+	} else if item == nil {
+		return nil, fmt.Errorf("deleted participant %s does not exist", did)
+	}
+	return unmarshalDeletedParticipant(ctx, deletedKey, item)
+}
+
+// unmarshalDeletedParticipant decodes a tombstone, the tombstones written before the
+// soft-delete only have the payload, the DID is taken from the key
+func unmarshalDeletedParticipant(ctx contractapi.TransactionContextInterface, key string, value []byte) (*DeletedParticipant, error) {
+	var deleted DeletedParticipant
+	if err := json.Unmarshal(value, &deleted); err != nil {
+		return nil, err
+	}
+	if deleted.Did == "" {
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(attributes) > 1 {
+			deleted.Did = attributes[1]
+		}
+	}
+	if deleted.PurgeAfter == "" {
+		// tombstone without frozen copy, it can not be restored and it is retained from its deletion
+		config, err := getConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+		deletedTime, err := lus.ParseRFC3339toTime(deleted.Time)
+		if err != nil {
+			return nil, err
+		}
+		deleted.RestoreUntil = deleted.Time
+		deleted.PurgeAfter = deletedTime.AddDate(0, 0, config.RetentionDays).Format(time.RFC3339)
+	}
+	return &deleted, nil
+}
+
+// assertSameMsp the admin capabilities are scoped to the MSP of the client
+func assertSameMsp(ctx contractapi.TransactionContextInterface, mspID string) error {
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf(lus.ErrorGetMSPID, err)
+	}
+	if mspID != clientMSPID {
+		return fmt.Errorf("client from org %v is not authorized to manage an identity deleted by the org %v", clientMSPID, mspID)
+	}
+	return nil
+}
+
+// txAfter returns true if the transaction timestamp is after the RFC3339 time
+func txAfter(ctx contractapi.TransactionContextInterface, rfc3339 string) (bool, error) {
+	txTimestamp, err := lus.GetTxTimestampRFC3339(ctx.GetStub())
+	if err != nil {
+		return false, err
+	}
+	txTime, err := lus.ParseRFC3339toTime(txTimestamp)
+	if err != nil {
+		return false, err
+	}
+	limit, err := lus.ParseRFC3339toTime(rfc3339)
+	if err != nil {
+		return false, err
+	}
+	return txTime.After(limit), nil
+}
@@ -0,0 +1,135 @@
+package identity
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/did"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	modeltools "github.com/kmilodenisglez/model-identity-go/tools"
+	"log"
+)
+
+// DidDocument minimal DID document of a participant, https://www.w3.org/TR/did-core/
+type DidDocument struct {
+	Context            []string             `json:"@context" metadata:",optional"`
+	ID                 string               `json:"id"`
+	Controller         string               `json:"controller,omitempty" metadata:",optional"` // MSP ID of the organization of the participant
+	VerificationMethod []VerificationMethod `json:"verificationMethod,omitempty" metadata:",optional"`
+	Authentication     []string             `json:"authentication,omitempty" metadata:",optional"`
+	AssertionMethod    []string             `json:"assertionMethod,omitempty" metadata:",optional"`
+	Deactivated        bool                 `json:"deactivated,omitempty" metadata:",optional"` // the participant is deleted or inactive
+}
+
+// VerificationMethod public key of a DID document, Multikey encoded
+type VerificationMethod struct {
+	ID                 string `json:"id"`
+	Type               string `json:"type"`
+	Controller         string `json:"controller"`
+	PublicKeyMultibase string `json:"publicKeyMultibase"`
+}
+
+// ResolveDid resolves the DID of a participant to its DID document, built from the ledger
+//
+// Arguments:
+//		0: ParticipantGetRequest
+// Returns:
+//		0: DidDocument
+//		1: error
+func (ci *ContractIdentity) ResolveDid(ctx contractapi.TransactionContextInterface, request model.ParticipantGetRequest) (*DidDocument, error) {
+	log.Printf("[%s][ResolveDid]", ctx.GetStub().GetChannelID())
+
+	if _, err := did.Parse(request.Did); err != nil {
+		return nil, err
+	}
+
+	document := &DidDocument{
+		Context: []string{"https://www.w3.org/ns/did/v1", "https://w3id.org/security/multikey/v1"},
+		ID:      request.Did,
+	}
+
+	participant, err := findParticipant(ctx, request.Did)
+	if err != nil {
+		return nil, err
+	}
+	if participant == nil {
+		// a deleted participant resolves to a deactivated document without keys
+		tombstoned, err := isTombstoned(ctx, request.Did)
+		if err != nil {
+			return nil, err
+		}
+		if !tombstoned {
+			return nil, fmt.Errorf(lus.ErrorDefaultNotExist, request.Did)
+		}
+		document.Deactivated = true
+		return document, nil
+	}
+
+	publicKey, err := lus.ParsePublicKey(participant.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	multibase, err := did.Multibase(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	methodID := request.Did + "#" + multibase
+	document.Controller = participant.MspID
+	document.VerificationMethod = []VerificationMethod{{
+		ID:                 methodID,
+		Type:               "Multikey",
+		Controller:         request.Did,
+		PublicKeyMultibase: multibase,
+	}}
+	document.Authentication = []string{methodID}
+	document.AssertionMethod = []string{methodID}
+	document.Deactivated = !participant.Active
+	return document, nil
+}
+
+// participantDid returns the DID of a new participant of the organization. If the
+// organization selected a DID method the DID is generated, or validated, with it, else
+// the legacy did:<hash> is generated and a requested DID is validated with its own method
+func participantDid(ctx contractapi.TransactionContextInterface, organization *Organization, request model.ParticipantCreateRequest, autogenerate bool) (string, error) {
+	if (organization == nil || organization.DidMethod == "") && autogenerate {
+		return modeltools.CreateDid(request.PublicKey)
+	}
+
+	publicKey, err := lus.ParsePublicKey(request.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	params := did.Params{
+		PublicKey: publicKey,
+		Channel:   ctx.GetStub().GetChannelID(),
+	}
+
+	if organization == nil || organization.DidMethod == "" {
+		if request.DID == "" {
+			return "", fmt.Errorf(lus.ErrorRequiredParameter, "did")
+		}
+		if err := did.Validate(request.DID, params); err != nil {
+			return "", fmt.Errorf("invalid did: %v", err)
+		}
+		return request.DID, nil
+	}
+
+	method, err := did.Lookup(organization.DidMethod)
+	if err != nil {
+		return "", err
+	}
+	params.Domain = organization.DidDomain
+
+	if autogenerate {
+		return method.Generate(params)
+	}
+	if request.DID == "" {
+		return "", fmt.Errorf(lus.ErrorRequiredParameter, "did")
+	}
+	if err := method.Validate(request.DID, params); err != nil {
+		return "", fmt.Errorf("invalid did for organization %s: %v", organization.MspID, err)
+	}
+	return request.DID, nil
+}
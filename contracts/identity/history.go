@@ -0,0 +1,195 @@
+package identity
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/jsondiff"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/query"
+	modeltools "github.com/kmilodenisglez/model-identity-go/tools"
+)
+
+// HistoryOptions options of the history queries
+type HistoryOptions struct {
+	Patch    bool   `json:"patch,omitempty" metadata:",optional"`    // the JSON Patch from the previous version instead of the snapshot
+	PageSize int    `json:"pageSize,omitempty" metadata:",optional"` // 0 returns the whole history
+	Bookmark string `json:"bookmark,omitempty" metadata:",optional"`
+}
+
+// HistoryCreator creator of the transaction of a version, read from its audit record,
+// the versions written before the audit trail have no creator
+type HistoryCreator struct {
+	MspID string `json:"mspID"`
+	ID    string `json:"id"` // client identity ID
+	Did   string `json:"did,omitempty" metadata:",optional"`
+}
+
+// historyVersion version of a key, the record is the response of the version
+type historyVersion struct {
+	TxID     string
+	Time     string
+	IsDelete bool
+	Record   interface{}
+	Patch    []jsondiff.Operation
+	Creator  *HistoryCreator
+}
+
+// historyDecoder decodes the value of a version to its response
+type historyDecoder func(value []byte) (interface{}, error)
+
+// historyPage returns a page of the versions of the key of an entity, the newest first
+// as returned by Fabric. The patch of a version is computed from the response of the
+// previous one, so one version more than the page is read
+func historyPage(ctx contractapi.TransactionContextInterface, entityType, entityID, key string, options HistoryOptions, decode historyDecoder) ([]historyVersion, string, error) {
+	if options.PageSize < 0 || options.PageSize > query.MaxPageSize {
+		return nil, "", fmt.Errorf("pageSize must be between 1 and %d, or 0 for the whole history", query.MaxPageSize)
+	}
+	var after string
+	if options.Bookmark != "" {
+		bookmark, err := base64.RawURLEncoding.DecodeString(options.Bookmark)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid bookmark: %v", err)
+		}
+		after = string(bookmark)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(key)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resultsIterator.Close()
+
+	var versions []historyVersion
+	var records [][]byte // JSON of the response of every version, to compute the patches
+	more := false
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, "", err
+		}
+		if after != "" {
+			// the bookmark is the transaction of the last version of the previous page
+			if response.TxId == after {
+				after = ""
+			}
+			continue
+		}
+
+		var record interface{}
+		var recordJE []byte
+		if !response.IsDelete && len(response.Value) > 0 {
+			if record, err = decode(response.Value); err != nil {
+				return nil, "", err
+			}
+			if recordJE, err = json.Marshal(record); err != nil {
+				return nil, "", err
+			}
+		}
+		if options.PageSize > 0 && len(versions) == options.PageSize {
+			// the previous version of the last one of the page
+			if options.Patch {
+				records = append(records, recordJE)
+			}
+			more = true
+			break
+		}
+
+		timestamp := time.Unix(response.Timestamp.GetSeconds(), int64(response.Timestamp.GetNanos()))
+		creator, err := historyCreator(ctx, entityType, entityID, timestamp, response.TxId)
+		if err != nil {
+			return nil, "", err
+		}
+		versions = append(versions, historyVersion{
+			TxID:     response.TxId,
+			Time:     modeltools.GetTimestampRFC3339(response.Timestamp),
+			IsDelete: response.IsDelete,
+			Record:   record,
+			Creator:  creator,
+		})
+		records = append(records, recordJE)
+	}
+	if after != "" {
+		return nil, "", fmt.Errorf("invalid bookmark, the transaction %s is not in the history of %s", after, entityID)
+	}
+
+	if options.Patch {
+		for i := range versions {
+			var previous []byte
+			if i+1 < len(records) {
+				previous = records[i+1]
+			}
+			patch, err := jsondiff.Diff(previous, records[i])
+			if err != nil {
+				return nil, "", err
+			}
+			versions[i].Patch = patch
+			versions[i].Record = nil
+		}
+	}
+
+	var bookmark string
+	if more {
+		bookmark = base64.RawURLEncoding.EncodeToString([]byte(versions[len(versions)-1].TxID))
+	}
+	return versions, bookmark, nil
+}
+
+// historyCreator creator of the version from the audit record of its transaction
+func historyCreator(ctx contractapi.TransactionContextInterface, entityType, entityID string, txTime time.Time, txID string) (*HistoryCreator, error) {
+	record, err := getAuditRecord(ctx, entityType, entityID, txTime, txID)
+	if err != nil || record == nil {
+		return nil, err
+	}
+	return &HistoryCreator{MspID: record.MspID, ID: record.CallerID, Did: record.CallerDid}, nil
+}
+
+// historyInstant instant of a point in time query. With a transaction the instant is
+// the moment it was endorsed, the versions written by the transaction are excluded
+type historyInstant struct {
+	time time.Time
+	txID string
+}
+
+// includes the version was committed at or before the instant
+func (i historyInstant) includes(version *queryresult.KeyModification) bool {
+	timestamp := time.Unix(version.Timestamp.GetSeconds(), int64(version.Timestamp.GetNanos()))
+	if i.txID != "" {
+		return version.TxId != i.txID && timestamp.Before(i.time)
+	}
+	return !timestamp.After(i.time)
+}
+
+// versionsAsOf returns the versions of the key committed at or before the instant,
+// the newest first
+func versionsAsOf(ctx contractapi.TransactionContextInterface, key string, instant historyInstant, limit int) ([]*queryresult.KeyModification, error) {
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(key)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var versions []*queryresult.KeyModification
+	for resultsIterator.HasNext() && (limit == 0 || len(versions) < limit) {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if instant.includes(response) {
+			versions = append(versions, response)
+		}
+	}
+	return versions, nil
+}
+
+// valueAsOf returns the value of the key at the instant, nil if it did not exist
+// or was deleted
+func valueAsOf(ctx contractapi.TransactionContextInterface, key string, instant historyInstant) ([]byte, error) {
+	versions, err := versionsAsOf(ctx, key, instant, 1)
+	if err != nil || len(versions) == 0 || versions[0].IsDelete {
+		return nil, err
+	}
+	return versions[0].Value, nil
+}
@@ -0,0 +1,176 @@
+package identity
+
+import (
+	"crypto/x509"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	"log"
+)
+
+// maxIssuerChainDepth maximum number of issuers of a chain, root included
+const maxIssuerChainDepth = 8
+
+// IssuerCreateRequest create an issuer, an intermediate CA references its parent issuer
+type IssuerCreateRequest struct {
+	model.IssuerCreateRequest
+	ParentID string `json:"parentId,omitempty" metadata:",optional"` // issuer of the certificate, empty for a root
+}
+
+// IssuerChainEntry issuer of a chain
+type IssuerChainEntry struct {
+	model.IssuerQueryResponse
+	ParentID    string             `json:"parentId,omitempty" metadata:",optional"`
+	Subject     string             `json:"subject"`
+	CertPem     string             `json:"certPem"`
+	TrustPolicy *IssuerTrustPolicy `json:"trustPolicy,omitempty" metadata:",optional"`
+}
+
+// GetIssuerChain get the chain of an issuer, from the issuer to its root, verified
+// at the transaction time
+//
+// Arguments:
+//		0: GetRequest
+// Returns:
+//		0: []IssuerChainEntry
+//		1: error
+func (ci *ContractIdentity) GetIssuerChain(ctx contractapi.TransactionContextInterface, request model.GetRequest) ([]IssuerChainEntry, error) {
+	log.Printf("[%s][GetIssuerChain]", ctx.GetStub().GetChannelID())
+
+	chain, err := issuerChain(ctx, request.ID)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := issuerCerts(chain)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyIssuerCerts(ctx, certs[0], certs[1:]); err != nil {
+		return nil, err
+	}
+
+	var items = make([]IssuerChainEntry, 0, len(chain))
+	for i, issuer := range chain {
+		items = append(items, IssuerChainEntry{
+			IssuerQueryResponse: *issuer.response(),
+			ParentID:            issuer.ParentID,
+			Subject:             certs[i].Subject.String(),
+			CertPem:             issuer.CertPem,
+			TrustPolicy:         issuer.TrustPolicy,
+		})
+	}
+	return items, nil
+}
+
+// issuerChain returns the issuer and its ancestors, from the issuer to the root
+func issuerChain(ctx contractapi.TransactionContextInterface, issuerID string) ([]*IssuerRecord, error) {
+	var chain []*IssuerRecord
+	visited := make(map[string]bool)
+	for id := issuerID; id != ""; {
+		if visited[id] {
+			return nil, fmt.Errorf("the chain of the issuer %s has a cycle at %s", issuerID, id)
+		}
+		if len(chain) == maxIssuerChainDepth {
+			return nil, fmt.Errorf("the chain of the issuer %s is longer than %d issuers", issuerID, maxIssuerChainDepth)
+		}
+		visited[id] = true
+
+		issuer, err := getIssuer(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, issuer)
+		id = issuer.ParentID
+	}
+	return chain, nil
+}
+
+// issuerCerts certificates of the issuers
+func issuerCerts(issuers []*IssuerRecord) ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, 0, len(issuers))
+	for _, issuer := range issuers {
+		cert, err := lus.GetX509CertFromPem(issuer.CertPem)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate of the issuer %s: %v", issuer.ID, err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// verifyIssuerCerts verifies the certificate against the chain, from the issuer to the
+// root, at the transaction time. The last certificate of the chain is the trust anchor
+func verifyIssuerCerts(ctx contractapi.TransactionContextInterface, cert *x509.Certificate, chain []*x509.Certificate) error {
+	txTimestamp, err := lus.GetTxTimestampRFC3339(ctx.GetStub())
+	if err != nil {
+		return err
+	}
+	txTime, err := lus.ParseRFC3339toTime(txTimestamp)
+	if err != nil {
+		return err
+	}
+	if len(chain) == 0 {
+		// a root issuer is its own trust anchor
+		_, err := lus.VerifyChain(cert, nil, []*x509.Certificate{cert}, txTime)
+		return err
+	}
+	verified, err := lus.VerifyChains(cert, chain[:len(chain)-1], chain[len(chain)-1:], txTime)
+	if err != nil {
+		return err
+	}
+	// the pool of intermediates lets the certificate skip the issuer, only the path
+	// through every stored issuer is accepted
+	for _, path := range verified {
+		if isIssuerPath(path[1:], chain) {
+			return nil
+		}
+	}
+	return fmt.Errorf("the certificate is not signed by %s", chain[0].Subject)
+}
+
+// isIssuerPath returns whether the verified path is the chain of the issuer
+func isIssuerPath(path, chain []*x509.Certificate) bool {
+	if len(path) != len(chain) {
+		return false
+	}
+	for i := range path {
+		if !path[i].Equal(chain[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// verifyIssuedBy verifies that the certificate was issued by the issuer, through every
+// stored ancestor of the issuer
+func verifyIssuedBy(ctx contractapi.TransactionContextInterface, cert *x509.Certificate, issuerID string) error {
+	chain, err := issuerChain(ctx, issuerID)
+	if err != nil {
+		return err
+	}
+	certs, err := issuerCerts(chain)
+	if err != nil {
+		return err
+	}
+	if err := verifyIssuerCerts(ctx, cert, certs); err != nil {
+		return fmt.Errorf("the certificate was not issued by the issuer %s: %v", issuerID, err)
+	}
+	return nil
+}
+
+// issuerChildren returns the IDs of the issuers whose parent is the issuer
+func issuerChildren(ctx contractapi.TransactionContextInterface, issuerID string) ([]string, error) {
+	issuers, err := getIssuers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var children []string
+	for _, issuer := range issuers {
+		if issuer.ParentID == issuerID {
+			children = append(children, issuer.ID)
+		}
+	}
+	return children, nil
+}
@@ -1,14 +1,68 @@
 package identity
 
 import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
 	"fmt"
+	"sort"
+	"time"
+
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/jsondiff"
 	model "github.com/kmilodenisglez/model-identity-go/model"
 	modeltools "github.com/kmilodenisglez/model-identity-go/tools"
 	"log"
 )
 
+// IssuerRecord issuer stored in the ledger
+type IssuerRecord struct {
+	model.Issuer
+	MspID         string              `json:"mspID,omitempty"`         // org that manages the issuer, the org of the admin that created it
+	ParentID      string              `json:"parentId,omitempty"`      // issuer of the certificate, empty for a root
+	TrustPolicy   *IssuerTrustPolicy  `json:"trustPolicy,omitempty"`   // what the issuer may vouch for
+	PreviousCerts []IssuerCertificate `json:"previousCerts,omitempty"` // certificates replaced by RenewIssuer, oldest first
+	StatusReason  string              `json:"statusReason,omitempty"`  // reason of the last deactivation
+	StatusTime    string              `json:"statusTime,omitempty"`    // time of the last deactivation or reactivation
+	// LegacyPublicKey the first versions of RenewIssuer stored the certificate PEM in publicKey
+	LegacyPublicKey string `json:"publicKey,omitempty"`
+}
+
+// IssuerCertificate certificate replaced by RenewIssuer
+type IssuerCertificate struct {
+	CertPem      string `json:"certPem"`
+	IssuedTime   string `json:"issuedTime"`
+	ExpiresTime  string `json:"expiresTime"`
+	ReplacedTime string `json:"replacedTime"`
+}
+
+// IssuerUpdateRequest
+type IssuerUpdateRequest struct {
+	ID      string `json:"id"`
+	CertPem string `json:"certPem"` // b64 certificate PEM active
+}
+
+// IssuerStatusRequest
+type IssuerStatusRequest struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason,omitempty" metadata:",optional"`
+}
+
+// IssuerClaimRequest owner org of an issuer stored before the owner was recorded
+type IssuerClaimRequest struct {
+	ID    string `json:"id"`
+	MspID string `json:"mspID,omitempty" metadata:",optional"` // assigned by a channel admin, the org of the caller otherwise
+}
+
+// IssuerExpiringRequest page of the issuers expiring, the bookmark is the expiry time and
+// the ID of the last issuer of the previous page
+type IssuerExpiringRequest struct {
+	ListRequest
+	Days           int  `json:"days"`                                          // issuers whose certificate expires within the days
+	IncludeExpired bool `json:"includeExpired,omitempty" metadata:",optional"` // the issuers already expired too
+}
+
 // CreateIssuer create in the ledger the issuer's certificate with its attributes
 //
 // Arguments:
@@ -16,12 +70,12 @@ import (
 // Returns:
 //		0: Issuer
 //		1: error
-func (ci *ContractIdentity) CreateIssuer(ctx contractapi.TransactionContextInterface, issuerRequest model.IssuerCreateRequest) (*model.IssuerQueryResponse, error) {
+func (ci *ContractIdentity) CreateIssuer(ctx contractapi.TransactionContextInterface, issuerRequest IssuerCreateRequest) (*model.IssuerQueryResponse, error) {
 	log.Printf("[%s][CreateIssuer]", ctx.GetStub().GetChannelID())
 
-	// check if client-node connected as admin
-	if err := lus.AssertAdmin(ctx); err != nil {
-		return nil, fmt.Errorf(err.Error())
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityIssuerAdmin); err != nil {
+		return nil, err
 	}
 
 	exist, err := lus.CertificateAlreadyExists(ctx, issuerRequest.CertPem, IssuerDocType, []string{})
@@ -31,19 +85,51 @@ func (ci *ContractIdentity) CreateIssuer(ctx contractapi.TransactionContextInter
 		return nil, fmt.Errorf("an issuer with the same certificate already exists")
 	}
 
+	// decode certificate
+	certX509, err := lus.GetX509CertFromPem(issuerRequest.CertPem)
+	if err != nil {
+		return nil, err
+	}
+	if err := lus.HasExpired(certX509); err != nil {
+		return nil, err
+	}
+	// the key of the certificate must be supported
+	if _, err := lus.GetPublicKey(certX509); err != nil {
+		return nil, err
+	}
+	// an intermediate CA must be issued by its parent, through every ancestor
+	if issuerRequest.ParentID != "" {
+		if !certX509.BasicConstraintsValid || !certX509.IsCA {
+			return nil, fmt.Errorf("the certificate of an intermediate issuer must be a CA certificate")
+		}
+		if err := assertIssuerActive(ctx, issuerRequest.ParentID); err != nil {
+			return nil, err
+		}
+		// the intermediate CAs are managed by the org of their parent
+		parent, err := getIssuer(ctx, issuerRequest.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if err := assertIssuerOwner(ctx, parent); err != nil {
+			return nil, err
+		}
+		if err := verifyIssuedBy(ctx, certX509, issuerRequest.ParentID); err != nil {
+			return nil, err
+		}
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf(lus.ErrorGetMSPID, err)
+	}
 	issuerID := lus.GenerateUUIDStr()
 
 	// If the new issuer is to be the default, we must check if there is
 	// another issuer registered and marked "by default"
-	if err := ci.issuerMarkAsDefault(ctx, issuerID, &issuerRequest); err != nil {
+	if err := ci.issuerMarkAsDefault(ctx, issuerID, &issuerRequest.IssuerCreateRequest); err != nil {
 		return nil, err
 	}
 
-	// decode certificate
-	certX509, err := lus.GetX509CertFromPem(issuerRequest.CertPem)
-	if err != nil {
-		return nil, err
-	}
 	// we insert commonName if the Name field is empty
 	commonName := certX509.Subject.CommonName
 	if issuerRequest.Name == "" {
@@ -53,57 +139,34 @@ func (ci *ContractIdentity) CreateIssuer(ctx contractapi.TransactionContextInter
 	attrs := modeltools.GetAttrsCert(certX509)
 	// get dates
 	dateCert := lus.GetDateCertificate(certX509)
-	// begin: get publicKey
-	publicKey, err := lus.GetPublicKey(certX509)
-	if err != nil {
-		return nil, err
-	}
-	// end: publicKey
 
 	// Create Issuer
-	issuer := &model.Issuer{
-		DocType:     IssuerDocType,
-		ID:          issuerID,
-		Name:        issuerRequest.Name,
-		CertPem:     issuerRequest.CertPem,
-		Attrs:       attrs,
-		AttrsExtras: make(map[string]string),
-		IssuedTime:  dateCert["issuedTime"],
-		ExpiresTime: dateCert["expiresTime"],
-		ByDefault:   issuerRequest.ByDefault,
+	issuer := &IssuerRecord{
+		Issuer: model.Issuer{
+			DocType:     IssuerDocType,
+			ID:          issuerID,
+			Name:        issuerRequest.Name,
+			CertPem:     issuerRequest.CertPem,
+			Attrs:       attrs,
+			AttrsExtras: make(map[string]string),
+			IssuedTime:  dateCert["issuedTime"],
+			ExpiresTime: dateCert["expiresTime"],
+			Active:      true,
+			ByDefault:   issuerRequest.ByDefault,
+		},
+		MspID:    clientMSPID,
+		ParentID: issuerRequest.ParentID,
 	}
-
-	key, err := ctx.GetStub().CreateCompositeKey(IssuerDocType, []string{issuerID})
-	if err != nil {
-		return nil, err
-	}
-
-	// JSON encoding of issuer
-	issuerJE, _ := json.Marshal(issuer)
-	if err := ctx.GetStub().PutState(key, issuerJE); err != nil {
+	if err := putIssuer(ctx, issuer); err != nil {
 		return nil, fmt.Errorf("issuer %s could not be created: %v", issuerRequest.Name, err)
 	}
 
-	return &model.IssuerQueryResponse{
-		ID:          issuer.ID,
-		Name:        issuer.Name,
-		PublicKey:   publicKey,
-		Attrs:       issuer.Attrs,
-		AttrsExtras: issuer.AttrsExtras,
-		IssuedTime:  issuer.IssuedTime,
-		ExpiresTime: issuer.ExpiresTime,
-		Active:      issuer.Active,
-		ByDefault:   issuer.ByDefault,
-	}, nil
-}
-
-// IssuerUpdateRequest
-type IssuerUpdateRequest struct {
-	ID      string `json:"id"`
-	CertPem string `json:"certPem"` // b64 certificate PEM active
+	return issuer.response(), nil
 }
 
-// RenewIssuer update issuer certificate in the ledger
+// RenewIssuer replaces the certificate of the issuer. The new certificate must have
+// the same subject and be issued by the same authority key, and expire after the
+// current one, the current certificate is kept in previousCerts
 //
 // Arguments:
 //		0: IssuerUpdateRequest
@@ -111,20 +174,23 @@ type IssuerUpdateRequest struct {
 //		0: Issuer
 //		1: error
 func (ci *ContractIdentity) RenewIssuer(ctx contractapi.TransactionContextInterface, issuerRequest IssuerUpdateRequest) (*model.IssuerQueryResponse, error) {
-	log.Printf("[%s][UpdateIssuer]", ctx.GetStub().GetChannelID())
+	log.Printf("[%s][RenewIssuer]", ctx.GetStub().GetChannelID())
 
-	// check if client-node connected as admin
-	if err := lus.AssertAdmin(ctx); err != nil {
-		return nil, fmt.Errorf(err.Error())
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityIssuerAdmin); err != nil {
+		return nil, err
 	}
 
-	// get issuer
-	issuerToUpdate, err := ci.GetIssuer(ctx, model.GetRequest{ID: issuerRequest.ID})
+	issuer, err := getIssuer(ctx, issuerRequest.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get User identity: %v", err)
+		return nil, err
+	}
+	if err := assertIssuerOwner(ctx, issuer); err != nil {
+		return nil, err
 	}
-	if issuerToUpdate == nil {
-		return nil, fmt.Errorf("%s does not exist", issuerToUpdate.ID)
+	currentCert, err := lus.GetX509CertFromPem(issuer.CertPem)
+	if err != nil {
+		return nil, err
 	}
 
 	// decode certificate
@@ -132,31 +198,92 @@ func (ci *ContractIdentity) RenewIssuer(ctx contractapi.TransactionContextInterf
 	if err != nil {
 		return nil, err
 	}
-	// we insert commonName if the Name field is empty
-	commonName := certX509.Subject.CommonName
-
-	attrs := modeltools.GetAttrsCert(certX509)
-	// get dates
-	dateCert := lus.GetDateCertificate(certX509)
+	if err := lus.HasExpired(certX509); err != nil {
+		return nil, err
+	}
+	if _, err := lus.GetPublicKey(certX509); err != nil {
+		return nil, err
+	}
+	if lus.CompareCertsPemBase64(issuer.CertPem, issuerRequest.CertPem) {
+		return nil, fmt.Errorf("the certificate of the issuer %s is already the requested one", issuer.ID)
+	}
+	exist, err := lus.CertificateAlreadyExists(ctx, issuerRequest.CertPem, IssuerDocType, []string{})
+	if err != nil {
+		return nil, err
+	} else if exist {
+		return nil, fmt.Errorf("an issuer with the same certificate already exists")
+	}
 
-	// Create Issuer
-	issuerToUpdate.Name = commonName
-	issuerToUpdate.PublicKey = issuerRequest.CertPem
-	issuerToUpdate.Attrs = model.Attrs(attrs)
-	issuerToUpdate.IssuedTime = dateCert["issuedTime"]
-	issuerToUpdate.ExpiresTime = dateCert["expiresTime"]
+	// same subject and same issuing chain
+	if !bytes.Equal(currentCert.RawSubject, certX509.RawSubject) {
+		return nil, fmt.Errorf("the subject %s of the certificate does not match the issuer subject %s", certX509.Subject, currentCert.Subject)
+	}
+	if !bytes.Equal(currentCert.RawIssuer, certX509.RawIssuer) || !bytes.Equal(currentCert.AuthorityKeyId, certX509.AuthorityKeyId) {
+		return nil, fmt.Errorf("the certificate must be issued by the same authority as the current certificate of the issuer")
+	}
+	if !certX509.NotAfter.After(currentCert.NotAfter) {
+		return nil, fmt.Errorf("the certificate must expire after the current certificate of the issuer, %s", currentCert.NotAfter.Format(time.RFC3339))
+	}
+	if issuer.ParentID != "" {
+		if err := verifyIssuedBy(ctx, certX509, issuer.ParentID); err != nil {
+			return nil, err
+		}
+	}
+	// the certificates issued by the issuer must keep verifying
+	children, err := issuerChildren(ctx, issuer.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(children) > 0 && !bytes.Equal(currentCert.RawSubjectPublicKeyInfo, certX509.RawSubjectPublicKeyInfo) {
+		return nil, fmt.Errorf("issuer %s has the intermediate issuers %v, the renewed certificate must keep the public key", issuer.ID, children)
+	}
 
-	key, err := ctx.GetStub().CreateCompositeKey(IssuerDocType, []string{issuerToUpdate.ID})
+	txTimestamp, err := lus.GetTxTimestampRFC3339(ctx.GetStub())
 	if err != nil {
 		return nil, err
 	}
+	issuer.PreviousCerts = append(issuer.PreviousCerts, IssuerCertificate{
+		CertPem:      issuer.CertPem,
+		IssuedTime:   issuer.IssuedTime,
+		ExpiresTime:  issuer.ExpiresTime,
+		ReplacedTime: txTimestamp,
+	})
 
-	// JSON encoding of issuer
-	issuerJE, _ := json.Marshal(issuerToUpdate)
-	if err := ctx.GetStub().PutState(key, issuerJE); err != nil {
-		return nil, fmt.Errorf("issuer %s could not be created: %v", commonName, err)
+	dateCert := lus.GetDateCertificate(certX509)
+	issuer.CertPem = issuerRequest.CertPem
+	issuer.Attrs = modeltools.GetAttrsCert(certX509)
+	issuer.IssuedTime = dateCert["issuedTime"]
+	issuer.ExpiresTime = dateCert["expiresTime"]
+
+	if err := putIssuer(ctx, issuer); err != nil {
+		return nil, fmt.Errorf("issuer %s could not be renewed: %v", issuer.Name, err)
 	}
-	return issuerToUpdate, nil
+	return issuer.response(), nil
+}
+
+// DeactivateIssuer deactivates an issuer, the participants can not be created with
+// an inactive issuer
+//
+// Arguments:
+//		0: IssuerStatusRequest
+// Returns:
+//		0: Issuer
+//		1: error
+func (ci *ContractIdentity) DeactivateIssuer(ctx contractapi.TransactionContextInterface, request IssuerStatusRequest) (*model.IssuerQueryResponse, error) {
+	log.Printf("[%s][DeactivateIssuer]", ctx.GetStub().GetChannelID())
+	return ci.setIssuerActive(ctx, request, false)
+}
+
+// ReactivateIssuer reactivates an issuer, its certificate must not be expired
+//
+// Arguments:
+//		0: IssuerStatusRequest
+// Returns:
+//		0: Issuer
+//		1: error
+func (ci *ContractIdentity) ReactivateIssuer(ctx contractapi.TransactionContextInterface, request IssuerStatusRequest) (*model.IssuerQueryResponse, error) {
+	log.Printf("[%s][ReactivateIssuer]", ctx.GetStub().GetChannelID())
+	return ci.setIssuerActive(ctx, request, true)
 }
 
 // GetIssuer get an issuer from the ledger
@@ -168,38 +295,15 @@ func (ci *ContractIdentity) RenewIssuer(ctx contractapi.TransactionContextInterf
 //		1: error
 func (ci *ContractIdentity) GetIssuer(ctx contractapi.TransactionContextInterface, request model.GetRequest) (*model.IssuerQueryResponse, error) {
 	log.Printf("[%s][GetIssuer]", ctx.GetStub().GetChannelID())
-	key, err := ctx.GetStub().CreateCompositeKey(IssuerDocType, []string{request.ID})
-	if err != nil {
-		return nil, fmt.Errorf("error happened creating key for: %v", err)
-	} else if key == "" {
-		return nil, fmt.Errorf("no state found for %s", key)
-	}
-	issuer, err := ctx.GetStub().GetState(key)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get: %v", err)
-	} else if issuer == nil {
-		return nil, fmt.Errorf("no state found for %s", key)
-	}
-	var issuerJD model.Issuer
-	err = json.Unmarshal(issuer, &issuerJD)
+
+	issuer, err := getIssuer(ctx, request.ID)
 	if err != nil {
 		return nil, err
 	}
-
-	return &model.IssuerQueryResponse{
-		ID:          issuerJD.ID,
-		Name:        issuerJD.Name,
-		PublicKey:   issuerJD.CertPem,
-		Attrs:       issuerJD.Attrs,
-		AttrsExtras: issuerJD.AttrsExtras,
-		IssuedTime:  issuerJD.IssuedTime,
-		ExpiresTime: issuerJD.ExpiresTime,
-		Active:      issuerJD.Active,
-		ByDefault:   issuerJD.ByDefault,
-	}, nil
+	return issuer.response(), nil
 }
 
-// DeleteIssuer delete an issuer from the ledger
+// DeleteIssuer delete an issuer from the ledger, only an inactive issuer can be deleted
 //
 // Arguments:
 //		0: GetRequest
@@ -208,13 +312,35 @@ func (ci *ContractIdentity) GetIssuer(ctx contractapi.TransactionContextInterfac
 //		1: error
 func (ci *ContractIdentity) DeleteIssuer(ctx contractapi.TransactionContextInterface, issuerRequest model.GetRequest) error {
 	log.Printf("[%s][DeleteIssuer]", ctx.GetStub().GetChannelID())
+
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityIssuerAdmin); err != nil {
+		return err
+	}
+
+	issuer, err := getIssuer(ctx, issuerRequest.ID)
+	if err != nil {
+		return err
+	}
+	if err := assertIssuerOwner(ctx, issuer); err != nil {
+		return err
+	}
+	if issuer.Active {
+		return fmt.Errorf("issuer %s is active, deactivate it before deleting it", issuer.ID)
+	}
+	children, err := issuerChildren(ctx, issuer.ID)
+	if err != nil {
+		return err
+	}
+	if len(children) > 0 {
+		return fmt.Errorf("issuer %s has the intermediate issuers %v, delete them first", issuer.ID, children)
+	}
+
 	key, err := ctx.GetStub().CreateCompositeKey(IssuerDocType, []string{issuerRequest.ID})
 	if err != nil {
 		return fmt.Errorf("error happened creating key: %v", err)
-	} else if key == "" {
-		return fmt.Errorf("no state found for %s", key)
 	}
-	err = ctx.GetStub().DelState(key)
+	err = deleteAudited(ctx, IssuerDocType, issuerRequest.ID, key)
 	if err != nil {
 		return fmt.Errorf("failed to get: %v", err)
 	}
@@ -228,49 +354,197 @@ func (ci *ContractIdentity) DeleteIssuer(ctx contractapi.TransactionContextInter
 	return nil
 }
 
-// GetIssuers get all issuer
+// ClaimIssuer assigns the owner org of an issuer stored before the owner was recorded.
+// A channel admin assigns any org, an issuer admin claims the issuer for its org only
+// if the org created it according to the audit trail
 //
 // Arguments:
-//		0: none
+//		0: IssuerClaimRequest
 // Returns:
-//		0: []Issuer
+//		0: Issuer
 //		1: error
-func (ci *ContractIdentity) GetIssuers(ctx contractapi.TransactionContextInterface) ([]model.IssuerQueryResponse, error) {
-	log.Printf("[%s][GetIssuers]", ctx.GetStub().GetChannelID())
+func (ci *ContractIdentity) ClaimIssuer(ctx contractapi.TransactionContextInterface, request IssuerClaimRequest) (*model.IssuerQueryResponse, error) {
+	log.Printf("[%s][ClaimIssuer]", ctx.GetStub().GetChannelID())
 
-	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(IssuerDocType, []string{})
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf(lus.ErrorGetMSPID, err)
+	}
+	issuer, err := getIssuer(ctx, request.ID)
 	if err != nil {
 		return nil, err
 	}
-	defer resultsIterator.Close()
+	if issuer.MspID != "" {
+		return nil, fmt.Errorf("issuer %s is already owned by the org %s", issuer.ID, issuer.MspID)
+	}
 
-	var items = make([]model.IssuerQueryResponse, 0)
-	for resultsIterator.HasNext() {
-		responseRange, err := resultsIterator.Next()
-		if responseRange == nil {
+	if err := ci.assertChannelAdmin(ctx); err == nil {
+		issuer.MspID = request.MspID
+		if issuer.MspID == "" {
+			issuer.MspID = clientMSPID
+		}
+	} else {
+		if request.MspID != "" && request.MspID != clientMSPID {
+			return nil, fmt.Errorf("only a %s can assign the issuer %s to the org %s", CapabilityChannelAdmin, issuer.ID, request.MspID)
+		}
+		if err := ci.assertCapability(ctx, CapabilityIssuerAdmin); err != nil {
 			return nil, err
 		}
-
-		var item model.IssuerQueryResponse
-		err = json.Unmarshal(responseRange.Value, &item)
+		creatorOrg, err := issuerCreatorOrg(ctx, issuer.ID)
 		if err != nil {
 			return nil, err
 		}
-		items = append(items, item)
+		if creatorOrg != clientMSPID {
+			return nil, fmt.Errorf("issuer %s was not created by the org %s, only a %s can assign its owner", issuer.ID, clientMSPID, CapabilityChannelAdmin)
+		}
+		issuer.MspID = clientMSPID
 	}
-	return items, nil
 
-	//return  (*model.IssuerQueryResponse)(unsafe.Pointer(&items)), nil
+	if err := putIssuer(ctx, issuer); err != nil {
+		return nil, err
+	}
+	return issuer.response(), nil
+}
+
+// GetIssuers get a page of the issuers, in ID order
+//
+// Arguments:
+//		0: ListRequest
+// Returns:
+//		0: IssuersResponse
+//		1: error
+func (ci *ContractIdentity) GetIssuers(ctx contractapi.TransactionContextInterface, request ListRequest) (*IssuersResponse, error) {
+	log.Printf("[%s][GetIssuers]", ctx.GetStub().GetChannelID())
+
+	records, bookmark, err := listPage(ctx, IssuerDocType, []string{}, request, listFields(IssuerDocType), func(_ string, value []byte) (interface{}, error) {
+		return unmarshalIssuer(value)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var items = make([]model.IssuerQueryResponse, 0, len(records))
+	for _, record := range records {
+		items = append(items, *record.(*IssuerRecord).response())
+	}
+	return &IssuersResponse{
+		Records:             items,
+		FetchedRecordsCount: int32(len(items)),
+		Bookmark:            bookmark,
+	}, nil
+}
+
+// GetIssuersExpiring get a page of the active issuers whose certificate expires within
+// the requested days of the transaction time, the soonest first. The issuers already
+// expired are skipped, unless includeExpired
+//
+// Arguments:
+//		0: IssuerExpiringRequest
+// Returns:
+//		0: IssuersResponse
+//		1: error
+func (ci *ContractIdentity) GetIssuersExpiring(ctx contractapi.TransactionContextInterface, request IssuerExpiringRequest) (*IssuersResponse, error) {
+	log.Printf("[%s][GetIssuersExpiring]", ctx.GetStub().GetChannelID())
+
+	if request.Days < 0 {
+		return nil, fmt.Errorf("days can not be negative")
+	}
+	after, err := parseListRequest(request.ListRequest, listFields(IssuerDocType))
+	if err != nil {
+		return nil, err
+	}
+	txTimestamp, err := lus.GetTxTimestampRFC3339(ctx.GetStub())
+	if err != nil {
+		return nil, err
+	}
+	txTime, err := lus.ParseRFC3339toTime(txTimestamp)
+	if err != nil {
+		return nil, err
+	}
+	limit := txTime.AddDate(0, 0, request.Days)
+
+	issuers, err := getIssuers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// the issuers are ordered by the key expiry time and ID, the bookmark is the last key
+	var expiring []*IssuerRecord
+	var sortKeys = make(map[string]string)
+	for _, issuer := range issuers {
+		if !issuer.Active {
+			continue
+		}
+		expires, err := lus.ParseRFC3339toTime(issuer.ExpiresTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiresTime of the issuer %s: %v", issuer.ID, err)
+		}
+		if expires.After(limit) || (!request.IncludeExpired && expires.Before(txTime)) {
+			continue
+		}
+		sortKey := expires.UTC().Format(time.RFC3339) + "\x00" + issuer.ID
+		if after != "" && sortKey <= after {
+			continue
+		}
+		if len(request.Filters) > 0 {
+			if ok, err := matchFilters(issuer, request.Filters); err != nil {
+				return nil, err
+			} else if !ok {
+				continue
+			}
+		}
+		expiring = append(expiring, issuer)
+		sortKeys[issuer.ID] = sortKey
+	}
+	sort.Slice(expiring, func(i, j int) bool { return sortKeys[expiring[i].ID] < sortKeys[expiring[j].ID] })
+
+	var bookmark string
+	if len(expiring) > request.PageSize {
+		expiring = expiring[:request.PageSize]
+		bookmark = base64.RawURLEncoding.EncodeToString([]byte(sortKeys[expiring[len(expiring)-1].ID]))
+	}
+	var items = make([]model.IssuerQueryResponse, 0, len(expiring))
+	for _, issuer := range expiring {
+		items = append(items, *issuer.response())
+	}
+	return &IssuersResponse{
+		Records:             items,
+		FetchedRecordsCount: int32(len(items)),
+		Bookmark:            bookmark,
+	}, nil
+}
+
+// IssuerHistoryRequest history of an issuer
+type IssuerHistoryRequest struct {
+	model.GetRequest
+	HistoryOptions
+}
+
+// IssuerHistoryRecord version of an issuer, with the patch option the record is replaced
+// by the JSON Patch from the previous version
+type IssuerHistoryRecord struct {
+	Record   *model.IssuerQueryResponse `json:"record,omitempty" metadata:",optional"`
+	Patch    []jsondiff.Operation       `json:"patch,omitempty" metadata:",optional"`
+	Creator  *HistoryCreator            `json:"creator,omitempty" metadata:",optional"`
+	TxID     string                     `json:"txID"`
+	Time     string                     `json:"time"`
+	IsDelete bool                       `json:"isDelete"`
+}
+
+// IssuerHistoryResponse page of the history of an issuer, the newest version first
+type IssuerHistoryResponse struct {
+	Records             []IssuerHistoryRecord `json:"records"`
+	FetchedRecordsCount int32                 `json:"fetchedRecordsCount"`
+	Bookmark            string                `json:"bookmark"`
 }
 
 // GetIssuerHistory returns the chain of custody for a issuer since issuance
 //
 // Arguments:
-//		0: model.GetRequest
+//		0: IssuerHistoryRequest
 // Returns:
-//		0: []model.IssuerHistoryQueryResponse
+//		0: IssuerHistoryResponse
 //		1: error
-func (ci *ContractIdentity) GetIssuerHistory(ctx contractapi.TransactionContextInterface, issuerRequest model.GetRequest) ([]model.IssuerHistoryQueryResponse, error) {
+func (ci *ContractIdentity) GetIssuerHistory(ctx contractapi.TransactionContextInterface, issuerRequest IssuerHistoryRequest) (*IssuerHistoryResponse, error) {
 	log.Printf("GetIssuerHistory: ID %v", issuerRequest.ID)
 
 	compositeKeyID, err := ctx.GetStub().CreateCompositeKey(IssuerDocType, []string{issuerRequest.ID})
@@ -279,40 +553,244 @@ func (ci *ContractIdentity) GetIssuerHistory(ctx contractapi.TransactionContextI
 	} else if compositeKeyID == "" {
 		return nil, fmt.Errorf("no state found for %s", compositeKeyID)
 	}
-	resultsIterator, err := ctx.GetStub().GetHistoryForKey(compositeKeyID)
+
+	versions, bookmark, err := historyPage(ctx, IssuerDocType, issuerRequest.ID, compositeKeyID, issuerRequest.HistoryOptions, func(value []byte) (interface{}, error) {
+		record, err := unmarshalIssuer(value)
+		if err != nil {
+			return nil, err
+		}
+		return record.response(), nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer resultsIterator.Close()
 
-	var records []model.IssuerHistoryQueryResponse
-	for resultsIterator.HasNext() {
-		response, err := resultsIterator.Next()
+	var records = make([]IssuerHistoryRecord, 0, len(versions))
+	for _, version := range versions {
+		record := IssuerHistoryRecord{
+			Patch:    version.Patch,
+			Creator:  version.Creator,
+			TxID:     version.TxID,
+			Time:     version.Time,
+			IsDelete: version.IsDelete,
+		}
+		if issuer, ok := version.Record.(*model.IssuerQueryResponse); ok {
+			record.Record = issuer
+		} else if !issuerRequest.Patch {
+			// the deletes keep the ID of the issuer
+			record.Record = &model.IssuerQueryResponse{ID: issuerRequest.ID}
+		}
+		records = append(records, record)
+	}
+	return &IssuerHistoryResponse{
+		Records:             records,
+		FetchedRecordsCount: int32(len(records)),
+		Bookmark:            bookmark,
+	}, nil
+}
+
+// setIssuerActive activates or deactivates an issuer
+func (ci *ContractIdentity) setIssuerActive(ctx contractapi.TransactionContextInterface, request IssuerStatusRequest, active bool) (*model.IssuerQueryResponse, error) {
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityIssuerAdmin); err != nil {
+		return nil, err
+	}
+
+	issuer, err := getIssuer(ctx, request.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := assertIssuerOwner(ctx, issuer); err != nil {
+		return nil, err
+	}
+	if issuer.Active == active {
+		return nil, fmt.Errorf("issuer %s is already %s", issuer.ID, map[bool]string{true: "active", false: "inactive"}[active])
+	}
+	if active {
+		expired, err := txAfter(ctx, issuer.ExpiresTime)
 		if err != nil {
 			return nil, err
+		} else if expired {
+			return nil, fmt.Errorf("the certificate of the issuer %s expired at %s, renew it before reactivating it", issuer.ID, issuer.ExpiresTime)
 		}
+	}
 
-		issuer := &model.IssuerQueryResponse{}
-		issuer.ID = issuerRequest.ID
-		if len(response.Value) > 0 {
-			err = json.Unmarshal(response.Value, &issuer)
-			if err != nil {
-				return nil, err
+	txTimestamp, err := lus.GetTxTimestampRFC3339(ctx.GetStub())
+	if err != nil {
+		return nil, err
+	}
+	issuer.Active = active
+	issuer.StatusReason = request.Reason
+	issuer.StatusTime = txTimestamp
+
+	if err := putIssuer(ctx, issuer); err != nil {
+		return nil, err
+	}
+	return issuer.response(), nil
+}
+
+// assertIssuerActive returns an error if the issuer, or one of its ancestors, does not
+// exist or it is inactive
+func assertIssuerActive(ctx contractapi.TransactionContextInterface, issuerID string) error {
+	chain, err := issuerChain(ctx, issuerID)
+	if err != nil {
+		return err
+	}
+	return assertChainActive(issuerID, chain)
+}
+
+// assertIssuerOwner returns an error if the client is not from the org that manages the
+// issuer. The issuers stored before the owner was recorded can not be managed until
+// they are claimed with ClaimIssuer
+func assertIssuerOwner(ctx contractapi.TransactionContextInterface, issuer *IssuerRecord) error {
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf(lus.ErrorGetMSPID, err)
+	}
+	if issuer.MspID == "" {
+		return fmt.Errorf("issuer %s has no owner org, it must be claimed with ClaimIssuer before it is managed", issuer.ID)
+	}
+	if issuer.MspID != clientMSPID {
+		return fmt.Errorf("client from org %v is not authorized to manage the issuer %s of the org %v", clientMSPID, issuer.ID, issuer.MspID)
+	}
+	return nil
+}
+
+// issuerCreatorOrg returns the org of the audit record of the creation of the issuer,
+// empty if the issuer was created before the audit trail
+func issuerCreatorOrg(ctx contractapi.TransactionContextInterface, issuerID string) (string, error) {
+	// the records of an entity are sorted by time, the first one is its creation
+	items, _, err := scanPage(ctx, AuditDocType, []string{IssuerDocType, issuerID}, ListRequest{PageSize: 1}, nil, func(_ string, value []byte) (interface{}, error) {
+		var record AuditRecord
+		if err := json.Unmarshal(value, &record); err != nil {
+			return nil, err
+		}
+		return &record, nil
+	})
+	if err != nil || len(items) == 0 {
+		return "", err
+	}
+	if record := items[0].(*AuditRecord); record.Action == AuditCreate {
+		return record.MspID, nil
+	}
+	return "", nil
+}
+
+// assertChainActive returns an error if the issuer or one of its ancestors is inactive
+func assertChainActive(issuerID string, chain []*IssuerRecord) error {
+	for _, issuer := range chain {
+		if !issuer.Active {
+			if issuer.ID == issuerID {
+				return fmt.Errorf("issuer %s is inactive", issuerID)
 			}
+			return fmt.Errorf("issuer %s is inactive, it is an ancestor of the issuer %s", issuer.ID, issuerID)
 		}
+	}
+	return nil
+}
 
-		timestamp := modeltools.GetTimestampRFC3339(response.Timestamp)
+// getIssuer returns the issuer, or an error if it does not exist
+func getIssuer(ctx contractapi.TransactionContextInterface, issuerID string) (*IssuerRecord, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(IssuerDocType, []string{issuerID})
+	if err != nil {
+		return nil, fmt.Errorf("error happened creating key for: %v", err)
+	}
+	issuerJE, err := getDocument(ctx, IssuerDocType, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get: %v", err)
+	} else if issuerJE == nil {
+		return nil, fmt.Errorf("issuer %s does not exist", issuerID)
+	}
+	return unmarshalIssuer(issuerJE)
+}
 
-		record := model.IssuerHistoryQueryResponse{
-			TxID:     response.TxId,
-			Time:     timestamp,
-			Record:   issuer,
-			IsDelete: response.IsDelete,
+// getIssuers returns every issuer
+func getIssuers(ctx contractapi.TransactionContextInterface) ([]*IssuerRecord, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(IssuerDocType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var issuers []*IssuerRecord
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if responseRange == nil {
+			return nil, err
 		}
-		records = append(records, record)
+		issuerJE, err := migrateDocument(IssuerDocType, responseRange.Value)
+		if err != nil {
+			return nil, err
+		}
+		issuer, err := unmarshalIssuer(issuerJE)
+		if err != nil {
+			return nil, err
+		}
+		issuers = append(issuers, issuer)
 	}
+	return issuers, nil
+}
 
-	return records, nil
+// unmarshalIssuer decodes a stored issuer. The first versions never set active and
+// some of them stored the certificate in publicKey, an issuer that was never
+// deactivated is active
+func unmarshalIssuer(issuerJE []byte) (*IssuerRecord, error) {
+	var issuer IssuerRecord
+	if err := json.Unmarshal(issuerJE, &issuer); err != nil {
+		return nil, err
+	}
+	if issuer.CertPem == "" {
+		issuer.CertPem = issuer.LegacyPublicKey
+	}
+	issuer.LegacyPublicKey = ""
+	if issuer.StatusTime == "" {
+		issuer.Active = true
+	}
+	if issuer.Attrs == (model.Attrs{}) {
+		if certX509, err := lus.GetX509CertFromPem(issuer.CertPem); err == nil {
+			issuer.Attrs = modeltools.GetAttrsCert(certX509)
+		}
+	}
+	return &issuer, nil
+}
+
+// putIssuer stores the issuer
+func putIssuer(ctx contractapi.TransactionContextInterface, issuer *IssuerRecord) error {
+	key, err := ctx.GetStub().CreateCompositeKey(IssuerDocType, []string{issuer.ID})
+	if err != nil {
+		return err
+	}
+	issuer.DocType = IssuerDocType
+	if issuer.AttrsExtras == nil {
+		issuer.AttrsExtras = make(map[string]string)
+	}
+	// JSON encoding of issuer
+	issuerJE, err := json.Marshal(issuer)
+	if err != nil {
+		return fmt.Errorf("error happened marshalling the issuer: %v", err)
+	}
+	return putAudited(ctx, IssuerDocType, issuer.ID, key, issuerJE)
+}
+
+// response issuer response, the public key is the base64 SPKI of the certificate
+func (issuer *IssuerRecord) response() *model.IssuerQueryResponse {
+	var publicKey string
+	if certX509, err := lus.GetX509CertFromPem(issuer.CertPem); err == nil {
+		if spki, err := x509.MarshalPKIXPublicKey(certX509.PublicKey); err == nil {
+			publicKey = base64.StdEncoding.EncodeToString(spki)
+		}
+	}
+	return &model.IssuerQueryResponse{
+		ID:          issuer.ID,
+		Name:        issuer.Name,
+		PublicKey:   publicKey,
+		Attrs:       issuer.Attrs,
+		AttrsExtras: issuer.AttrsExtras,
+		IssuedTime:  issuer.IssuedTime,
+		ExpiresTime: issuer.ExpiresTime,
+		Active:      issuer.Active,
+		ByDefault:   issuer.ByDefault,
+	}
 }
 
 // issuerMarkAsDefault modifies issuer  "byDefault" status to true only if request ByDefault field
@@ -340,22 +818,14 @@ func (ci *ContractIdentity) issuerMarkAsDefault(ctx contractapi.TransactionConte
 
 		if len(compositeKeyParts) == 1 {
 			returnedIssuerID := compositeKeyParts[0]
-			response, err := ci.GetIssuer(ctx, model.GetRequest{ID: returnedIssuerID})
+			returnedIssuer, err := getIssuer(ctx, returnedIssuerID)
 			if err != nil {
 				return err
 			}
-			response.ByDefault = false
+			returnedIssuer.ByDefault = false
 
-			// struct to JSON
-			responseJSON, err := json.Marshal(response)
-			if err != nil {
-				return fmt.Errorf("error happened marshalling the issuer: %v", err)
-			}
-
-			ledgerKey, _ := ctx.GetStub().CreateCompositeKey(IssuerDocType, []string{returnedIssuerID})
 			// Put issuer to StateDB
-			err = ctx.GetStub().PutState(ledgerKey, responseJSON)
-			if err != nil {
+			if err := putIssuer(ctx, returnedIssuer); err != nil {
 				return fmt.Errorf("error happened updating the issuer: %v", err)
 			}
 
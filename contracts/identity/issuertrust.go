@@ -0,0 +1,282 @@
+package identity
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/keys"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	jose "gopkg.in/square/go-jose.v2"
+	"log"
+)
+
+// IssuerTrustPolicy what an issuer may vouch for, an empty rule allows anything. The
+// policies of the ancestors of an issuer also apply to it. The policy is enforced when a
+// participant is created (CreateParticipant, CreateParticipantsBatch) and when its
+// attributes are attested (UpdateParticipant). Credential issuance is out of scope, the
+// chaincode does not issue verifiable credentials
+type IssuerTrustPolicy struct {
+	AllowedAttributes    []string `json:"allowedAttributes,omitempty" metadata:",optional"`    // attribute names, ex: name, company or an attrsExtras name
+	AllowedDidPrefixes   []string `json:"allowedDidPrefixes,omitempty" metadata:",optional"`   // ex: did:fabric:mychannel:
+	AllowedMspIDs        []string `json:"allowedMspIDs,omitempty" metadata:",optional"`        // organizations of the participants
+	MaxValidityDays      int      `json:"maxValidityDays"`                                     // validity of the participant certificate, 0 unlimited
+	AllowedKeyAlgorithms []string `json:"allowedKeyAlgorithms,omitempty" metadata:",optional"` // JWS algorithms of the participant key, ex: ES256, EdDSA
+}
+
+// IssuerTrustPolicyRequest
+type IssuerTrustPolicyRequest struct {
+	IssuerID string             `json:"issuerId"`
+	Policy   *IssuerTrustPolicy `json:"policy,omitempty" metadata:",optional"` // empty, removes the policy or reports against the current one
+}
+
+// TrustPolicyViolation participant of an issuer that breaks a trust policy
+type TrustPolicyViolation struct {
+	Did      string   `json:"did"`
+	IssuerID string   `json:"issuerId"`
+	Reasons  []string `json:"reasons"`
+}
+
+// trustGrant what an issuer vouches for when it backs a participant
+type trustGrant struct {
+	did         string
+	mspID       string
+	publicKey   string
+	attributes  []string
+	issuedTime  string
+	expiresTime string
+}
+
+// SetIssuerTrustPolicy sets or removes the trust policy of an issuer, the participants
+// already backed by the issuer are not changed, see GetTrustPolicyViolations
+//
+// Arguments:
+//		0: IssuerTrustPolicyRequest
+// Returns:
+//		0: IssuerTrustPolicy
+//		1: error
+func (ci *ContractIdentity) SetIssuerTrustPolicy(ctx contractapi.TransactionContextInterface, request IssuerTrustPolicyRequest) (*IssuerTrustPolicy, error) {
+	log.Printf("[%s][SetIssuerTrustPolicy]", ctx.GetStub().GetChannelID())
+
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityIssuerAdmin); err != nil {
+		return nil, err
+	}
+	if request.Policy != nil {
+		if err := request.Policy.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	issuer, err := getIssuer(ctx, request.IssuerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := assertIssuerOwner(ctx, issuer); err != nil {
+		return nil, err
+	}
+	issuer.TrustPolicy = request.Policy
+	if err := putIssuer(ctx, issuer); err != nil {
+		return nil, err
+	}
+	return issuer.TrustPolicy, nil
+}
+
+// GetIssuerTrustPolicy get the trust policy of an issuer, nil if it has no policy
+//
+// Arguments:
+//		0: GetRequest
+// Returns:
+//		0: IssuerTrustPolicy
+//		1: error
+func (ci *ContractIdentity) GetIssuerTrustPolicy(ctx contractapi.TransactionContextInterface, request model.GetRequest) (*IssuerTrustPolicy, error) {
+	log.Printf("[%s][GetIssuerTrustPolicy]", ctx.GetStub().GetChannelID())
+
+	issuer, err := getIssuer(ctx, request.ID)
+	if err != nil {
+		return nil, err
+	}
+	return issuer.TrustPolicy, nil
+}
+
+// GetTrustPolicyViolations reports the participants backed by the issuer that break
+// the requested policy, or the current policy of the issuer if none is requested.
+// Used to review the grants before tightening a policy, the participants are found
+// with the issuer index, ordered by DID
+//
+// Arguments:
+//		0: IssuerTrustPolicyRequest
+// Returns:
+//		0: []TrustPolicyViolation
+//		1: error
+func (ci *ContractIdentity) GetTrustPolicyViolations(ctx contractapi.TransactionContextInterface, request IssuerTrustPolicyRequest) ([]TrustPolicyViolation, error) {
+	log.Printf("[%s][GetTrustPolicyViolations]", ctx.GetStub().GetChannelID())
+
+	issuer, err := getIssuer(ctx, request.IssuerID)
+	if err != nil {
+		return nil, err
+	}
+	policy := request.Policy
+	if policy == nil {
+		policy = issuer.TrustPolicy
+	} else if err := policy.validate(); err != nil {
+		return nil, err
+	}
+
+	var items = make([]TrustPolicyViolation, 0)
+	if policy == nil {
+		return items, nil
+	}
+
+	// participants of the issuer by the secondary index, see RebuildParticipantIndexes
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(ObjectTypeParticipantBy, []string{participantByIssuer, issuer.ID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
+		}
+		participant, err := findParticipant(ctx, keyParts[len(keyParts)-1])
+		if err != nil {
+			return nil, err
+		} else if participant == nil || participant.IssuerID != issuer.ID {
+			continue
+		}
+		if reasons := policy.violations(participantGrant(participant)); len(reasons) > 0 {
+			items = append(items, TrustPolicyViolation{Did: participant.Did, IssuerID: issuer.ID, Reasons: reasons})
+		}
+	}
+	return items, nil
+}
+
+// assertTrustPolicy returns an error if the grant breaks the trust policy of the issuer
+// or of one of its ancestors. A transaction that issues credentials must call it with the
+// validity of the credential
+func assertTrustPolicy(ctx contractapi.TransactionContextInterface, issuerID string, grant trustGrant) error {
+	chain, err := issuerChain(ctx, issuerID)
+	if err != nil {
+		return err
+	}
+	return assertChainTrustPolicy(chain, grant)
+}
+
+// assertChainTrustPolicy checks the grant against the trust policy of every issuer of the chain
+func assertChainTrustPolicy(chain []*IssuerRecord, grant trustGrant) error {
+	for _, issuer := range chain {
+		if issuer.TrustPolicy == nil {
+			continue
+		}
+		if reasons := issuer.TrustPolicy.violations(grant); len(reasons) > 0 {
+			return fmt.Errorf("the trust policy of the issuer %s does not allow %s: %s", issuer.ID, grant.did, strings.Join(reasons, "; "))
+		}
+	}
+	return nil
+}
+
+// participantGrant what the issuer of the participant vouches for
+func participantGrant(participant *model.Participant) trustGrant {
+	attributes := make([]string, 0)
+	for name, value := range participantAttributes(participant) {
+		switch name {
+		case "did", "mspID", "issuerId", "active":
+			continue
+		}
+		if value != "" {
+			attributes = append(attributes, name)
+		}
+	}
+	sort.Strings(attributes)
+	return trustGrant{
+		did:         participant.Did,
+		mspID:       participant.MspID,
+		publicKey:   participant.PublicKey,
+		attributes:  attributes,
+		issuedTime:  participant.IssuedTime,
+		expiresTime: participant.ExpiresTime,
+	}
+}
+
+// validate checks the rules of the policy
+func (p *IssuerTrustPolicy) validate() error {
+	if p.MaxValidityDays < 0 {
+		return fmt.Errorf("maxValidityDays can not be negative")
+	}
+	for _, alg := range p.AllowedKeyAlgorithms {
+		switch jose.SignatureAlgorithm(alg) {
+		case jose.EdDSA, jose.ES256, jose.ES384, jose.ES512, jose.RS256, jose.RS384, jose.RS512, jose.PS256, jose.PS384, jose.PS512:
+		default:
+			return fmt.Errorf("unsupported key algorithm %s", alg)
+		}
+	}
+	return nil
+}
+
+// violations reasons why the grant breaks the policy, empty if it is allowed
+func (p *IssuerTrustPolicy) violations(grant trustGrant) []string {
+	var reasons []string
+
+	if len(p.AllowedAttributes) > 0 {
+		for _, name := range grant.attributes {
+			if !lus.Contains(p.AllowedAttributes, name) {
+				reasons = append(reasons, fmt.Sprintf("attribute %s is not allowed", name))
+			}
+		}
+	}
+
+	if len(p.AllowedDidPrefixes) > 0 {
+		allowed := false
+		for _, prefix := range p.AllowedDidPrefixes {
+			if strings.HasPrefix(grant.did, prefix) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			reasons = append(reasons, fmt.Sprintf("did %s does not have an allowed prefix", grant.did))
+		}
+	}
+
+	if len(p.AllowedMspIDs) > 0 && !lus.Contains(p.AllowedMspIDs, grant.mspID) {
+		reasons = append(reasons, fmt.Sprintf("organization %s is not allowed", grant.mspID))
+	}
+
+	if p.MaxValidityDays > 0 && grant.issuedTime != "" && grant.expiresTime != "" {
+		issued, err1 := lus.ParseRFC3339toTime(grant.issuedTime)
+		expires, err2 := lus.ParseRFC3339toTime(grant.expiresTime)
+		if err1 != nil || err2 != nil {
+			reasons = append(reasons, "invalid certificate validity")
+		} else if days := expires.Sub(issued).Hours() / 24; days > float64(p.MaxValidityDays) {
+			reasons = append(reasons, fmt.Sprintf("certificate validity of %.0f days exceeds %d days", days, p.MaxValidityDays))
+		}
+	}
+
+	if len(p.AllowedKeyAlgorithms) > 0 {
+		publicKey, err := keys.ParseSPKIBase64(grant.publicKey)
+		if err != nil {
+			reasons = append(reasons, fmt.Sprintf("unsupported public key: %v", err))
+		} else {
+			algorithms, _ := keys.Algorithms(publicKey)
+			allowed := false
+			for _, alg := range algorithms {
+				if lus.Contains(p.AllowedKeyAlgorithms, string(alg)) {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				reasons = append(reasons, fmt.Sprintf("key algorithms %v are not allowed", algorithms))
+			}
+		}
+	}
+	return reasons
+}
@@ -0,0 +1,120 @@
+package identity
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/keys"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	"log"
+)
+
+// JSONWebKey public JWK, RFC 7517. The kid is the RFC 7638 SHA-256 thumbprint of the key
+type JSONWebKey struct {
+	Kty string   `json:"kty"`
+	Kid string   `json:"kid"`
+	Use string   `json:"use"`
+	Alg string   `json:"alg"`
+	Crv string   `json:"crv,omitempty" metadata:",optional"` // EC and OKP
+	X   string   `json:"x,omitempty" metadata:",optional"`   // EC and OKP
+	Y   string   `json:"y,omitempty" metadata:",optional"`   // EC
+	N   string   `json:"n,omitempty" metadata:",optional"`   // RSA
+	E   string   `json:"e,omitempty" metadata:",optional"`   // RSA
+	X5c []string `json:"x5c,omitempty" metadata:",optional"` // base64 DER certificate of the key
+}
+
+// JSONWebKeySet JWK set, RFC 7517
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// GetParticipantJWKS get the public key of a participant as JWK set, the set of an
+// inactive participant is empty
+//
+// Arguments:
+//		0: ParticipantGetRequest
+// Returns:
+//		0: JSONWebKeySet
+//		1: error
+func (ci *ContractIdentity) GetParticipantJWKS(ctx contractapi.TransactionContextInterface, request model.ParticipantGetRequest) (*JSONWebKeySet, error) {
+	log.Printf("[%s][GetParticipantJWKS]", ctx.GetStub().GetChannelID())
+
+	participant, err := findParticipant(ctx, request.Did)
+	if err != nil {
+		return nil, err
+	} else if participant == nil {
+		return nil, fmt.Errorf(lus.ErrorDefaultNotExist, request.Did)
+	}
+
+	set := &JSONWebKeySet{Keys: make([]JSONWebKey, 0)}
+	if !participant.Active {
+		return set, nil
+	}
+	publicKey, err := keys.ParseSPKIBase64(participant.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key of %s: %v", request.Did, err)
+	}
+	jwk, err := toJSONWebKey(publicKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	set.Keys = append(set.Keys, *jwk)
+	return set, nil
+}
+
+// GetIssuerJWKS get the public key of an issuer as JWK set, with its certificate in x5c,
+// the set of an inactive issuer is empty
+//
+// Arguments:
+//		0: GetRequest
+// Returns:
+//		0: JSONWebKeySet
+//		1: error
+func (ci *ContractIdentity) GetIssuerJWKS(ctx contractapi.TransactionContextInterface, request model.GetRequest) (*JSONWebKeySet, error) {
+	log.Printf("[%s][GetIssuerJWKS]", ctx.GetStub().GetChannelID())
+
+	issuer, err := getIssuer(ctx, request.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !issuer.Active {
+		return &JSONWebKeySet{Keys: make([]JSONWebKey, 0)}, nil
+	}
+	cert, err := lus.GetX509CertFromPem(issuer.CertPem)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := keys.FromCertificate(cert)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key of the issuer %s: %v", request.ID, err)
+	}
+	jwk, err := toJSONWebKey(publicKey, []*x509.Certificate{cert})
+	if err != nil {
+		return nil, err
+	}
+	return &JSONWebKeySet{Keys: []JSONWebKey{*jwk}}, nil
+}
+
+// toJSONWebKey public JWK of the key, the certificates are added to x5c
+func toJSONWebKey(publicKey crypto.PublicKey, certs []*x509.Certificate) (*JSONWebKey, error) {
+	jwk, err := keys.JWK(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	jwkJE, err := jwk.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var key JSONWebKey
+	if err := json.Unmarshal(jwkJE, &key); err != nil {
+		return nil, err
+	}
+	for _, cert := range certs {
+		key.X5c = append(key.X5c, base64.StdEncoding.EncodeToString(cert.Raw))
+	}
+	return &key, nil
+}
@@ -0,0 +1,447 @@
+package identity
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/did"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	"log"
+)
+
+// organization status
+const (
+	OrganizationActive    = "active"
+	OrganizationSuspended = "suspended"
+)
+
+// Organization registry entry of an MSP, the participants of an MSP can only be
+// created while its organization is registered and active
+type Organization struct {
+	DocType            string              `json:"docType"`
+	MspID              string              `json:"mspID"`
+	DisplayName        string              `json:"displayName"`
+	RootCerts          []string            `json:"rootCerts"`          // b64 PEM of the root CA certificates
+	IntermediateCerts  []string            `json:"intermediateCerts"`  // b64 PEM of the intermediate CA certificates
+	AllowedDidPrefixes []string            `json:"allowedDidPrefixes"` // empty, any DID is allowed
+	MaxParticipants    int                 `json:"maxParticipants"`    // 0, unlimited
+	DidMethod          string              `json:"didMethod"`          // key, web or fabric, empty for the legacy did:<hash>
+	DidDomain          string              `json:"didDomain"`          // domain of the did:web DIDs
+	ParticipantCount   int                 `json:"participantCount"`
+	Status             string              `json:"status"` // active or suspended
+	Contact            OrganizationContact `json:"contact"`
+	Time               string              `json:"time"`
+}
+
+// OrganizationContact
+type OrganizationContact struct {
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty" metadata:",optional"`
+	Phone string `json:"phone,omitempty" metadata:",optional"`
+}
+
+// OrganizationRequest register or update the organization of the caller's MSP,
+// the update replaces every field of the request
+type OrganizationRequest struct {
+	DisplayName        string              `json:"displayName"`
+	RootCerts          []string            `json:"rootCerts,omitempty" metadata:",optional"`
+	IntermediateCerts  []string            `json:"intermediateCerts,omitempty" metadata:",optional"`
+	AllowedDidPrefixes []string            `json:"allowedDidPrefixes,omitempty" metadata:",optional"`
+	MaxParticipants    int                 `json:"maxParticipants,omitempty" metadata:",optional"`
+	DidMethod          string              `json:"didMethod,omitempty" metadata:",optional"`
+	DidDomain          string              `json:"didDomain,omitempty" metadata:",optional"`
+	Contact            OrganizationContact `json:"contact,omitempty" metadata:",optional"`
+}
+
+// OrganizationStatusRequest
+type OrganizationStatusRequest struct {
+	MspID  string `json:"mspID"`
+	Status string `json:"status"` // active or suspended
+}
+
+// CreateOrganization registers the organization of the caller's MSP
+//
+// Arguments:
+//		0: OrganizationRequest
+// Returns:
+//		0: Organization
+//		1: error
+func (ci *ContractIdentity) CreateOrganization(ctx contractapi.TransactionContextInterface, request OrganizationRequest) (*Organization, error) {
+	log.Printf("[%s][CreateOrganization]", ctx.GetStub().GetChannelID())
+
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityIdentityAdmin); err != nil {
+		return nil, err
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf(lus.ErrorGetMSPID, err)
+	}
+	organization, err := getOrganization(ctx, mspID)
+	if err != nil {
+		return nil, err
+	} else if organization != nil {
+		return nil, fmt.Errorf("organization %s already exists", mspID)
+	}
+
+	// timestamp when the transaction was created, have the same value across all endorsers
+	txTimestamp, err := lus.GetTxTimestampRFC3339(ctx.GetStub())
+	if err != nil {
+		return nil, err
+	}
+
+	organization = &Organization{
+		DocType: OrganizationDocType,
+		MspID:   mspID,
+		Status:  OrganizationActive,
+		Time:    txTimestamp,
+	}
+	if err := organization.apply(request); err != nil {
+		return nil, err
+	}
+	if err := putOrganization(ctx, organization); err != nil {
+		return nil, err
+	}
+	return organization, nil
+}
+
+// UpdateOrganization replaces the metadata of the organization of the caller's MSP,
+// the status and the participant count are not modified
+func (ci *ContractIdentity) UpdateOrganization(ctx contractapi.TransactionContextInterface, request OrganizationRequest) (*Organization, error) {
+	log.Printf("[%s][UpdateOrganization]", ctx.GetStub().GetChannelID())
+
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityIdentityAdmin); err != nil {
+		return nil, err
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf(lus.ErrorGetMSPID, err)
+	}
+	organization, err := getOrganization(ctx, mspID)
+	if err != nil {
+		return nil, err
+	} else if organization == nil {
+		return nil, fmt.Errorf(lus.ErrorDefaultNotExist, mspID)
+	}
+
+	if err := organization.apply(request); err != nil {
+		return nil, err
+	}
+	if organization.MaxParticipants > 0 && organization.ParticipantCount > organization.MaxParticipants {
+		return nil, fmt.Errorf("organization %s already has %d participants, the quota can not be %d", mspID, organization.ParticipantCount, organization.MaxParticipants)
+	}
+	if err := putOrganization(ctx, organization); err != nil {
+		return nil, err
+	}
+	return organization, nil
+}
+
+// SetOrganizationStatus activates or suspends an organization, a suspended
+// organization can not create participants. An IdentityAdmin sets the status of its
+// own organization, a channel admin the status of any organization
+func (ci *ContractIdentity) SetOrganizationStatus(ctx contractapi.TransactionContextInterface, request OrganizationStatusRequest) (*Organization, error) {
+	log.Printf("[%s][SetOrganizationStatus]", ctx.GetStub().GetChannelID())
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf(lus.ErrorGetMSPID, err)
+	}
+	// admin capability required
+	if request.MspID == mspID {
+		if err := ci.assertCapability(ctx, CapabilityIdentityAdmin); err != nil {
+			return nil, err
+		}
+	} else if err := ci.assertChannelAdmin(ctx); err != nil {
+		return nil, fmt.Errorf("client from org %v is not authorized to set the status of the org %v: %v", mspID, request.MspID, err)
+	}
+
+	if request.Status != OrganizationActive && request.Status != OrganizationSuspended {
+		return nil, fmt.Errorf("invalid organization status %s, expected %s or %s", request.Status, OrganizationActive, OrganizationSuspended)
+	}
+	organization, err := getOrganization(ctx, request.MspID)
+	if err != nil {
+		return nil, err
+	} else if organization == nil {
+		return nil, fmt.Errorf(lus.ErrorDefaultNotExist, request.MspID)
+	}
+
+	organization.Status = request.Status
+	if err := putOrganization(ctx, organization); err != nil {
+		return nil, err
+	}
+	return organization, nil
+}
+
+// GetOrganization
+//
+// Arguments:
+//		0: GetRequest, id is the MSP ID
+// Returns:
+//		0: Organization
+//		1: error
+func (ci *ContractIdentity) GetOrganization(ctx contractapi.TransactionContextInterface, request model.GetRequest) (*Organization, error) {
+	log.Printf("[%s][GetOrganization]", ctx.GetStub().GetChannelID())
+
+	organization, err := getOrganization(ctx, request.ID)
+	if err != nil {
+		return nil, err
+	} else if organization == nil {
+		return nil, fmt.Errorf(lus.ErrorDefaultNotExist, request.ID)
+	}
+	return organization, nil
+}
+
+// GetOrganizations get a page of the registered organizations, in MSP order
+//
+// Arguments:
+//		0: ListRequest
+// Returns:
+//		0: OrganizationsResponse
+//		1: error
+func (ci *ContractIdentity) GetOrganizations(ctx contractapi.TransactionContextInterface, request ListRequest) (*OrganizationsResponse, error) {
+	log.Printf("[%s][GetOrganizations]", ctx.GetStub().GetChannelID())
+
+	records, bookmark, err := listPage(ctx, OrganizationDocType, []string{}, request, listFields(OrganizationDocType), func(_ string, value []byte) (interface{}, error) {
+		var organization Organization
+		if err := json.Unmarshal(value, &organization); err != nil {
+			return nil, err
+		}
+		return &organization, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var items = make([]Organization, 0, len(records))
+	for _, record := range records {
+		items = append(items, *record.(*Organization))
+	}
+	return &OrganizationsResponse{
+		Records:             items,
+		FetchedRecordsCount: int32(len(items)),
+		Bookmark:            bookmark,
+	}, nil
+}
+
+// registerOrganization registers the caller's MSP if it is not registered yet, the
+// participants already stored by the MSP are counted
+func (ci *ContractIdentity) registerOrganization(ctx contractapi.TransactionContextInterface) error {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf(lus.ErrorGetMSPID, err)
+	}
+	organization, err := getOrganization(ctx, mspID)
+	if err != nil {
+		return err
+	} else if organization != nil {
+		return nil
+	}
+
+	// timestamp when the transaction was created, have the same value across all endorsers
+	txTimestamp, err := lus.GetTxTimestampRFC3339(ctx.GetStub())
+	if err != nil {
+		return err
+	}
+
+	count, err := countParticipants(ctx, mspID)
+	if err != nil {
+		return err
+	}
+	return putOrganization(ctx, &Organization{
+		DocType:            OrganizationDocType,
+		MspID:              mspID,
+		DisplayName:        mspID,
+		RootCerts:          make([]string, 0),
+		IntermediateCerts:  make([]string, 0),
+		AllowedDidPrefixes: make([]string, 0),
+		ParticipantCount:   count,
+		Status:             OrganizationActive,
+		Time:               txTimestamp,
+	})
+}
+
+// reserveParticipantSlot checks that the organization of the MSP is registered and
+// active, that the DID has an allowed prefix and that the quota is not exceeded,
+// then it increments the participant count
+func reserveParticipantSlot(ctx contractapi.TransactionContextInterface, mspID, did string) error {
+	organization, err := getOrganization(ctx, mspID)
+	if err != nil {
+		return err
+	}
+	if err := assertParticipantSlot(organization, mspID, did, 0); err != nil {
+		return err
+	}
+	organization.ParticipantCount++
+	return putOrganization(ctx, organization)
+}
+
+// assertParticipantSlot checks that the organization is registered and active, that the
+// DID has an allowed prefix and that the quota is not exceeded by one more participant
+// after the reserved ones
+func assertParticipantSlot(organization *Organization, mspID, did string, reserved int) error {
+	if organization == nil {
+		return fmt.Errorf("organization %s is not registered", mspID)
+	}
+	if organization.Status != OrganizationActive {
+		return fmt.Errorf("organization %s is %s", mspID, organization.Status)
+	}
+
+	if len(organization.AllowedDidPrefixes) > 0 {
+		allowed := false
+		for _, prefix := range organization.AllowedDidPrefixes {
+			if strings.HasPrefix(did, prefix) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("did %s is not allowed for organization %s, expected one of the prefixes %v", did, mspID, organization.AllowedDidPrefixes)
+		}
+	}
+
+	if organization.MaxParticipants > 0 && organization.ParticipantCount+reserved >= organization.MaxParticipants {
+		return fmt.Errorf("organization %s reached its quota of %d participants", mspID, organization.MaxParticipants)
+	}
+	return nil
+}
+
+// releaseParticipantSlot decrements the participant count of the organization of the MSP
+func releaseParticipantSlot(ctx contractapi.TransactionContextInterface, mspID string) error {
+	organization, err := getOrganization(ctx, mspID)
+	if err != nil {
+		return err
+	} else if organization == nil || organization.ParticipantCount == 0 {
+		return nil
+	}
+	organization.ParticipantCount--
+	return putOrganization(ctx, organization)
+}
+
+// apply copies the request into the organization, the certificates must be valid
+// and every intermediate certificate must be issued by one of the root certificates
+func (o *Organization) apply(request OrganizationRequest) error {
+	if request.DisplayName == "" {
+		return fmt.Errorf(lus.ErrorRequiredParameter, "displayName")
+	}
+	if request.MaxParticipants < 0 {
+		return fmt.Errorf("maxParticipants can not be negative")
+	}
+	if request.DidMethod != "" {
+		if _, err := did.Lookup(request.DidMethod); err != nil {
+			return err
+		}
+	}
+	if request.DidMethod == (did.WebMethod{}).Name() && request.DidDomain == "" {
+		return fmt.Errorf(lus.ErrorRequiredParameter, "didDomain")
+	}
+
+	var rootsPem []byte
+	for _, certPem := range request.RootCerts {
+		if _, err := lus.GetX509CertFromPem(certPem); err != nil {
+			return fmt.Errorf("invalid root certificate: %v", err)
+		}
+		certByte, _ := base64.StdEncoding.DecodeString(certPem)
+		rootsPem = append(rootsPem, certByte...)
+	}
+	for _, certPem := range request.IntermediateCerts {
+		certByte, err := base64.StdEncoding.DecodeString(certPem)
+		if err != nil {
+			return fmt.Errorf(lus.ErrorBase64)
+		}
+		if len(rootsPem) == 0 {
+			return fmt.Errorf("the intermediate certificates require at least one root certificate")
+		}
+		if err := lus.VerifyIssuedByRootCert(rootsPem, certByte); err != nil {
+			return fmt.Errorf("invalid intermediate certificate: %v", err)
+		}
+	}
+
+	o.DisplayName = request.DisplayName
+	o.RootCerts = nonNil(request.RootCerts)
+	o.IntermediateCerts = nonNil(request.IntermediateCerts)
+	o.AllowedDidPrefixes = nonNil(request.AllowedDidPrefixes)
+	o.MaxParticipants = request.MaxParticipants
+	o.DidMethod = request.DidMethod
+	o.DidDomain = request.DidDomain
+	o.Contact = request.Contact
+	return nil
+}
+
+// getOrganization returns the organization of the MSP, or nil if it is not registered
+func getOrganization(ctx contractapi.TransactionContextInterface, mspID string) (*Organization, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(OrganizationDocType, []string{mspID})
+	if err != nil {
+		return nil, err
+	}
+	item, err := getDocument(ctx, OrganizationDocType, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization %s: %v", mspID, err)
+	} else if item == nil {
+		return nil, nil
+	}
+
+	var organization Organization
+	if err = json.Unmarshal(item, &organization); err != nil {
+		return nil, err
+	}
+	return &organization, nil
+}
+
+func putOrganization(ctx contractapi.TransactionContextInterface, organization *Organization) error {
+	key, err := ctx.GetStub().CreateCompositeKey(OrganizationDocType, []string{organization.MspID})
+	if err != nil {
+		return err
+	}
+	// JSON encoding
+	organizationJE, err := json.Marshal(organization)
+	if err != nil {
+		return err
+	}
+	if err := putAudited(ctx, OrganizationDocType, organization.MspID, key, organizationJE); err != nil {
+		return fmt.Errorf("organization %s could not be stored: %v", organization.MspID, err)
+	}
+	return nil
+}
+
+// countParticipants number of participants stored by the MSP
+func countParticipants(ctx contractapi.TransactionContextInterface, mspID string) (int, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(ParticipantDocType, []string{})
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	count := 0
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if responseRange == nil {
+			return 0, err
+		}
+
+		participantJE, err := migrateDocument(ParticipantDocType, responseRange.Value)
+		if err != nil {
+			return 0, err
+		}
+		var participant model.Participant
+		if err = json.Unmarshal(participantJE, &participant); err != nil {
+			return 0, err
+		}
+		if participant.MspID == mspID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return make([]string, 0)
+	}
+	return values
+}
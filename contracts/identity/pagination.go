@@ -0,0 +1,256 @@
+package identity
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/query"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+)
+
+// ListRequest page of a list transaction. The documents are returned in the order of
+// their keys, the bookmark is the key of the last document of the previous page
+type ListRequest struct {
+	PageSize int          `json:"pageSize"`
+	Bookmark string       `json:"bookmark,omitempty" metadata:",optional"`
+	Filters  []ListFilter `json:"filters,omitempty" metadata:",optional"` // combined with AND
+}
+
+// ListFilter the field of the document is equal to the value, an array field contains it
+type ListFilter struct {
+	Field string `json:"field"`
+	Value string `json:"value"`
+}
+
+// ParticipantsResponse page of participants
+type ParticipantsResponse struct {
+	Records             []model.ParticipantResponse `json:"records"`
+	FetchedRecordsCount int32                       `json:"fetchedRecordsCount"`
+	Bookmark            string                      `json:"bookmark"`
+}
+
+// IssuersResponse page of issuers
+type IssuersResponse struct {
+	Records             []model.IssuerQueryResponse `json:"records"`
+	FetchedRecordsCount int32                       `json:"fetchedRecordsCount"`
+	Bookmark            string                      `json:"bookmark"`
+}
+
+// RolesResponse page of roles
+type RolesResponse struct {
+	Records             []model.RoleResponse `json:"records"`
+	FetchedRecordsCount int32                `json:"fetchedRecordsCount"`
+	Bookmark            string               `json:"bookmark"`
+}
+
+// AccessesResponse page of access entries
+type AccessesResponse struct {
+	Records             []model.AccessResponse `json:"records"`
+	FetchedRecordsCount int32                  `json:"fetchedRecordsCount"`
+	Bookmark            string                 `json:"bookmark"`
+}
+
+// OrganizationsResponse page of organizations
+type OrganizationsResponse struct {
+	Records             []Organization `json:"records"`
+	FetchedRecordsCount int32          `json:"fetchedRecordsCount"`
+	Bookmark            string         `json:"bookmark"`
+}
+
+// listDecoder decodes the document of a key, nil skips the document
+type listDecoder func(key string, value []byte) (interface{}, error)
+
+// listPage returns a page of the documents of the partial composite key. The filters
+// are matched on the JSON of the decoded documents, only the filterable fields can be
+// used. The keys are read with the paginated range of the peer from the bookmark, a page
+// with filters reads as many ranges as needed to fill it. The peer does not allow writes
+// after a paginated query, the transactions that write use scanPage
+func listPage(ctx contractapi.TransactionContextInterface, objectType string, attributes []string, request ListRequest, filterable []string, decode listDecoder) ([]interface{}, string, error) {
+	return listRange(ctx, objectType, attributes, "", "", request, filterable, decode)
+}
+
+// listRange returns a page of the documents of the partial composite key like listPage,
+// from the start key, inclusive, to the end key, exclusive. An empty start or end is the
+// first or the last key of the partial composite key
+func listRange(ctx contractapi.TransactionContextInterface, objectType string, attributes []string, start, end string, request ListRequest, filterable []string, decode listDecoder) ([]interface{}, string, error) {
+	after, err := parseListRequest(request, filterable)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// the range starts at the first key after the last key of the previous page
+	if after != "" && after+"\x00" > start {
+		start = after + "\x00"
+	}
+	var records = make([]interface{}, 0, request.PageSize)
+	var lastKey string
+	for {
+		// one more key than the page tells if there is a next page
+		resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(objectType, attributes, int32(request.PageSize+1), start)
+		if err != nil {
+			return nil, "", err
+		}
+		for resultsIterator.HasNext() {
+			responseRange, err := resultsIterator.Next()
+			if err != nil {
+				resultsIterator.Close()
+				return nil, "", err
+			}
+			if end != "" && responseRange.Key >= end {
+				resultsIterator.Close()
+				return records, "", nil
+			}
+			record, err := listRecord(objectType, responseRange.Key, responseRange.Value, request.Filters, decode)
+			if err != nil {
+				resultsIterator.Close()
+				return nil, "", err
+			} else if record == nil {
+				continue
+			}
+			if len(records) == request.PageSize {
+				resultsIterator.Close()
+				return records, base64.RawURLEncoding.EncodeToString([]byte(lastKey)), nil
+			}
+			records = append(records, record)
+			lastKey = responseRange.Key
+		}
+		resultsIterator.Close()
+
+		if responseMetadata.Bookmark == "" || responseMetadata.FetchedRecordsCount == 0 {
+			return records, "", nil
+		}
+		start = responseMetadata.Bookmark
+	}
+}
+
+// scanPage returns a page of the documents of the partial composite key like listPage,
+// for the transactions that write. The keys before the bookmark are skipped
+func scanPage(ctx contractapi.TransactionContextInterface, objectType string, attributes []string, request ListRequest, filterable []string, decode listDecoder) ([]interface{}, string, error) {
+	after, err := parseListRequest(request, filterable)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resultsIterator.Close()
+
+	var records = make([]interface{}, 0, request.PageSize)
+	var lastKey string
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, "", err
+		}
+		if after != "" && responseRange.Key <= after {
+			continue
+		}
+		record, err := listRecord(objectType, responseRange.Key, responseRange.Value, request.Filters, decode)
+		if err != nil {
+			return nil, "", err
+		} else if record == nil {
+			continue
+		}
+		if len(records) == request.PageSize {
+			return records, base64.RawURLEncoding.EncodeToString([]byte(lastKey)), nil
+		}
+		records = append(records, record)
+		lastKey = responseRange.Key
+	}
+	return records, "", nil
+}
+
+// parseListRequest validates the page and returns the key of its bookmark
+func parseListRequest(request ListRequest, filterable []string) (string, error) {
+	if request.PageSize < 1 || request.PageSize > query.MaxPageSize {
+		return "", fmt.Errorf("pageSize must be between 1 and %d", query.MaxPageSize)
+	}
+	for _, filter := range request.Filters {
+		if !lus.Contains(filterable, filter.Field) {
+			return "", fmt.Errorf("field %s can not be filtered, expected one of %v", filter.Field, filterable)
+		}
+	}
+	if request.Bookmark == "" {
+		return "", nil
+	}
+	bookmark, err := base64.RawURLEncoding.DecodeString(request.Bookmark)
+	if err != nil {
+		return "", fmt.Errorf("invalid bookmark: %v", err)
+	}
+	return string(bookmark), nil
+}
+
+// listRecord decodes the migrated document, nil if it is skipped or does not match the filters
+func listRecord(objectType, key string, value []byte, filters []ListFilter, decode listDecoder) (interface{}, error) {
+	value, err := migrateDocument(objectType, value)
+	if err != nil {
+		return nil, err
+	}
+	record, err := decode(key, value)
+	if err != nil || record == nil {
+		return nil, err
+	}
+	if len(filters) > 0 {
+		if ok, err := matchFilters(record, filters); err != nil || !ok {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+// matchFilters returns true if the JSON of the record matches every filter
+func matchFilters(record interface{}, filters []ListFilter) (bool, error) {
+	recordJE, err := json.Marshal(record)
+	if err != nil {
+		return false, err
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(recordJE, &document); err != nil {
+		return false, err
+	}
+	for _, filter := range filters {
+		if !matchValue(document[filter.Field], filter.Value) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func matchValue(value interface{}, expected string) bool {
+	switch v := value.(type) {
+	case string:
+		return v == expected
+	case bool:
+		return strconv.FormatBool(v) == expected
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64) == expected
+	case []interface{}:
+		for _, item := range v {
+			if matchValue(item, expected) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// listFields fields of the doc type that can be filtered, the equality fields of its
+// query collection
+func listFields(docType string, extra ...string) []string {
+	fields := append([]string{}, extra...)
+	if collection, ok := queryCollections[docType]; ok {
+		for name, field := range collection.Fields {
+			if lus.Contains(field.Ops, query.OpEq) || lus.Contains(field.Ops, query.OpElemMatch) {
+				fields = append(fields, name)
+			}
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
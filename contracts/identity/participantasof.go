@@ -0,0 +1,302 @@
+package identity
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/abac"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	modeltools "github.com/kmilodenisglez/model-identity-go/tools"
+	"log"
+)
+
+// ParticipantAsOfRequest state of a participant at a timestamp, or at the moment a
+// transaction was endorsed
+type ParticipantAsOfRequest struct {
+	Did       string `json:"did"`
+	Timestamp string `json:"timestamp,omitempty" metadata:",optional"` // RFC3339
+	TxID      string `json:"txId,omitempty" metadata:",optional"`      // the state the transaction was endorsed against
+	Function  string `json:"function,omitempty" metadata:",optional"`  // contract function to authorize at the instant
+}
+
+// ParticipantKeyAsOf public key held by the participant up to the instant
+type ParticipantKeyAsOf struct {
+	PublicKey   string `json:"publicKey"`
+	Fingerprint string `json:"fingerprint,omitempty" metadata:",optional"`
+	Current     bool   `json:"current"` // the key of the participant at the instant
+	Bound       bool   `json:"bound"`   // the public key index bound the key to the DID at the instant
+}
+
+// ParticipantAuthorizationAsOf authorization of the participant for a function at the
+// instant by the ABAC policy of the function, as AuthorizeTransaction. The certificate
+// of the caller is unknown, so are the conditions over its attributes
+type ParticipantAuthorizationAsOf struct {
+	Function   string   `json:"function"`
+	Authorized bool     `json:"authorized"`
+	Unknown    bool     `json:"unknown"` // the certificate attributes decide the policy, authorized is false
+	Trace      []string `json:"trace"`   // result of every evaluated condition
+}
+
+// ParticipantAsOfResponse state of the participant reconstructed from the history
+type ParticipantAsOfResponse struct {
+	Did           string                        `json:"did"`
+	Time          string                        `json:"time"` // instant, RFC3339
+	TxID          string                        `json:"txId,omitempty" metadata:",optional"`
+	Exists        bool                          `json:"exists"`
+	VersionTxID   string                        `json:"versionTxId,omitempty" metadata:",optional"` // transaction that wrote the version of the participant
+	VersionTime   string                        `json:"versionTime,omitempty" metadata:",optional"`
+	Participant   *model.Participant            `json:"participant,omitempty" metadata:",optional"`
+	Keys          []ParticipantKeyAsOf          `json:"keys"`
+	Roles         []model.RoleResponse          `json:"roles"` // the roles that did not exist at the instant are omitted
+	Authorization *ParticipantAuthorizationAsOf `json:"authorization,omitempty" metadata:",optional"`
+}
+
+// GetParticipantAsOf reconstructs the participant, its keys and its roles at a timestamp
+// or at the moment a transaction was endorsed, by replaying their history
+//
+// Arguments:
+//		0: ParticipantAsOfRequest
+// Returns:
+//		0: ParticipantAsOfResponse
+//		1: error
+func (ci *ContractIdentity) GetParticipantAsOf(ctx contractapi.TransactionContextInterface, request ParticipantAsOfRequest) (*ParticipantAsOfResponse, error) {
+	log.Printf("[%s][GetParticipantAsOf]", ctx.GetStub().GetChannelID())
+
+	if request.Did == "" {
+		return nil, fmt.Errorf(lus.ErrorRequiredParameter, "did")
+	}
+	compositeKeyID, err := ctx.GetStub().CreateCompositeKey(ParticipantDocType, []string{request.Did})
+	if err != nil {
+		return nil, err
+	}
+
+	instant := historyInstant{txID: request.TxID}
+	switch {
+	case request.Timestamp != "" && request.TxID != "":
+		return nil, fmt.Errorf("timestamp and txId are exclusive")
+	case request.Timestamp != "":
+		if instant.time, err = lus.ParseRFC3339toTime(request.Timestamp); err != nil {
+			return nil, fmt.Errorf("invalid timestamp: %v", err)
+		}
+	case request.TxID != "":
+		if instant.time, err = transactionTime(ctx, request.Did, compositeKeyID, request.TxID); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf(lus.ErrorRequiredParameter, "timestamp or txId")
+	}
+
+	response := &ParticipantAsOfResponse{
+		Did:   request.Did,
+		Time:  instant.time.UTC().Format(time.RFC3339Nano),
+		TxID:  request.TxID,
+		Keys:  make([]ParticipantKeyAsOf, 0),
+		Roles: make([]model.RoleResponse, 0),
+	}
+
+	versions, err := versionsAsOf(ctx, compositeKeyID, instant, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) > 0 && !versions[0].IsDelete {
+		participantJE, err := migrateDocument(ParticipantDocType, versions[0].Value)
+		if err != nil {
+			return nil, err
+		}
+		var participant model.Participant
+		if err := json.Unmarshal(participantJE, &participant); err != nil {
+			return nil, err
+		}
+		decryptParticipant(ctx, &participant)
+		response.Exists = true
+		response.Participant = &participant
+		response.VersionTxID = versions[0].TxId
+		response.VersionTime = modeltools.GetTimestampRFC3339(versions[0].Timestamp)
+
+		if response.Roles, err = rolesAsOf(ctx, participant.Roles, instant); err != nil {
+			return nil, err
+		}
+	}
+	if response.Keys, err = keysAsOf(ctx, request.Did, versions, instant); err != nil {
+		return nil, err
+	}
+
+	if request.Function != "" {
+		if response.Authorization, err = authorizationAsOf(ctx, response, lus.TransactionName(request.Function), instant); err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+// transactionTime returns the timestamp of a transaction that changed the participant,
+// or that the participant invoked and was recorded by the audit trail
+func transactionTime(ctx contractapi.TransactionContextInterface, did, key, txID string) (time.Time, error) {
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return time.Time{}, err
+		}
+		if response.TxId == txID {
+			return time.Unix(response.Timestamp.GetSeconds(), int64(response.Timestamp.GetNanos())), nil
+		}
+	}
+
+	actorIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(ObjectTypeAuditActor, []string{did})
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer actorIterator.Close()
+
+	for actorIterator.HasNext() {
+		responseRange, err := actorIterator.Next()
+		if err != nil {
+			return time.Time{}, err
+		}
+		// actor~time~entityType~entityId~txId
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if len(attributes) == 5 && attributes[4] == txID {
+			return time.Parse(auditTimeLayout, attributes[1])
+		}
+	}
+	return time.Time{}, fmt.Errorf("transaction %s not found in the history of %s", txID, did)
+}
+
+// keysAsOf the public keys of the versions of the participant, the oldest first
+func keysAsOf(ctx contractapi.TransactionContextInterface, did string, versions []*queryresult.KeyModification, instant historyInstant) ([]ParticipantKeyAsOf, error) {
+	var keys = make([]ParticipantKeyAsOf, 0)
+	seen := make(map[string]int) // index of the key in keys
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].IsDelete {
+			continue
+		}
+		participantJE, err := migrateDocument(ParticipantDocType, versions[i].Value)
+		if err != nil {
+			return nil, err
+		}
+		var participant model.Participant
+		if err := json.Unmarshal(participantJE, &participant); err != nil {
+			return nil, err
+		}
+		if participant.PublicKey == "" {
+			continue
+		} else if index, ok := seen[participant.PublicKey]; ok {
+			keys[index].Current = i == 0
+			continue
+		}
+		seen[participant.PublicKey] = len(keys)
+
+		// the newest version is the participant at the instant
+		key := ParticipantKeyAsOf{PublicKey: participant.PublicKey, Current: i == 0}
+		if fingerprint, err := lus.PublicKeyFingerprint(participant.PublicKey); err == nil {
+			key.Fingerprint = fingerprint
+			indexKey, err := ctx.GetStub().CreateCompositeKey(ObjectTypeParticipantPubKey, []string{fingerprint})
+			if err != nil {
+				return nil, err
+			}
+			indexJE, err := valueAsOf(ctx, indexKey, instant)
+			if err != nil {
+				return nil, err
+			}
+			if indexJE != nil {
+				var index PublicKeyIndex
+				if err := json.Unmarshal(indexJE, &index); err != nil {
+					return nil, err
+				}
+				key.Bound = index.Did == did
+			}
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// rolesAsOf the roles of the participant at the instant
+func rolesAsOf(ctx contractapi.TransactionContextInterface, roleIDs []string, instant historyInstant) ([]model.RoleResponse, error) {
+	var items = make([]model.RoleResponse, 0, len(roleIDs))
+	for _, roleID := range roleIDs {
+		key, err := ctx.GetStub().CreateCompositeKey(RoleDocType, []string{roleID})
+		if err != nil {
+			return nil, err
+		}
+		roleJE, err := valueAsOf(ctx, key, instant)
+		if err != nil {
+			return nil, err
+		} else if roleJE == nil {
+			continue
+		}
+		if roleJE, err = migrateDocument(RoleDocType, roleJE); err != nil {
+			return nil, err
+		}
+		var role model.Role
+		if err := json.Unmarshal(roleJE, &role); err != nil {
+			return nil, err
+		}
+		items = append(items, model.RoleResponse{
+			DocType:           role.DocType,
+			ID:                role.ID,
+			Name:              role.Name,
+			Description:       role.Description,
+			ContractFunctions: lus.MapToSlice(role.ContractFunctions),
+		})
+	}
+	return items, nil
+}
+
+// authorizationAsOf evaluates the ABAC policy of the function at the instant like
+// AuthorizeTransaction, a function without policy is allowed. The participant attributes
+// and MSP are those of the participant at the instant, the certificate attributes are
+// unknown, and so is the MSP when the participant did not exist
+func authorizationAsOf(ctx contractapi.TransactionContextInterface, state *ParticipantAsOfResponse, function string, instant historyInstant) (*ParticipantAuthorizationAsOf, error) {
+	authorization := &ParticipantAuthorizationAsOf{Function: function, Trace: make([]string, 0)}
+
+	key, err := ctx.GetStub().CreateCompositeKey(PolicyDocType, []string{function})
+	if err != nil {
+		return nil, err
+	}
+	policyJE, err := valueAsOf(ctx, key, instant)
+	if err != nil {
+		return nil, err
+	}
+	if policyJE == nil {
+		// functions without policy are not restricted by ABAC
+		authorization.Trace = append(authorization.Trace, fmt.Sprintf("no policy for %s", function))
+		authorization.Authorized = true
+		return authorization, nil
+	}
+	if policyJE, err = migrateDocument(PolicyDocType, policyJE); err != nil {
+		return nil, err
+	}
+	var policy Policy
+	if err := json.Unmarshal(policyJE, &policy); err != nil {
+		return nil, err
+	}
+
+	unknownSources := []string{abac.SourceCert}
+	subject := abac.Subject{CertAttributes: make(map[string]string)}
+	if participant := state.Participant; participant != nil {
+		subject.MspID = participant.MspID
+		subject.ParticipantAttributes = participantAttributes(participant)
+	} else {
+		unknownSources = append(unknownSources, abac.SourceMsp)
+	}
+	decision, err := abac.EvaluatePartial(&policy.Expr, subject, unknownSources, &authorization.Trace)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy for %s: %v", function, err)
+	}
+	authorization.Authorized = decision == abac.DecisionTrue
+	authorization.Unknown = decision == abac.DecisionUnknown
+	return authorization, nil
+}
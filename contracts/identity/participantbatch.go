@@ -0,0 +1,399 @@
+package identity
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/keys"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	modeltools "github.com/kmilodenisglez/model-identity-go/tools"
+	"log"
+)
+
+// MaxParticipantsBatch maximum number of participants of a batch
+const MaxParticipantsBatch = 100
+
+// ParticipantsBatchRequest participants to create in one transaction. The data key of the
+// participant i is sent in the transient field dataKey.i, see BatchDataKeyField
+type ParticipantsBatchRequest struct {
+	Participants []StapledParticipantCreateRequest `json:"participants"`
+	Partial      bool                              `json:"partial,omitempty" metadata:",optional"` // create the valid participants and report the invalid ones
+}
+
+// ParticipantBatchResult result of a participant of the batch
+type ParticipantBatchResult struct {
+	Index int      `json:"index"` // position in the request
+	Did   string   `json:"did,omitempty" metadata:",optional"`
+	Roles []string `json:"roles,omitempty" metadata:",optional"`
+	Error string   `json:"error,omitempty" metadata:",optional"`
+}
+
+// ParticipantsBatchResponse
+type ParticipantsBatchResponse struct {
+	Results      []ParticipantBatchResult `json:"results"`
+	CreatedCount int32                    `json:"createdCount"`
+	FailedCount  int32                    `json:"failedCount"`
+}
+
+// CreateParticipantsBatch create the participants of a batch. By default the batch is
+// all-or-nothing, in partial mode the invalid participants are reported and the rest
+// are created
+//
+// Arguments:
+//		0: ParticipantsBatchRequest
+// Returns:
+//		0: ParticipantsBatchResponse
+//		1: error
+func (ci *ContractIdentity) CreateParticipantsBatch(ctx contractapi.TransactionContextInterface, request ParticipantsBatchRequest) (*ParticipantsBatchResponse, error) {
+	log.Printf("[%s][CreateParticipantsBatch]", ctx.GetStub().GetChannelID())
+
+	// admin capability required, checked once for the batch
+	if err := ci.assertCapability(ctx, CapabilityIdentityAdmin); err != nil {
+		return nil, err
+	}
+	if len(request.Participants) == 0 {
+		return nil, fmt.Errorf(lus.ErrorRequiredParameter, "participants")
+	} else if len(request.Participants) > MaxParticipantsBatch {
+		return nil, fmt.Errorf("a batch can not have more than %d participants, got %d", MaxParticipantsBatch, len(request.Participants))
+	}
+
+	onboarding, err := newParticipantOnboarding(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// every participant is validated before anything is written
+	response := &ParticipantsBatchResponse{Results: make([]ParticipantBatchResult, 0, len(request.Participants))}
+	drafts := make([]*participantDraft, len(request.Participants))
+	for i, item := range request.Participants {
+		draft, err := ci.prepareParticipant(ctx, onboarding, item, BatchDataKeyField(i))
+		if err != nil {
+			if !request.Partial {
+				return nil, fmt.Errorf("participant %d: %v", i, err)
+			}
+			response.Results = append(response.Results, ParticipantBatchResult{Index: i, Error: err.Error()})
+			response.FailedCount++
+			continue
+		}
+		drafts[i] = draft
+	}
+
+	for i, draft := range drafts {
+		if draft == nil {
+			continue
+		}
+		if err := storeParticipant(ctx, draft); err != nil {
+			return nil, fmt.Errorf("participant %d: %v", i, err)
+		}
+		response.Results = append(response.Results, ParticipantBatchResult{
+			Index: i,
+			Did:   draft.participant.Did,
+			Roles: draft.participant.Roles,
+		})
+		response.CreatedCount++
+	}
+	if err := onboarding.commit(ctx); err != nil {
+		return nil, err
+	}
+
+	// the results in the order of the request
+	results := make([]ParticipantBatchResult, len(request.Participants))
+	for _, result := range response.Results {
+		results[result.Index] = result
+	}
+	response.Results = results
+	return response, nil
+}
+
+// BatchDataKeyField transient field with the data key of the participant i of a batch,
+// every participant has its own data key
+func BatchDataKeyField(i int) string {
+	return TransientDataKey + "." + strconv.Itoa(i)
+}
+
+// participantOnboarding state shared by the participants created by a transaction. The
+// statecache makes its reads see its own writes, but every participant is validated
+// before any is stored, so the DIDs, public keys and slots of the organization taken by
+// the previous participants of the batch are tracked here
+type participantOnboarding struct {
+	mspID        string
+	txTimestamp  string
+	config       *Config
+	organization *Organization // nil if the organization is not registered
+	issuers      map[string]*onboardingIssuer
+	dids         map[string]bool
+	fingerprints map[string]string // DID of every public key fingerprint
+	dataKeys     map[string]string // DID of every data key fingerprint
+	reserved     int               // slots of the organization
+}
+
+// onboardingIssuer issuer chain, its certificates and the result of its checks
+type onboardingIssuer struct {
+	chain []*IssuerRecord
+	certs []*x509.Certificate
+	err   error
+}
+
+// participantDraft participant validated and ready to be stored
+type participantDraft struct {
+	participant model.Participant
+	fingerprint string
+	dataKey     []byte
+	ocspStatus  *ParticipantOcspStatus
+}
+
+func newParticipantOnboarding(ctx contractapi.TransactionContextInterface) (*participantOnboarding, error) {
+	// Get MSP ID of the client
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf(lus.ErrorGetMSPID, err)
+	}
+	config, err := getConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	organization, err := getOrganization(ctx, mspID)
+	if err != nil {
+		return nil, err
+	}
+	// timestamp when the transaction was created, have the same value across all endorsers
+	txTimestamp, err := lus.GetTxTimestampRFC3339(ctx.GetStub())
+	if err != nil {
+		return nil, err
+	}
+	return &participantOnboarding{
+		mspID:        mspID,
+		txTimestamp:  txTimestamp,
+		config:       config,
+		organization: organization,
+		issuers:      make(map[string]*onboardingIssuer),
+		dids:         make(map[string]bool),
+		fingerprints: make(map[string]string),
+		dataKeys:     make(map[string]string),
+	}, nil
+}
+
+// issuer returns the chain of the issuer, read and checked once
+func (o *participantOnboarding) issuer(ctx contractapi.TransactionContextInterface, issuerID string) (*onboardingIssuer, error) {
+	if issuer, ok := o.issuers[issuerID]; ok {
+		return issuer, issuer.err
+	}
+	issuer := &onboardingIssuer{}
+	issuer.chain, issuer.err = issuerChain(ctx, issuerID)
+	if issuer.err == nil {
+		// the issuer must be registered and active
+		issuer.err = assertChainActive(issuerID, issuer.chain)
+	}
+	if issuer.err == nil {
+		issuer.certs, issuer.err = issuerCerts(issuer.chain)
+	}
+	o.issuers[issuerID] = issuer
+	return issuer, issuer.err
+}
+
+// commit consumes the slots of the organization taken by the participants
+func (o *participantOnboarding) commit(ctx contractapi.TransactionContextInterface) error {
+	if o.reserved == 0 {
+		return nil
+	}
+	o.organization.ParticipantCount += o.reserved
+	return putOrganization(ctx, o.organization)
+}
+
+// prepareParticipant validates a new participant, nothing is written
+func (ci *ContractIdentity) prepareParticipant(ctx contractapi.TransactionContextInterface, onboarding *participantOnboarding, request StapledParticipantCreateRequest, dataKeyField string) (*participantDraft, error) {
+	// publicKey required
+	if request.PublicKey == "" {
+		return nil, fmt.Errorf(lus.ErrorRequiredParameter, "publicKey")
+	}
+	// the key type must be supported and the RSA keys strong enough
+	if _, err := keys.ParseSPKIBase64(request.PublicKey); err != nil {
+		return nil, fmt.Errorf("invalid publicKey: %v", err)
+	}
+
+	publicKey := request.PublicKey
+
+	// the DID method is selected by the organization of the client
+	did, err := participantDid(ctx, onboarding.organization, request.ParticipantCreateRequest, onboarding.config.AutogenerateDid)
+	if err != nil {
+		return nil, err
+	}
+
+	if onboarding.dids[did] {
+		return nil, fmt.Errorf(lus.ErrorIdentityExists, did)
+	}
+	exist, err := ci.ParticipantExits(ctx, model.ParticipantGetRequest{Did: did})
+	if err != nil {
+		return nil, err
+	}
+	if exist {
+		return nil, fmt.Errorf(lus.ErrorIdentityExists, did)
+	}
+	// a deleted DID can only come back with RestoreParticipant, or after it is purged
+	tombstoned, err := isTombstoned(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+	if tombstoned {
+		return nil, fmt.Errorf("identity %s is deleted, restore it or purge it before creating it again", did)
+	}
+
+	// a public key can only be bound to one DID
+	fingerprint, err := assertPublicKeyFree(ctx, did, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if boundDid, ok := onboarding.fingerprints[fingerprint]; ok && boundDid != did {
+		return nil, fmt.Errorf("the public key is already bound to %s", boundDid)
+	}
+
+	var issuer *onboardingIssuer
+	if request.IssuerID != "" {
+		if issuer, err = onboarding.issuer(ctx, request.IssuerID); err != nil {
+			return nil, err
+		}
+	}
+
+	var issuedTime, expiresTime, attrs = "", "", model.Attrs{}
+
+	// getParticipant certificate attrs
+	if request.CertPem != "" {
+		// validate cert
+		certX509, err := lus.GetX509CertFromPem(request.CertPem)
+		if err != nil {
+			return nil, err
+		}
+		err = lus.HasExpired(certX509)
+		if err != nil {
+			return nil, err
+		}
+		// the certificate must be issued by the issuer, through every ancestor of the issuer
+		if issuer != nil {
+			if err := verifyIssuerCerts(ctx, certX509, issuer.certs); err != nil {
+				return nil, fmt.Errorf("the certificate was not issued by the issuer %s: %v", request.IssuerID, err)
+			}
+		}
+		// get dates
+		dateCert := lus.GetDateCertificate(certX509)
+		issuedTime = dateCert["issuedTime"]
+		expiresTime = dateCert["expiresTime"]
+
+		// get attrs
+		attrs = modeltools.GetAttrsCert(certX509)
+
+		// validating publicKey
+		certPublicKey, err := lus.GetPublicKey(certX509)
+		if err != nil {
+			return nil, err
+		}
+		if strings.Compare(certPublicKey, publicKey) != 0 {
+			return nil, fmt.Errorf("public key parameter does not match the one obtained from the certificate")
+		}
+	}
+
+	// the stapled OCSP response must report the certificate as good
+	var ocspStatus *ParticipantOcspStatus
+	if request.OcspResponse != "" {
+		if ocspStatus, err = verifyParticipantOcsp(ctx, did, request.CertPem, request.IssuerID, request.OcspResponse); err != nil {
+			return nil, err
+		}
+	}
+
+	if request.Roles == nil {
+		// Use make to create an empty slice of string.
+		request.Roles = make([]string, 0)
+	}
+
+	// the roles can not break a static separation-of-duty rule
+	if err := ci.assertStaticSod(ctx, did, request.Roles); err != nil {
+		return nil, err
+	}
+
+	// the organization must be registered and active, and its quota not exceeded
+	if err := assertParticipantSlot(onboarding.organization, onboarding.mspID, did, onboarding.reserved); err != nil {
+		return nil, err
+	}
+
+	// Create Participant
+	identity := model.Participant{
+		DocType:     ParticipantDocType,
+		Did:         did,
+		PublicKey:   publicKey,
+		IssuerID:    request.IssuerID,
+		Creator:     "",
+		Roles:       request.Roles,
+		Attrs:       attrs,
+		AttrsExtras: make(map[string]string),
+		Time:        onboarding.txTimestamp,
+		IssuedTime:  issuedTime,
+		ExpiresTime: expiresTime,
+		Active:      true,
+		MspID:       onboarding.mspID,
+	}
+	// the issuer, and its ancestors, must be allowed to vouch for the participant
+	if issuer != nil {
+		if err := assertChainTrustPolicy(issuer.chain, participantGrant(&identity)); err != nil {
+			return nil, err
+		}
+	}
+	// the personal values are encrypted with the data key of the participant, see EraseParticipant
+	dataKey, err := transientDataKey(ctx, dataKeyField, onboarding.config.EncryptPersonalData)
+	if err != nil {
+		return nil, err
+	}
+	var dataKeyFingerprint string
+	if dataKey != nil {
+		if dataKeyFingerprint, err = assertDataKeyFree(ctx, dataKey); err != nil {
+			return nil, err
+		}
+		if keyDid, ok := onboarding.dataKeys[dataKeyFingerprint]; ok {
+			return nil, fmt.Errorf("the data key is already used by %s", keyDid)
+		}
+	}
+
+	onboarding.dids[did] = true
+	onboarding.fingerprints[fingerprint] = did
+	if dataKey != nil {
+		onboarding.dataKeys[dataKeyFingerprint] = did
+	}
+	onboarding.reserved++
+	return &participantDraft{
+		participant: identity,
+		fingerprint: fingerprint,
+		dataKey:     dataKey,
+		ocspStatus:  ocspStatus,
+	}, nil
+}
+
+// storeParticipant writes a validated participant, its public key, its data key and its indexes
+func storeParticipant(ctx contractapi.TransactionContextInterface, draft *participantDraft) error {
+	identity := draft.participant
+	if err := putPublicKeyIndex(ctx, draft.fingerprint, identity.Did); err != nil {
+		return err
+	}
+	if draft.dataKey != nil {
+		if err := putDataKey(ctx, identity.Did, draft.dataKey); err != nil {
+			return err
+		}
+	}
+	if err := encryptParticipant(ctx, draft.dataKey, &identity); err != nil {
+		return err
+	}
+
+	// compositeKey ID
+	compositeKeyID, err := ctx.GetStub().CreateCompositeKey(ParticipantDocType, []string{identity.Did})
+	if err != nil {
+		return err
+	}
+
+	// JSON encoding of identity, with the OCSP status verified for its certificate
+	identityEncode, _ := json.Marshal(participantDocument{Participant: identity, OcspStatus: draft.ocspStatus})
+	if err := putAudited(ctx, ParticipantDocType, identity.Did, compositeKeyID, identityEncode); err != nil {
+		return fmt.Errorf("failed to create identity: %v", err)
+	}
+	return indexParticipant(ctx, nil, &identity)
+}
@@ -1,38 +1,39 @@
 package identity
 
 import (
+	"crypto/x509"
 	"fmt"
-	"strings"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/jsondiff"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/keys"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/shred"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/statecache"
 	model "github.com/kmilodenisglez/model-identity-go/model"
 	modeltools "github.com/kmilodenisglez/model-identity-go/tools"
 	"log"
 )
 
-// Config
-// TODO: in a later version this configuration should be able to be managed in a decentralized way
-type Config struct {
-	AutogenerateDid bool `json:"autogenerateDid,omitempty" metadata:",optional"` // did is sent by the dapp, it is not generated by the chaincode
-}
-
-var config = Config{AutogenerateDid: false}
-
 // InitLedger adds a base set of data to the ledger
 func (ci *ContractIdentity) InitLedger(ctx contractapi.TransactionContextInterface) error {
 	log.Printf("[%s][InitLedger]", ctx.GetStub().GetChannelID())
-	// check if client-node is connected as admin
-	if err := lus.AssertAdmin(ctx); err != nil {
-		return fmt.Errorf(err.Error())
+	// bootstrap: the OU=admin client receives the admin capabilities of its MSP
+	if err := ci.bootstrapAdminRoles(ctx); err != nil {
+		return err
+	}
+	// register the MSP of the caller in the organization registry
+	if err := ci.registerOrganization(ctx); err != nil {
+		return err
 	}
+
 	accessIdentity := model.AccessCreateRequest{
 		ContractName:      ci.Name,                        // contract name
 		ContractFunctions: modeltools.GetTransactions(ci), // functions name
 	}
 
 	// create identity access
-	_, err := ci.CreateAccess(ctx, accessIdentity)
+	_, err := putAccess(ctx, accessIdentity)
 	if err != nil {
 		return err
 	}
@@ -41,118 +42,33 @@ func (ci *ContractIdentity) InitLedger(ctx contractapi.TransactionContextInterfa
 }
 
 // CreateParticipant
-func (ci *ContractIdentity) CreateParticipant(ctx contractapi.TransactionContextInterface, request model.ParticipantCreateRequest) (*model.ParticipantResponse, error) {
+func (ci *ContractIdentity) CreateParticipant(ctx contractapi.TransactionContextInterface, request StapledParticipantCreateRequest) (*model.ParticipantResponse, error) {
 	log.Printf("[%s][CreateParticipant]", ctx.GetStub().GetChannelID())
 
-	// check if client-node connected as admin
-	if err := lus.AssertAdmin(ctx); err != nil {
-		return nil, fmt.Errorf(err.Error())
-	}
-
-	// publicKey required
-	if request.PublicKey == "" {
-		return nil, fmt.Errorf(lus.ErrorRequiredParameter, "publicKey")
-	}
-
-	publicKey := request.PublicKey
-
-	// Get MSP ID of the client
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
-	if err != nil {
-		return nil, fmt.Errorf(lus.ErrorGetMSPID, err)
-	}
-
-	did := request.DID
-	if config.AutogenerateDid {
-		did, err = modeltools.CreateDid(request.PublicKey)
-		if err != nil {
-			return nil, err
-		}
-	} else if request.DID == "" {
-		return nil, fmt.Errorf(lus.ErrorRequiredParameter, "did")
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityIdentityAdmin); err != nil {
+		return nil, err
 	}
 
-	exist, err := ci.ParticipantExits(ctx, model.ParticipantGetRequest{Did: did})
+	onboarding, err := newParticipantOnboarding(ctx)
 	if err != nil {
 		return nil, err
 	}
-	if exist {
-		return nil, fmt.Errorf(lus.ErrorIdentityExists, did)
-	}
-
-	var issuedTime, expiresTime, attrs = "", "", model.Attrs{}
-
-	// getParticipant certificate attrs
-	if request.CertPem != "" {
-		// validate cert
-		certX509, err := lus.GetX509CertFromPem(request.CertPem)
-		if err != nil {
-			return nil, err
-		}
-		err = lus.HasExpired(certX509)
-		if err != nil {
-			return nil, err
-		}
-		// get dates
-		dateCert := lus.GetDateCertificate(certX509)
-		issuedTime = dateCert["issuedTime"]
-		expiresTime = dateCert["expiresTime"]
-
-		// get attrs
-		attrs = modeltools.GetAttrsCert(certX509)
-
-		// validating publicKey
-		certPublicKey, err := lus.GetPublicKey(certX509)
-		if err != nil {
-			return nil, err
-		}
-		if strings.Compare(certPublicKey, publicKey) != 0 {
-			return nil, fmt.Errorf("public key parameter does not match the one obtained from the certificate")
-		}
-	}
-
-	// timestamp when the transaction was created, have the same value across all endorsers
-	txTimestamp, err := lus.GetTxTimestampRFC3339(ctx.GetStub())
+	draft, err := ci.prepareParticipant(ctx, onboarding, request, TransientDataKey)
 	if err != nil {
 		return nil, err
 	}
-
-	if request.Roles == nil {
-		// Use make to create an empty slice of string.
-		request.Roles = make([]string, 0)
-	}
-
-	// Create Participant
-	identity := model.Participant{
-		DocType:     ParticipantDocType,
-		Did:         did,
-		PublicKey:   publicKey,
-		IssuerID:    request.IssuerID,
-		Creator:     "",
-		Roles:       request.Roles,
-		Attrs:       attrs,
-		AttrsExtras: make(map[string]string),
-		Time:        txTimestamp,
-		IssuedTime:  issuedTime,
-		ExpiresTime: expiresTime,
-		Active:      true,
-		MspID:       clientMSPID,
-	}
-	// compositeKey ID
-	compositeKeyID, err := ctx.GetStub().CreateCompositeKey(ParticipantDocType, []string{identity.Did})
-	if err != nil {
+	if err := storeParticipant(ctx, draft); err != nil {
 		return nil, err
 	}
-
-	// JSON encoding of identity
-	identityEncode, _ := json.Marshal(identity)
-	if err := ctx.GetStub().PutState(compositeKeyID, identityEncode); err != nil {
-		return nil, fmt.Errorf("failed to create identity: %v", err)
+	// the participant consumes a slot of its organization
+	if err := onboarding.commit(ctx); err != nil {
+		return nil, err
 	}
 
 	return &model.ParticipantResponse{
-		DID:     identity.Did,
-		Roles:   identity.Roles,
+		DID:     draft.participant.Did,
+		Roles:   draft.participant.Roles,
 		Creator: nil,
 	}, nil
 }
@@ -161,9 +77,9 @@ func (ci *ContractIdentity) CreateParticipant(ctx contractapi.TransactionContext
 // TODO: debug
 func (ci *ContractIdentity) DeleteParticipant(ctx contractapi.TransactionContextInterface, identityRequest model.ParticipantDeleteRequest) error {
 	log.Printf("[%s][DeleteParticipant]", ctx.GetStub().GetChannelID())
-	// check if client-node connected as admin
-	if err := lus.AssertAdmin(ctx); err != nil {
-		return fmt.Errorf(err.Error())
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityIdentityAdmin); err != nil {
+		return err
 	}
 
 	// Get the MSP ID of submitting client identity
@@ -172,8 +88,8 @@ func (ci *ContractIdentity) DeleteParticipant(ctx contractapi.TransactionContext
 		return fmt.Errorf(lus.ErrorGetMSPID, err)
 	}
 
-	// get user
-	userToRevoke, err := ci.GetParticipant(ctx, model.ParticipantGetRequest{Did: identityRequest.UserDid})
+	// get user, the stored document is kept in the tombstone
+	userToRevoke, err := findParticipant(ctx, identityRequest.UserDid)
 	if err != nil {
 		return fmt.Errorf("failed to get participant identity: %v", err)
 	}
@@ -205,14 +121,19 @@ func (ci *ContractIdentity) DeleteParticipant(ctx contractapi.TransactionContext
 		return err
 	}
 
-	err = ctx.GetStub().DelState(participantKey)
+	err = deleteAudited(ctx, ParticipantDocType, userToRevoke.Did, participantKey)
 	if err != nil {
 		return fmt.Errorf("failed to delete identity %s: %v", userToRevoke.Did, err)
 	}
+	if err := indexParticipant(ctx, userToRevoke, nil); err != nil {
+		return err
+	}
 
-	// index
-	deletedKey, err := ctx.GetStub().CreateCompositeKey(ObjectTypeParticipantDeleted, []string{Deleted, userToRevoke.Did})
-	if err != nil {
+	if err := releaseParticipantSlot(ctx, userToRevoke.MspID); err != nil {
+		return err
+	}
+	// the public key is free while the participant is deleted, RestoreParticipant binds it again
+	if err := unbindPublicKey(ctx, userToRevoke.Did, userToRevoke.PublicKey); err != nil {
 		return err
 	}
 
@@ -222,25 +143,24 @@ func (ci *ContractIdentity) DeleteParticipant(ctx contractapi.TransactionContext
 		return err
 	}
 
-	payload := &model.ParticipantDeletedPayload{
+	// tombstone with a frozen copy of the participant, see RestoreParticipant
+	return tombstoneParticipant(ctx, userToRevoke, model.ParticipantDeletedPayload{
 		MspID:    clientMSPID,
 		Time:     txTimestamp,
 		CallerID: callerID, // keep a record of the user who deleted the identity
-	}
-	// JSON encoding of payload
-	payloadJE, _ := json.Marshal(payload)
-
-	if err := ctx.GetStub().PutState(deletedKey, payloadJE); err != nil {
-		return fmt.Errorf("could not create deleted index %v: %v", deletedKey, err)
-	}
-	return err
+	})
 }
 
-func (ci *ContractIdentity) UpdateParticipant(ctx contractapi.TransactionContextInterface, request model.ParticipantUpdateRequest) error {
+func (ci *ContractIdentity) UpdateParticipant(ctx contractapi.TransactionContextInterface, request StapledParticipantUpdateRequest) error {
 	log.Printf("[%s][UpdateParticipant]", ctx.GetStub().GetChannelID())
 
-	// check if client-node connected as admin
-	if err := lus.AssertAdmin(ctx); err != nil {
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityIdentityAdmin); err != nil {
+		return err
+	}
+
+	config, err := getConfig(ctx)
+	if err != nil {
 		return err
 	}
 
@@ -250,28 +170,122 @@ func (ci *ContractIdentity) UpdateParticipant(ctx contractapi.TransactionContext
 		return fmt.Errorf(lus.ErrorRequiredParameter, "did")
 	}
 
-	identity, err := ci.GetParticipant(ctx, model.ParticipantGetRequest{Did: did})
+	// stored document, the personal values stay encrypted
+	identity, err := findParticipant(ctx, did)
 	if err != nil {
 		return err
 	} else if identity == nil {
 		return fmt.Errorf(lus.ErrorDefaultNotExist, did)
 	}
 
-	// compositeKey ID
-	compositeKeyID, err := ctx.GetStub().CreateCompositeKey(ParticipantDocType, []string{did})
+	// the admin capabilities are scoped to the MSP of the client
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
 	if err != nil {
-		return err
+		return fmt.Errorf(lus.ErrorGetMSPID, err)
+	}
+	if identity.MspID != clientMSPID {
+		return fmt.Errorf("client from org %v is not authorized to update an identity generated by the org %v", clientMSPID, identity.MspID)
 	}
 
-	valueToUpdate, err := lus.UpdateJSON(request, identity)
-	if err != nil {
+	// the new roles can not break a static separation-of-duty rule
+	if len(request.Roles) > 0 {
+		if err := ci.assertStaticSod(ctx, did, request.Roles); err != nil {
+			return err
+		}
+	}
+
+	// a new issuer must be registered and active, and it must have issued a certificate
+	// of the participant key
+	var issuerCert *x509.Certificate
+	if request.IssuerID != "" && request.IssuerID != identity.IssuerID {
+		if err := assertIssuerActive(ctx, request.IssuerID); err != nil {
+			return err
+		}
+		if request.CertPem == "" {
+			return fmt.Errorf("the certPem issued by %s is required to change the issuer of the participant", request.IssuerID)
+		}
+		if issuerCert, err = lus.GetX509CertFromPem(request.CertPem); err != nil {
+			return err
+		}
+		if err := lus.HasExpired(issuerCert); err != nil {
+			return err
+		}
+		if err := verifyIssuedBy(ctx, issuerCert, request.IssuerID); err != nil {
+			return err
+		}
+	}
+
+	publicKey := identity.PublicKey
+	if _, err := lus.UpdateJSON(request.ParticipantUpdateRequest, identity); err != nil {
 		return err
 	}
-	if err := ctx.GetStub().PutState(compositeKeyID, valueToUpdate); err != nil {
-		return fmt.Errorf(lus.ErrorUpdateIdentity, compositeKeyID)
+
+	// the certificate of the new issuer is of the key of the participant, rotated or not
+	if issuerCert != nil {
+		certPublicKey, err := lus.GetPublicKey(issuerCert)
+		if err != nil {
+			return err
+		}
+		if certPublicKey != identity.PublicKey {
+			return fmt.Errorf("public key of the participant does not match the one obtained from the certificate")
+		}
 	}
 
-	return nil
+	// key rotation, the index follows the new public key
+	if identity.PublicKey != publicKey {
+		if _, err := keys.ParseSPKIBase64(identity.PublicKey); err != nil {
+			return fmt.Errorf("invalid publicKey: %v", err)
+		}
+		if err := unbindPublicKey(ctx, did, publicKey); err != nil {
+			return err
+		}
+		if err := bindPublicKey(ctx, did, identity.PublicKey); err != nil {
+			return err
+		}
+	}
+
+	// the attested attributes must be allowed by the trust policy of the issuer
+	if identity.IssuerID != "" {
+		if err := assertTrustPolicy(ctx, identity.IssuerID, participantGrant(identity)); err != nil {
+			return err
+		}
+	}
+
+	// the stapled OCSP response must be of a certificate of the participant key, issued by its issuer
+	var ocspStatus *ParticipantOcspStatus
+	if request.OcspResponse != "" {
+		ocspStatus, err = verifyParticipantOcsp(ctx, did, request.CertPem, identity.IssuerID, request.OcspResponse)
+		if err != nil {
+			return err
+		}
+		certX509, err := lus.GetX509CertFromPem(request.CertPem)
+		if err != nil {
+			return err
+		}
+		if err := verifyIssuedBy(ctx, certX509, identity.IssuerID); err != nil {
+			return err
+		}
+		certPublicKey, err := lus.GetPublicKey(certX509)
+		if err != nil {
+			return err
+		}
+		if certPublicKey != identity.PublicKey {
+			return fmt.Errorf("public key of the participant does not match the one obtained from the certificate")
+		}
+	}
+
+	// the new personal values are encrypted, a participant without data key can receive one now
+	dataKey := getDataKey(ctx, did)
+	if dataKey == nil {
+		if dataKey, err = storeDataKey(ctx, did, false); err != nil {
+			return err
+		}
+	}
+	if err := encryptParticipant(ctx, dataKey, identity); err != nil {
+		return err
+	}
+
+	return putParticipant(ctx, identity, ocspStatus)
 }
 
 func (ci *ContractIdentity) GetParticipant(ctx contractapi.TransactionContextInterface, request model.ParticipantGetRequest) (*model.Participant, error) {
@@ -287,18 +301,51 @@ func (ci *ContractIdentity) GetParticipant(ctx contractapi.TransactionContextInt
 	if err != nil {
 		return nil, err
 	}
+	decryptParticipant(ctx, &identity)
 
 	return &identity, nil
 }
 
+// ParticipantHistoryRequest history of a participant
+type ParticipantHistoryRequest struct {
+	model.ParticipantGetRequest
+	HistoryOptions
+}
+
+// ParticipantHistoryRecord result of the history query, the record keeps the fields of
+// model.ParticipantQueryResponse and adds the rest of the participant. With the patch
+// option the record is replaced by the JSON Patch from the previous version
+type ParticipantHistoryRecord struct {
+	TxID     string                   `json:"txID"`
+	Record   *ParticipantHistoryEntry `json:"record,omitempty" metadata:",optional"`
+	Patch    []jsondiff.Operation     `json:"patch,omitempty" metadata:",optional"`
+	Creator  *HistoryCreator          `json:"creator,omitempty" metadata:",optional"`
+	Time     string                   `json:"time"`
+	IsDelete bool                     `json:"isDelete"`
+}
+
+// ParticipantHistoryEntry participant at a point of its history, the personal values
+// are decrypted, or redacted if the participant was erased
+type ParticipantHistoryEntry struct {
+	ParticipantID string `json:"participantID"`
+	model.Participant
+}
+
+// ParticipantHistoryResponse page of the history of a participant, the newest version first
+type ParticipantHistoryResponse struct {
+	Records             []ParticipantHistoryRecord `json:"records"`
+	FetchedRecordsCount int32                      `json:"fetchedRecordsCount"`
+	Bookmark            string                     `json:"bookmark"`
+}
+
 // GetParticipantHistory returns the chain of custody for an identity since issuance
 //
 // Arguments:
-//		0: model_api.ParticipantGetRequest
+//		0: ParticipantHistoryRequest
 // Returns:
-//		0: []model_api.ParticipantHistoryQueryResponse
+//		0: ParticipantHistoryResponse
 //		1: error
-func (ci *ContractIdentity) GetParticipantHistory(ctx contractapi.TransactionContextInterface, request model.ParticipantGetRequest) ([]model.ParticipantHistoryQueryResponse, error) {
+func (ci *ContractIdentity) GetParticipantHistory(ctx contractapi.TransactionContextInterface, request ParticipantHistoryRequest) (*ParticipantHistoryResponse, error) {
 	log.Printf("GetParticipantHistory: ID %v", request.Did)
 
 	identity, err := ci.GetParticipant(ctx, model.ParticipantGetRequest{Did: request.Did})
@@ -313,77 +360,83 @@ func (ci *ContractIdentity) GetParticipantHistory(ctx contractapi.TransactionCon
 	if err != nil {
 		return nil, err
 	}
-	resultsIterator, err := ctx.GetStub().GetHistoryForKey(compositeKeyID)
-	if err != nil {
-		return nil, err
-	}
-	defer resultsIterator.Close()
 
-	var records []model.ParticipantHistoryQueryResponse
-	for resultsIterator.HasNext() {
-		response, err := resultsIterator.Next()
-		if err != nil {
+	// the data key is read once, the erased participants have redacted history
+	dataKey := getDataKey(ctx, identity.Did)
+
+	versions, bookmark, err := historyPage(ctx, ParticipantDocType, identity.Did, compositeKeyID, request.HistoryOptions, func(value []byte) (interface{}, error) {
+		entry := &ParticipantHistoryEntry{}
+		entry.ParticipantID = request.Did
+		if err := json.Unmarshal(value, entry); err != nil {
 			return nil, err
 		}
-
-		identity := model.ParticipantQueryResponse{}
-		identity.ParticipantID = request.Did
-		if len(response.Value) > 0 {
-			err = json.Unmarshal(response.Value, &identity)
+		_ = mapPersonalValues(&entry.Participant, func(_, value string) (string, error) {
+			plain, err := shred.Decrypt(dataKey, value)
 			if err != nil {
-				return nil, err
+				return shred.Redacted, nil
 			}
-		}
-
-		timestamp := modeltools.GetTimestampRFC3339(response.Timestamp)
+			return plain, nil
+		})
+		return entry, nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		record := model.ParticipantHistoryQueryResponse{
-			TxID:     response.TxId,
-			Time:     timestamp,
-			Record:   &identity,
-			IsDelete: response.IsDelete,
+	var records = make([]ParticipantHistoryRecord, 0, len(versions))
+	for _, version := range versions {
+		record := ParticipantHistoryRecord{
+			TxID:     version.TxID,
+			Patch:    version.Patch,
+			Creator:  version.Creator,
+			Time:     version.Time,
+			IsDelete: version.IsDelete,
+		}
+		if entry, ok := version.Record.(*ParticipantHistoryEntry); ok {
+			record.Record = entry
+		} else if !request.Patch {
+			// the deletes keep the DID of the participant
+			record.Record = &ParticipantHistoryEntry{ParticipantID: request.Did}
 		}
 		records = append(records, record)
 	}
-
-	return records, nil
+	return &ParticipantHistoryResponse{
+		Records:             records,
+		FetchedRecordsCount: int32(len(records)),
+		Bookmark:            bookmark,
+	}, nil
 }
 
-// GetParticipants get all identity
+// GetParticipants get a page of the participants, in DID order
 //
 // Arguments:
-//		0: request model.RichQuerySelector
+//		0: ListRequest
 // Returns:
-//		0: *model.PaginatedQueryResponse
+//		0: ParticipantsResponse
 //		1: error
-func (ci *ContractIdentity) GetParticipants(ctx contractapi.TransactionContextInterface, request model.QueryPaginator) (*model.PaginatedQueryResponse, error) {
+func (ci *ContractIdentity) GetParticipants(ctx contractapi.TransactionContextInterface, request ListRequest) (*ParticipantsResponse, error) {
 	log.Printf("[%s][GetParticipants]", ctx.GetStub().GetChannelID())
 
-	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(ParticipantDocType, []string{}, int32(request.PageSize), request.Bookmark)
+	records, bookmark, err := listPage(ctx, ParticipantDocType, []string{}, request, listFields(ParticipantDocType), func(_ string, value []byte) (interface{}, error) {
+		var participant model.Participant
+		if err := json.Unmarshal(value, &participant); err != nil {
+			return nil, err
+		}
+		return &participant, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer resultsIterator.Close()
 
-	var items = make([]interface{}, 0)
-	for resultsIterator.HasNext() {
-		responseRange, err := resultsIterator.Next()
-		if responseRange == nil {
-			return nil, err
-		}
-
-		var identity model.ParticipantResponse
-		err = json.Unmarshal(responseRange.Value, &identity)
-		if err != nil {
-			return nil, err
-		}
-		items = append(items, identity)
+	var items = make([]model.ParticipantResponse, 0, len(records))
+	for _, record := range records {
+		participant := record.(*model.Participant)
+		items = append(items, model.ParticipantResponse{DID: participant.Did, Roles: participant.Roles})
 	}
-
-	return &model.PaginatedQueryResponse{
+	return &ParticipantsResponse{
 		Records:             items,
-		FetchedRecordsCount: responseMetadata.FetchedRecordsCount,
-		Bookmark:            responseMetadata.Bookmark,
+		FetchedRecordsCount: int32(len(items)),
+		Bookmark:            bookmark,
 	}, nil
 }
 
@@ -415,22 +468,29 @@ func (ci *ContractIdentity) GetParticipantRoles(ctx contractapi.TransactionConte
 		return nil, err
 	}
 
-	var items = make([]model.RoleResponse, 0)
-	// I remove variable address: &docRequest is constant and does not change during the loop iteration
-	// See golang.org/doc/faq#closures_and_goroutines
-	// See https://stackoverflow.com/questions/62446118/implicit-memory-aliasing-in-for-loop/68247837
+	// the roles are read in one request
+	roleKeys := make([]string, 0, len(identityRoles.Roles))
 	for _, rolID := range identityRoles.Roles {
 		key, err := ctx.GetStub().CreateCompositeKey(RoleDocType, []string{rolID})
 		if err != nil {
 			return nil, err
 		}
-		state, err := ctx.GetStub().GetState(key)
-		if err != nil {
-			return nil, err
-		} else if state == nil {
+		roleKeys = append(roleKeys, key)
+	}
+	states, err := statecache.GetMultipleStates(ctx.GetStub(), roleKeys...)
+	if err != nil {
+		return nil, err
+	}
+
+	var items = make([]model.RoleResponse, 0)
+	for _, state := range states {
+		if state == nil {
 			// los roles que no existan son omitidos
 			continue
 		}
+		if state, err = migrateDocument(RoleDocType, state); err != nil {
+			return nil, err
+		}
 		var role model.Role
 		err = json.Unmarshal(state, &role)
 		if err != nil {
@@ -455,7 +515,7 @@ func (ci *ContractIdentity) getParticipant(ctx contractapi.TransactionContextInt
 		return nil, err
 	}
 
-	identityBytes, err := ctx.GetStub().GetState(compositeKeyID)
+	identityBytes, err := getDocument(ctx, ParticipantDocType, compositeKeyID)
 	if err != nil {
 		return nil, fmt.Errorf(lus.ErrorGetIdentity, compositeKeyID)
 	} else if identityBytes == nil {
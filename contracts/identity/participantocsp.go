@@ -0,0 +1,139 @@
+package identity
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	"log"
+)
+
+// StapledParticipantCreateRequest create a participant, the client can staple an OCSP response
+// of the certificate, the chaincode can not reach the OCSP responders. The contract schema
+// names the components by the type name, so it can not be named as model.ParticipantCreateRequest
+type StapledParticipantCreateRequest struct {
+	model.ParticipantCreateRequest
+	OcspResponse string `json:"ocspResponse,omitempty" metadata:",optional"` // base64 DER OCSP response of certPem, requires issuerID
+}
+
+// StapledParticipantUpdateRequest update a participant, the client can staple an OCSP response
+// of the certificate
+type StapledParticipantUpdateRequest struct {
+	model.ParticipantUpdateRequest
+	OcspResponse string `json:"ocspResponse,omitempty" metadata:",optional"` // base64 DER OCSP response of certPem
+}
+
+// participantDocument document of a participant, model.Participant with the last OCSP
+// status verified for its certificate
+type participantDocument struct {
+	model.Participant
+	OcspStatus *ParticipantOcspStatus `json:"ocspStatus,omitempty"`
+}
+
+// ParticipantOcspStatus last OCSP status verified for the certificate of a participant,
+// it is stored in the document of the participant
+type ParticipantOcspStatus struct {
+	Did          string `json:"did"`
+	IssuerID     string `json:"issuerId"`
+	SerialNumber string `json:"serialNumber"` // of the certificate
+	Status       string `json:"status"`
+	ThisUpdate   string `json:"thisUpdate"`
+	NextUpdate   string `json:"nextUpdate,omitempty" metadata:",optional"`
+	ProducedAt   string `json:"producedAt"`
+	VerifiedTime string `json:"verifiedTime"` // transaction timestamp
+	TxID         string `json:"txId"`
+}
+
+// GetParticipantOcspStatus get the last OCSP status verified for a participant
+//
+// Arguments:
+//		0: ParticipantGetRequest
+// Returns:
+//		0: ParticipantOcspStatus
+//		1: error
+func (ci *ContractIdentity) GetParticipantOcspStatus(ctx contractapi.TransactionContextInterface, request model.ParticipantGetRequest) (*ParticipantOcspStatus, error) {
+	log.Printf("[%s][GetParticipantOcspStatus]", ctx.GetStub().GetChannelID())
+
+	document, err := getParticipantDocument(ctx, request.Did)
+	if err != nil {
+		return nil, err
+	} else if document == nil {
+		return nil, fmt.Errorf(lus.ErrorDefaultNotExist, request.Did)
+	} else if document.OcspStatus == nil {
+		return nil, fmt.Errorf("no OCSP status verified for the participant %s", request.Did)
+	}
+	return document.OcspStatus, nil
+}
+
+// getParticipantDocument returns the stored document of the participant, nil if it
+// does not exist
+func getParticipantDocument(ctx contractapi.TransactionContextInterface, did string) (*participantDocument, error) {
+	compositeKeyID, err := ctx.GetStub().CreateCompositeKey(ParticipantDocType, []string{did})
+	if err != nil {
+		return nil, err
+	}
+	documentJE, err := getDocument(ctx, ParticipantDocType, compositeKeyID)
+	if err != nil {
+		return nil, fmt.Errorf(lus.ErrorGetIdentity, compositeKeyID)
+	} else if documentJE == nil {
+		return nil, nil
+	}
+	var document participantDocument
+	if err := json.Unmarshal(documentJE, &document); err != nil {
+		return nil, err
+	}
+	return &document, nil
+}
+
+// verifyParticipantOcsp verifies the OCSP response of the participant certificate against
+// the certificate of the issuer, at the transaction time
+func verifyParticipantOcsp(ctx contractapi.TransactionContextInterface, did, certPem, issuerID, ocspResponse string) (*ParticipantOcspStatus, error) {
+	if certPem == "" {
+		return nil, fmt.Errorf(lus.ErrorRequiredParameter, "certPem")
+	}
+	if issuerID == "" {
+		return nil, fmt.Errorf(lus.ErrorRequiredParameter, "issuerID")
+	}
+	cert, err := lus.GetX509CertFromPem(certPem)
+	if err != nil {
+		return nil, err
+	}
+	issuer, err := getIssuer(ctx, issuerID)
+	if err != nil {
+		return nil, err
+	}
+	issuerCert, err := lus.GetX509CertFromPem(issuer.CertPem)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate of the issuer %s: %v", issuerID, err)
+	}
+
+	txTimestamp, err := lus.GetTxTimestampRFC3339(ctx.GetStub())
+	if err != nil {
+		return nil, err
+	}
+	txTime, err := lus.ParseRFC3339toTime(txTimestamp)
+	if err != nil {
+		return nil, err
+	}
+	response, err := lus.VerifyOCSPResponse(ocspResponse, cert, issuerCert, txTime)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &ParticipantOcspStatus{
+		Did:          did,
+		IssuerID:     issuerID,
+		SerialNumber: cert.SerialNumber.String(),
+		Status:       lus.OCSPStatus(response.Status),
+		ThisUpdate:   response.ThisUpdate.Format(time.RFC3339),
+		ProducedAt:   response.ProducedAt.Format(time.RFC3339),
+		VerifiedTime: txTimestamp,
+		TxID:         ctx.GetStub().GetTxID(),
+	}
+	if !response.NextUpdate.IsZero() {
+		status.NextUpdate = response.NextUpdate.Format(time.RFC3339)
+	}
+	return status, nil
+}
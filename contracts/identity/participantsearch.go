@@ -0,0 +1,462 @@
+package identity
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/query"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	"log"
+)
+
+// State databases of the peer, see Config.StateDatabase
+const (
+	StateDatabaseCouchDB = "couchdb"
+	StateDatabaseLevelDB = "leveldb"
+)
+
+// names of the secondary indexes of the participants, ObjectTypeParticipantBy~name~value~did
+const (
+	participantByIssuer  = "issuerId"
+	participantByRole    = "role"
+	participantByMsp     = "mspID"
+	participantByExpires = "expiresMonth"
+	participantByActive  = "active"
+)
+
+// expiresMonthLayout month of the expiresMonth filter and index
+const expiresMonthLayout = "2006-01"
+
+// ParticipantSearchRequest search of participants, the filters are combined with AND
+// and at least one is required
+type ParticipantSearchRequest struct {
+	MspID        string `json:"mspID,omitempty" metadata:",optional"`
+	IssuerID     string `json:"issuerId,omitempty" metadata:",optional"`
+	Role         string `json:"role,omitempty" metadata:",optional"`
+	Active       string `json:"active,omitempty" metadata:",optional"`       // true or false
+	ExpiresMonth string `json:"expiresMonth,omitempty" metadata:",optional"` // YYYY-MM, UTC
+	PageSize     int    `json:"pageSize"`
+	Bookmark     string `json:"bookmark,omitempty" metadata:",optional"` // of the previous page, see SearchParticipants
+}
+
+// ParticipantSearchResponse page of participants
+type ParticipantSearchResponse struct {
+	Records             []model.Participant `json:"records"`
+	FetchedRecordsCount int32               `json:"fetchedRecordsCount"`
+	Bookmark            string              `json:"bookmark"`
+	StateDatabase       string              `json:"stateDatabase"` // couchdb, rich query, or leveldb, secondary composite keys
+}
+
+// IssuerSearchRequest search of issuers, empty filters match every issuer
+type IssuerSearchRequest struct {
+	Active       string `json:"active,omitempty" metadata:",optional"`       // true or false
+	ExpiresMonth string `json:"expiresMonth,omitempty" metadata:",optional"` // YYYY-MM, UTC
+	ParentID     string `json:"parentId,omitempty" metadata:",optional"`
+	PageSize     int    `json:"pageSize"`
+	Bookmark     string `json:"bookmark,omitempty" metadata:",optional"` // last issuer ID of the previous page
+}
+
+// IssuerSearchResponse page of issuers
+type IssuerSearchResponse struct {
+	Records             []model.IssuerQueryResponse `json:"records"`
+	FetchedRecordsCount int32                       `json:"fetchedRecordsCount"`
+	Bookmark            string                      `json:"bookmark"`
+}
+
+// IndexRebuildResponse page of participants whose secondary indexes were written
+type IndexRebuildResponse struct {
+	FetchedRecordsCount int32  `json:"fetchedRecordsCount"`
+	Bookmark            string `json:"bookmark"`
+}
+
+// SearchParticipants searches the participants by MSP, issuer, role, active flag and
+// expiry month. It uses a rich query on CouchDB and the secondary composite keys of
+// the participants on LevelDB, or when no CouchDB index covers the filters, so the
+// same participants are found on both state databases.
+//
+// The bookmarks of the two paths are not compatible: the rich query returns the opaque
+// bookmark of CouchDB and the composite keys the last DID of the page, both ordered
+// differently. The StateDatabase of the response tells the path of its bookmark, a DID
+// bookmark continues on the composite keys and a CouchDB bookmark is rejected by them,
+// so a search started before the state database or the indexes change is restarted
+//
+// Arguments:
+//		0: ParticipantSearchRequest
+// Returns:
+//		0: ParticipantSearchResponse
+//		1: error
+func (ci *ContractIdentity) SearchParticipants(ctx contractapi.TransactionContextInterface, request ParticipantSearchRequest) (*ParticipantSearchResponse, error) {
+	log.Printf("[%s][SearchParticipants]", ctx.GetStub().GetChannelID())
+
+	if request.MspID == "" && request.IssuerID == "" && request.Role == "" && request.Active == "" && request.ExpiresMonth == "" {
+		return nil, fmt.Errorf("at least one filter is required")
+	}
+	if err := validateSearch(request.Active, request.ExpiresMonth, request.PageSize); err != nil {
+		return nil, err
+	}
+
+	config, err := getConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var response *ParticipantSearchResponse
+	if config.StateDatabase != StateDatabaseLevelDB && !isDidBookmark(request.Bookmark) {
+		response, err = searchParticipantsRich(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if response == nil {
+		if response, err = searchParticipantsByKey(ctx, request); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range response.Records {
+		decryptParticipant(ctx, &response.Records[i])
+	}
+	return response, nil
+}
+
+// SearchIssuers searches the issuers by active flag, expiry month and parent. The issuers
+// are few and the documents of the first versions have no active flag, they are always
+// read through their composite keys, on both state databases
+//
+// Arguments:
+//		0: IssuerSearchRequest
+// Returns:
+//		0: IssuerSearchResponse
+//		1: error
+func (ci *ContractIdentity) SearchIssuers(ctx contractapi.TransactionContextInterface, request IssuerSearchRequest) (*IssuerSearchResponse, error) {
+	log.Printf("[%s][SearchIssuers]", ctx.GetStub().GetChannelID())
+
+	if err := validateSearch(request.Active, request.ExpiresMonth, request.PageSize); err != nil {
+		return nil, err
+	}
+
+	// ordered by ID, the key of the issuers
+	issuers, err := getIssuers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	response := &IssuerSearchResponse{Records: make([]model.IssuerQueryResponse, 0)}
+	for _, issuer := range issuers {
+		if request.Bookmark != "" && issuer.ID <= request.Bookmark {
+			continue
+		}
+		if request.Active != "" && strconv.FormatBool(issuer.Active) != request.Active {
+			continue
+		}
+		if request.ExpiresMonth != "" && expiresMonth(issuer.ExpiresTime) != request.ExpiresMonth {
+			continue
+		}
+		if request.ParentID != "" && issuer.ParentID != request.ParentID {
+			continue
+		}
+		if len(response.Records) == request.PageSize {
+			response.Bookmark = response.Records[len(response.Records)-1].ID
+			break
+		}
+		response.Records = append(response.Records, *issuer.response())
+	}
+	response.FetchedRecordsCount = int32(len(response.Records))
+	return response, nil
+}
+
+// RebuildParticipantIndexes writes the secondary composite keys of a page of
+// participants, the participants created before the indexes existed are not found
+// by SearchParticipants on LevelDB until their indexes are rebuilt
+//
+// Arguments:
+//		0: QueryPaginator
+// Returns:
+//		0: IndexRebuildResponse
+//		1: error
+func (ci *ContractIdentity) RebuildParticipantIndexes(ctx contractapi.TransactionContextInterface, request model.QueryPaginator) (*IndexRebuildResponse, error) {
+	log.Printf("[%s][RebuildParticipantIndexes]", ctx.GetStub().GetChannelID())
+
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityIdentityAdmin); err != nil {
+		return nil, err
+	}
+	if request.PageSize < 1 || request.PageSize > query.MaxPageSize {
+		return nil, fmt.Errorf("pageSize must be between 1 and %d", query.MaxPageSize)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(ParticipantDocType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	response := &IndexRebuildResponse{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		participantJE, err := migrateDocument(ParticipantDocType, responseRange.Value)
+		if err != nil {
+			return nil, err
+		}
+		var participant model.Participant
+		if err := json.Unmarshal(participantJE, &participant); err != nil {
+			return nil, err
+		}
+		// the bookmark is the last DID of the previous page
+		if request.Bookmark != "" && participant.Did <= request.Bookmark {
+			continue
+		}
+		if int(response.FetchedRecordsCount) == request.PageSize {
+			return response, nil
+		}
+		if err := indexParticipant(ctx, nil, &participant); err != nil {
+			return nil, err
+		}
+		response.FetchedRecordsCount++
+		response.Bookmark = participant.Did
+	}
+	response.Bookmark = ""
+	return response, nil
+}
+
+// participantSearchQuery the rich query of the search request
+func participantSearchQuery(request ParticipantSearchRequest) query.Query {
+	q := query.Query{
+		DocType:  ParticipantDocType,
+		Fields:   []string{"did"},
+		PageSize: request.PageSize,
+		Bookmark: request.Bookmark,
+	}
+	if request.MspID != "" {
+		q.Where = append(q.Where, query.Predicate{Field: "mspID", Op: query.OpEq, Value: request.MspID})
+	}
+	if request.IssuerID != "" {
+		q.Where = append(q.Where, query.Predicate{Field: "issuerId", Op: query.OpEq, Value: request.IssuerID})
+	}
+	if request.Role != "" {
+		q.Where = append(q.Where, query.Predicate{Field: "roles", Op: query.OpElemMatch, Value: request.Role})
+	}
+	if request.Active != "" {
+		q.Where = append(q.Where, query.Predicate{Field: "active", Op: query.OpEq, Value: request.Active})
+	}
+	if request.ExpiresMonth != "" {
+		from, _ := time.Parse(expiresMonthLayout, request.ExpiresMonth)
+		q.Where = append(q.Where,
+			query.Predicate{Field: "expiresTime", Op: query.OpGte, Value: from.Format(time.RFC3339)},
+			query.Predicate{Field: "expiresTime", Op: query.OpLt, Value: from.AddDate(0, 1, 0).Format(time.RFC3339)},
+		)
+	}
+	return q
+}
+
+// searchParticipantsRich searches the participants with a rich query, nil if the state
+// database does not support rich queries or no index covers the filters
+func searchParticipantsRich(ctx contractapi.TransactionContextInterface, request ParticipantSearchRequest) (*ParticipantSearchResponse, error) {
+	compiled, err := compileQuery(participantSearchQuery(request))
+	if err != nil {
+		// the secondary composite keys cover every filter
+		log.Printf("[%s][SearchParticipants] %v, using the composite keys", ctx.GetStub().GetChannelID(), err)
+		return nil, nil
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetQueryResultWithPagination(compiled.QueryString, compiled.PageSize, compiled.Bookmark)
+	if err != nil {
+		if strings.Contains(err.Error(), "not supported for leveldb") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	response := &ParticipantSearchResponse{
+		Records:       make([]model.Participant, 0),
+		Bookmark:      responseMetadata.Bookmark,
+		StateDatabase: StateDatabaseCouchDB,
+	}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var item struct {
+			Did string `json:"did"`
+		}
+		if err := json.Unmarshal(queryResult.Value, &item); err != nil {
+			return nil, err
+		}
+		participant, err := findParticipant(ctx, item.Did)
+		if err != nil {
+			return nil, err
+		} else if participant == nil {
+			continue
+		}
+		response.Records = append(response.Records, *participant)
+	}
+	response.FetchedRecordsCount = int32(len(response.Records))
+	return response, nil
+}
+
+// searchParticipantsByKey searches the participants with the most selective secondary
+// composite key of the filters, the other filters are checked on the documents. The
+// participants are ordered by DID and the bookmark is the last DID of the page
+func searchParticipantsByKey(ctx contractapi.TransactionContextInterface, request ParticipantSearchRequest) (*ParticipantSearchResponse, error) {
+	var attributes []string
+	switch {
+	case request.IssuerID != "":
+		attributes = []string{participantByIssuer, request.IssuerID}
+	case request.Role != "":
+		attributes = []string{participantByRole, request.Role}
+	case request.MspID != "":
+		attributes = []string{participantByMsp, request.MspID}
+	case request.ExpiresMonth != "":
+		attributes = []string{participantByExpires, request.ExpiresMonth}
+	default:
+		attributes = []string{participantByActive, request.Active}
+	}
+
+	if request.Bookmark != "" && !isDidBookmark(request.Bookmark) {
+		return nil, fmt.Errorf("invalid bookmark, it is not the last DID of a %s search", StateDatabaseLevelDB)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(ObjectTypeParticipantBy, attributes)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	response := &ParticipantSearchResponse{
+		Records:       make([]model.Participant, 0),
+		StateDatabase: StateDatabaseLevelDB,
+	}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
+		}
+		did := keyParts[len(keyParts)-1]
+		if request.Bookmark != "" && did <= request.Bookmark {
+			continue
+		}
+
+		participant, err := findParticipant(ctx, did)
+		if err != nil {
+			return nil, err
+		} else if participant == nil || !request.matches(participant) {
+			continue
+		}
+		if len(response.Records) == request.PageSize {
+			response.Bookmark = response.Records[len(response.Records)-1].Did
+			break
+		}
+		response.Records = append(response.Records, *participant)
+	}
+	response.FetchedRecordsCount = int32(len(response.Records))
+	return response, nil
+}
+
+// isDidBookmark returns true if the bookmark is the last DID of a page of the composite
+// keys, the CouchDB bookmarks are base64
+func isDidBookmark(bookmark string) bool {
+	return strings.HasPrefix(bookmark, "did:")
+}
+
+// matches returns true if the stored participant matches every filter of the request
+func (request *ParticipantSearchRequest) matches(participant *model.Participant) bool {
+	if request.MspID != "" && participant.MspID != request.MspID {
+		return false
+	}
+	if request.IssuerID != "" && participant.IssuerID != request.IssuerID {
+		return false
+	}
+	if request.Role != "" && !lus.Contains(participant.Roles, request.Role) {
+		return false
+	}
+	if request.Active != "" && strconv.FormatBool(participant.Active) != request.Active {
+		return false
+	}
+	if request.ExpiresMonth != "" && expiresMonth(participant.ExpiresTime) != request.ExpiresMonth {
+		return false
+	}
+	return true
+}
+
+// validateSearch checks the common filters of the searches
+func validateSearch(active, month string, pageSize int) error {
+	if active != "" && active != "true" && active != "false" {
+		return fmt.Errorf("invalid active %s, expected true or false", active)
+	}
+	if month != "" {
+		if _, err := time.Parse(expiresMonthLayout, month); err != nil {
+			return fmt.Errorf("invalid expiresMonth %s, expected YYYY-MM", month)
+		}
+	}
+	if pageSize < 1 || pageSize > query.MaxPageSize {
+		return fmt.Errorf("pageSize must be between 1 and %d", query.MaxPageSize)
+	}
+	return nil
+}
+
+// indexParticipant updates the secondary composite keys of a participant, previous is
+// nil for a new participant and current is nil for a deleted one
+func indexParticipant(ctx contractapi.TransactionContextInterface, previous, current *model.Participant) error {
+	previousKeys := participantIndexKeys(previous)
+	currentKeys := participantIndexKeys(current)
+
+	for key, attributes := range previousKeys {
+		if _, ok := currentKeys[key]; ok {
+			continue
+		}
+		if err := lus.DeleteIndex(ctx.GetStub(), ObjectTypeParticipantBy, attributes, false); err != nil {
+			return err
+		}
+	}
+	for key, attributes := range currentKeys {
+		if _, ok := previousKeys[key]; ok {
+			continue
+		}
+		if err := lus.CreateIndex(ctx.GetStub(), ObjectTypeParticipantBy, attributes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// participantIndexKeys attributes of the secondary composite keys of the participant
+func participantIndexKeys(participant *model.Participant) map[string][]string {
+	keys := make(map[string][]string)
+	if participant == nil {
+		return keys
+	}
+	add := func(name, value string) {
+		if value != "" {
+			keys[name+"\x00"+value] = []string{name, value, participant.Did}
+		}
+	}
+	add(participantByMsp, participant.MspID)
+	add(participantByIssuer, participant.IssuerID)
+	for _, role := range participant.Roles {
+		add(participantByRole, role)
+	}
+	add(participantByActive, strconv.FormatBool(participant.Active))
+	add(participantByExpires, expiresMonth(participant.ExpiresTime))
+	return keys
+}
+
+// expiresMonth UTC month of an RFC3339 time, empty if it is not valid
+func expiresMonth(rfc3339 string) string {
+	t, err := lus.ParseRFC3339toTime(rfc3339)
+	if err != nil {
+		return ""
+	}
+	return t.UTC().Format(expiresMonthLayout)
+}
@@ -0,0 +1,314 @@
+package identity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/shred"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	"log"
+)
+
+const (
+	// PersonalDataCollection private data collection that holds the data keys of the
+	// participants, see collections_config.json
+	PersonalDataCollection = "identityPersonalData"
+	// TransientDataKey transient field with the data key (32 random bytes) of a new participant
+	TransientDataKey = "dataKey"
+)
+
+// ParticipantErasure record of a crypto-shredded participant
+type ParticipantErasure struct {
+	DocType string `json:"docType"`
+	Did     string `json:"did"`
+	MspID   string `json:"mspID"` // mspID of the invoking client
+	Time    string `json:"time"`
+}
+
+// EraseParticipant honors a right-to-be-forgotten request: it purges the data key of
+// the participant from the private data collection, its private history included, so
+// its personal values can not be decrypted anymore, not even from the history of the
+// world state, and it redacts the current values. Works with deleted participants too.
+// The purge requires Fabric v2.5 peers.
+//
+// Arguments:
+//		0: ParticipantGetRequest
+// Returns:
+//		0: ParticipantErasure
+//		1: error
+func (ci *ContractIdentity) EraseParticipant(ctx contractapi.TransactionContextInterface, request model.ParticipantGetRequest) (*ParticipantErasure, error) {
+	log.Printf("[%s][EraseParticipant]", ctx.GetStub().GetChannelID())
+
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityIdentityAdmin); err != nil {
+		return nil, err
+	}
+
+	participant, err := findParticipant(ctx, request.Did)
+	if err != nil {
+		return nil, err
+	}
+	var deleted *DeletedParticipant
+	if participant == nil {
+		if deleted, err = ci.getDeletedParticipant(ctx, request.Did); err != nil {
+			return nil, err
+		}
+		participant = &deleted.Participant
+		participant.MspID = deleted.MspID
+	}
+	if err := assertSameMsp(ctx, participant.MspID); err != nil {
+		return nil, err
+	}
+
+	// a deleted key would still be readable from the private history of the peers
+	if err := ctx.GetStub().PurgePrivateData(PersonalDataCollection, request.Did); err != nil {
+		return nil, fmt.Errorf("failed to purge the data key of %s: %v", request.Did, err)
+	}
+
+	// the plain values of the participants created before the encryption are redacted too
+	_ = mapPersonalValues(participant, func(_, value string) (string, error) {
+		if value == "" {
+			return value, nil
+		}
+		return shred.Redacted, nil
+	})
+	if deleted != nil {
+		err = putDeletedParticipant(ctx, deleted)
+	} else {
+		err = putParticipant(ctx, participant, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// timestamp when the transaction was created, have the same value across all endorsers
+	txTimestamp, err := lus.GetTxTimestampRFC3339(ctx.GetStub())
+	if err != nil {
+		return nil, err
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf(lus.ErrorGetMSPID, err)
+	}
+	erasure := &ParticipantErasure{
+		DocType: ErasureDocType,
+		Did:     request.Did,
+		MspID:   clientMSPID,
+		Time:    txTimestamp,
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(ErasureDocType, []string{request.Did})
+	if err != nil {
+		return nil, err
+	}
+	// JSON encoding
+	erasureJE, _ := json.Marshal(erasure)
+	if err := putAudited(ctx, ErasureDocType, request.Did, key, erasureJE); err != nil {
+		return nil, fmt.Errorf("erasure of %s could not be stored: %v", request.Did, err)
+	}
+	return erasure, nil
+}
+
+// GetParticipantErasure get the erasure record of a participant
+func (ci *ContractIdentity) GetParticipantErasure(ctx contractapi.TransactionContextInterface, request model.ParticipantGetRequest) (*ParticipantErasure, error) {
+	log.Printf("[%s][GetParticipantErasure]", ctx.GetStub().GetChannelID())
+
+	key, err := ctx.GetStub().CreateCompositeKey(ErasureDocType, []string{request.Did})
+	if err != nil {
+		return nil, err
+	}
+	item, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf(lus.ErrorGetIdentity, request.Did)
+	} else if item == nil {
+		return nil, fmt.Errorf("participant %s is not erased", request.Did)
+	}
+
+	var erasure ParticipantErasure
+	if err = json.Unmarshal(item, &erasure); err != nil {
+		return nil, err
+	}
+	return &erasure, nil
+}
+
+// storeDataKey stores the data key sent in the transient map, it returns nil if
+// no key was sent and it is not required
+func storeDataKey(ctx contractapi.TransactionContextInterface, did string, required bool) ([]byte, error) {
+	key, err := transientDataKey(ctx, TransientDataKey, required)
+	if err != nil || key == nil {
+		return nil, err
+	}
+	if _, err := assertDataKeyFree(ctx, key); err != nil {
+		return nil, err
+	}
+	return key, putDataKey(ctx, did, key)
+}
+
+// transientDataKey returns the data key sent in the transient field, nil if it was not sent
+func transientDataKey(ctx contractapi.TransactionContextInterface, field string, required bool) ([]byte, error) {
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, err
+	}
+	key, ok := transient[field]
+	if !ok {
+		if required {
+			return nil, fmt.Errorf("the data key of the participant must be sent in the transient field %s", field)
+		}
+		return nil, nil
+	}
+	if len(key) != shred.KeySize {
+		return nil, fmt.Errorf("the data key must have %d bytes", shred.KeySize)
+	}
+	return key, nil
+}
+
+// putDataKey stores the data key of the participant and its fingerprint in the private
+// data collection
+func putDataKey(ctx contractapi.TransactionContextInterface, did string, key []byte) error {
+	if err := ctx.GetStub().PutPrivateData(PersonalDataCollection, did, key); err != nil {
+		return fmt.Errorf("failed to store the data key of %s: %v", did, err)
+	}
+	indexKey, err := ctx.GetStub().CreateCompositeKey(ObjectTypeParticipantDataKey, []string{dataKeyFingerprint(key)})
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutPrivateData(PersonalDataCollection, indexKey, []byte(did)); err != nil {
+		return fmt.Errorf("could not create data key index of %s: %v", did, err)
+	}
+	return nil
+}
+
+// assertDataKeyFree returns the fingerprint of the data key, it fails if the key was
+// given to another participant: the nonces are derived from the transaction ID, so two
+// participants of a transaction with the same key would reuse them. The fingerprint is
+// kept when the key is erased, an erased key must not decrypt the history again
+func assertDataKeyFree(ctx contractapi.TransactionContextInterface, key []byte) (string, error) {
+	fingerprint := dataKeyFingerprint(key)
+	indexKey, err := ctx.GetStub().CreateCompositeKey(ObjectTypeParticipantDataKey, []string{fingerprint})
+	if err != nil {
+		return "", err
+	}
+	// the hash can be read by the peers that are not members of the collection
+	hash, err := ctx.GetStub().GetPrivateDataHash(PersonalDataCollection, indexKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to get data key index: %v", err)
+	} else if hash != nil {
+		return "", fmt.Errorf("the data key is already used by another participant")
+	}
+	return fingerprint, nil
+}
+
+// dataKeyFingerprint hex SHA-256 of the data key
+func dataKeyFingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:])
+}
+
+// getDataKey returns the data key of the participant, or nil if it was erased, it
+// never existed or the peer is not a member of the collection
+func getDataKey(ctx contractapi.TransactionContextInterface, did string) []byte {
+	key, err := ctx.GetStub().GetPrivateData(PersonalDataCollection, did)
+	if err != nil {
+		log.Printf("[%s][getDataKey] data key of %s not available: %v", ctx.GetStub().GetChannelID(), did, err)
+		return nil
+	}
+	return key
+}
+
+// encryptParticipant encrypts the plain personal values of the participant, the
+// nonces are derived from the transaction ID and the field name
+func encryptParticipant(ctx contractapi.TransactionContextInterface, key []byte, participant *model.Participant) error {
+	if key == nil {
+		return nil
+	}
+	txID := ctx.GetStub().GetTxID()
+	return mapPersonalValues(participant, func(field, value string) (string, error) {
+		return shred.Encrypt(key, txID+field, value)
+	})
+}
+
+// decryptParticipant decrypts the personal values of the participant, the values
+// that can not be decrypted are redacted
+func decryptParticipant(ctx contractapi.TransactionContextInterface, participant *model.Participant) {
+	key := getDataKey(ctx, participant.Did)
+	_ = mapPersonalValues(participant, func(_, value string) (string, error) {
+		if key == nil {
+			return shred.Redact(value), nil
+		}
+		plain, err := shred.Decrypt(key, value)
+		if err != nil {
+			return shred.Redacted, nil
+		}
+		return plain, nil
+	})
+}
+
+// mapPersonalValues replaces every personal value of the participant with the result of fn
+func mapPersonalValues(participant *model.Participant, fn func(field, value string) (string, error)) error {
+	attrs := map[string]*string{
+		"attrs.name":               &participant.Attrs.Name,
+		"attrs.dni":                &participant.Attrs.DNI,
+		"attrs.company":            &participant.Attrs.Company,
+		"attrs.position":           &participant.Attrs.Position,
+		"attrs.country":            &participant.Attrs.Country,
+		"attrs.province":           &participant.Attrs.Province,
+		"attrs.locality":           &participant.Attrs.Locality,
+		"attrs.organizationalUnit": &participant.Attrs.OrganizationalUnit,
+	}
+	for field, value := range attrs {
+		result, err := fn(field, *value)
+		if err != nil {
+			return err
+		}
+		*value = result
+	}
+
+	names := make([]string, 0, len(participant.AttrsExtras))
+	for name := range participant.AttrsExtras {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		result, err := fn("attrsExtras."+name, participant.AttrsExtras[name])
+		if err != nil {
+			return err
+		}
+		participant.AttrsExtras[name] = result
+	}
+	return nil
+}
+
+// putParticipant stores the participant with the OCSP status verified in the transaction,
+// without one the previous status is kept while the public key does not change
+func putParticipant(ctx contractapi.TransactionContextInterface, participant *model.Participant, ocspStatus *ParticipantOcspStatus) error {
+	// the secondary indexes follow the stored document
+	previous, err := getParticipantDocument(ctx, participant.Did)
+	if err != nil {
+		return err
+	}
+	var previousParticipant *model.Participant
+	if previous != nil {
+		previousParticipant = &previous.Participant
+		if ocspStatus == nil && previous.PublicKey == participant.PublicKey {
+			ocspStatus = previous.OcspStatus
+		}
+	}
+	if err := indexParticipant(ctx, previousParticipant, participant); err != nil {
+		return err
+	}
+
+	compositeKeyID, err := ctx.GetStub().CreateCompositeKey(ParticipantDocType, []string{participant.Did})
+	if err != nil {
+		return err
+	}
+	// JSON encoding of identity
+	identityEncode, _ := json.Marshal(participantDocument{Participant: *participant, OcspStatus: ocspStatus})
+	if err := putAudited(ctx, ParticipantDocType, participant.Did, compositeKeyID, identityEncode); err != nil {
+		return fmt.Errorf(lus.ErrorUpdateIdentity, compositeKeyID)
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package identity
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/abac"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	"log"
+)
+
+// Policy ABAC policy of a contract function, evaluated by the authorization hook
+type Policy struct {
+	DocType     string    `json:"docType"`
+	ID          string    `json:"id"` // contract function name, ex: CreateIssuer
+	Description string    `json:"description,omitempty" metadata:",optional"`
+	Expr        abac.Expr `json:"expr"`
+	Time        string    `json:"time"`
+}
+
+// PolicySetRequest
+type PolicySetRequest struct {
+	Function    string    `json:"function"` // contract function name
+	Description string    `json:"description,omitempty" metadata:",optional"`
+	Expr        abac.Expr `json:"expr"`
+}
+
+// PolicyIdentity identity used to dry-run a policy
+type PolicyIdentity struct {
+	MspID   string `json:"mspID"`
+	CertPem string `json:"certPem,omitempty" metadata:",optional"` // b64 certificate PEM, source of the cert attributes
+	Did     string `json:"did,omitempty" metadata:",optional"`     // participant DID, source of the participant attributes
+}
+
+// PolicyEvaluateRequest evaluates the stored policy of Function, or Expr if it is set
+type PolicyEvaluateRequest struct {
+	Function string         `json:"function,omitempty" metadata:",optional"`
+	Expr     *abac.Expr     `json:"expr,omitempty" metadata:",optional"`
+	Identity PolicyIdentity `json:"identity"`
+}
+
+// PolicyEvaluateResponse
+type PolicyEvaluateResponse struct {
+	Function string   `json:"function,omitempty" metadata:",optional"`
+	Allowed  bool     `json:"allowed"`
+	Trace    []string `json:"trace"` // result of every evaluated condition
+}
+
+// SetPolicy create or replace the ABAC policy of a contract function
+//
+// Arguments:
+//		0: PolicySetRequest
+// Returns:
+//		0: Policy
+//		1: error
+func (ci *ContractIdentity) SetPolicy(ctx contractapi.TransactionContextInterface, request PolicySetRequest) (*Policy, error) {
+	log.Printf("[%s][SetPolicy]", ctx.GetStub().GetChannelID())
+
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityRoleAdmin); err != nil {
+		return nil, err
+	}
+
+	if request.Function == "" {
+		return nil, fmt.Errorf(lus.ErrorRequiredParameter, "function")
+	}
+	if err := request.Expr.Validate(); err != nil {
+		return nil, err
+	}
+
+	// timestamp when the transaction was created, have the same value across all endorsers
+	txTimestamp, err := lus.GetTxTimestampRFC3339(ctx.GetStub())
+	if err != nil {
+		return nil, err
+	}
+
+	function := lus.TransactionName(request.Function)
+	policy := &Policy{
+		DocType:     PolicyDocType,
+		ID:          function,
+		Description: request.Description,
+		Expr:        request.Expr,
+		Time:        txTimestamp,
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(PolicyDocType, []string{function})
+	if err != nil {
+		return nil, err
+	}
+	// JSON encoding
+	policyJE, err := json.Marshal(policy)
+	if err != nil {
+		return nil, err
+	}
+	if err := putAudited(ctx, PolicyDocType, function, key, policyJE); err != nil {
+		return nil, fmt.Errorf("policy for %s could not be stored: %v", function, err)
+	}
+	return policy, nil
+}
+
+// GetPolicy get the ABAC policy of a contract function
+//
+// Arguments:
+//		0: GetRequest, id is the function name
+// Returns:
+//		0: Policy
+//		1: error
+func (ci *ContractIdentity) GetPolicy(ctx contractapi.TransactionContextInterface, request model.GetRequest) (*Policy, error) {
+	log.Printf("[%s][GetPolicy]", ctx.GetStub().GetChannelID())
+
+	policy, err := getPolicy(ctx, request.ID)
+	if err != nil {
+		return nil, err
+	} else if policy == nil {
+		return nil, fmt.Errorf("no policy found for %s", request.ID)
+	}
+	return policy, nil
+}
+
+// GetPolicies get all ABAC policies
+func (ci *ContractIdentity) GetPolicies(ctx contractapi.TransactionContextInterface) ([]Policy, error) {
+	log.Printf("[%s][GetPolicies]", ctx.GetStub().GetChannelID())
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(PolicyDocType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var items = make([]Policy, 0)
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if responseRange == nil {
+			return nil, err
+		}
+
+		policyJE, err := migrateDocument(PolicyDocType, responseRange.Value)
+		if err != nil {
+			return nil, err
+		}
+		var policy Policy
+		if err = json.Unmarshal(policyJE, &policy); err != nil {
+			return nil, err
+		}
+		items = append(items, policy)
+	}
+	return items, nil
+}
+
+// DeletePolicy remove the ABAC policy of a contract function
+func (ci *ContractIdentity) DeletePolicy(ctx contractapi.TransactionContextInterface, request model.GetRequest) error {
+	log.Printf("[%s][DeletePolicy]", ctx.GetStub().GetChannelID())
+
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityRoleAdmin); err != nil {
+		return err
+	}
+
+	if _, err := ci.GetPolicy(ctx, request); err != nil {
+		return err
+	}
+	function := lus.TransactionName(request.ID)
+	key, err := ctx.GetStub().CreateCompositeKey(PolicyDocType, []string{function})
+	if err != nil {
+		return err
+	}
+	return deleteAudited(ctx, PolicyDocType, function, key)
+}
+
+// EvaluatePolicy dry-run of a policy against a given identity, nothing is written to the ledger
+//
+// Arguments:
+//		0: PolicyEvaluateRequest
+// Returns:
+//		0: PolicyEvaluateResponse
+//		1: error
+func (ci *ContractIdentity) EvaluatePolicy(ctx contractapi.TransactionContextInterface, request PolicyEvaluateRequest) (*PolicyEvaluateResponse, error) {
+	log.Printf("[%s][EvaluatePolicy]", ctx.GetStub().GetChannelID())
+
+	expr := request.Expr
+	if expr == nil {
+		if request.Function == "" {
+			return nil, fmt.Errorf(lus.ErrorRequiredParameter, "function or expr")
+		}
+		policy, err := ci.GetPolicy(ctx, model.GetRequest{ID: lus.TransactionName(request.Function)})
+		if err != nil {
+			return nil, err
+		}
+		expr = &policy.Expr
+	}
+
+	subject := abac.Subject{MspID: request.Identity.MspID, CertAttributes: make(map[string]string)}
+	if request.Identity.CertPem != "" {
+		certPem, err := base64.StdEncoding.DecodeString(request.Identity.CertPem)
+		if err != nil {
+			return nil, fmt.Errorf(lus.ErrorBase64)
+		}
+		attrs, err := lus.GetAttrsNonStandardCert(certPem)
+		if err != nil {
+			return nil, err
+		}
+		subject.CertAttributes = attrs
+	}
+	if request.Identity.Did != "" {
+		participant, err := ci.GetParticipant(ctx, model.ParticipantGetRequest{Did: request.Identity.Did})
+		if err != nil {
+			return nil, err
+		}
+		subject.ParticipantAttributes = participantAttributes(participant)
+	}
+
+	var trace = make([]string, 0)
+	allowed, err := abac.Evaluate(expr, subject, &trace)
+	if err != nil {
+		return nil, err
+	}
+	return &PolicyEvaluateResponse{
+		Function: request.Function,
+		Allowed:  allowed,
+		Trace:    trace,
+	}, nil
+}
+
+// getPolicy returns the policy of the function, or nil if it has none
+func getPolicy(ctx contractapi.TransactionContextInterface, function string) (*Policy, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(PolicyDocType, []string{function})
+	if err != nil {
+		return nil, err
+	}
+	item, err := getDocument(ctx, PolicyDocType, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy for %s: %v", function, err)
+	} else if item == nil {
+		return nil, nil
+	}
+
+	var policy Policy
+	if err = json.Unmarshal(item, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
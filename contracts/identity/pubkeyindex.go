@@ -0,0 +1,217 @@
+package identity
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	"log"
+)
+
+// PublicKeyIndex entry of the did.participant.pubkey index, binds the SHA-256 of the
+// SPKI of a public key to the only DID that can use it
+type PublicKeyIndex struct {
+	Fingerprint string `json:"fingerprint"`
+	Did         string `json:"did"`
+}
+
+// ParticipantPublicKeyRequest
+type ParticipantPublicKeyRequest struct {
+	PublicKey string `json:"publicKey"` // base64 SPKI (DER)
+}
+
+// PublicKeyDuplicate public key registered under more than one DID
+type PublicKeyDuplicate struct {
+	Fingerprint string   `json:"fingerprint"`
+	Dids        []string `json:"dids"`
+}
+
+// GetParticipantByPublicKey get the participant bound to a public key
+//
+// Arguments:
+//		0: ParticipantPublicKeyRequest
+// Returns:
+//		0: model.Participant
+//		1: error
+func (ci *ContractIdentity) GetParticipantByPublicKey(ctx contractapi.TransactionContextInterface, request ParticipantPublicKeyRequest) (*model.Participant, error) {
+	log.Printf("[%s][GetParticipantByPublicKey]", ctx.GetStub().GetChannelID())
+
+	fingerprint, err := lus.PublicKeyFingerprint(request.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	did, err := getPublicKeyDid(ctx, fingerprint)
+	if err != nil {
+		return nil, err
+	} else if did == "" {
+		return nil, fmt.Errorf("no participant found for the public key %s", fingerprint)
+	}
+	return ci.GetParticipant(ctx, model.ParticipantGetRequest{Did: did})
+}
+
+// GetPublicKeyDuplicates scans the participants and returns the public keys that are
+// registered under more than one DID, they were created before the index existed
+func (ci *ContractIdentity) GetPublicKeyDuplicates(ctx contractapi.TransactionContextInterface) ([]PublicKeyDuplicate, error) {
+	log.Printf("[%s][GetPublicKeyDuplicates]", ctx.GetStub().GetChannelID())
+
+	byFingerprint, err := participantsByFingerprint(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var items = make([]PublicKeyDuplicate, 0)
+	for fingerprint, dids := range byFingerprint {
+		if len(dids) > 1 {
+			items = append(items, PublicKeyDuplicate{Fingerprint: fingerprint, Dids: dids})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Fingerprint < items[j].Fingerprint })
+	return items, nil
+}
+
+// IndexParticipantPublicKeys adds the participants created before the index to it, the
+// duplicated public keys are not indexed and they are returned to be solved by hand
+func (ci *ContractIdentity) IndexParticipantPublicKeys(ctx contractapi.TransactionContextInterface) ([]PublicKeyDuplicate, error) {
+	log.Printf("[%s][IndexParticipantPublicKeys]", ctx.GetStub().GetChannelID())
+
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityIdentityAdmin); err != nil {
+		return nil, err
+	}
+
+	byFingerprint, err := participantsByFingerprint(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fingerprints := make([]string, 0, len(byFingerprint))
+	for fingerprint := range byFingerprint {
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	// sorted, the writes must be the same across all endorsers
+	sort.Strings(fingerprints)
+
+	var duplicates = make([]PublicKeyDuplicate, 0)
+	for _, fingerprint := range fingerprints {
+		dids := byFingerprint[fingerprint]
+		if len(dids) > 1 {
+			duplicates = append(duplicates, PublicKeyDuplicate{Fingerprint: fingerprint, Dids: dids})
+			continue
+		}
+		if err := putPublicKeyIndex(ctx, fingerprint, dids[0]); err != nil {
+			return nil, err
+		}
+	}
+	return duplicates, nil
+}
+
+// bindPublicKey adds the public key of the participant to the index, it fails
+// if the key is already bound to another DID
+func bindPublicKey(ctx contractapi.TransactionContextInterface, did, publicKey string) error {
+	fingerprint, err := assertPublicKeyFree(ctx, did, publicKey)
+	if err != nil {
+		return err
+	}
+	return putPublicKeyIndex(ctx, fingerprint, did)
+}
+
+// assertPublicKeyFree returns the fingerprint of the public key, it fails if the key
+// is bound to another DID
+func assertPublicKeyFree(ctx contractapi.TransactionContextInterface, did, publicKey string) (string, error) {
+	fingerprint, err := lus.PublicKeyFingerprint(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid public key: %v", err)
+	}
+	boundDid, err := getPublicKeyDid(ctx, fingerprint)
+	if err != nil {
+		return "", err
+	}
+	if boundDid != "" && boundDid != did {
+		return "", fmt.Errorf("the public key is already bound to %s", boundDid)
+	}
+	return fingerprint, nil
+}
+
+// unbindPublicKey removes the public key of the participant from the index, keys
+// that can not be parsed were never indexed
+func unbindPublicKey(ctx contractapi.TransactionContextInterface, did, publicKey string) error {
+	fingerprint, err := lus.PublicKeyFingerprint(publicKey)
+	if err != nil {
+		return nil
+	}
+	boundDid, err := getPublicKeyDid(ctx, fingerprint)
+	if err != nil {
+		return err
+	}
+	if boundDid != did {
+		return nil
+	}
+	return lus.DeleteIndex(ctx.GetStub(), ObjectTypeParticipantPubKey, []string{fingerprint}, true)
+}
+
+// getPublicKeyDid returns the DID bound to the fingerprint, or an empty string
+func getPublicKeyDid(ctx contractapi.TransactionContextInterface, fingerprint string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(ObjectTypeParticipantPubKey, []string{fingerprint})
+	if err != nil {
+		return "", err
+	}
+	item, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to get public key index %s: %v", fingerprint, err)
+	} else if item == nil {
+		return "", nil
+	}
+
+	var index PublicKeyIndex
+	if err = json.Unmarshal(item, &index); err != nil {
+		return "", err
+	}
+	return index.Did, nil
+}
+
+func putPublicKeyIndex(ctx contractapi.TransactionContextInterface, fingerprint, did string) error {
+	key, err := ctx.GetStub().CreateCompositeKey(ObjectTypeParticipantPubKey, []string{fingerprint})
+	if err != nil {
+		return err
+	}
+	// JSON encoding
+	indexJE, _ := json.Marshal(PublicKeyIndex{Fingerprint: fingerprint, Did: did})
+	if err := ctx.GetStub().PutState(key, indexJE); err != nil {
+		return fmt.Errorf("could not create public key index %v: %v", key, err)
+	}
+	return nil
+}
+
+// participantsByFingerprint groups the DIDs of the participants by public key, the
+// DIDs are sorted and the keys that can not be parsed are skipped
+func participantsByFingerprint(ctx contractapi.TransactionContextInterface) (map[string][]string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(ParticipantDocType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	byFingerprint := make(map[string][]string)
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if responseRange == nil {
+			return nil, err
+		}
+
+		var participant model.Participant
+		if err = json.Unmarshal(responseRange.Value, &participant); err != nil {
+			return nil, err
+		}
+		fingerprint, err := lus.PublicKeyFingerprint(participant.PublicKey)
+		if err != nil {
+			log.Printf("[%s][participantsByFingerprint] invalid public key of %s: %v", ctx.GetStub().GetChannelID(), participant.Did, err)
+			continue
+		}
+		byFingerprint[fingerprint] = append(byFingerprint[fingerprint], participant.Did)
+	}
+	for _, dids := range byFingerprint {
+		sort.Strings(dids)
+	}
+	return byFingerprint, nil
+}
@@ -0,0 +1,150 @@
+package identity
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/query"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	"log"
+)
+
+var (
+	eqOps    = []string{query.OpEq, query.OpNe, query.OpIn}
+	rangeOps = []string{query.OpEq, query.OpGt, query.OpGte, query.OpLt, query.OpLte}
+	boolOps  = []string{query.OpEq}
+)
+
+// queryCollections doc types that can be queried with QueryDocuments, the personal
+// values of the participants are encrypted and can not be queried.
+// Every index is shipped in META-INF/statedb/couchdb/indexes, run tools/indexcheck after
+// changing a collection or a query built by a transaction
+var queryCollections = map[string]*query.Collection{
+	ParticipantDocType: {
+		DocType: ParticipantDocType,
+		Fields: map[string]query.Field{
+			"did":         {Kind: query.String, Ops: eqOps},
+			"publicKey":   {Kind: query.String, Ops: []string{query.OpEq}},
+			"issuerId":    {Kind: query.String, Ops: append([]string{query.OpExists}, eqOps...)},
+			"creator":     {Kind: query.String},
+			"roles":       {Kind: query.StringArray, Ops: []string{query.OpElemMatch}},
+			"time":        {Kind: query.String, Ops: rangeOps, Sortable: true},
+			"issuedTime":  {Kind: query.String, Ops: rangeOps},
+			"expiresTime": {Kind: query.String, Ops: rangeOps, Sortable: true},
+			"active":      {Kind: query.Bool, Ops: boolOps},
+			"mspID":       {Kind: query.String, Ops: eqOps},
+		},
+		// there is no docType only index, a query can not scan every participant
+		Indexes: []query.Index{
+			{DesignDoc: "indexParticipantMspDoc", Name: "indexParticipantMsp", Fields: []string{"docType", "mspID"}},
+			{DesignDoc: "indexParticipantIssuerDoc", Name: "indexParticipantIssuer", Fields: []string{"docType", "issuerId"}},
+			{DesignDoc: "indexParticipantActiveDoc", Name: "indexParticipantActive", Fields: []string{"docType", "active"}},
+			{DesignDoc: "indexParticipantTimeDoc", Name: "indexParticipantTime", Fields: []string{"docType", "time"}},
+			{DesignDoc: "indexParticipantExpiresDoc", Name: "indexParticipantExpires", Fields: []string{"docType", "expiresTime"}},
+			{DesignDoc: "indexParticipantDidDoc", Name: "indexParticipantDid", Fields: []string{"docType", "did"}},
+			{DesignDoc: "indexParticipantPublicKeyDoc", Name: "indexParticipantPublicKey", Fields: []string{"docType", "publicKey"}},
+			{DesignDoc: "indexParticipantIssuedTimeDoc", Name: "indexParticipantIssuedTime", Fields: []string{"docType", "issuedTime"}},
+		},
+	},
+	IssuerDocType: {
+		DocType: IssuerDocType,
+		Fields: map[string]query.Field{
+			"id":          {Kind: query.String, Ops: eqOps},
+			"name":        {Kind: query.String, Ops: eqOps, Sortable: true},
+			"certPem":     {Kind: query.String},
+			"issuedTime":  {Kind: query.String, Ops: rangeOps},
+			"expiresTime": {Kind: query.String, Ops: rangeOps, Sortable: true},
+			"active":      {Kind: query.Bool, Ops: boolOps},
+			"byDefault":   {Kind: query.Bool, Ops: boolOps},
+			"parentId":    {Kind: query.String, Ops: append([]string{query.OpExists}, eqOps...)},
+		},
+		Indexes: []query.Index{
+			{DesignDoc: "indexIssuerDoc", Name: "indexIssuer", Fields: []string{"docType"}},
+			{DesignDoc: "indexIssuerNameDoc", Name: "indexIssuerName", Fields: []string{"docType", "name"}},
+			{DesignDoc: "indexIssuerExpiresDoc", Name: "indexIssuerExpires", Fields: []string{"docType", "expiresTime"}},
+		},
+	},
+	RoleDocType: {
+		DocType: RoleDocType,
+		Fields: map[string]query.Field{
+			"id":          {Kind: query.String, Ops: eqOps},
+			"name":        {Kind: query.String, Ops: eqOps, Sortable: true},
+			"description": {Kind: query.String},
+		},
+		Indexes: []query.Index{
+			{DesignDoc: "indexRoleDoc", Name: "indexRole", Fields: []string{"docType"}},
+			{DesignDoc: "indexRoleNameDoc", Name: "indexRoleName", Fields: []string{"docType", "name"}},
+		},
+	},
+	AccessDocType: {
+		DocType: AccessDocType,
+		Fields: map[string]query.Field{
+			"id":          {Kind: query.String, Ops: eqOps},
+			"description": {Kind: query.String},
+		},
+		Indexes: []query.Index{
+			{DesignDoc: "indexAccessDoc", Name: "indexAccess", Fields: []string{"docType"}},
+		},
+	},
+	OrganizationDocType: {
+		DocType: OrganizationDocType,
+		Fields: map[string]query.Field{
+			"mspID":            {Kind: query.String, Ops: eqOps},
+			"displayName":      {Kind: query.String, Ops: []string{query.OpEq}},
+			"didMethod":        {Kind: query.String, Ops: eqOps},
+			"participantCount": {Kind: query.Number, Ops: rangeOps},
+			"maxParticipants":  {Kind: query.Number, Ops: rangeOps},
+			"status":           {Kind: query.String, Ops: eqOps},
+			"time":             {Kind: query.String, Ops: rangeOps},
+		},
+		Indexes: []query.Index{
+			{DesignDoc: "indexOrganizationDoc", Name: "indexOrganization", Fields: []string{"docType"}},
+		},
+	},
+}
+
+// QueryDocuments runs a typed query of a doc type. Only the whitelisted fields,
+// operators and sort keys are allowed, and the query must use a shipped index.
+// Ex: {"docType":"did.participant","where":[{"field":"mspID","op":"$eq","value":"Org1MSP"}],"pageSize":10}
+//
+// Arguments:
+//		0: query.Query
+// Returns:
+//		0: model.PaginatedQueryResponse
+//		1: error
+func (ci *ContractIdentity) QueryDocuments(ctx contractapi.TransactionContextInterface, request query.Query) (*model.PaginatedQueryResponse, error) {
+	log.Printf("[%s][QueryDocuments]", ctx.GetStub().GetChannelID())
+
+	compiled, err := compileQuery(request)
+	if err != nil {
+		return nil, err
+	}
+	return lus.GetQueryResultForQueryStringWithPagination(ctx, compiled.QueryString, compiled.PageSize, compiled.Bookmark)
+}
+
+// compileQuery compiles the query with the collection of its doc type
+func compileQuery(request query.Query) (*query.Compiled, error) {
+	collection, ok := queryCollections[request.DocType]
+	if !ok {
+		return nil, fmt.Errorf("doc type %s can not be queried", request.DocType)
+	}
+	return collection.Compile(request)
+}
+
+// QueryCollections collections of the doc types that can be queried, read by tools/indexcheck
+func QueryCollections() map[string]*query.Collection {
+	return queryCollections
+}
+
+// QueryShapes rich queries built by the transactions, besides the queries of the clients
+// (see query.Collection.Shapes), read by tools/indexcheck. The role filter of
+// SearchParticipants is not included, it is served by the composite keys
+func QueryShapes() []query.Query {
+	return []query.Query{
+		participantSearchQuery(ParticipantSearchRequest{MspID: "Org1MSP", PageSize: 1}),
+		participantSearchQuery(ParticipantSearchRequest{IssuerID: "issuer", PageSize: 1}),
+		participantSearchQuery(ParticipantSearchRequest{Active: "true", PageSize: 1}),
+		participantSearchQuery(ParticipantSearchRequest{ExpiresMonth: "2006-01", PageSize: 1}),
+	}
+}
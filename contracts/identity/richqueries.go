@@ -1,9 +1,12 @@
 package identity
 
 import (
+	"fmt"
+
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 	jsoniter "github.com/json-iterator/go"
 	libUtils "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/query"
 	model "github.com/kmilodenisglez/model-identity-go/model"
 )
 
@@ -12,6 +15,8 @@ var json = jsoniter.ConfigCompatibleWithStandardLibrary
 // QueryAssetsBy uses a query string to perform a query for any identity contract asset
 // Query string matching state database syntax is passed in and executed as is.
 // Supports ad hoc queries that can be defined at runtime by the client.
+// The raw selector can read every doc type, it requires the QueryAdmin capability,
+// the clients use QueryDocuments.
 // Param Ex: {"selector":{"docType":"did.participant","id":"myID"}}
 //
 // Arguments:
@@ -19,6 +24,11 @@ var json = jsoniter.ConfigCompatibleWithStandardLibrary
 // Returns:
 //		0: []string
 func (ci *ContractIdentity) QueryAssetsBy(ctx contractapi.TransactionContextInterface, query map[string]interface{}) ([]interface{}, error) {
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityQueryAdmin); err != nil {
+		return nil, err
+	}
+
 	queryString, err := json.MarshalToString(&query)
 	if err != nil {
 		return nil, err
@@ -39,13 +49,25 @@ func (ci *ContractIdentity) QueryAssetsBy(ctx contractapi.TransactionContextInte
 // If this is not desired, follow the QueryAssetsForOwner example for parameterized queries.
 // Only available on state databases that support rich query (e.g. CouchDB)
 // Paginated queries are only valid for read only transactions.
+// The raw selector requires the QueryAdmin capability, see QueryDocuments.
+// The queryString must have a selector and the pageSize must be between 1 and query.MaxPageSize.
 // Example: Pagination with Ad hoc Rich Query
 func (ci *ContractIdentity) QueryAssetsWithPagination(ctx contractapi.TransactionContextInterface, request model.RichQuerySelector) (*model.PaginatedQueryResponse, error) {
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityQueryAdmin); err != nil {
+		return nil, err
+	}
+
+	if _, ok := request.QueryString["selector"]; !ok {
+		return nil, fmt.Errorf(libUtils.ErrorRequiredParameter, "queryString.selector")
+	}
+	if request.PageSize < 1 || request.PageSize > query.MaxPageSize {
+		return nil, fmt.Errorf("pageSize must be between 1 and %d", query.MaxPageSize)
+	}
 	queryString, err := json.MarshalToString(&request.QueryString)
 	if err != nil {
 		return nil, err
 	}
-	//TODO: add validation: len(request.QueryString)
 
 	return libUtils.GetQueryResultForQueryStringWithPagination(ctx, queryString, int32(request.PageSize), request.Bookmark)
 }
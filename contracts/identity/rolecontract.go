@@ -14,6 +14,11 @@ import (
 func (ci *ContractIdentity) CreateRole(ctx contractapi.TransactionContextInterface, request modelapi.RoleCreateRequest) (*modelapi.RoleResponse, error) {
 	log.Printf("[%s][CreateRole]", ctx.GetStub().GetChannelID())
 
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityRoleAdmin); err != nil {
+		return nil, err
+	}
+
 	// TODO: remove uuid
 	id := lus.GenerateUUIDStr()
 	key, err := ctx.GetStub().CreateCompositeKey(RoleDocType, []string{id})
@@ -37,7 +42,7 @@ func (ci *ContractIdentity) CreateRole(ctx contractapi.TransactionContextInterfa
 		return nil, err
 	}
 
-	if err := ctx.GetStub().PutState(key, roleJE); err != nil {
+	if err := putAudited(ctx, RoleDocType, role.ID, key, roleJE); err != nil {
 		return nil, fmt.Errorf("role %s could not be created: %v", request.Name, err)
 	}
 	return &modelapi.RoleResponse{
@@ -58,7 +63,7 @@ func (ci *ContractIdentity) GetRole(ctx contractapi.TransactionContextInterface,
 	} else if key == "" {
 		return nil, fmt.Errorf("no state found for %s", request.ID)
 	}
-	item, err := ctx.GetStub().GetState(key)
+	item, err := getDocument(ctx, RoleDocType, key)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get: %v", err)
 	} else if item == nil {
@@ -79,47 +84,59 @@ func (ci *ContractIdentity) GetRole(ctx contractapi.TransactionContextInterface,
 	}, nil
 }
 
-// GetRoles get all role
-func (ci *ContractIdentity) GetRoles(ctx contractapi.TransactionContextInterface) ([]modelapi.RoleResponse, error) {
+// GetRoles get a page of the roles, in ID order
+//
+// Arguments:
+//		0: ListRequest
+// Returns:
+//		0: RolesResponse
+//		1: error
+func (ci *ContractIdentity) GetRoles(ctx contractapi.TransactionContextInterface, request ListRequest) (*RolesResponse, error) {
 	log.Printf("[%s][GetRoles]", ctx.GetStub().GetChannelID())
 
-	rolesResultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(RoleDocType, []string{})
+	records, bookmark, err := listPage(ctx, RoleDocType, []string{}, request, listFields(RoleDocType), func(_ string, value []byte) (interface{}, error) {
+		var role modelapi.Role
+		if err := json.Unmarshal(value, &role); err != nil {
+			return nil, err
+		}
+		return &role, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer rolesResultsIterator.Close()
 
-	var items []modelapi.RoleResponse
-	if rolesResultsIterator.HasNext() {
-		responseRange, err := rolesResultsIterator.Next()
-		if responseRange == nil {
-			return nil, err
-		}
-
-		var role modelapi.Role
-		err = json.Unmarshal(responseRange.Value, &role)
-		if err != nil {
-			return nil, err
-		}
+	var items = make([]modelapi.RoleResponse, 0, len(records))
+	for _, record := range records {
+		role := record.(*modelapi.Role)
 		items = append(items, modelapi.RoleResponse{
 			DocType:           role.DocType,
 			ID:                role.ID,
 			Name:              role.Name,
+			Description:       role.Description,
 			ContractFunctions: lus.MapToSlice(role.ContractFunctions),
 		})
 	}
-	return items, nil
+	return &RolesResponse{
+		Records:             items,
+		FetchedRecordsCount: int32(len(items)),
+		Bookmark:            bookmark,
+	}, nil
 }
 
 // UpdateRole
 func (ci *ContractIdentity) UpdateRole(ctx contractapi.TransactionContextInterface, request modelapi.RoleUpdateRequest) error {
 	log.Printf("[%s][UpdateRole]", ctx.GetStub().GetChannelID())
+
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityRoleAdmin); err != nil {
+		return err
+	}
 	key, err := ctx.GetStub().CreateCompositeKey(RoleDocType, []string{request.ID})
 	if err != nil {
 		return err
 	}
 
-	role, err := ctx.GetStub().GetState(key)
+	role, err := getDocument(ctx, RoleDocType, key)
 	if err != nil {
 		return fmt.Errorf("failed to get a role: %v", err)
 	} else if role == nil {
@@ -140,7 +157,7 @@ func (ci *ContractIdentity) UpdateRole(ctx contractapi.TransactionContextInterfa
 	if err != nil {
 		return err
 	}
-	if err := ctx.GetStub().PutState(key, roleJE); err != nil {
+	if err := putAudited(ctx, RoleDocType, roleJD.ID, key, roleJE); err != nil {
 		return fmt.Errorf("role %s could not be updated: %v", roleJD.ID, err)
 	}
 
@@ -150,7 +167,16 @@ func (ci *ContractIdentity) UpdateRole(ctx contractapi.TransactionContextInterfa
 // DeleteRole
 func (ci *ContractIdentity) DeleteRole(ctx contractapi.TransactionContextInterface, request modelapi.GetRequest) error {
 	log.Printf("[%s][DeleteRole]", ctx.GetStub().GetChannelID())
-	if err := lus.DeleteIndex(ctx.GetStub(), RoleDocType, []string{request.ID}, true); err != nil {
+
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityRoleAdmin); err != nil {
+		return err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(RoleDocType, []string{request.ID})
+	if err != nil {
+		return err
+	}
+	if err := deleteAudited(ctx, RoleDocType, request.ID, key); err != nil {
 		return err
 	}
 
@@ -0,0 +1,183 @@
+package identity
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/migration"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/query"
+	"log"
+)
+
+// schemaMigrations migrations of the stored documents by doc type. A breaking change of
+// a document registers the migration from its previous layout, in init:
+//
+//	schemaMigrations.Register(ParticipantDocType, func(doc map[string]interface{}) error { ... })
+//
+// The migrations receive the stored document, the personal data is still encrypted.
+// The documents are migrated when they are read, and stored migrated by MigrateBatch
+var schemaMigrations = migration.NewRegistry()
+
+func init() {
+	// version 2, the certificate dates are compared as strings by the rich queries
+	schemaMigrations.Register(ParticipantDocType, migrateCertificateDatesToUTC)
+	schemaMigrations.Register(IssuerDocType, migrateCertificateDatesToUTC)
+}
+
+// schemaDocTypes doc types of the versioned documents, the entities of the contract
+var schemaDocTypes = []string{
+	ParticipantDocType, IssuerDocType, RoleDocType, AccessDocType, PolicyDocType,
+	SodRuleDocType, AdminDocType, OrganizationDocType, ConfigDocType,
+}
+
+// MigrateBatchRequest page of the documents of a doc type to migrate
+type MigrateBatchRequest struct {
+	DocType  string `json:"docType"`
+	Bookmark string `json:"bookmark,omitempty" metadata:",optional"`
+	PageSize int    `json:"pageSize,omitempty" metadata:",optional"` // query.MaxPageSize by default
+	DryRun   bool   `json:"dryRun,omitempty" metadata:",optional"`   // count the documents to migrate, nothing is written
+}
+
+// MigrateBatchResponse result of a page of the migration, the bookmark is empty when
+// every document of the doc type was scanned
+type MigrateBatchResponse struct {
+	DocType       string `json:"docType"`
+	SchemaVersion int    `json:"schemaVersion"` // current version of the doc type
+	DryRun        bool   `json:"dryRun"`
+	Scanned       int    `json:"scanned"`
+	Migrated      int    `json:"migrated"` // the documents migrated, or that would be on a dry run
+	Bookmark      string `json:"bookmark"`
+}
+
+// MigrateBatch stores a page of the documents of a doc type migrated to its current
+// schema version, every migration is recorded by the audit trail
+//
+// Arguments:
+//		0: MigrateBatchRequest
+// Returns:
+//		0: MigrateBatchResponse
+//		1: error
+func (ci *ContractIdentity) MigrateBatch(ctx contractapi.TransactionContextInterface, request MigrateBatchRequest) (*MigrateBatchResponse, error) {
+	log.Printf("[%s][MigrateBatch]", ctx.GetStub().GetChannelID())
+
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilitySchemaAdmin); err != nil {
+		return nil, err
+	}
+	if request.DocType == "" {
+		return nil, fmt.Errorf(lus.ErrorRequiredParameter, "docType")
+	} else if !lus.Contains(schemaDocTypes, request.DocType) {
+		return nil, fmt.Errorf("invalid docType %s, expected one of %v", request.DocType, schemaDocTypes)
+	}
+	if request.PageSize == 0 {
+		request.PageSize = query.MaxPageSize
+	} else if request.PageSize < 1 || request.PageSize > query.MaxPageSize {
+		return nil, fmt.Errorf("pageSize must be between 1 and %d", query.MaxPageSize)
+	}
+	var after string
+	if request.Bookmark != "" {
+		bookmark, err := base64.RawURLEncoding.DecodeString(request.Bookmark)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bookmark: %v", err)
+		}
+		after = string(bookmark)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(request.DocType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	response := &MigrateBatchResponse{
+		DocType:       request.DocType,
+		SchemaVersion: schemaMigrations.Version(request.DocType),
+		DryRun:        request.DryRun,
+	}
+	var lastKey string
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if after != "" && responseRange.Key <= after {
+			continue
+		}
+		if response.Scanned == request.PageSize {
+			response.Bookmark = base64.RawURLEncoding.EncodeToString([]byte(lastKey))
+			return response, nil
+		}
+		response.Scanned++
+		lastKey = responseRange.Key
+
+		migrated, changed, err := schemaMigrations.Migrate(request.DocType, responseRange.Value)
+		if err != nil {
+			return nil, fmt.Errorf("document %s: %v", responseRange.Key, err)
+		} else if !changed {
+			continue
+		}
+		response.Migrated++
+		if request.DryRun {
+			continue
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
+		}
+		if err := putAudited(ctx, request.DocType, strings.Join(attributes, ":"), responseRange.Key, migrated); err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+// getDocument returns the document of the key migrated to the current schema version of
+// its doc type, nil if it does not exist
+func getDocument(ctx contractapi.TransactionContextInterface, docType, key string) ([]byte, error) {
+	value, err := ctx.GetStub().GetState(key)
+	if err != nil || value == nil {
+		return value, err
+	}
+	return migrateDocument(docType, value)
+}
+
+// migrateDocument returns the document migrated to the current schema version of its doc
+// type, the documents of the indexes and of the records are not versioned
+func migrateDocument(docType string, value []byte) ([]byte, error) {
+	if len(value) == 0 || !lus.Contains(schemaDocTypes, docType) {
+		return value, nil
+	}
+	migrated, _, err := schemaMigrations.Migrate(docType, value)
+	if err != nil {
+		return nil, err
+	}
+	return migrated, nil
+}
+
+// stampDocument returns the document written by the contract with the current schema
+// version of its doc type
+func stampDocument(docType string, value []byte) ([]byte, error) {
+	if len(value) == 0 || !lus.Contains(schemaDocTypes, docType) {
+		return value, nil
+	}
+	return schemaMigrations.Stamp(docType, value)
+}
+
+// migrateCertificateDatesToUTC stores the RFC3339 dates of the certificate in UTC, the
+// dates that are not valid are kept
+func migrateCertificateDatesToUTC(doc map[string]interface{}) error {
+	for _, field := range []string{"issuedTime", "expiresTime"} {
+		value, ok := doc[field].(string)
+		if !ok || value == "" {
+			continue
+		}
+		if t, err := lus.ParseRFC3339toTime(value); err == nil {
+			doc[field] = t.UTC().Format(time.RFC3339)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,436 @@
+package identity
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	"log"
+)
+
+// separation-of-duty rule types
+const (
+	SodStatic  = "static"  // checked when roles are assigned to a participant
+	SodDynamic = "dynamic" // checked at transaction time, inside the same workflow
+)
+
+// SodRule separation-of-duty rule, a participant can not hold (static) or act
+// in the same workflow with (dynamic) more than one of the roles of the rule
+type SodRule struct {
+	DocType     string   `json:"docType"`
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty" metadata:",optional"`
+	Type        string   `json:"type"`  // static or dynamic
+	Roles       []string `json:"roles"` // mutually exclusive role id list
+}
+
+// SodRuleCreateRequest
+type SodRuleCreateRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty" metadata:",optional"`
+	Type        string   `json:"type"`  // static or dynamic
+	Roles       []string `json:"roles"` // at least two role ids
+}
+
+// WorkflowActivityRequest a participant acting with a role inside a workflow,
+// ex: the DID that creates a proposal and the DID that approves it
+type WorkflowActivityRequest struct {
+	WorkflowID string `json:"workflowId"` // proposal id, process id, etc.
+	Did        string `json:"did"`
+	RoleID     string `json:"roleId"`
+	Action     string `json:"action,omitempty" metadata:",optional"` // ex: create, approve
+}
+
+// workflowActivity stored under SodActivityDocType~workflowId~did~roleId
+type workflowActivity struct {
+	DocType    string `json:"docType"`
+	WorkflowID string `json:"workflowId"`
+	Did        string `json:"did"`
+	RoleID     string `json:"roleId"`
+	Action     string `json:"action,omitempty"`
+	TxID       string `json:"txID"`
+	Time       string `json:"time"`
+}
+
+// SodConflict participant that currently holds mutually exclusive roles
+type SodConflict struct {
+	Did      string   `json:"did"`
+	MspID    string   `json:"mspID"`
+	RuleID   string   `json:"ruleId"`
+	RuleName string   `json:"ruleName"`
+	Roles    []string `json:"roles"` // conflicting role id list
+}
+
+// SodViolationError is returned when an operation breaks a separation-of-duty rule
+type SodViolationError struct {
+	RuleID     string
+	RuleType   string
+	Did        string
+	Roles      []string
+	WorkflowID string
+}
+
+func (e *SodViolationError) Error() string {
+	msg := fmt.Sprintf(lus.ErrorSodViolation, e.RuleID, e.Did, e.Roles)
+	if e.WorkflowID != "" {
+		msg = fmt.Sprintf("%s in workflow %s", msg, e.WorkflowID)
+	}
+	return msg
+}
+
+// CreateSodRule store a separation-of-duty rule in the ledger
+//
+// Arguments:
+//		0: SodRuleCreateRequest
+// Returns:
+//		0: SodRule
+//		1: error
+func (ci *ContractIdentity) CreateSodRule(ctx contractapi.TransactionContextInterface, request SodRuleCreateRequest) (*SodRule, error) {
+	log.Printf("[%s][CreateSodRule]", ctx.GetStub().GetChannelID())
+
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityRoleAdmin); err != nil {
+		return nil, err
+	}
+
+	if request.Name == "" {
+		return nil, fmt.Errorf(lus.ErrorRequiredParameter, "name")
+	}
+	if request.Type != SodStatic && request.Type != SodDynamic {
+		return nil, fmt.Errorf("invalid rule type %s, expected %s or %s", request.Type, SodStatic, SodDynamic)
+	}
+
+	roles := make(map[string]string)
+	lus.SliceToMap(request.Roles, roles)
+	if len(roles) < 2 {
+		return nil, fmt.Errorf("a separation of duty rule needs at least two different roles")
+	}
+	for roleID := range roles {
+		if _, err := ci.GetRole(ctx, model.GetRequest{ID: roleID}); err != nil {
+			return nil, err
+		}
+	}
+
+	id := lus.NormalizeString(request.Name)
+	key, err := ctx.GetStub().CreateCompositeKey(SodRuleDocType, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	exists, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, err
+	} else if exists != nil {
+		return nil, fmt.Errorf("separation of duty rule %s already exists", id)
+	}
+
+	// sorted, the document must be the same across all endorsers
+	ruleRoles := lus.MapToSlice(roles)
+	sort.Strings(ruleRoles)
+
+	rule := &SodRule{
+		DocType:     SodRuleDocType,
+		ID:          id,
+		Name:        request.Name,
+		Description: request.Description,
+		Type:        request.Type,
+		Roles:       ruleRoles,
+	}
+	// JSON encoding
+	ruleJE, err := json.Marshal(rule)
+	if err != nil {
+		return nil, err
+	}
+	if err := putAudited(ctx, SodRuleDocType, rule.ID, key, ruleJE); err != nil {
+		return nil, fmt.Errorf("separation of duty rule %s could not be created: %v", request.Name, err)
+	}
+
+	return rule, nil
+}
+
+// GetSodRule get a separation-of-duty rule
+//
+// Arguments:
+//		0: GetRequest
+// Returns:
+//		0: SodRule
+//		1: error
+func (ci *ContractIdentity) GetSodRule(ctx contractapi.TransactionContextInterface, request model.GetRequest) (*SodRule, error) {
+	log.Printf("[%s][GetSodRule]", ctx.GetStub().GetChannelID())
+
+	key, err := ctx.GetStub().CreateCompositeKey(SodRuleDocType, []string{request.ID})
+	if err != nil {
+		return nil, fmt.Errorf("error happened creating composite key: %v", err)
+	}
+	item, err := getDocument(ctx, SodRuleDocType, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get: %v", err)
+	} else if item == nil {
+		return nil, fmt.Errorf("no state found for %s", key)
+	}
+
+	var rule SodRule
+	if err = json.Unmarshal(item, &rule); err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// GetSodRules get all separation-of-duty rules
+func (ci *ContractIdentity) GetSodRules(ctx contractapi.TransactionContextInterface) ([]SodRule, error) {
+	log.Printf("[%s][GetSodRules]", ctx.GetStub().GetChannelID())
+	return ci.getSodRules(ctx, "")
+}
+
+// DeleteSodRule remove a separation-of-duty rule, the recorded workflow activities are kept
+func (ci *ContractIdentity) DeleteSodRule(ctx contractapi.TransactionContextInterface, request model.GetRequest) error {
+	log.Printf("[%s][DeleteSodRule]", ctx.GetStub().GetChannelID())
+
+	// admin capability required
+	if err := ci.assertCapability(ctx, CapabilityRoleAdmin); err != nil {
+		return err
+	}
+
+	if _, err := ci.GetSodRule(ctx, request); err != nil {
+		return err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(SodRuleDocType, []string{request.ID})
+	if err != nil {
+		return err
+	}
+	return deleteAudited(ctx, SodRuleDocType, request.ID, key)
+}
+
+// RecordWorkflowActivity checks the dynamic separation-of-duty rules and records that a
+// participant acted with a role inside a workflow. It must be invoked by the business
+// transaction (ex: CreateProposal, ApproveProposal) before committing its own changes.
+// The caller must be the participant, or a RoleAdmin of the participant's org.
+//
+// Arguments:
+//		0: WorkflowActivityRequest
+// Returns:
+//		0: error, *SodViolationError when the participant already acted with a conflicting role
+func (ci *ContractIdentity) RecordWorkflowActivity(ctx contractapi.TransactionContextInterface, request WorkflowActivityRequest) error {
+	log.Printf("[%s][RecordWorkflowActivity]", ctx.GetStub().GetChannelID())
+
+	if request.WorkflowID == "" {
+		return fmt.Errorf(lus.ErrorRequiredParameter, "workflowId")
+	} else if request.Did == "" {
+		return fmt.Errorf(lus.ErrorRequiredParameter, "did")
+	} else if request.RoleID == "" {
+		return fmt.Errorf(lus.ErrorRequiredParameter, "roleId")
+	}
+
+	participant, err := ci.GetParticipant(ctx, model.ParticipantGetRequest{Did: request.Did})
+	if err != nil {
+		return err
+	}
+	// the participant records its own activity, or a role admin of its org on its behalf
+	did, err := callerDid(ctx)
+	if err != nil {
+		return err
+	}
+	if did != request.Did {
+		if err := ci.assertCapability(ctx, CapabilityRoleAdmin); err != nil {
+			return fmt.Errorf("the caller is not the participant %s: %v", request.Did, err)
+		}
+		mspID, err := ctx.GetClientIdentity().GetMSPID()
+		if err != nil {
+			return fmt.Errorf(lus.ErrorGetMSPID, err)
+		}
+		if mspID != participant.MspID {
+			return fmt.Errorf("client from org %v is not authorized to record the activity of a participant of the org %v", mspID, participant.MspID)
+		}
+	}
+	if !participant.Active {
+		return fmt.Errorf("participant %s is not active", request.Did)
+	}
+	if !lus.Contains(participant.Roles, request.RoleID) {
+		return fmt.Errorf("participant %s does not hold the role %s", request.Did, request.RoleID)
+	}
+
+	rules, err := ci.getSodRules(ctx, SodDynamic)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if !lus.Contains(rule.Roles, request.RoleID) {
+			continue
+		}
+		for _, other := range rule.Roles {
+			if other == request.RoleID {
+				continue
+			}
+			key, err := ctx.GetStub().CreateCompositeKey(SodActivityDocType, []string{request.WorkflowID, request.Did, other})
+			if err != nil {
+				return err
+			}
+			previous, err := ctx.GetStub().GetState(key)
+			if err != nil {
+				return err
+			}
+			if previous != nil {
+				return &SodViolationError{
+					RuleID:     rule.ID,
+					RuleType:   rule.Type,
+					Did:        request.Did,
+					Roles:      []string{other, request.RoleID},
+					WorkflowID: request.WorkflowID,
+				}
+			}
+		}
+	}
+
+	// timestamp when the transaction was created, have the same value across all endorsers
+	txTimestamp, err := lus.GetTxTimestampRFC3339(ctx.GetStub())
+	if err != nil {
+		return err
+	}
+	activity := &workflowActivity{
+		DocType:    SodActivityDocType,
+		WorkflowID: request.WorkflowID,
+		Did:        request.Did,
+		RoleID:     request.RoleID,
+		Action:     request.Action,
+		TxID:       ctx.GetStub().GetTxID(),
+		Time:       txTimestamp,
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(SodActivityDocType, []string{request.WorkflowID, request.Did, request.RoleID})
+	if err != nil {
+		return err
+	}
+	// JSON encoding
+	activityJE, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+	activityID := strings.Join([]string{request.WorkflowID, request.Did, request.RoleID}, "~")
+	if err := putAudited(ctx, SodActivityDocType, activityID, key, activityJE); err != nil {
+		return fmt.Errorf("workflow activity could not be recorded: %v", err)
+	}
+	return nil
+}
+
+// GetSodConflicts list the participants that currently hold roles declared mutually
+// exclusive by a static rule, ex: participants created before the rule was added
+//
+// Arguments:
+//		0: none
+// Returns:
+//		0: []SodConflict
+//		1: error
+func (ci *ContractIdentity) GetSodConflicts(ctx contractapi.TransactionContextInterface) ([]SodConflict, error) {
+	log.Printf("[%s][GetSodConflicts]", ctx.GetStub().GetChannelID())
+
+	rules, err := ci.getSodRules(ctx, SodStatic)
+	if err != nil {
+		return nil, err
+	}
+
+	var items = make([]SodConflict, 0)
+	if len(rules) == 0 {
+		return items, nil
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(ParticipantDocType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if responseRange == nil {
+			return nil, err
+		}
+
+		participantJE, err := migrateDocument(ParticipantDocType, responseRange.Value)
+		if err != nil {
+			return nil, err
+		}
+		var participant model.Participant
+		if err = json.Unmarshal(participantJE, &participant); err != nil {
+			return nil, err
+		}
+		for _, rule := range rules {
+			if held := sodHeldRoles(rule, participant.Roles); len(held) > 1 {
+				items = append(items, SodConflict{
+					Did:      participant.Did,
+					MspID:    participant.MspID,
+					RuleID:   rule.ID,
+					RuleName: rule.Name,
+					Roles:    held,
+				})
+			}
+		}
+	}
+
+	return items, nil
+}
+
+// assertStaticSod returns a *SodViolationError if the roles to be assigned to a participant
+// break a static separation-of-duty rule
+func (ci *ContractIdentity) assertStaticSod(ctx contractapi.TransactionContextInterface, did string, roles []string) error {
+	if len(roles) < 2 {
+		return nil
+	}
+	rules, err := ci.getSodRules(ctx, SodStatic)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if held := sodHeldRoles(rule, roles); len(held) > 1 {
+			return &SodViolationError{
+				RuleID:   rule.ID,
+				RuleType: rule.Type,
+				Did:      did,
+				Roles:    held,
+			}
+		}
+	}
+	return nil
+}
+
+// getSodRules returns the stored rules, filtered by type if ruleType is not empty
+func (ci *ContractIdentity) getSodRules(ctx contractapi.TransactionContextInterface, ruleType string) ([]SodRule, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(SodRuleDocType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var items = make([]SodRule, 0)
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if responseRange == nil {
+			return nil, err
+		}
+
+		ruleJE, err := migrateDocument(SodRuleDocType, responseRange.Value)
+		if err != nil {
+			return nil, err
+		}
+		var rule SodRule
+		if err = json.Unmarshal(ruleJE, &rule); err != nil {
+			return nil, err
+		}
+		if ruleType == "" || rule.Type == ruleType {
+			items = append(items, rule)
+		}
+	}
+	return items, nil
+}
+
+// sodHeldRoles returns the roles of the rule that are in roles
+func sodHeldRoles(rule SodRule, roles []string) []string {
+	var held []string
+	for _, roleID := range rule.Roles {
+		if lus.Contains(roles, roleID) {
+			held = append(held, roleID)
+		}
+	}
+	return held
+}
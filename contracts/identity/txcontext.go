@@ -0,0 +1,28 @@
+package identity
+
+import (
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/statecache"
+)
+
+// TransactionContext transaction context of the contract, the world state is accessed
+// through a statecache.Stub: the reads are cached and the writes are buffered until
+// FlushState, the after transaction hook, sends them to the peer
+type TransactionContext struct {
+	contractapi.TransactionContext
+}
+
+// SetStub stores the state cache of the stub of the transaction
+func (ctx *TransactionContext) SetStub(stub shim.ChaincodeStubInterface) {
+	ctx.TransactionContext.SetStub(statecache.New(stub))
+}
+
+// FlushState sends the writes buffered by the transaction to the peer, the contexts
+// without state cache write directly
+func FlushState(ctx contractapi.TransactionContextInterface) error {
+	if cache, ok := ctx.GetStub().(*statecache.Stub); ok {
+		return cache.Flush()
+	}
+	return nil
+}
@@ -4,15 +4,17 @@ go 1.16
 
 require (
 	github.com/go-jose/go-jose/v3 v3.0.0
-	github.com/hyperledger/fabric-chaincode-go v0.0.0-20210718160520-38d29fabecb9
+	github.com/golang/protobuf v1.5.2
+	github.com/hyperledger/fabric-chaincode-go v0.0.0-20230731094759-d626e9ab09b9
 	github.com/hyperledger/fabric-contract-api-go v1.1.1
-	github.com/hyperledger/fabric-protos-go v0.0.0-20210422135545-37e930696e2a
+	github.com/hyperledger/fabric-protos-go v0.3.0
 	github.com/json-iterator/go v1.1.12
 	github.com/kmilodenisglez/model-identity-go v0.0.0-20221019213759-7ef1f1528919
 	github.com/maxbrunsfeld/counterfeiter/v6 v6.4.1
 	github.com/onsi/ginkgo v1.16.5
 	github.com/onsi/gomega v1.16.0
-	golang.org/x/text v0.3.7
+	golang.org/x/crypto v0.0.0-20211108221036-ceb1ce70b4fa
+	golang.org/x/text v0.7.0
 	google.golang.org/protobuf v1.28.1
 	gopkg.in/square/go-jose.v2 v2.5.1
 // TODO: update "gopkg.in/square/go-jose.v2" to v2.6.0 version
@@ -3,6 +3,7 @@ package hooks
 import (
 	"fmt"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
 )
 
 // UnknownTransactionHandler returns a shim error
@@ -11,3 +12,15 @@ func UnknownTransactionHandler(ctx contractapi.TransactionContextInterface) erro
 	fcn, args := ctx.GetStub().GetFunctionAndParameters()
 	return fmt.Errorf("invalid function %s passed with args %v", fcn, args)
 }
+
+// AfterTransactionHandler writes the state buffered by the transaction, it is called
+// after every successful transaction of the contract
+func AfterTransactionHandler(ctx contractapi.TransactionContextInterface) error {
+	return identity.FlushState(ctx)
+}
+
+// BeforeTransactionHandler authorization hook, is called before every transaction
+// and rejects the request if the caller does not satisfy the ABAC policy of the function
+func BeforeTransactionHandler(ctx contractapi.TransactionContextInterface) error {
+	return identity.AuthorizeTransaction(ctx)
+}
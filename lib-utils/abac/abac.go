@@ -0,0 +1,234 @@
+// Package abac evaluates attribute-based access control policies over the
+// attributes of a caller: certificate attributes, stored participant
+// attributes and MSP ID.
+package abac
+
+import (
+	"fmt"
+	"strings"
+)
+
+// attribute sources
+const (
+	SourceCert        = "cert"        // Fabric CA attributes of the caller certificate, ex: hf.Affiliation, Cargo
+	SourceParticipant = "participant" // attributes stored in the participant, ex: company, position, attrsExtras
+	SourceMsp         = "msp"         // MSP ID of the caller, the condition name is ignored
+)
+
+// operators
+const (
+	OpAnd  = "and"
+	OpOr   = "or"
+	OpNot  = "not"
+	OpAttr = "attr"
+)
+
+// Expr node of a policy, and/or/not combine Args, attr compares one attribute:
+//
+//	{"op":"and","args":[
+//	    {"op":"attr","attr":{"source":"cert","name":"hf.Affiliation","value":"org1.dept"}},
+//	    {"op":"attr","attr":{"source":"cert","name":"Cargo","value":"Director de Calidad"}}]}
+type Expr struct {
+	Op   string     `json:"op"`                                  // and, or, not, attr
+	Args []Expr     `json:"args,omitempty" metadata:",optional"` // operands of and, or (one or more) and not (exactly one)
+	Attr *Condition `json:"attr,omitempty" metadata:",optional"` // condition of attr
+}
+
+// Condition compares one attribute of the subject. If Value and Values are
+// empty the attribute only needs to be present.
+type Condition struct {
+	Source string   `json:"source"`                                // cert, participant or msp
+	Name   string   `json:"name,omitempty" metadata:",optional"`   // attribute name
+	Value  string   `json:"value,omitempty" metadata:",optional"`  // expected value
+	Values []string `json:"values,omitempty" metadata:",optional"` // any of these values
+}
+
+// Subject attributes of the identity the policy is evaluated against
+type Subject struct {
+	MspID                 string
+	CertAttributes        map[string]string
+	ParticipantAttributes map[string]string // nil if the caller is not a registered participant
+}
+
+// Validate checks the shape of the expression
+func (e *Expr) Validate() error {
+	switch e.Op {
+	case OpAnd, OpOr:
+		if len(e.Args) == 0 {
+			return fmt.Errorf("empty %s expression", e.Op)
+		}
+	case OpNot:
+		if len(e.Args) != 1 {
+			return fmt.Errorf("a not expression must have exactly one argument")
+		}
+	case OpAttr:
+		return e.Attr.validate()
+	default:
+		return fmt.Errorf("invalid policy operator %s", e.Op)
+	}
+
+	for i := range e.Args {
+		if err := e.Args[i].Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Condition) validate() error {
+	if c == nil {
+		return fmt.Errorf("an attr expression must have a condition")
+	}
+	switch c.Source {
+	case SourceCert, SourceParticipant:
+		if c.Name == "" {
+			return fmt.Errorf("the attribute name is required for source %s", c.Source)
+		}
+	case SourceMsp:
+	default:
+		return fmt.Errorf("invalid attribute source %s", c.Source)
+	}
+	return nil
+}
+
+// Evaluate returns true if the subject satisfies the expression. When trace is
+// not nil the result of every evaluated condition is appended to it.
+func Evaluate(e *Expr, subject Subject, trace *[]string) (bool, error) {
+	if err := e.Validate(); err != nil {
+		return false, err
+	}
+	return evaluate(e, subject, trace), nil
+}
+
+// Decision result of a partial evaluation
+type Decision string
+
+const (
+	DecisionTrue    Decision = "true"
+	DecisionFalse   Decision = "false"
+	DecisionUnknown Decision = "unknown" // it depends on an unknown attribute
+)
+
+// EvaluatePartial evaluates the expression when the attributes of some sources of the
+// subject are unknown, ex: the certificate of a past caller. The conditions over those
+// sources are unknown and are combined with three-valued logic, the result is unknown
+// only if the known attributes do not decide it
+func EvaluatePartial(e *Expr, subject Subject, unknownSources []string, trace *[]string) (Decision, error) {
+	if err := e.Validate(); err != nil {
+		return DecisionFalse, err
+	}
+	return evaluatePartial(e, subject, unknownSources, trace), nil
+}
+
+func evaluate(e *Expr, subject Subject, trace *[]string) bool {
+	switch e.Op {
+	case OpAnd:
+		for i := range e.Args {
+			if !evaluate(&e.Args[i], subject, trace) {
+				return false
+			}
+		}
+		return true
+	case OpOr:
+		for i := range e.Args {
+			if evaluate(&e.Args[i], subject, trace) {
+				return true
+			}
+		}
+		return false
+	case OpNot:
+		return !evaluate(&e.Args[0], subject, trace)
+	}
+
+	ok := e.Attr.match(subject)
+	if trace != nil {
+		*trace = append(*trace, fmt.Sprintf("%s: %t", e.Attr, ok))
+	}
+	return ok
+}
+
+func evaluatePartial(e *Expr, subject Subject, unknownSources []string, trace *[]string) Decision {
+	switch e.Op {
+	case OpAnd, OpOr:
+		// false decides an and, true decides an or
+		decisive, result := DecisionFalse, DecisionTrue
+		if e.Op == OpOr {
+			decisive, result = DecisionTrue, DecisionFalse
+		}
+		for i := range e.Args {
+			switch evaluatePartial(&e.Args[i], subject, unknownSources, trace) {
+			case decisive:
+				return decisive
+			case DecisionUnknown:
+				result = DecisionUnknown
+			}
+		}
+		return result
+	case OpNot:
+		switch evaluatePartial(&e.Args[0], subject, unknownSources, trace) {
+		case DecisionTrue:
+			return DecisionFalse
+		case DecisionFalse:
+			return DecisionTrue
+		}
+		return DecisionUnknown
+	}
+
+	decision := DecisionFalse
+	for _, source := range unknownSources {
+		if e.Attr.Source == source {
+			decision = DecisionUnknown
+		}
+	}
+	if decision != DecisionUnknown && e.Attr.match(subject) {
+		decision = DecisionTrue
+	}
+	if trace != nil {
+		*trace = append(*trace, fmt.Sprintf("%s: %s", e.Attr, decision))
+	}
+	return decision
+}
+
+func (c *Condition) match(subject Subject) bool {
+	var value string
+	var found bool
+
+	switch c.Source {
+	case SourceMsp:
+		value, found = subject.MspID, subject.MspID != ""
+	case SourceCert:
+		value, found = subject.CertAttributes[c.Name]
+	case SourceParticipant:
+		value, found = subject.ParticipantAttributes[c.Name]
+	}
+
+	if !found {
+		return false
+	}
+	if c.Value == "" && len(c.Values) == 0 {
+		return true
+	}
+	if c.Value != "" && value == c.Value {
+		return true
+	}
+	for _, v := range c.Values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Condition) String() string {
+	name := c.Source
+	if c.Source != SourceMsp {
+		name = c.Source + "." + c.Name
+	}
+	switch {
+	case c.Value != "":
+		return fmt.Sprintf("%s == %q", name, c.Value)
+	case len(c.Values) > 0:
+		return fmt.Sprintf("%s in [%s]", name, strings.Join(c.Values, ", "))
+	}
+	return fmt.Sprintf("%s exists", name)
+}
@@ -13,4 +13,7 @@ const (
 	ErrorIdentityExists    = `identity %s already exists`
 	ErrorDefaultNotExist   = `%s does not exist`
 	ErrorRequiredParameter = "a required parameter (%s) was not provided"
+	ErrorMissingCapability = `the caller does not hold the %s capability in %s`
+	ErrorAccessDenied      = `access denied to %s: the caller does not satisfy the policy`
+	ErrorSodViolation      = `separation of duty rule %s violated by %s: roles %v are mutually exclusive`
 )
@@ -2,11 +2,10 @@ package libutils
 
 import (
 	"bytes"
-	"crypto/ecdsa"
-	"crypto/ed25519"
-	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
@@ -15,6 +14,7 @@ import (
 	"github.com/hyperledger/fabric-chaincode-go/pkg/attrmgr"
 	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/keys"
 	jose "gopkg.in/square/go-jose.v2"
 	"log"
 	"strings"
@@ -56,31 +56,14 @@ func GetX509CertFromPem(certPemBase64 string) (*x509.Certificate, error) {
 	return cert, nil
 }
 
+// GetPublicKey base64 SPKI (DER) of the public key of the certificate, the key must
+// be supported by the keys package
 func GetPublicKey(cert *x509.Certificate) (string, error) {
-	type PKey struct {
-		PublicKey interface{}
-	}
-	var parsedKey = PKey{PublicKey: nil}
-	ok := false
-
-	switch cert.PublicKeyAlgorithm {
-	case x509.RSA:
-		parsedKey.PublicKey, ok = cert.PublicKey.(*rsa.PublicKey)
-	case x509.ECDSA:
-		parsedKey.PublicKey, ok = cert.PublicKey.(*ecdsa.PublicKey)
-	case x509.Ed25519:
-		parsedKey.PublicKey, ok = cert.PublicKey.(*ed25519.PublicKey)
-	default:
-		return "", x509.ErrUnsupportedAlgorithm
-	}
-	if !ok {
-		return "", fmt.Errorf("wanted an %s public key but found: %#v", cert.PublicKeyAlgorithm, parsedKey)
-	}
-	parsedPKBytes, err := x509.MarshalPKIXPublicKey(parsedKey.PublicKey)
+	publicKey, err := keys.FromCertificate(cert)
 	if err != nil {
 		return "", err
 	}
-	return base64.StdEncoding.EncodeToString(parsedPKBytes), nil
+	return keys.SPKIBase64(publicKey)
 }
 
 func CompareCertsPemBase64(cert1, cert2 string) bool {
@@ -163,6 +146,41 @@ func VerifyIssuedByRootCert(certRoot []byte, certIssue []byte) error {
 	return nil
 }
 
+// VerifyChain verifies the certificate against the roots and intermediates at the
+// given time, the path length and name constraints of the chain are enforced.
+// Returns the verified chain, from the certificate to the root
+func VerifyChain(cert *x509.Certificate, intermediates, roots []*x509.Certificate, at time.Time) ([]*x509.Certificate, error) {
+	chains, err := VerifyChains(cert, intermediates, roots, at)
+	if err != nil {
+		return nil, err
+	}
+	return chains[0], nil
+}
+
+// VerifyChains verifies the certificate at the given time and returns every verified chain
+func VerifyChains(cert *x509.Certificate, intermediates, roots []*x509.Certificate, at time.Time) ([][]*x509.Certificate, error) {
+	rootPool := x509.NewCertPool()
+	for _, root := range roots {
+		rootPool.AddCert(root)
+	}
+	intermediatePool := x509.NewCertPool()
+	for _, intermediate := range intermediates {
+		intermediatePool.AddCert(intermediate)
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         rootPool,
+		Intermediates: intermediatePool,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	chains, err := cert.Verify(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify certificate: %v", err.Error())
+	}
+	return chains, nil
+}
+
 // CheckSignatureFrom verifies that the signature on certIssue is a valid signature from Root Cert.
 func CheckSignatureFrom(certRoot []byte, certIssue []byte) error {
 	certR, err := GetX509CertFromPemByte(certRoot)
@@ -201,16 +219,41 @@ func HasExpired(cert *x509.Certificate) error {
 	return nil
 }
 
-// GetDateCertificate returns the issue and expiration date of a certificate
+// GetDateCertificate returns the issue and expiration date of a certificate, RFC3339 in UTC
 func GetDateCertificate(cert *x509.Certificate) map[string]string {
-	issuedTime := cert.NotBefore.Format(time.RFC3339)
-	expiresTime := cert.NotAfter.Format(time.RFC3339)
+	issuedTime := cert.NotBefore.UTC().Format(time.RFC3339)
+	expiresTime := cert.NotAfter.UTC().Format(time.RFC3339)
 
 	res := map[string]string{"issuedTime": issuedTime, "expiresTime": expiresTime}
 
 	return res
 }
 
+// PublicKeyFingerprint hex SHA-256 of the SPKI (DER) of a base64 public key,
+// the key is parsed and marshaled again so equal keys have equal fingerprints
+func PublicKeyFingerprint(publicKeyBase64 string) (string, error) {
+	publicKey, err := parsePublicKeyX509(publicKeyBase64)
+	if err != nil {
+		return "", err
+	}
+	return PublicKeyFingerprintOf(publicKey)
+}
+
+// PublicKeyFingerprintOf hex SHA-256 of the SPKI (DER) of a public key
+func PublicKeyFingerprintOf(publicKey interface{}) (string, error) {
+	spki, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(spki)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ParsePublicKey parses a base64 public key (SPKI DER)
+func ParsePublicKey(publicKeyBase64 string) (interface{}, error) {
+	return parsePublicKeyX509(publicKeyBase64)
+}
+
 func DidFormat(hashPubKey string) string {
 	return fmt.Sprintf("did:%s", hashPubKey)
 }
@@ -239,7 +282,7 @@ func parsePublicKeyX509(publicKey string) (interface{}, error) {
 	}
 	d = d[:n]
 
-	publicKeyImported, err := x509.ParsePKIXPublicKey(d)
+	publicKeyImported, err := keys.ParsePKIXPublicKey(d)
 	if err != nil {
 		return nil, errors.New(ErrorParseX509)
 	}
@@ -297,17 +340,17 @@ func parseKey(publicKey string) string {
 }
 
 func VerifySignature(message string, key string) ([]byte, error) {
-	msg, err := parseMessage(message)
-	if err != nil {
+	if _, err := parseMessage(message); err != nil {
 		return nil, err
 	}
 	pbkey, err := parsePublicKeyX509(key)
 	if err != nil {
 		return nil, err
 	}
-	result, err := jose.JSONWebSignature.Verify(*msg, pbkey)
+	// the algorithm of the JWS must be permitted for the key
+	result, err := keys.VerifyJWS(message, pbkey)
 	if err != nil {
-		return nil, errors.New(ErrorVerifying)
+		return nil, fmt.Errorf("%s: %v", ErrorVerifying, err)
 	}
 	return result, nil
 }
@@ -0,0 +1,57 @@
+package did
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// bitcoin alphabet, used by the base58btc multibase encoding
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var base58Radix = big.NewInt(58)
+
+func base58Encode(data []byte) string {
+	x := new(big.Int).SetBytes(data)
+	mod := new(big.Int)
+
+	var out []byte
+	for x.Sign() > 0 {
+		x.DivMod(x, base58Radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	// every leading zero byte is encoded as the first character of the alphabet
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+func base58Decode(text string) ([]byte, error) {
+	x := new(big.Int)
+	for i := 0; i < len(text); i++ {
+		index := -1
+		for j := 0; j < len(base58Alphabet); j++ {
+			if base58Alphabet[j] == text[i] {
+				index = j
+				break
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", text[i])
+		}
+		x.Mul(x, base58Radix)
+		x.Add(x, big.NewInt(int64(index)))
+	}
+
+	zeros := 0
+	for zeros < len(text) && text[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), x.Bytes()...), nil
+}
@@ -0,0 +1,141 @@
+// Package did parses, validates and generates the DIDs of the participants.
+// Each DID method implements DIDMethod and is registered by its name:
+//
+//	did:key:<multibase multicodec public key>   derived from the public key
+//	did:web:<domain>[:<path>]                   mapped to the domain of the organization
+//	did:fabric:<channel>:<id>                   scoped to the channel of the chaincode
+//
+// The DIDs without method name (did:<hash>) created by the first versions of the
+// chaincode are still accepted as Legacy.
+package did
+
+import (
+	"crypto"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Legacy name of the DIDs without method, ex: did:ab43bd...
+const Legacy = "legacy"
+
+var (
+	methodName = regexp.MustCompile(`^[a-z0-9]+$`)
+	idChars    = regexp.MustCompile(`^[a-zA-Z0-9.\-_:%]+$`)
+)
+
+// DID parsed DID, did:<Method>:<ID>
+type DID struct {
+	Method string
+	ID     string // method specific identifier
+}
+
+func (d DID) String() string {
+	if d.Method == Legacy {
+		return "did:" + d.ID
+	}
+	return "did:" + d.Method + ":" + d.ID
+}
+
+// Params context used to generate and validate a DID
+type Params struct {
+	PublicKey crypto.PublicKey // public key of the participant
+	Channel   string           // channel of the chaincode, did:fabric
+	Domain    string           // domain of the organization, did:web
+	Name      string           // optional local name of the participant, did:web and did:fabric
+}
+
+// DIDMethod implementation of a DID method
+type DIDMethod interface {
+	// Name of the method, ex: key
+	Name() string
+	// Generate a new DID of the method
+	Generate(params Params) (string, error)
+	// Parse returns the DID if it is a well formed DID of the method
+	Parse(did string) (*DID, error)
+	// Validate returns an error if the DID is not a valid DID of the method for the params
+	Validate(did string, params Params) error
+}
+
+var methods = map[string]DIDMethod{}
+
+// Register adds a DID method, it replaces a method with the same name
+func Register(method DIDMethod) {
+	methods[method.Name()] = method
+}
+
+// Lookup returns the DID method with the given name
+func Lookup(name string) (DIDMethod, error) {
+	method, ok := methods[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported DID method %s, expected one of %v", name, Methods())
+	}
+	return method, nil
+}
+
+// Methods names of the registered methods, sorted
+func Methods() []string {
+	names := make([]string, 0, len(methods))
+	for name := range methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Parse splits a DID in method and method specific identifier. A DID with only
+// one segment after did: is a Legacy DID.
+func Parse(did string) (*DID, error) {
+	if !strings.HasPrefix(did, "did:") {
+		return nil, fmt.Errorf("invalid DID %s, it must start with did:", did)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(did, "did:"), ":", 2)
+	if len(parts) == 1 {
+		if parts[0] == "" || !idChars.MatchString(parts[0]) {
+			return nil, fmt.Errorf("invalid DID %s", did)
+		}
+		return &DID{Method: Legacy, ID: parts[0]}, nil
+	}
+	if !methodName.MatchString(parts[0]) {
+		return nil, fmt.Errorf("invalid DID method %s", parts[0])
+	}
+	if parts[1] == "" || !idChars.MatchString(parts[1]) {
+		return nil, fmt.Errorf("invalid method specific identifier in %s", did)
+	}
+	return &DID{Method: parts[0], ID: parts[1]}, nil
+}
+
+// Validate validates the DID with its own method, the Legacy DIDs are only parsed
+func Validate(did string, params Params) error {
+	parsed, err := Parse(did)
+	if err != nil {
+		return err
+	}
+	if parsed.Method == Legacy {
+		return nil
+	}
+	method, err := Lookup(parsed.Method)
+	if err != nil {
+		return err
+	}
+	return method.Validate(did, params)
+}
+
+// parseMethod parses the DID and checks that it belongs to the method
+func parseMethod(did, name string) (*DID, error) {
+	parsed, err := Parse(did)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Method != name {
+		return nil, fmt.Errorf("%s is not a did:%s", did, name)
+	}
+	return parsed, nil
+}
+
+func init() {
+	Register(KeyMethod{})
+	Register(WebMethod{})
+	Register(FabricMethod{})
+}
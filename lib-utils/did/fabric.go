@@ -0,0 +1,73 @@
+package did
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var localNameChars = regexp.MustCompile(`^[a-zA-Z0-9.\-_]+$`)
+
+// FabricMethod did:fabric, ledger native DID scoped to the channel of the chaincode,
+// ex: did:fabric:mychannel:<id>
+type FabricMethod struct{}
+
+func (FabricMethod) Name() string { return "fabric" }
+
+func (FabricMethod) Generate(params Params) (string, error) {
+	if params.Channel == "" {
+		return "", fmt.Errorf("did:fabric requires the channel")
+	}
+	name, err := localName(params)
+	if err != nil {
+		return "", err
+	}
+	return "did:fabric:" + params.Channel + ":" + name, nil
+}
+
+func (m FabricMethod) Parse(did string) (*DID, error) {
+	parsed, err := parseMethod(did, m.Name())
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(parsed.ID, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || !localNameChars.MatchString(parts[1]) {
+		return nil, fmt.Errorf("invalid did:fabric %s, expected did:fabric:<channel>:<id>", did)
+	}
+	return parsed, nil
+}
+
+func (m FabricMethod) Validate(did string, params Params) error {
+	parsed, err := m.Parse(did)
+	if err != nil {
+		return err
+	}
+	parts := strings.SplitN(parsed.ID, ":", 2)
+	if params.Channel != "" && parts[0] != params.Channel {
+		return fmt.Errorf("%s does not belong to the channel %s", did, params.Channel)
+	}
+	return nil
+}
+
+// localName returns the name of the params, or the first 16 bytes of the SHA-256
+// of the public key in hex
+func localName(params Params) (string, error) {
+	if params.Name != "" {
+		if !localNameChars.MatchString(params.Name) {
+			return "", fmt.Errorf("invalid name %s", params.Name)
+		}
+		return params.Name, nil
+	}
+	if params.PublicKey == nil {
+		return "", fmt.Errorf("a name or a public key is required to generate the DID")
+	}
+	spki, err := x509.MarshalPKIXPublicKey(params.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(spki)
+	return hex.EncodeToString(sum[:16]), nil
+}
@@ -0,0 +1,136 @@
+package did
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+)
+
+// multicodec codes of the public keys, https://github.com/multiformats/multicodec
+const (
+	codecEd25519 = 0xed
+	codecP256    = 0x1200
+	codecP384    = 0x1201
+	codecP521    = 0x1202
+	codecRSA     = 0x1205
+)
+
+// KeyMethod did:key, the identifier is the multibase (base58btc) multicodec public key
+type KeyMethod struct{}
+
+func (KeyMethod) Name() string { return "key" }
+
+func (KeyMethod) Generate(params Params) (string, error) {
+	multibase, err := Multibase(params.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	return "did:key:" + multibase, nil
+}
+
+// Parse requires a public key encoded by Multibase
+func (m KeyMethod) Parse(did string) (*DID, error) {
+	parsed, err := parseMethod(did, m.Name())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ParseMultibase(parsed.ID); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+func (m KeyMethod) Validate(did string, params Params) error {
+	parsed, err := m.Parse(did)
+	if err != nil {
+		return err
+	}
+	if params.PublicKey == nil {
+		return nil
+	}
+	expected, err := Multibase(params.PublicKey)
+	if err != nil {
+		return err
+	}
+	if parsed.ID != expected {
+		return fmt.Errorf("%s is not derived from the public key of the participant", did)
+	}
+	return nil
+}
+
+// Multibase encodes the public key as base58btc multibase of its multicodec
+// representation, ECDSA points are compressed and RSA keys are PKCS #1
+func Multibase(publicKey crypto.PublicKey) (string, error) {
+	var code uint64
+	var raw []byte
+
+	switch key := publicKey.(type) {
+	case ed25519.PublicKey:
+		code, raw = codecEd25519, key
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			code = codecP256
+		case elliptic.P384():
+			code = codecP384
+		case elliptic.P521():
+			code = codecP521
+		default:
+			return "", fmt.Errorf("unsupported curve %s", key.Curve.Params().Name)
+		}
+		raw = elliptic.MarshalCompressed(key.Curve, key.X, key.Y)
+	case *rsa.PublicKey:
+		code, raw = codecRSA, x509.MarshalPKCS1PublicKey(key)
+	default:
+		return "", fmt.Errorf("unsupported key type %T", publicKey)
+	}
+
+	prefix := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(prefix, code)
+	return "z" + base58Encode(append(prefix[:n], raw...)), nil
+}
+
+// ParseMultibase decodes a public key encoded by Multibase
+func ParseMultibase(multibase string) (crypto.PublicKey, error) {
+	if len(multibase) < 2 || multibase[0] != 'z' {
+		return nil, fmt.Errorf("unsupported multibase encoding, expected base58btc (z)")
+	}
+	data, err := base58Decode(multibase[1:])
+	if err != nil {
+		return nil, err
+	}
+	code, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid multicodec prefix")
+	}
+	raw := data[n:]
+
+	var curve elliptic.Curve
+	switch code {
+	case codecEd25519:
+		if len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(raw), nil
+	case codecRSA:
+		return x509.ParsePKCS1PublicKey(raw)
+	case codecP256:
+		curve = elliptic.P256()
+	case codecP384:
+		curve = elliptic.P384()
+	case codecP521:
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported multicodec 0x%x", code)
+	}
+	x, y := elliptic.UnmarshalCompressed(curve, raw)
+	if x == nil {
+		return nil, fmt.Errorf("invalid %s public key", curve.Params().Name)
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
@@ -0,0 +1,50 @@
+package did
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WebMethod did:web, the identifier is the domain of the organization followed by
+// the path of the participant, ex: did:web:example.com:participants:<name>
+type WebMethod struct{}
+
+func (WebMethod) Name() string { return "web" }
+
+func (WebMethod) Generate(params Params) (string, error) {
+	if params.Domain == "" {
+		return "", fmt.Errorf("did:web requires the domain of the organization")
+	}
+	name, err := localName(params)
+	if err != nil {
+		return "", err
+	}
+	// a port is percent encoded, ex: localhost%3A8443
+	domain := strings.ReplaceAll(params.Domain, ":", "%3A")
+	return "did:web:" + domain + ":participants:" + name, nil
+}
+
+// Parse requires the host of the domain, the port is optional
+func (m WebMethod) Parse(did string) (*DID, error) {
+	parsed, err := parseMethod(did, m.Name())
+	if err != nil {
+		return nil, err
+	}
+	domain := strings.SplitN(parsed.ID, ":", 2)[0]
+	if host := strings.SplitN(domain, "%3A", 2)[0]; host == "" {
+		return nil, fmt.Errorf("invalid did:web %s, expected did:web:<domain>[:<path>]", did)
+	}
+	return parsed, nil
+}
+
+func (m WebMethod) Validate(did string, params Params) error {
+	parsed, err := m.Parse(did)
+	if err != nil {
+		return err
+	}
+	domain := strings.SplitN(parsed.ID, ":", 2)[0]
+	if params.Domain != "" && domain != strings.ReplaceAll(params.Domain, ":", "%3A") {
+		return fmt.Errorf("%s does not belong to the domain %s", did, params.Domain)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+// Package didauth runs the challenge-response DID authentication of the identity
+// chaincode from a gateway or any off-chain application:
+//
+//	client := didauth.NewClient(contract) // fabric-gateway *client.Contract
+//	assertion, err := client.Login(did, "https://app.example.com", privateKey)
+//
+// The assertion is a JWS signed by the chaincode, relying parties validate it
+// with VerifyAssertion, the public key of the chaincode assertion key, the channel
+// of the chaincode and their own audience:
+//
+//	claims, err := didauth.VerifyAssertion(assertion.Jws, publicKey, "mychannel", "https://app.example.com")
+package didauth
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/keys"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// transactions of the identity chaincode
+const (
+	TxCreateAuthChallenge = "CreateAuthChallenge"
+	TxVerifyAuthResponse  = "VerifyAuthResponse"
+	TxGetAuthAssertion    = "GetAuthAssertion"
+)
+
+// Submitter is the subset of a Fabric gateway contract used by the client,
+// it is satisfied by the fabric-gateway and fabric-sdk-go contracts
+type Submitter interface {
+	SubmitTransaction(name string, args ...string) ([]byte, error)
+	EvaluateTransaction(name string, args ...string) ([]byte, error)
+}
+
+// Challenge stored by CreateAuthChallenge
+type Challenge struct {
+	ID          string `json:"id"`
+	Did         string `json:"did"`
+	Audience    string `json:"audience"`
+	Challenge   string `json:"challenge"`
+	ExpiresTime string `json:"expiresTime"`
+}
+
+// ResponsePayload payload of the JWS signed by the participant key
+type ResponsePayload struct {
+	ChallengeID string `json:"challengeId"`
+	Challenge   string `json:"challenge"`
+	Did         string `json:"did"`
+	Audience    string `json:"aud"`
+}
+
+// AssertionClaims payload of the assertion signed by the chaincode, times are unix seconds
+type AssertionClaims struct {
+	Issuer      string `json:"iss"` // channel of the chaincode
+	Subject     string `json:"sub"` // participant DID
+	Audience    string `json:"aud"`
+	ChallengeID string `json:"jti"`
+	IssuedAt    int64  `json:"iat"`
+	ExpiresAt   int64  `json:"exp"`
+}
+
+// Assertion returned by GetAuthAssertion
+type Assertion struct {
+	Did         string `json:"did"`
+	Audience    string `json:"audience"`
+	ExpiresTime string `json:"expiresTime"`
+	Jws         string `json:"jws"`
+}
+
+// Client runs the authentication flow against the identity chaincode
+type Client struct {
+	contract Submitter
+}
+
+// NewClient
+func NewClient(contract Submitter) *Client {
+	return &Client{contract: contract}
+}
+
+// CreateChallenge submits CreateAuthChallenge, ttl is in seconds (0, chaincode default)
+func (c *Client) CreateChallenge(did, audience string, ttl int) (*Challenge, error) {
+	request, err := json.Marshal(map[string]interface{}{"did": did, "audience": audience, "ttl": ttl})
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.contract.SubmitTransaction(TxCreateAuthChallenge, string(request))
+	if err != nil {
+		return nil, err
+	}
+
+	var challenge Challenge
+	if err := json.Unmarshal(result, &challenge); err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// VerifyResponse submits VerifyAuthResponse with the signed response, the challenge
+// is consumed, and once it is committed evaluates GetAuthAssertion
+func (c *Client) VerifyResponse(challengeID, jws string) (*Assertion, error) {
+	request, err := json.Marshal(map[string]string{"challengeId": challengeID, "jws": jws})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.contract.SubmitTransaction(TxVerifyAuthResponse, string(request)); err != nil {
+		return nil, err
+	}
+
+	request, err = json.Marshal(map[string]string{"id": challengeID})
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.contract.EvaluateTransaction(TxGetAuthAssertion, string(request))
+	if err != nil {
+		return nil, err
+	}
+
+	var assertion Assertion
+	if err := json.Unmarshal(result, &assertion); err != nil {
+		return nil, err
+	}
+	return &assertion, nil
+}
+
+// Login creates a challenge, signs it with the participant key and returns the assertion
+func (c *Client) Login(did, audience string, key crypto.Signer) (*Assertion, error) {
+	challenge, err := c.CreateChallenge(did, audience, 0)
+	if err != nil {
+		return nil, err
+	}
+	jws, err := SignResponse(challenge, key)
+	if err != nil {
+		return nil, err
+	}
+	return c.VerifyResponse(challenge.ID, jws)
+}
+
+// SignResponse signs the response of a challenge with the participant private key
+func SignResponse(challenge *Challenge, key crypto.Signer) (string, error) {
+	payload, err := json.Marshal(ResponsePayload{
+		ChallengeID: challenge.ID,
+		Challenge:   challenge.Challenge,
+		Did:         challenge.Did,
+		Audience:    challenge.Audience,
+	})
+	if err != nil {
+		return "", err
+	}
+	return Sign(payload, key)
+}
+
+// Sign returns the compact JWS of the payload, the algorithm is chosen from the key
+func Sign(payload []byte, key crypto.Signer) (string, error) {
+	alg, err := SigningAlgorithm(key.Public())
+	if err != nil {
+		return "", err
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: key}, nil)
+	if err != nil {
+		return "", err
+	}
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return jws.CompactSerialize()
+}
+
+// VerifyAssertion verifies the assertion JWS with the public key of the chaincode
+// assertion key, checks that it was issued by the chaincode of the channel for the
+// audience and that it is not expired
+func VerifyAssertion(jws string, publicKey crypto.PublicKey, issuer, audience string) (*AssertionClaims, error) {
+	payload, err := keys.VerifyJWS(jws, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims AssertionClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, err
+	}
+	if claims.Issuer != issuer {
+		return nil, fmt.Errorf("assertion issued by %s, expected %s", claims.Issuer, issuer)
+	}
+	if claims.Audience != audience {
+		return nil, fmt.Errorf("assertion for the audience %s, expected %s", claims.Audience, audience)
+	}
+	if time.Now().Unix() > claims.ExpiresAt {
+		return nil, fmt.Errorf("assertion for %s expired", claims.Subject)
+	}
+	return &claims, nil
+}
+
+// SigningAlgorithm JWS algorithm of a public key
+func SigningAlgorithm(publicKey crypto.PublicKey) (jose.SignatureAlgorithm, error) {
+	return keys.DefaultAlgorithm(publicKey)
+}
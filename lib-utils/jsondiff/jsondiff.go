@@ -0,0 +1,248 @@
+// Package jsondiff field-level differences of JSON documents as RFC 6902 JSON Patch
+// operations, the paths are RFC 6901 JSON pointers
+package jsondiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Operations, only add, remove and replace are generated
+const (
+	OpAdd     = "add"
+	OpRemove  = "remove"
+	OpReplace = "replace"
+)
+
+// Operation RFC 6902 operation
+type Operation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty" metadata:",optional"` // add and replace
+}
+
+// MarshalJSON the value of add and replace is always written, even if null
+func (o Operation) MarshalJSON() ([]byte, error) {
+	if o.Op == OpRemove {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{o.Op, o.Path})
+	}
+	return json.Marshal(struct {
+		Op    string      `json:"op"`
+		Path  string      `json:"path"`
+		Value interface{} `json:"value"`
+	}{o.Op, o.Path, o.Value})
+}
+
+// Diff returns the patch that transforms the document a into b. An empty document
+// does not exist: the patch of a new document adds it at the root, the patch of a
+// removed document removes the root. The members of the objects are compared in
+// order, the arrays element by element if they have the same length, else replaced
+func Diff(a, b []byte) ([]Operation, error) {
+	if len(a) == 0 && len(b) == 0 {
+		return []Operation{}, nil
+	}
+	if len(a) == 0 {
+		value, err := decode(b)
+		if err != nil {
+			return nil, err
+		}
+		return []Operation{{Op: OpAdd, Path: "", Value: value}}, nil
+	}
+	if len(b) == 0 {
+		return []Operation{{Op: OpRemove, Path: ""}}, nil
+	}
+
+	va, err := decode(a)
+	if err != nil {
+		return nil, err
+	}
+	vb, err := decode(b)
+	if err != nil {
+		return nil, err
+	}
+	operations := make([]Operation, 0)
+	diff("", va, vb, &operations)
+	return operations, nil
+}
+
+func diff(path string, a, b interface{}, operations *[]Operation) {
+	switch va := a.(type) {
+	case map[string]interface{}:
+		vb, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(va)+len(vb))
+		for key := range va {
+			keys = append(keys, key)
+		}
+		for key := range vb {
+			if _, ok := va[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			memberA, inA := va[key]
+			memberB, inB := vb[key]
+			child := path + "/" + Escape(key)
+			switch {
+			case !inB:
+				*operations = append(*operations, Operation{Op: OpRemove, Path: child})
+			case !inA:
+				*operations = append(*operations, Operation{Op: OpAdd, Path: child, Value: memberB})
+			default:
+				diff(child, memberA, memberB, operations)
+			}
+		}
+		return
+	case []interface{}:
+		vb, ok := b.([]interface{})
+		if !ok || len(va) != len(vb) {
+			break
+		}
+		for i := range va {
+			diff(path+"/"+strconv.Itoa(i), va[i], vb[i], operations)
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		*operations = append(*operations, Operation{Op: OpReplace, Path: path, Value: b})
+	}
+}
+
+// Apply applies the patch to the document, an empty result is a removed document
+func Apply(document []byte, patch []Operation) ([]byte, error) {
+	var root interface{}
+	if len(document) > 0 {
+		var err error
+		if root, err = decode(document); err != nil {
+			return nil, err
+		}
+	}
+	exists := len(document) > 0
+	for _, operation := range patch {
+		if operation.Path == "" {
+			switch operation.Op {
+			case OpRemove:
+				root, exists = nil, false
+			case OpAdd, OpReplace:
+				root, exists = operation.Value, true
+			default:
+				return nil, fmt.Errorf("unsupported operation %s", operation.Op)
+			}
+			continue
+		}
+		if !exists {
+			return nil, fmt.Errorf("%s %s: the document does not exist", operation.Op, operation.Path)
+		}
+		var err error
+		if root, err = apply(root, split(operation.Path), operation); err != nil {
+			return nil, fmt.Errorf("%s %s: %v", operation.Op, operation.Path, err)
+		}
+	}
+	if !exists {
+		return []byte{}, nil
+	}
+	return json.Marshal(root)
+}
+
+// apply applies the operation to the member of the tokens of the value, returns the value
+func apply(value interface{}, tokens []string, operation Operation) (interface{}, error) {
+	token := tokens[0]
+	last := len(tokens) == 1
+	switch v := value.(type) {
+	case map[string]interface{}:
+		member, ok := v[token]
+		if !last {
+			if !ok {
+				return nil, fmt.Errorf("member %s does not exist", token)
+			}
+			child, err := apply(member, tokens[1:], operation)
+			if err != nil {
+				return nil, err
+			}
+			v[token] = child
+			return v, nil
+		}
+		switch operation.Op {
+		case OpAdd:
+			v[token] = operation.Value
+		case OpReplace, OpRemove:
+			if !ok {
+				return nil, fmt.Errorf("member %s does not exist", token)
+			}
+			if operation.Op == OpRemove {
+				delete(v, token)
+			} else {
+				v[token] = operation.Value
+			}
+		default:
+			return nil, fmt.Errorf("unsupported operation %s", operation.Op)
+		}
+		return v, nil
+	case []interface{}:
+		if last && operation.Op == OpAdd && token == "-" {
+			return append(v, operation.Value), nil
+		}
+		i, err := strconv.Atoi(token)
+		if err != nil || i < 0 || i > len(v) || (i == len(v) && !(last && operation.Op == OpAdd)) {
+			return nil, fmt.Errorf("invalid array index %s", token)
+		}
+		if !last {
+			child, err := apply(v[i], tokens[1:], operation)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = child
+			return v, nil
+		}
+		switch operation.Op {
+		case OpAdd:
+			v = append(v, nil)
+			copy(v[i+1:], v[i:])
+			v[i] = operation.Value
+		case OpReplace:
+			v[i] = operation.Value
+		case OpRemove:
+			v = append(v[:i], v[i+1:]...)
+		default:
+			return nil, fmt.Errorf("unsupported operation %s", operation.Op)
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("%s is not a container", token)
+}
+
+// Escape escapes a member name as a JSON pointer reference token
+func Escape(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
+
+// split the reference tokens of a JSON pointer
+func split(pointer string) []string {
+	tokens := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens
+}
+
+// decode decodes the JSON document, the numbers are kept as json.Number
+func decode(document []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
@@ -0,0 +1,246 @@
+// Package keys normalizes the public keys accepted by the identity chaincode:
+// ECDSA P-256, P-384 and P-521, RSA of at least MinRSABits bits (PKCS #1 v1.5 and
+// PSS signatures) and Ed25519. Every key is exported as SPKI (DER) and as JWK, and
+// it only verifies the JWS algorithms of its type. The SPKI of the RSA keys with the
+// id-RSASSA-PSS algorithm are parsed too, they are exported as rsaEncryption.
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// MinRSABits minimum size of the RSA keys
+const MinRSABits = 2048
+
+// oidRSASSAPSS id-RSASSA-PSS, RFC 4055, crypto/x509 only parses it as signature algorithm
+var oidRSASSAPSS = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+
+// subjectPublicKeyInfo SPKI of RFC 5280
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// ErrUnsupportedKey the key type, or its curve, is not supported
+var ErrUnsupportedKey = errors.New("unsupported public key")
+
+// Normalize checks that the public key is supported and strong enough and returns it
+// in the form used by crypto/x509, ex: a *ed25519.PublicKey is returned by value
+func Normalize(publicKey crypto.PublicKey) (crypto.PublicKey, error) {
+	switch key := publicKey.(type) {
+	case *jose.JSONWebKey:
+		if key == nil || !key.IsPublic() {
+			return nil, ErrUnsupportedKey
+		}
+		return Normalize(key.Key)
+	case ed25519.PublicKey:
+		if len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 public key size %d", len(key))
+		}
+		return key, nil
+	case *ed25519.PublicKey:
+		if key == nil {
+			return nil, ErrUnsupportedKey
+		}
+		return Normalize(*key)
+	case *ecdsa.PublicKey:
+		if key == nil || key.X == nil || key.Y == nil {
+			return nil, ErrUnsupportedKey
+		}
+		if _, err := curveAlgorithm(key.Curve); err != nil {
+			return nil, err
+		}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("invalid %s public key, the point is not on the curve", key.Curve.Params().Name)
+		}
+		return key, nil
+	case *rsa.PublicKey:
+		if key == nil || key.N == nil {
+			return nil, ErrUnsupportedKey
+		}
+		if key.N.BitLen() < MinRSABits {
+			return nil, fmt.Errorf("weak RSA public key of %d bits, at least %d bits are required", key.N.BitLen(), MinRSABits)
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w %T", ErrUnsupportedKey, publicKey)
+}
+
+// Algorithms JWS algorithms permitted for the public key, the first one is the default
+func Algorithms(publicKey crypto.PublicKey) ([]jose.SignatureAlgorithm, error) {
+	key, err := Normalize(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		return []jose.SignatureAlgorithm{jose.EdDSA}, nil
+	case *ecdsa.PublicKey:
+		alg, err := curveAlgorithm(key.Curve)
+		if err != nil {
+			return nil, err
+		}
+		return []jose.SignatureAlgorithm{alg}, nil
+	default: // *rsa.PublicKey
+		return []jose.SignatureAlgorithm{jose.RS256, jose.RS384, jose.RS512, jose.PS256, jose.PS384, jose.PS512}, nil
+	}
+}
+
+// DefaultAlgorithm JWS algorithm used to sign with the key
+func DefaultAlgorithm(publicKey crypto.PublicKey) (jose.SignatureAlgorithm, error) {
+	algorithms, err := Algorithms(publicKey)
+	if err != nil {
+		return "", err
+	}
+	return algorithms[0], nil
+}
+
+// Allows returns an error if the JWS algorithm is not permitted for the public key
+func Allows(publicKey crypto.PublicKey, alg string) error {
+	algorithms, err := Algorithms(publicKey)
+	if err != nil {
+		return err
+	}
+	for _, allowed := range algorithms {
+		if string(allowed) == alg {
+			return nil
+		}
+	}
+	return fmt.Errorf("the JWS algorithm %s is not allowed for the public key, expected one of %v", alg, algorithms)
+}
+
+// FromCertificate normalized public key of the certificate
+func FromCertificate(cert *x509.Certificate) (crypto.PublicKey, error) {
+	if cert.PublicKeyAlgorithm == x509.UnknownPublicKeyAlgorithm {
+		return ParseSPKI(cert.RawSubjectPublicKeyInfo)
+	}
+	return Normalize(cert.PublicKey)
+}
+
+// ParsePKIXPublicKey parses a SPKI (DER) public key like x509.ParsePKIXPublicKey, and
+// the RSA keys of the id-RSASSA-PSS algorithm. The PSS parameters are not kept
+func ParsePKIXPublicKey(der []byte) (crypto.PublicKey, error) {
+	publicKey, err := x509.ParsePKIXPublicKey(der)
+	if err == nil {
+		return publicKey, nil
+	}
+
+	var spki subjectPublicKeyInfo
+	if rest, asn1Err := asn1.Unmarshal(der, &spki); asn1Err != nil || len(rest) > 0 || !spki.Algorithm.Algorithm.Equal(oidRSASSAPSS) {
+		return nil, err
+	}
+	rsaKey, pkcs1Err := x509.ParsePKCS1PublicKey(spki.PublicKey.RightAlign())
+	if pkcs1Err != nil {
+		return nil, fmt.Errorf("invalid RSA-PSS public key: %v", pkcs1Err)
+	}
+	return rsaKey, nil
+}
+
+// ParseSPKI parses and normalizes a SPKI (DER) public key
+func ParseSPKI(der []byte) (crypto.PublicKey, error) {
+	publicKey, err := ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	return Normalize(publicKey)
+}
+
+// ParseSPKIBase64 parses and normalizes a base64 SPKI (DER) public key
+func ParseSPKIBase64(publicKeyBase64 string) (crypto.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(publicKeyBase64)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSPKI(der)
+}
+
+// SPKI marshals the normalized public key as SPKI (DER)
+func SPKI(publicKey crypto.PublicKey) ([]byte, error) {
+	key, err := Normalize(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return x509.MarshalPKIXPublicKey(key)
+}
+
+// SPKIBase64 marshals the normalized public key as base64 SPKI (DER), the format of
+// the public key of the participants
+func SPKIBase64(publicKey crypto.PublicKey) (string, error) {
+	der, err := SPKI(publicKey)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(der), nil
+}
+
+// JWK public JWK of the key, with use sig, the default algorithm and the RFC 7638
+// thumbprint as kid
+func JWK(publicKey crypto.PublicKey) (*jose.JSONWebKey, error) {
+	key, err := Normalize(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	alg, err := DefaultAlgorithm(key)
+	if err != nil {
+		return nil, err
+	}
+	jwk := &jose.JSONWebKey{Key: key, Algorithm: string(alg), Use: "sig"}
+	thumbprint, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	jwk.KeyID = base64.RawURLEncoding.EncodeToString(thumbprint)
+	return jwk, nil
+}
+
+// Thumbprint RFC 7638 SHA-256 thumbprint of the public key, base64url encoded
+func Thumbprint(publicKey crypto.PublicKey) (string, error) {
+	jwk, err := JWK(publicKey)
+	if err != nil {
+		return "", err
+	}
+	return jwk.KeyID, nil
+}
+
+// VerifyJWS verifies a compact or JSON serialized JWS with the public key, the
+// algorithm of the JWS must be permitted for the key
+func VerifyJWS(jws string, publicKey crypto.PublicKey) ([]byte, error) {
+	key, err := Normalize(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	object, err := jose.ParseSigned(jws)
+	if err != nil {
+		return nil, err
+	}
+	for _, signature := range object.Signatures {
+		if err := Allows(key, signature.Header.Algorithm); err != nil {
+			return nil, err
+		}
+	}
+	return object.Verify(key)
+}
+
+func curveAlgorithm(curve elliptic.Curve) (jose.SignatureAlgorithm, error) {
+	switch curve {
+	case elliptic.P256():
+		return jose.ES256, nil
+	case elliptic.P384():
+		return jose.ES384, nil
+	case elliptic.P521():
+		return jose.ES512, nil
+	}
+	return "", fmt.Errorf("%w, curve %s", ErrUnsupportedKey, curve.Params().Name)
+}
@@ -0,0 +1,151 @@
+// Package migration schema versions of the JSON documents of the world state. Every doc
+// type has a chain of migrations, the migration i upgrades a document of version i+1 to
+// version i+2, so the current version of a doc type is one more than its migrations.
+//
+// The documents stored before the versioning have no schemaVersion member and are of
+// version 1. The version is the first member of the migrated and stamped documents.
+package migration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// VersionField member of the documents with their schema version
+const VersionField = "schemaVersion"
+
+// Func upgrades a decoded document by one version, the numbers are json.Number and the
+// schemaVersion member is not present
+type Func func(doc map[string]interface{}) error
+
+// Registry migrations by doc type
+type Registry struct {
+	migrations map[string][]Func
+}
+
+// NewRegistry returns an empty registry, every doc type is at version 1
+func NewRegistry() *Registry {
+	return &Registry{migrations: make(map[string][]Func)}
+}
+
+// Register appends migrations to the chain of the doc type, each one increments its
+// current version
+func (r *Registry) Register(docType string, migrations ...Func) {
+	r.migrations[docType] = append(r.migrations[docType], migrations...)
+}
+
+// Version returns the current schema version of the doc type
+func (r *Registry) Version(docType string) int {
+	return 1 + len(r.migrations[docType])
+}
+
+// Outdated returns true when the document is not stamped with the current version of
+// its doc type, it would be changed by Migrate
+func (r *Registry) Outdated(docType string, value []byte) (bool, error) {
+	version, ok, err := DocumentVersion(value)
+	if err != nil {
+		return false, err
+	}
+	current := r.Version(docType)
+	if ok && (version < 1 || version > current) {
+		return false, fmt.Errorf("%s document of schema version %d, expected 1 to %d", docType, version, current)
+	}
+	return !ok || version < current, nil
+}
+
+// Migrate upgrades the document to the current version of its doc type and stamps it,
+// returns false when the document was already current. A document of a newer version
+// than the current one is an error, it was written by a newer chaincode
+func (r *Registry) Migrate(docType string, value []byte) ([]byte, bool, error) {
+	version, ok, err := DocumentVersion(value)
+	if err != nil {
+		return nil, false, err
+	}
+	current := r.Version(docType)
+	switch {
+	case !ok:
+		version = 1
+	case version == current:
+		return value, false, nil
+	case version < 1 || version > current:
+		return nil, false, fmt.Errorf("%s document of schema version %d, expected 1 to %d", docType, version, current)
+	}
+	if version == current {
+		return stamp(value, current), true, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	var doc map[string]interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, false, err
+	}
+	delete(doc, VersionField)
+	for i, migration := range r.migrations[docType][version-1:] {
+		if err := migration(doc); err != nil {
+			return nil, false, fmt.Errorf("migration of %s from schema version %d: %v", docType, version+i, err)
+		}
+	}
+	docJE, err := json.Marshal(doc)
+	if err != nil {
+		return nil, false, err
+	}
+	return stamp(docJE, current), true, nil
+}
+
+// Stamp returns the document written by the current code with the current version of
+// its doc type. A document that already has a version is migrated from it
+func (r *Registry) Stamp(docType string, value []byte) ([]byte, error) {
+	_, ok, err := DocumentVersion(value)
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return stamp(value, r.Version(docType)), nil
+	}
+	value, _, err = r.Migrate(docType, value)
+	return value, err
+}
+
+// DocumentVersion returns the schema version of the document, false if it has none
+func DocumentVersion(value []byte) (int, bool, error) {
+	var header struct {
+		SchemaVersion *int `json:"schemaVersion"`
+	}
+	if trimmed := bytes.TrimSpace(value); len(trimmed) == 0 || trimmed[0] != '{' {
+		return 0, false, fmt.Errorf("invalid document: not a JSON object")
+	}
+	if err := json.Unmarshal(value, &header); err != nil {
+		return 0, false, fmt.Errorf("invalid document: %v", err)
+	}
+	if header.SchemaVersion == nil {
+		return 0, false, nil
+	}
+	return *header.SchemaVersion, true, nil
+}
+
+// WithVersion returns the unversioned document stamped with the version it was written
+// with, to be migrated from it. Used for the copies of documents kept inside others
+func WithVersion(value []byte, version int) ([]byte, error) {
+	if _, ok, err := DocumentVersion(value); err != nil {
+		return nil, err
+	} else if ok {
+		return nil, fmt.Errorf("the document already has a schema version")
+	}
+	if version < 1 {
+		version = 1
+	}
+	return stamp(value, version), nil
+}
+
+// stamp inserts the version as the first member of a document that has none
+func stamp(value []byte, version int) []byte {
+	value = bytes.TrimSpace(value)
+	stamped := make([]byte, 0, len(value)+len(VersionField)+8)
+	stamped = append(stamped, `{"`+VersionField+`":`+strconv.Itoa(version)...)
+	if rest := bytes.TrimSpace(value[1:]); len(rest) > 0 && rest[0] != '}' {
+		stamped = append(stamped, ',')
+	}
+	return append(stamped, value[1:]...)
+}
@@ -0,0 +1,75 @@
+package libutils
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// OCSPMaxAge maximum age of an OCSP response without nextUpdate
+const OCSPMaxAge = 24 * time.Hour
+
+// OCSPStatus name of an OCSP certificate status
+func OCSPStatus(status int) string {
+	switch status {
+	case ocsp.Good:
+		return "good"
+	case ocsp.Revoked:
+		return "revoked"
+	default:
+		return "unknown"
+	}
+}
+
+// VerifyOCSPResponse verifies a base64 DER OCSP response of the certificate, signed by
+// the issuer or by a responder delegated by the issuer, and valid at the given time.
+// Revoked and unknown statuses are rejected
+func VerifyOCSPResponse(responseBase64 string, cert, issuer *x509.Certificate, at time.Time) (*ocsp.Response, error) {
+	der, err := base64.StdEncoding.DecodeString(responseBase64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode OCSP response: %v", err)
+	}
+	if err := cert.CheckSignatureFrom(issuer); err != nil {
+		return nil, fmt.Errorf("the certificate was not issued by the OCSP issuer: %v", err)
+	}
+	response, err := ocsp.ParseResponseForCert(der, cert, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OCSP response: %v", err)
+	}
+	// a delegated responder must be authorized by the issuer to sign OCSP responses
+	if response.Certificate != nil && !hasExtKeyUsage(response.Certificate, x509.ExtKeyUsageOCSPSigning) {
+		return nil, fmt.Errorf("the OCSP responder %s is not authorized to sign OCSP responses", response.Certificate.Subject)
+	}
+
+	if at.Before(response.ThisUpdate) {
+		return nil, fmt.Errorf("OCSP response is not valid before %s", response.ThisUpdate.Format(time.RFC3339))
+	}
+	if !response.NextUpdate.IsZero() {
+		if !at.Before(response.NextUpdate) {
+			return nil, fmt.Errorf("OCSP response expired at %s", response.NextUpdate.Format(time.RFC3339))
+		}
+	} else if at.Sub(response.ThisUpdate) > OCSPMaxAge {
+		return nil, fmt.Errorf("OCSP response of %s is older than %s", response.ThisUpdate.Format(time.RFC3339), OCSPMaxAge)
+	}
+
+	switch response.Status {
+	case ocsp.Good:
+		return response, nil
+	case ocsp.Revoked:
+		return nil, fmt.Errorf("certificate %s was revoked at %s", cert.SerialNumber, response.RevokedAt.Format(time.RFC3339))
+	default:
+		return nil, fmt.Errorf("certificate %s has an unknown OCSP status", cert.SerialNumber)
+	}
+}
+
+func hasExtKeyUsage(cert *x509.Certificate, usage x509.ExtKeyUsage) bool {
+	for _, u := range cert.ExtKeyUsage {
+		if u == usage {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,350 @@
+// Package query typed queries of the state database. A Query is checked against the
+// Collection of its doc type, only whitelisted fields, operators and sort keys are
+// allowed, and it is compiled to a CouchDB (Mango) query that uses a declared index
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Operators
+const (
+	OpEq        = "$eq"
+	OpNe        = "$ne"
+	OpGt        = "$gt"
+	OpGte       = "$gte"
+	OpLt        = "$lt"
+	OpLte       = "$lte"
+	OpIn        = "$in"        // the field is one of values
+	OpExists    = "$exists"    // value true or false
+	OpElemMatch = "$elemMatch" // the array field contains value
+)
+
+// MaxPageSize maximum page size of a query
+const MaxPageSize = 100
+
+// maxInValues maximum number of values of an $in condition
+const maxInValues = 100
+
+// Kind JSON type of a field
+type Kind int
+
+const (
+	String Kind = iota
+	Bool
+	Number
+	StringArray
+)
+
+// Field field of a collection that can be read by a query. A field without operators
+// can be returned but not filtered
+type Field struct {
+	Kind     Kind
+	Ops      []string
+	Sortable bool
+}
+
+// Index CouchDB index of a collection, see META-INF/statedb/couchdb/indexes
+type Index struct {
+	DesignDoc string
+	Name      string
+	Fields    []string
+}
+
+// Collection queryable doc type
+type Collection struct {
+	DocType string
+	Fields  map[string]Field
+	Indexes []Index
+}
+
+// Predicate condition of a query, values are converted to the kind of the field. Named
+// apart from abac.Condition, the contract metadata has one schema per type name
+type Predicate struct {
+	Field  string   `json:"field"`
+	Op     string   `json:"op"`
+	Value  string   `json:"value,omitempty" metadata:",optional"`
+	Values []string `json:"values,omitempty" metadata:",optional"` // $in
+}
+
+// SortField sort key of a query
+type SortField struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc,omitempty" metadata:",optional"`
+}
+
+// Query typed query of a doc type, the conditions are combined with AND
+type Query struct {
+	DocType  string      `json:"docType"`
+	Where    []Predicate `json:"where,omitempty" metadata:",optional"`
+	Sort     []SortField `json:"sort,omitempty" metadata:",optional"`
+	Fields   []string    `json:"fields,omitempty" metadata:",optional"` // empty, every field of the collection
+	PageSize int         `json:"pageSize"`
+	Bookmark string      `json:"bookmark,omitempty" metadata:",optional"`
+}
+
+// Compiled Mango query string and the index it uses
+type Compiled struct {
+	QueryString string
+	PageSize    int32
+	Bookmark    string
+	Index       Index
+}
+
+// Compile checks the query against the collection and compiles it to Mango
+func (c *Collection) Compile(q Query) (*Compiled, error) {
+	if q.DocType != c.DocType {
+		return nil, fmt.Errorf("query of %s can not be run on %s", q.DocType, c.DocType)
+	}
+	if q.PageSize < 1 || q.PageSize > MaxPageSize {
+		return nil, fmt.Errorf("pageSize must be between 1 and %d", MaxPageSize)
+	}
+
+	selector := map[string]map[string]interface{}{
+		"docType": {OpEq: c.DocType},
+	}
+	for _, cond := range q.Where {
+		if cond.Field == "docType" {
+			return nil, fmt.Errorf("docType can not be filtered, it is the doc type of the query")
+		}
+		field, ok := c.Fields[cond.Field]
+		if !ok {
+			return nil, fmt.Errorf("field %s is not allowed in %s queries", cond.Field, c.DocType)
+		}
+		if !contains(field.Ops, cond.Op) {
+			return nil, fmt.Errorf("operator %s is not allowed on %s, expected one of %v", cond.Op, cond.Field, field.Ops)
+		}
+		value, err := field.operand(cond)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s: %v", cond.Field, err)
+		}
+		ops, ok := selector[cond.Field]
+		if !ok {
+			ops = make(map[string]interface{})
+			selector[cond.Field] = ops
+		}
+		if _, ok := ops[cond.Op]; ok {
+			return nil, fmt.Errorf("operator %s is repeated on %s", cond.Op, cond.Field)
+		}
+		ops[cond.Op] = value
+	}
+
+	var mangoSort []map[string]string
+	for i, s := range q.Sort {
+		field, ok := c.Fields[s.Field]
+		if !ok || !field.Sortable {
+			return nil, fmt.Errorf("%s queries can not be sorted by %s", c.DocType, s.Field)
+		}
+		// CouchDB sorts every field in the same direction
+		if s.Desc != q.Sort[0].Desc {
+			return nil, fmt.Errorf("all sort fields must have the same direction")
+		}
+		if i == 0 {
+			// the sort of CouchDB requires the docType field of the index
+			mangoSort = append(mangoSort, map[string]string{"docType": direction(s.Desc)})
+		}
+		mangoSort = append(mangoSort, map[string]string{s.Field: direction(s.Desc)})
+		// a sort field must be in the selector to use its index
+		if _, ok := selector[s.Field]; !ok {
+			selector[s.Field] = map[string]interface{}{OpExists: true}
+		}
+	}
+
+	index, err := c.index(selector, q.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := c.projection(q.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	mango := map[string]interface{}{
+		"selector":  selector,
+		"fields":    fields,
+		"use_index": []string{"_design/" + index.DesignDoc, index.Name},
+	}
+	if len(mangoSort) > 0 {
+		mango["sort"] = mangoSort
+	}
+	queryString, err := json.Marshal(mango)
+	if err != nil {
+		return nil, err
+	}
+	return &Compiled{
+		QueryString: string(queryString),
+		PageSize:    int32(q.PageSize),
+		Bookmark:    q.Bookmark,
+		Index:       index,
+	}, nil
+}
+
+// index the declared index of the query, the one with more fields if there are several.
+// CouchDB only uses an index if every field of the index is in the selector, and the
+// sort fields must be in the index in the same order
+func (c *Collection) index(selector map[string]map[string]interface{}, sortFields []SortField) (Index, error) {
+	var best *Index
+	for i := range c.Indexes {
+		index := &c.Indexes[i]
+		if !covers(index, selector, sortFields) {
+			continue
+		}
+		if best == nil || len(index.Fields) > len(best.Fields) {
+			best = index
+		}
+	}
+	if best == nil {
+		return Index{}, fmt.Errorf("no index of %s covers the query", c.DocType)
+	}
+	return *best, nil
+}
+
+func covers(index *Index, selector map[string]map[string]interface{}, sortFields []SortField) bool {
+	for _, name := range index.Fields {
+		if _, ok := selector[name]; !ok {
+			return false
+		}
+	}
+	position := 0
+	for _, s := range sortFields {
+		found := false
+		for ; position < len(index.Fields); position++ {
+			if index.Fields[position] == s.Field {
+				found = true
+				position++
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// projection fields returned by the query, only the fields of the collection can be read
+func (c *Collection) projection(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		fields := make([]string, 0, len(c.Fields)+1)
+		fields = append(fields, "docType")
+		for name := range c.Fields {
+			fields = append(fields, name)
+		}
+		sort.Strings(fields[1:])
+		return fields, nil
+	}
+	fields := make([]string, 0, len(requested))
+	for _, name := range requested {
+		if _, ok := c.Fields[name]; !ok && name != "docType" {
+			return nil, fmt.Errorf("field %s can not be read in %s queries", name, c.DocType)
+		}
+		if !contains(fields, name) {
+			fields = append(fields, name)
+		}
+	}
+	return fields, nil
+}
+
+// Shapes single field queries accepted by the collection, one per filterable field and
+// one per sort key, in field order. Array fields are not included, CouchDB can not use an
+// index for $elemMatch, nor is the query of the doc type only, that scans the collection
+func (c *Collection) Shapes() []Query {
+	names := make([]string, 0, len(c.Fields))
+	for name := range c.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var shapes []Query
+	for _, name := range names {
+		field := c.Fields[name]
+		if len(field.Ops) > 0 && field.Kind != StringArray {
+			cond := Predicate{Field: name, Op: field.Ops[0], Value: field.sample()}
+			switch cond.Op {
+			case OpExists:
+				cond.Value = "true"
+			case OpIn:
+				cond.Values = []string{cond.Value}
+				cond.Value = ""
+			}
+			shapes = append(shapes, Query{DocType: c.DocType, Where: []Predicate{cond}, PageSize: 1})
+		}
+		if field.Sortable {
+			shapes = append(shapes, Query{DocType: c.DocType, Sort: []SortField{{Field: name}}, PageSize: 1})
+		}
+	}
+	return shapes
+}
+
+// sample a valid value of the kind of the field
+func (f Field) sample() string {
+	switch f.Kind {
+	case Bool:
+		return "true"
+	case Number:
+		return "0"
+	default:
+		return "sample"
+	}
+}
+
+// operand value of the condition, converted to the kind of the field
+func (f Field) operand(cond Predicate) (interface{}, error) {
+	switch cond.Op {
+	case OpExists:
+		return strconv.ParseBool(cond.Value)
+	case OpIn:
+		if len(cond.Values) == 0 || len(cond.Values) > maxInValues {
+			return nil, fmt.Errorf("%s requires between 1 and %d values", OpIn, maxInValues)
+		}
+		values := make([]interface{}, 0, len(cond.Values))
+		for _, v := range cond.Values {
+			value, err := f.convert(v)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	case OpElemMatch:
+		if f.Kind != StringArray {
+			return nil, fmt.Errorf("%s requires an array field", OpElemMatch)
+		}
+		return map[string]interface{}{OpEq: cond.Value}, nil
+	default:
+		return f.convert(cond.Value)
+	}
+}
+
+func (f Field) convert(value string) (interface{}, error) {
+	switch f.Kind {
+	case Bool:
+		return strconv.ParseBool(value)
+	case Number:
+		return strconv.ParseFloat(value, 64)
+	case StringArray:
+		return nil, fmt.Errorf("an array field can only be filtered with %s", OpElemMatch)
+	default:
+		return value, nil
+	}
+}
+
+func direction(desc bool) string {
+	if desc {
+		return "desc"
+	}
+	return "asc"
+}
+
+func contains(arr []string, elem string) bool {
+	for _, a := range arr {
+		if a == elem {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+// Package shred encrypts personal values under a per-subject data key, so they
+// can be made unreadable (crypto-shredded) by destroying the key.
+//
+// The encryption is deterministic for a given key, seed and value: the AES-GCM
+// nonce is derived from the seed, so every endorser computes the same ciphertext.
+// The seed must be unique per encryption, ex: transaction ID + field name.
+package shred
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+const (
+	Prefix   = "enc:v1:"    // prefix of the encrypted values
+	Redacted = "[redacted]" // placeholder of the values that can not be decrypted
+	KeySize  = 32           // AES-256
+)
+
+// IsEncrypted returns true if the value was produced by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// Encrypt returns Prefix + base64(nonce | ciphertext) of the value, empty and
+// already encrypted values are returned as is
+func Encrypt(key []byte, seed, value string) (string, error) {
+	if value == "" || IsEncrypted(value) {
+		return value, nil
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(seed))
+	nonce := mac.Sum(nil)[:aead.NonceSize()]
+
+	sealed := aead.Seal(nonce, nonce, []byte(value), nil)
+	return Prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the plain value, values without Prefix are returned as is
+func Decrypt(key []byte, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, Prefix))
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted value")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// Redact returns Redacted for the encrypted values
+func Redact(value string) string {
+	if IsEncrypted(value) {
+		return Redacted
+	}
+	return value
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("the data key must have %d bytes", KeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
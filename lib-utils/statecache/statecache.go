@@ -0,0 +1,191 @@
+// Package statecache is a transaction scoped state layer over the chaincode stub. The
+// reads of the world state are cached, the writes are buffered and seen by the later
+// reads of the transaction, and they are sent to the peer once by Flush.
+//
+// The range and rich queries are not cached, like in Fabric they read the committed
+// state and do not see the buffered writes.
+package statecache
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// MultipleStatesGetter stub that reads several keys in one request, the stub of the
+// peers that support it
+type MultipleStatesGetter interface {
+	GetMultipleStates(keys ...string) ([][]byte, error)
+}
+
+// CommittedStateGetter stub that can read the committed value of a key, ignoring the
+// writes of the transaction
+type CommittedStateGetter interface {
+	GetCommittedState(key string) ([]byte, error)
+}
+
+// write buffered write, a delete has no value
+type write struct {
+	value  []byte
+	delete bool
+}
+
+// Stub caches the reads and buffers the writes of the world state of a transaction
+type Stub struct {
+	shim.ChaincodeStubInterface
+	reads  map[string][]byte // committed values, nil if the key does not exist
+	writes map[string]write
+}
+
+// New returns the state cache of the transaction of the stub
+func New(stub shim.ChaincodeStubInterface) *Stub {
+	return &Stub{
+		ChaincodeStubInterface: stub,
+		reads:                  make(map[string][]byte),
+		writes:                 make(map[string]write),
+	}
+}
+
+// GetState returns the value of the key written by the transaction, or else the committed value
+func (s *Stub) GetState(key string) ([]byte, error) {
+	if w, ok := s.writes[key]; ok {
+		if w.delete {
+			return nil, nil
+		}
+		return w.value, nil
+	}
+	return s.GetCommittedState(key)
+}
+
+// GetCommittedState returns the committed value of the key, read once
+func (s *Stub) GetCommittedState(key string) ([]byte, error) {
+	if value, ok := s.reads[key]; ok {
+		return value, nil
+	}
+	value, err := s.ChaincodeStubInterface.GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	s.reads[key] = value
+	return value, nil
+}
+
+// GetMultipleStates returns the values of the keys, the keys that are not cached are read
+// in one request if the peer supports it
+func (s *Stub) GetMultipleStates(keys ...string) ([][]byte, error) {
+	var missing []string
+	for _, key := range keys {
+		if _, ok := s.writes[key]; ok {
+			continue
+		}
+		if _, ok := s.reads[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		values, err := GetMultipleStates(s.ChaincodeStubInterface, missing...)
+		if err != nil {
+			return nil, err
+		}
+		for i, key := range missing {
+			s.reads[key] = values[i]
+		}
+	}
+
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		value, err := s.GetState(key)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// PutState buffers the write of the key, an empty value deletes the key as in Fabric
+func (s *Stub) PutState(key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key must not be an empty string")
+	}
+	if len(value) == 0 {
+		return s.DelState(key)
+	}
+	s.writes[key] = write{value: append([]byte(nil), value...)}
+	return nil
+}
+
+// DelState buffers the delete of the key
+func (s *Stub) DelState(key string) error {
+	if key == "" {
+		return fmt.Errorf("key must not be an empty string")
+	}
+	s.writes[key] = write{delete: true}
+	return nil
+}
+
+// Pending returns the number of buffered writes
+func (s *Stub) Pending() int {
+	return len(s.writes)
+}
+
+// Flush sends the buffered writes to the peer, in key order
+func (s *Stub) Flush() error {
+	keys := make([]string, 0, len(s.writes))
+	for key := range s.writes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		w := s.writes[key]
+		if w.delete {
+			if err := s.ChaincodeStubInterface.DelState(key); err != nil {
+				return err
+			}
+			s.reads[key] = nil
+		} else {
+			if err := s.ChaincodeStubInterface.PutState(key, w.value); err != nil {
+				return err
+			}
+			s.reads[key] = w.value
+		}
+		delete(s.writes, key)
+	}
+	return nil
+}
+
+// GetMultipleStates reads the keys with one request if the stub supports it, else one by one
+func GetMultipleStates(stub shim.ChaincodeStubInterface, keys ...string) ([][]byte, error) {
+	if len(keys) == 0 {
+		return [][]byte{}, nil
+	}
+	if getter, ok := stub.(MultipleStatesGetter); ok {
+		values, err := getter.GetMultipleStates(keys...)
+		if err != nil {
+			return nil, err
+		} else if len(values) != len(keys) {
+			return nil, fmt.Errorf("expected %d states, got %d", len(keys), len(values))
+		}
+		return values, nil
+	}
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		value, err := stub.GetState(key)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// GetCommittedState reads the committed value of the key, for a stub without cache it
+// is the value returned by GetState
+func GetCommittedState(stub shim.ChaincodeStubInterface, key string) ([]byte, error) {
+	if getter, ok := stub.(CommittedStateGetter); ok {
+		return getter.GetCommittedState(key)
+	}
+	return stub.GetState(key)
+}
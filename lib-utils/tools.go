@@ -174,6 +174,15 @@ func FunctionCompare(f1, f2 string) (bool, error) {
 	return false, fmt.Errorf("invalid transaction for function")
 }
 
+// TransactionName returns the function name without the contract namespace,
+// ex: "org.identity:CreateIssuer" returns "CreateIssuer"
+func TransactionName(fcn string) string {
+	if i := strings.LastIndex(fcn, ":"); i >= 0 {
+		return fcn[i+1:]
+	}
+	return fcn
+}
+
 func SliceToMap(slice []string, dMap map[string]string) {
 	for _, data := range slice {
 		if _, ok := dMap[data]; !ok {
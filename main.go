@@ -1,19 +1,17 @@
 package main
 
 import (
-	"crypto/x509"
+	"crypto"
 	"encoding/json"
-	"encoding/pem"
-	"errors"
 	"fmt"
-	"github.com/go-jose/go-jose/v3"
 	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
 	"github.com/kmilodenisglez/cc-identity-go/hooks"
 	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/keys"
 	modelapi "github.com/kmilodenisglez/model-identity-go/model"
-	"gopkg.in/square/go-jose.v2"
+	jose "gopkg.in/square/go-jose.v2"
 	"io/ioutil"
 	"log"
 	"os"
@@ -36,6 +34,10 @@ func main() {
 	contractIdentity.Name = modelapi.ContractNameIdentity
 	contractIdentity.Info.Version = "0.2.1"
 	contractIdentity.UnknownTransaction = hooks.UnknownTransactionHandler // Is only called if a request is made to invoke a transaction not defined in the smart contract
+	contractIdentity.BeforeTransaction = hooks.BeforeTransactionHandler   // Evaluates the ABAC policy of the invoked function
+	contractIdentity.AfterTransaction = hooks.AfterTransactionHandler     // Writes the state buffered by the transaction
+	contractIdentity.TransactionContextHandler = new(identity.TransactionContext)
+	setAssertionKey()
 	chaincode, err := contractapi.NewChaincode(contractIdentity)
 
 	if err != nil {
@@ -112,6 +114,34 @@ func main() {
 
 }
 
+// setAssertionKey loads the key that signs the DID authentication assertions,
+// without it VerifyAuthResponse is disabled
+func setAssertionKey() {
+	keyFile := lus.GetEnvOrDefault("CHAINCODE_ASSERTION_KEY", "")
+	if keyFile == "" {
+		log.Printf("CHAINCODE_ASSERTION_KEY is not set, the DID authentication assertions are disabled")
+		return
+	}
+	keyBytes, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		log.Panicf("error while reading the assertion key: %s", err)
+	}
+	key, err := keys.LoadPrivateKey(keyBytes)
+	if err != nil {
+		log.Panicf("error while loading the assertion key: %s", err)
+	}
+	if jwk, ok := key.(*jose.JSONWebKey); ok {
+		key = jwk.Key
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		log.Panicf("the assertion key %T can not sign", key)
+	}
+	if err := identity.SetAssertionKey(signer); err != nil {
+		log.Panicf("invalid assertion key: %s", err)
+	}
+}
+
 func getTLSProperties() shim.TLSProperties {
 	// Check if chaincode is TLS enabled
 	tlsDisabledStr := lus.GetEnvOrDefault("CHAINCODE_TLS_DISABLED", "true")
@@ -151,11 +181,9 @@ func getTLSProperties() shim.TLSProperties {
 }
 
 func verify(input string, pubKey []byte) {
-	verificationKey, _ := LoadPublicKey(pubKey)
-
-	obj, _ := jose.ParseSigned(input)
+	verificationKey, _ := keys.LoadPublicKey(pubKey)
 
-	plaintext, _ := obj.Verify(verificationKey)
+	plaintext, _ := keys.VerifyJWS(input, verificationKey)
 
 	//fmt.Println("verify: ", plaintext)
 
@@ -164,79 +192,3 @@ func verify(input string, pubKey []byte) {
 
 	fmt.Println("verify: ", lop)
 }
-
-func LoadJSONWebKey(json []byte, pub bool) (*jose.JSONWebKey, error) {
-	var jwk jose.JSONWebKey
-	err := jwk.UnmarshalJSON(json)
-	if err != nil {
-		return nil, err
-	}
-	if !jwk.Valid() {
-		return nil, errors.New("invalid JWK key")
-	}
-	if jwk.IsPublic() != pub {
-		return nil, errors.New("priv/pub JWK key mismatch")
-	}
-	return &jwk, nil
-}
-
-// LoadPublicKey loads a public key from PEM/DER/JWK-encoded data.
-func LoadPublicKey(data []byte) (interface{}, error) {
-	input := data
-
-	block, _ := pem.Decode(data)
-	if block != nil {
-		input = block.Bytes
-	}
-
-	// Try to load SubjectPublicKeyInfo
-	pub, err0 := x509.ParsePKIXPublicKey(input)
-	if err0 == nil {
-		return pub, nil
-	}
-
-	cert, err1 := x509.ParseCertificate(input)
-	if err1 == nil {
-		return cert.PublicKey, nil
-	}
-
-	jwk, err2 := LoadJSONWebKey(data, true)
-	if err2 == nil {
-		return jwk, nil
-	}
-
-	return nil, errors.New("parse error, invalid public key")
-}
-
-// LoadPrivateKey loads a private key from PEM/DER/JWK-encoded data.
-func LoadPrivateKey(data []byte) (interface{}, error) {
-	input := data
-
-	block, _ := pem.Decode(data)
-	if block != nil {
-		input = block.Bytes
-	}
-
-	var priv interface{}
-	priv, err0 := x509.ParsePKCS1PrivateKey(input)
-	if err0 == nil {
-		return priv, nil
-	}
-
-	priv, err1 := x509.ParsePKCS8PrivateKey(input)
-	if err1 == nil {
-		return priv, nil
-	}
-
-	priv, err2 := x509.ParseECPrivateKey(input)
-	if err2 == nil {
-		return priv, nil
-	}
-
-	jwk, err3 := LoadJSONWebKey(input, false)
-	if err3 == nil {
-		return jwk, nil
-	}
-
-	return nil, errors.New("parse error, invalid private key")
-}
@@ -0,0 +1,13 @@
+package abac_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestAbac(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "ABAC Suite")
+}
@@ -0,0 +1,101 @@
+package abac_test
+
+import (
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/abac"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("ABAC policies", func() {
+	director := abac.Subject{
+		MspID: "org1MSP",
+		CertAttributes: map[string]string{
+			"hf.Affiliation": "org1.dept",
+			"Cargo":          "Director de Calidad",
+		},
+		ParticipantAttributes: map[string]string{"company": "Tecnomática"},
+	}
+	createIssuerPolicy := abac.Expr{
+		Op: abac.OpAnd,
+		Args: []abac.Expr{
+			{Op: abac.OpAttr, Attr: &abac.Condition{Source: abac.SourceCert, Name: "hf.Affiliation", Value: "org1.dept"}},
+			{Op: abac.OpAttr, Attr: &abac.Condition{Source: abac.SourceCert, Name: "Cargo", Value: "Director de Calidad"}},
+			{Op: abac.OpAttr, Attr: &abac.Condition{Source: abac.SourceMsp, Values: []string{"org1MSP", "org2MSP"}}},
+		},
+	}
+
+	ginkgo.It("allows a caller with every required attribute", func() {
+		var trace []string
+		allowed, err := abac.Evaluate(&createIssuerPolicy, director, &trace)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(allowed).To(gomega.BeTrue())
+		gomega.Expect(trace).To(gomega.HaveLen(3))
+	})
+
+	ginkgo.It("denies a caller missing a certificate attribute", func() {
+		subject := abac.Subject{MspID: "org1MSP", CertAttributes: map[string]string{"hf.Affiliation": "org1.dept"}}
+		allowed, err := abac.Evaluate(&createIssuerPolicy, subject, nil)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(allowed).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("combines or and not over participant attributes", func() {
+		policy := abac.Expr{
+			Op: abac.OpOr,
+			Args: []abac.Expr{
+				{Op: abac.OpAttr, Attr: &abac.Condition{Source: abac.SourceMsp, Value: "org2MSP"}},
+				{Op: abac.OpNot, Args: []abac.Expr{
+					{Op: abac.OpAttr, Attr: &abac.Condition{Source: abac.SourceParticipant, Name: "company", Value: "Cupet"}},
+				}},
+			},
+		}
+		allowed, err := abac.Evaluate(&policy, director, nil)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(allowed).To(gomega.BeTrue())
+
+		// not registered as participant: the attribute is missing, so not(...) holds
+		allowed, err = abac.Evaluate(&policy, abac.Subject{MspID: "org1MSP"}, nil)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(allowed).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("rejects malformed policies", func() {
+		_, err := abac.Evaluate(&abac.Expr{Op: abac.OpNot}, director, nil)
+		gomega.Expect(err).To(gomega.HaveOccurred())
+
+		_, err = abac.Evaluate(&abac.Expr{Op: abac.OpAttr, Attr: &abac.Condition{Source: "ldap", Name: "uid"}}, director, nil)
+		gomega.Expect(err).To(gomega.HaveOccurred())
+
+		_, err = abac.Evaluate(&abac.Expr{Op: "xor"}, director, nil)
+		gomega.Expect(err).To(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("reports as unknown the policies decided by the unknown sources", func() {
+		unknownCert := []string{abac.SourceCert}
+		var trace []string
+		decision, err := abac.EvaluatePartial(&createIssuerPolicy, director, unknownCert, &trace)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(decision).To(gomega.Equal(abac.DecisionUnknown))
+		gomega.Expect(trace).To(gomega.ContainElement(`cert.Cargo == "Director de Calidad": unknown`))
+
+		// a known condition decides the and
+		decision, err = abac.EvaluatePartial(&createIssuerPolicy, abac.Subject{MspID: "org3MSP"}, unknownCert, nil)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(decision).To(gomega.Equal(abac.DecisionFalse))
+
+		policy := abac.Expr{Op: abac.OpOr, Args: []abac.Expr{
+			{Op: abac.OpAttr, Attr: &abac.Condition{Source: abac.SourceCert, Name: "Cargo", Value: "Director de Calidad"}},
+			{Op: abac.OpAttr, Attr: &abac.Condition{Source: abac.SourceParticipant, Name: "company", Value: "Tecnomática"}},
+		}}
+		decision, err = abac.EvaluatePartial(&policy, director, unknownCert, nil)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(decision).To(gomega.Equal(abac.DecisionTrue))
+
+		decision, err = abac.EvaluatePartial(&abac.Expr{Op: abac.OpNot, Args: policy.Args[:1]}, director, unknownCert, nil)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(decision).To(gomega.Equal(abac.DecisionUnknown))
+
+		_, err = abac.EvaluatePartial(&abac.Expr{Op: "xor"}, director, unknownCert, nil)
+		gomega.Expect(err).To(gomega.HaveOccurred())
+	})
+})
@@ -0,0 +1,81 @@
+package contract_test
+
+import (
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GrantAdminCapability", func() {
+	var (
+		l            *ledger
+		org1, org2   *certificate
+		client       *certificate
+		channelAdmin []string
+	)
+
+	grant := func(caller *certificate, capability, member string) (*identity.AdminRole, error) {
+		var role identity.AdminRole
+		if err := l.as(caller).invokeInto(&role, "GrantAdminCapability", map[string]interface{}{"capability": capability, "member": member}); err != nil {
+			return nil, err
+		}
+		return &role, nil
+	}
+	channelAdmins := func() []string {
+		var role identity.AdminRole
+		Expect(l.invokeInto(&role, "GetChannelAdmins")).To(Succeed())
+		return role.Members
+	}
+
+	BeforeEach(func() {
+		l = newLedger()
+		org1 = newClient("Org1MSP", "admin", true, nil)
+		org2 = newClient("Org2MSP", "admin", true, nil)
+		client = newClient("Org2MSP", "client", false, nil)
+		_, err := l.as(org1).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = l.as(org2).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+		channelAdmin = []string{"Org1MSP:" + org1.clientID()}
+	})
+
+	It("grants a capability in the MSP of the caller", func() {
+		role, err := grant(org2, identity.CapabilityIssuerAdmin, client.clientID())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(role.MspID).To(Equal("Org2MSP"))
+		Expect(role.Members).To(ContainElement(client.clientID()))
+
+		_, err = l.as(client).invoke("DeactivateIssuer", map[string]interface{}{"id": "missing"})
+		Expect(err).To(MatchError(ContainSubstring("issuer missing does not exist")))
+	})
+
+	It("rejects a caller without RoleAdmin in its MSP", func() {
+		_, err := grant(client, identity.CapabilityIssuerAdmin, client.clientID())
+		Expect(err).To(MatchError(ContainSubstring("does not hold the RoleAdmin capability in Org2MSP")))
+	})
+
+	It("does not grant the channel admin capability, even to the channel admins", func() {
+		for _, caller := range []*certificate{org1, org2} {
+			_, err := grant(caller, identity.CapabilityChannelAdmin, client.clientID())
+			Expect(err).To(MatchError(ContainSubstring("invalid capability ChannelAdmin")))
+		}
+		Expect(channelAdmins()).To(Equal(channelAdmin))
+	})
+
+	It("leaves the ~channel scope to GrantChannelAdmin, that requires a channel admin", func() {
+		_, err := grant(org2, identity.CapabilityRoleAdmin, "Org2MSP:"+client.clientID())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(channelAdmins()).To(Equal(channelAdmin))
+
+		// a RoleAdmin that is not a channel admin
+		_, err = l.as(org2).invoke("GrantChannelAdmin", map[string]interface{}{"mspID": "Org2MSP", "member": client.clientID()})
+		Expect(err).To(MatchError(ContainSubstring("does not hold the ChannelAdmin capability in the channel")))
+		Expect(channelAdmins()).To(Equal(channelAdmin))
+
+		var roles []identity.AdminRole
+		Expect(l.as(org2).invokeInto(&roles, "GetAdminRoles")).To(Succeed())
+		for _, role := range roles {
+			Expect(role.MspID).To(Equal("Org2MSP"))
+		}
+	})
+})
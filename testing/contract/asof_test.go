@@ -0,0 +1,138 @@
+package contract_test
+
+import (
+	"time"
+
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/abac"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GetParticipantAsOf authorization", func() {
+	var (
+		l                *ledger
+		salesTx, legalTx string
+	)
+
+	department := func(value string) abac.Expr {
+		return abac.Expr{Op: abac.OpAttr, Attr: &abac.Condition{Source: abac.SourceParticipant, Name: "department", Value: value}}
+	}
+	cargo := abac.Expr{Op: abac.OpAttr, Attr: &abac.Condition{Source: abac.SourceCert, Name: "Cargo", Value: "Director"}}
+	org1 := abac.Expr{Op: abac.OpAttr, Attr: &abac.Condition{Source: abac.SourceMsp, Value: "Org1MSP"}}
+
+	setPolicy := func(expr abac.Expr) string {
+		_, err := l.invoke("SetPolicy", map[string]interface{}{"function": "CreateIssuer", "expr": expr})
+		Expect(err).NotTo(HaveOccurred())
+		return l.lastTxID()
+	}
+	setDepartment := func(value string) string {
+		_, err := l.invoke("UpdateParticipant", map[string]interface{}{"did": "did:asof", "active": true, "attrsExtras": map[string]interface{}{"department": value}})
+		Expect(err).NotTo(HaveOccurred())
+		return l.lastTxID()
+	}
+	authorization := func(request map[string]interface{}) *identity.ParticipantAuthorizationAsOf {
+		if request["did"] == nil {
+			request["did"] = "did:asof"
+		}
+		if request["function"] == nil {
+			request["function"] = "CreateIssuer"
+		}
+		var response identity.ParticipantAsOfResponse
+		Expect(l.invokeInto(&response, "GetParticipantAsOf", request)).To(Succeed())
+		Expect(response.Authorization).NotTo(BeNil())
+		return response.Authorization
+	}
+	now := func() string {
+		return l.clock.Format(time.RFC3339)
+	}
+
+	BeforeEach(func() {
+		l = newLedger()
+		_, err := l.as(newClient("Org1MSP", "admin", true, nil)).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = l.createParticipant(map[string]interface{}{"did": "did:asof", "publicKey": newKey()})
+		Expect(err).NotTo(HaveOccurred())
+		salesTx = setDepartment("sales")
+		setPolicy(department("legal"))
+		legalTx = setDepartment("legal")
+	})
+
+	It("allows the functions without policy", func() {
+		result := authorization(map[string]interface{}{"timestamp": now(), "function": "GetRole"})
+		Expect(result.Authorized).To(BeTrue())
+		Expect(result.Unknown).To(BeFalse())
+		Expect(result.Trace).To(Equal([]string{"no policy for GetRole"}))
+
+		// the policy of the function did not exist yet
+		result = authorization(map[string]interface{}{"txId": salesTx})
+		Expect(result.Authorized).To(BeTrue())
+		Expect(result.Trace).To(Equal([]string{"no policy for CreateIssuer"}))
+		Expect(authorization(map[string]interface{}{"txId": legalTx}).Trace).NotTo(ContainElement(HavePrefix("no policy")))
+	})
+
+	It("evaluates the policy with the participant at the transaction", func() {
+		// endorsed against the participant of the sales department
+		result := authorization(map[string]interface{}{"txId": legalTx})
+		Expect(result.Authorized).To(BeFalse())
+		Expect(result.Unknown).To(BeFalse())
+		Expect(result.Trace).To(Equal([]string{`participant.department == "legal": false`}))
+
+		Expect(authorization(map[string]interface{}{"timestamp": now()}).Authorized).To(BeTrue())
+	})
+
+	It("only evaluates the policy, as the authorization hook", func() {
+		_, err := l.invoke("UpdateParticipant", map[string]interface{}{"did": "did:asof", "active": false, "attrsExtras": map[string]interface{}{"department": "legal"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		// no role of the participant grants the function and it is inactive
+		result := authorization(map[string]interface{}{"timestamp": now()})
+		Expect(result.Authorized).To(BeTrue())
+		Expect(result.Trace).To(Equal([]string{`participant.department == "legal": true`}))
+	})
+
+	It("reports the conditions of the certificate attributes as unknown", func() {
+		setPolicy(abac.Expr{Op: abac.OpAnd, Args: []abac.Expr{department("legal"), cargo}})
+		result := authorization(map[string]interface{}{"timestamp": now()})
+		Expect(result.Authorized).To(BeFalse())
+		Expect(result.Unknown).To(BeTrue())
+		Expect(result.Trace).To(ContainElement(`cert.Cargo == "Director": unknown`))
+
+		// the known conditions decide the policy
+		setPolicy(abac.Expr{Op: abac.OpAnd, Args: []abac.Expr{department("sales"), cargo}})
+		result = authorization(map[string]interface{}{"timestamp": now()})
+		Expect(result.Authorized).To(BeFalse())
+		Expect(result.Unknown).To(BeFalse())
+
+		setPolicy(abac.Expr{Op: abac.OpOr, Args: []abac.Expr{department("legal"), cargo}})
+		result = authorization(map[string]interface{}{"timestamp": now()})
+		Expect(result.Authorized).To(BeTrue())
+		Expect(result.Unknown).To(BeFalse())
+
+		setPolicy(abac.Expr{Op: abac.OpNot, Args: []abac.Expr{cargo}})
+		Expect(authorization(map[string]interface{}{"timestamp": now()}).Unknown).To(BeTrue())
+	})
+
+	It("evaluates the MSP of the participant, unknown before it existed", func() {
+		setPolicy(org1)
+		Expect(authorization(map[string]interface{}{"timestamp": now()}).Authorized).To(BeTrue())
+
+		beforeCreate := now()
+		_, err := l.createParticipant(map[string]interface{}{"did": "did:later", "publicKey": newKey()})
+		Expect(err).NotTo(HaveOccurred())
+		createTx := l.lastTxID()
+
+		result := authorization(map[string]interface{}{"did": "did:later", "timestamp": beforeCreate})
+		Expect(result.Authorized).To(BeFalse())
+		Expect(result.Unknown).To(BeTrue())
+		Expect(result.Trace).To(Equal([]string{`msp == "Org1MSP": unknown`}))
+		Expect(authorization(map[string]interface{}{"did": "did:later", "timestamp": now()}).Authorized).To(BeTrue())
+
+		// endorsed before the participant was written, against the policy of the moment
+		setPolicy(department("legal"))
+		result = authorization(map[string]interface{}{"did": "did:later", "txId": createTx})
+		Expect(result.Unknown).To(BeTrue())
+		Expect(result.Trace).To(Equal([]string{`msp == "Org1MSP": unknown`}))
+	})
+})
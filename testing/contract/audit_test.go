@@ -0,0 +1,240 @@
+package contract_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/didauth"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/keys"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Audit trail", func() {
+	var (
+		l      *ledger
+		org1   *certificate
+		alice  *certificate
+		maker  string
+		times  []string // timestamps of the changes of did:alice
+		caller string   // client identity ID of org1
+	)
+
+	trail := func(request map[string]interface{}) identity.AuditTrailResponse {
+		var response identity.AuditTrailResponse
+		Expect(l.as(org1).invokeInto(&response, "GetAuditTrail", request)).To(Succeed())
+		Expect(response.FetchedRecordsCount).To(BeEquivalentTo(len(response.Records)))
+		return response
+	}
+	// timestamps returns the timestamps of the records of every page of the trail
+	timestamps := func(request map[string]interface{}) []string {
+		var found []string
+		for {
+			response := trail(request)
+			for _, record := range response.Records {
+				found = append(found, record.Timestamp)
+			}
+			if response.Bookmark == "" {
+				return found
+			}
+			request["bookmark"] = response.Bookmark
+		}
+	}
+	actions := func(entityType, entityID string) []string {
+		var found []string
+		for _, record := range trail(map[string]interface{}{"entityType": entityType, "entityId": entityID, "pageSize": 10}).Records {
+			found = append(found, record.Function+" "+record.Action)
+		}
+		return found
+	}
+	alicesTrail := func(request map[string]interface{}) map[string]interface{} {
+		request["entityType"] = identity.ParticipantDocType
+		request["entityId"] = "did:alice"
+		return request
+	}
+
+	BeforeEach(func() {
+		l = newLedger()
+		org1 = newClient("Org1MSP", "admin", true, nil)
+		alice = newClient("Org1MSP", "alice", false, nil)
+		_, err := l.as(org1).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+		var role struct {
+			ID string `json:"id"`
+		}
+		Expect(l.invokeInto(&role, "CreateRole", map[string]interface{}{"name": "maker", "contractFunctions": []string{"GetRole"}})).To(Succeed())
+		maker = role.ID
+
+		// did:alice is created and updated three times, an hour apart
+		_, err = l.createParticipant(map[string]interface{}{"did": "did:alice", "publicKey": alice.publicKey(), "roles": []string{maker}})
+		Expect(err).NotTo(HaveOccurred())
+		times = []string{l.clock.Format(time.RFC3339Nano)}
+		for _, active := range []bool{false, true, false} {
+			l.clock = l.clock.Add(time.Hour)
+			_, err = l.invoke("UpdateParticipant", map[string]interface{}{"did": "did:alice", "active": active})
+			Expect(err).NotTo(HaveOccurred())
+			times = append(times, l.clock.Format(time.RFC3339Nano))
+		}
+		caller = trail(alicesTrail(map[string]interface{}{"pageSize": 1})).Records[0].CallerID
+	})
+
+	Describe("GetAuditTrail", func() {
+		It("returns the changes of an entity in time order", func() {
+			records := trail(alicesTrail(map[string]interface{}{"pageSize": 10})).Records
+			Expect(records).To(HaveLen(4))
+			Expect(records[0].Function).To(Equal("CreateParticipant"))
+			Expect(records[0].Action).To(Equal(identity.AuditCreate))
+			for i, record := range records {
+				Expect(record.Timestamp).To(Equal(times[i]))
+				Expect(record.MspID).To(Equal("Org1MSP"))
+				Expect(record.CallerID).To(Equal(caller))
+				Expect(record.Changes).NotTo(BeEmpty())
+				if i > 0 {
+					Expect(record.Function).To(Equal("UpdateParticipant"))
+					Expect(record.Action).To(Equal(identity.AuditUpdate))
+				}
+			}
+		})
+
+		It("reads only the keys of the time range of an entity", func() {
+			l.rangeReads = 0
+			found := timestamps(alicesTrail(map[string]interface{}{"from": times[1], "to": times[3], "pageSize": 10}))
+			Expect(found).To(Equal(times[1:3]))
+			// the records of times[1] and times[2], and the first key after the range
+			Expect(l.rangeReads).To(Equal(3))
+		})
+
+		It("pages a time range with bookmarks", func() {
+			response := trail(alicesTrail(map[string]interface{}{"from": times[1], "pageSize": 1}))
+			Expect(response.Records[0].Timestamp).To(Equal(times[1]))
+			Expect(response.Bookmark).NotTo(BeEmpty())
+			Expect(timestamps(alicesTrail(map[string]interface{}{"from": times[1], "pageSize": 1}))).To(Equal(times[1:]))
+			Expect(timestamps(alicesTrail(map[string]interface{}{"to": times[1], "pageSize": 1}))).To(Equal(times[:1]))
+		})
+
+		It("returns the changes of an actor in a time range", func() {
+			found := timestamps(map[string]interface{}{"actor": caller, "from": times[2], "pageSize": 10})
+			Expect(found).To(Equal(times[2:]))
+		})
+
+		It("filters the time range of a doc type", func() {
+			found := timestamps(map[string]interface{}{"entityType": identity.ParticipantDocType, "from": times[3], "pageSize": 10})
+			Expect(found).To(Equal(times[3:]))
+		})
+
+		It("rejects invalid requests", func() {
+			_, err := l.invoke("GetAuditTrail", map[string]interface{}{"entityId": "did:alice", "pageSize": 10})
+			Expect(err).To(MatchError(ContainSubstring("entityType")))
+			_, err = l.invoke("GetAuditTrail", alicesTrail(map[string]interface{}{"from": "yesterday", "pageSize": 10}))
+			Expect(err).To(MatchError(ContainSubstring("invalid from")))
+		})
+
+		It("requires the Auditor capability", func() {
+			_, err := l.as(alice).invoke("GetAuditTrail", alicesTrail(map[string]interface{}{"pageSize": 10}))
+			Expect(err).To(MatchError(ContainSubstring("Auditor capability")))
+		})
+	})
+
+	Describe("ExportAuditTrail", func() {
+		var chaincodeKey ed25519.PrivateKey
+
+		export := func(request map[string]interface{}) (identity.AuditExport, identity.AuditExportClaims) {
+			var page identity.AuditExport
+			Expect(l.as(org1).invokeInto(&page, "ExportAuditTrail", request)).To(Succeed())
+			payload, err := keys.VerifyJWS(page.Jws, chaincodeKey.Public())
+			Expect(err).NotTo(HaveOccurred())
+			var claims identity.AuditExportClaims
+			Expect(json.Unmarshal(payload, &claims)).To(Succeed())
+			return page, claims
+		}
+
+		BeforeEach(func() {
+			_, chaincodeKey, _ = ed25519.GenerateKey(rand.Reader)
+			Expect(identity.SetAssertionKey(chaincodeKey)).To(Succeed())
+		})
+
+		It("exports the records as JSON Lines signed by the chaincode", func() {
+			page, claims := export(alicesTrail(map[string]interface{}{"pageSize": 10}))
+			records := trail(alicesTrail(map[string]interface{}{"pageSize": 10})).Records
+			lines := strings.Split(strings.TrimSuffix(page.Lines, "\n"), "\n")
+			Expect(lines).To(HaveLen(len(records)))
+			for i, line := range lines {
+				var record identity.AuditRecord
+				Expect(json.Unmarshal([]byte(line), &record)).To(Succeed())
+				Expect(record).To(Equal(records[i]))
+			}
+
+			sum := sha256.Sum256([]byte(page.Lines))
+			Expect(page.Sha256).To(Equal(hex.EncodeToString(sum[:])))
+			Expect(page.FetchedRecordsCount).To(BeEquivalentTo(4))
+			Expect(claims.Issuer).To(Equal(l.mock.ChannelID))
+			Expect(claims.Sha256).To(Equal(page.Sha256))
+			Expect(claims.FetchedRecordsCount).To(Equal(page.FetchedRecordsCount))
+			Expect(claims.Bookmark).To(BeEmpty())
+		})
+
+		It("chains the signed pages with their bookmarks", func() {
+			first, firstClaims := export(alicesTrail(map[string]interface{}{"pageSize": 3}))
+			Expect(first.FetchedRecordsCount).To(BeEquivalentTo(3))
+			Expect(firstClaims.PreviousBookmark).To(BeEmpty())
+			Expect(firstClaims.Bookmark).To(Equal(first.Bookmark))
+
+			second, secondClaims := export(alicesTrail(map[string]interface{}{"pageSize": 3, "bookmark": first.Bookmark}))
+			Expect(second.FetchedRecordsCount).To(BeEquivalentTo(1))
+			Expect(secondClaims.PreviousBookmark).To(Equal(first.Bookmark))
+			Expect(secondClaims.Bookmark).To(BeEmpty())
+		})
+
+		It("requires the Auditor capability", func() {
+			_, err := l.as(alice).invoke("ExportAuditTrail", alicesTrail(map[string]interface{}{"pageSize": 10}))
+			Expect(err).To(MatchError(ContainSubstring("Auditor capability")))
+		})
+	})
+
+	Describe("audited writes", func() {
+		It("records the changes of the auth challenges", func() {
+			_, chaincodeKey, _ := ed25519.GenerateKey(rand.Reader)
+			Expect(identity.SetAssertionKey(chaincodeKey)).To(Succeed())
+			_, err := l.invoke("UpdateParticipant", map[string]interface{}{"did": "did:alice", "active": true})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = didauth.NewClient(gateway{l}).Login("did:alice", "https://app.example.com", alice.key)
+			Expect(err).NotTo(HaveOccurred())
+
+			challenges := trail(map[string]interface{}{"entityType": identity.AuthChallengeDocType, "pageSize": 10}).Records
+			Expect(challenges).To(HaveLen(2))
+			challengeID := challenges[0].EntityID
+			Expect(actions(identity.AuthChallengeDocType, challengeID)).To(Equal([]string{"CreateAuthChallenge create", "VerifyAuthResponse update"}))
+
+			l.clock = l.clock.Add(time.Hour)
+			_, err = l.as(org1).invoke("DeleteExpiredAuthChallenges", map[string]interface{}{"pageSize": 10})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actions(identity.AuthChallengeDocType, challengeID)).To(ConsistOf("CreateAuthChallenge create", "VerifyAuthResponse update", "DeleteExpiredAuthChallenges delete"))
+		})
+
+		It("records the workflow activities", func() {
+			_, err := l.invoke("UpdateParticipant", map[string]interface{}{"did": "did:alice", "active": true})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = l.as(org1).invoke("RecordWorkflowActivity", map[string]interface{}{"workflowId": "proposal-1", "did": "did:alice", "roleId": maker})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actions(identity.SodActivityDocType, "proposal-1~did:alice~"+maker)).To(Equal([]string{"RecordWorkflowActivity create"}))
+		})
+
+		It("records the erasures and the tombstones", func() {
+			_, err := l.invoke("EraseParticipant", map[string]interface{}{"did": "did:alice"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actions(identity.ErasureDocType, "did:alice")).To(Equal([]string{"EraseParticipant create"}))
+
+			_, err = l.invoke("DeleteParticipant", map[string]interface{}{"userDid": "did:alice", "callerDid": "did:alice"})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = l.invoke("RestoreParticipant", map[string]interface{}{"did": "did:alice"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actions(identity.ObjectTypeParticipantDeleted, "did:alice")).To(Equal([]string{"DeleteParticipant create", "RestoreParticipant delete"}))
+		})
+	})
+})
@@ -0,0 +1,203 @@
+package contract_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"time"
+
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/didauth"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// gateway submits the transactions of the didauth client to the ledger
+type gateway struct {
+	l *ledger
+}
+
+func (g gateway) SubmitTransaction(name string, args ...string) ([]byte, error) {
+	result, err := g.l.invoke(name, g.args(args)...)
+	return []byte(result), err
+}
+
+func (g gateway) EvaluateTransaction(name string, args ...string) ([]byte, error) {
+	result, err := g.l.evaluate(name, g.args(args)...)
+	return []byte(result), err
+}
+
+func (g gateway) args(args []string) []interface{} {
+	invokeArgs := make([]interface{}, 0, len(args))
+	for _, arg := range args {
+		invokeArgs = append(invokeArgs, arg)
+	}
+	return invokeArgs
+}
+
+var _ = Describe("DID authentication", func() {
+	var (
+		l            *ledger
+		org1         *certificate
+		chaincodeKey ed25519.PrivateKey
+		participant  *ecdsa.PrivateKey
+		client       *didauth.Client
+	)
+
+	const did, audience = "did:auth", "https://app.example.com"
+
+	BeforeEach(func() {
+		_, chaincodeKey, _ = ed25519.GenerateKey(rand.Reader)
+		Expect(identity.SetAssertionKey(chaincodeKey)).To(Succeed())
+
+		l = newLedger()
+		org1 = newClient("Org1MSP", "admin", true, nil)
+		_, err := l.as(org1).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+
+		participant, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		der, _ := x509.MarshalPKIXPublicKey(&participant.PublicKey)
+		_, err = l.createParticipant(map[string]interface{}{"did": did, "publicKey": base64.StdEncoding.EncodeToString(der)})
+		Expect(err).NotTo(HaveOccurred())
+		client = didauth.NewClient(gateway{l})
+	})
+
+	It("signs the assertions with an ECDSA key", func() {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(identity.SetAssertionKey(key)).To(Succeed())
+		assertion, err := client.Login(did, audience, participant)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = didauth.VerifyAssertion(assertion.Jws, key.Public(), l.mock.ChannelID, audience)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("returns an assertion of the channel for the audience", func() {
+		assertion, err := client.Login(did, audience, participant)
+		Expect(err).NotTo(HaveOccurred())
+
+		claims, err := didauth.VerifyAssertion(assertion.Jws, chaincodeKey.Public(), l.mock.ChannelID, audience)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claims.Subject).To(Equal(did))
+	})
+
+	It("derives a different challenge on every transaction", func() {
+		first, err := client.CreateChallenge(did, audience, 0)
+		Expect(err).NotTo(HaveOccurred())
+		second, err := client.CreateChallenge(did, audience, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(first.Challenge).NotTo(Equal(second.Challenge))
+		Expect(first.Challenge).To(HaveLen(64))
+	})
+
+	It("consumes the challenge", func() {
+		challenge, err := client.CreateChallenge(did, audience, 0)
+		Expect(err).NotTo(HaveOccurred())
+		jws, err := didauth.SignResponse(challenge, participant)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.VerifyResponse(challenge.ID, jws)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.VerifyResponse(challenge.ID, jws)
+		Expect(err).To(MatchError(ContainSubstring("was already answered in the transaction")))
+	})
+
+	Describe("GetAuthAssertion", func() {
+		var challenge *didauth.Challenge
+		var response map[string]interface{}
+
+		BeforeEach(func() {
+			var err error
+			challenge, err = client.CreateChallenge(did, audience, 0)
+			Expect(err).NotTo(HaveOccurred())
+			jws, err := didauth.SignResponse(challenge, participant)
+			Expect(err).NotTo(HaveOccurred())
+			response = map[string]interface{}{"challengeId": challenge.ID, "jws": jws}
+		})
+
+		It("does not issue the assertion of a response that was only evaluated", func() {
+			_, err := l.evaluate("VerifyAuthResponse", response)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = l.evaluate("GetAuthAssertion", map[string]interface{}{"id": challenge.ID})
+			Expect(err).To(MatchError(ContainSubstring("has no committed response")))
+
+			// the challenge was not consumed, it is answered once when submitted
+			_, err = l.invoke("VerifyAuthResponse", response)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = l.invoke("VerifyAuthResponse", response)
+			Expect(err).To(MatchError(ContainSubstring("was already answered")))
+			_, err = l.evaluate("GetAuthAssertion", map[string]interface{}{"id": challenge.ID})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("issues the assertion to the client that submitted the response only", func() {
+			_, err := l.invoke("VerifyAuthResponse", response)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = l.as(newClient("Org1MSP", "other", false, nil)).evaluate("GetAuthAssertion", map[string]interface{}{"id": challenge.ID})
+			Expect(err).To(MatchError(ContainSubstring("submitted by another client")))
+		})
+
+		It("does not issue an assertion after it expires", func() {
+			_, err := l.invoke("VerifyAuthResponse", response)
+			Expect(err).NotTo(HaveOccurred())
+			l.clock = l.clock.Add(10 * time.Minute)
+			_, err = l.evaluate("GetAuthAssertion", map[string]interface{}{"id": challenge.ID})
+			Expect(err).To(MatchError(ContainSubstring("expired")))
+		})
+	})
+
+	It("rejects a response that does not match the challenge", func() {
+		challenge, err := client.CreateChallenge(did, audience, 0)
+		Expect(err).NotTo(HaveOccurred())
+		forged := *challenge
+		forged.Audience = "https://other.example.com"
+		jws, err := didauth.SignResponse(&forged, participant)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.VerifyResponse(challenge.ID, jws)
+		Expect(err).To(MatchError(ContainSubstring("the response does not match the challenge")))
+	})
+
+	It("rejects a response to an expired challenge", func() {
+		challenge, err := client.CreateChallenge(did, audience, 60)
+		Expect(err).NotTo(HaveOccurred())
+		jws, err := didauth.SignResponse(challenge, participant)
+		Expect(err).NotTo(HaveOccurred())
+
+		l.clock = l.clock.Add(2 * time.Minute)
+		_, err = client.VerifyResponse(challenge.ID, jws)
+		Expect(err).To(MatchError(ContainSubstring("expired")))
+	})
+
+	It("uses the transaction timestamp, not the clock of the peer", func() {
+		l.clock = time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+		challenge, err := client.CreateChallenge(did, audience, 60)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(challenge.ExpiresTime).To(Equal(l.clock.Add(time.Minute).Format(time.RFC3339)))
+	})
+
+	It("deletes the expired challenges", func() {
+		expired, err := client.CreateChallenge(did, audience, 60)
+		Expect(err).NotTo(HaveOccurred())
+		l.clock = l.clock.Add(2 * time.Minute)
+		pending, err := client.CreateChallenge(did, audience, 60)
+		Expect(err).NotTo(HaveOccurred())
+
+		var deleted identity.AuthChallengesDeleted
+		Expect(l.invokeInto(&deleted, "DeleteExpiredAuthChallenges", map[string]interface{}{"pageSize": 10})).To(Succeed())
+		Expect(deleted.Scanned).To(Equal(2))
+		Expect(deleted.Deleted).To(Equal(1))
+
+		_, err = l.invoke("GetAuthChallenge", map[string]interface{}{"id": expired.ID})
+		Expect(err).To(HaveOccurred())
+		_, err = l.invoke("GetAuthChallenge", map[string]interface{}{"id": pending.ID})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("deletes the expired challenges with IdentityAdmin only", func() {
+		_, err := l.as(newClient("Org1MSP", "client", false, nil)).invoke("DeleteExpiredAuthChallenges", map[string]interface{}{"pageSize": 10})
+		Expect(err).To(MatchError(ContainSubstring("IdentityAdmin capability")))
+	})
+})
@@ -0,0 +1,184 @@
+package contract_test
+
+import (
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CreateParticipantsBatch", func() {
+	var l *ledger
+
+	// batchWithKeys sends the data key i to the participant i of the batch
+	batchWithKeys := func(partial bool, dataKeys [][]byte, participants ...map[string]interface{}) (*identity.ParticipantsBatchResponse, error) {
+		l.transient = map[string][]byte{}
+		for i, dataKey := range dataKeys {
+			l.transient[identity.BatchDataKeyField(i)] = dataKey
+		}
+		var response identity.ParticipantsBatchResponse
+		if err := l.invokeInto(&response, "CreateParticipantsBatch", map[string]interface{}{"participants": participants, "partial": partial}); err != nil {
+			return nil, err
+		}
+		return &response, nil
+	}
+	batch := func(partial bool, participants ...map[string]interface{}) (*identity.ParticipantsBatchResponse, error) {
+		dataKeys := make([][]byte, len(participants))
+		for i := range participants {
+			dataKeys[i] = newDataKey()
+		}
+		return batchWithKeys(partial, dataKeys, participants...)
+	}
+	participant := func(did, publicKey string) map[string]interface{} {
+		return map[string]interface{}{"did": did, "publicKey": publicKey}
+	}
+	exists := func(did string) bool {
+		var found bool
+		Expect(l.invokeInto(&found, "ParticipantExits", model.ParticipantGetRequest{Did: did})).To(Succeed())
+		return found
+	}
+	participantCount := func() int {
+		var organization identity.Organization
+		Expect(l.invokeInto(&organization, "GetOrganization", map[string]interface{}{"id": "Org1MSP"})).To(Succeed())
+		return organization.ParticipantCount
+	}
+
+	BeforeEach(func() {
+		l = newLedger()
+		_, err := l.as(newClient("Org1MSP", "admin", true, nil)).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("creates every participant of the batch and reserves their slots", func() {
+		response, err := batch(false, participant("did:batch1", newKey()), participant("did:batch2", newKey()))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.CreatedCount).To(Equal(int32(2)))
+		Expect(response.Results[1].Did).To(Equal("did:batch2"))
+		Expect(exists("did:batch1")).To(BeTrue())
+		Expect(exists("did:batch2")).To(BeTrue())
+		Expect(participantCount()).To(Equal(2))
+	})
+
+	Describe("duplicates", func() {
+		It("rejects a DID repeated in the batch", func() {
+			_, err := batch(false, participant("did:batch1", newKey()), participant("did:batch1", newKey()))
+			Expect(err).To(MatchError(ContainSubstring("participant 1:")))
+			Expect(exists("did:batch1")).To(BeFalse())
+		})
+
+		It("rejects a public key repeated under another DID of the batch", func() {
+			publicKey := newKey()
+			_, err := batch(false, participant("did:batch1", publicKey), participant("did:batch2", publicKey))
+			Expect(err).To(MatchError(ContainSubstring("participant 1: the public key is already bound to did:batch1")))
+			Expect(exists("did:batch1")).To(BeFalse())
+		})
+
+		It("rejects the DIDs and public keys of the ledger", func() {
+			publicKey := newKey()
+			_, err := l.createParticipant(participant("did:ledger", publicKey))
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = batch(false, participant("did:ledger", newKey()))
+			Expect(err).To(MatchError(ContainSubstring("participant 0:")))
+			_, err = batch(false, participant("did:batch1", publicKey))
+			Expect(err).To(MatchError(ContainSubstring("participant 0:")))
+			Expect(exists("did:batch1")).To(BeFalse())
+		})
+
+		It("rejects a data key repeated in the batch", func() {
+			dataKey := newDataKey()
+			_, err := batchWithKeys(false, [][]byte{dataKey, dataKey}, participant("did:batch1", newKey()), participant("did:batch2", newKey()))
+			Expect(err).To(MatchError(ContainSubstring("participant 1: the data key is already used by did:batch1")))
+			Expect(exists("did:batch1")).To(BeFalse())
+
+			response, err := batchWithKeys(true, [][]byte{dataKey, dataKey}, participant("did:batch1", newKey()), participant("did:batch2", newKey()))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(response.CreatedCount).To(Equal(int32(1)))
+			Expect(response.Results[1].Error).To(ContainSubstring("the data key is already used by did:batch1"))
+			Expect(exists("did:batch2")).To(BeFalse())
+		})
+
+		It("rejects the data keys of the ledger, erased ones included", func() {
+			dataKey := newDataKey()
+			l.transient = map[string][]byte{identity.TransientDataKey: dataKey}
+			_, err := l.invoke("CreateParticipant", participant("did:ledger", newKey()))
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = batchWithKeys(false, [][]byte{dataKey}, participant("did:batch1", newKey()))
+			Expect(err).To(MatchError(ContainSubstring("participant 0: the data key is already used by another participant")))
+			l.transient = map[string][]byte{identity.TransientDataKey: dataKey}
+			_, err = l.invoke("CreateParticipant", participant("did:single", newKey()))
+			Expect(err).To(MatchError(ContainSubstring("the data key is already used by another participant")))
+
+			_, err = l.invoke("EraseParticipant", map[string]interface{}{"did": "did:ledger"})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = batchWithKeys(false, [][]byte{dataKey}, participant("did:batch1", newKey()))
+			Expect(err).To(MatchError(ContainSubstring("the data key is already used by another participant")))
+			Expect(exists("did:batch1")).To(BeFalse())
+			Expect(exists("did:single")).To(BeFalse())
+		})
+	})
+
+	Describe("organization quota", func() {
+		BeforeEach(func() {
+			_, err := l.createParticipant(participant("did:ledger", newKey()))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = l.invoke("UpdateOrganization", map[string]interface{}{"displayName": "Org1", "maxParticipants": 3})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("counts the slots reserved by the previous participants of the batch", func() {
+			_, err := batch(false, participant("did:batch1", newKey()), participant("did:batch2", newKey()), participant("did:batch3", newKey()))
+			Expect(err).To(MatchError(ContainSubstring("participant 2: organization Org1MSP reached its quota of 3 participants")))
+			Expect(exists("did:batch1")).To(BeFalse())
+			Expect(participantCount()).To(Equal(1))
+		})
+
+		It("creates the participants that fit in the quota in partial mode", func() {
+			response, err := batch(true, participant("did:batch1", newKey()), participant("did:batch2", newKey()), participant("did:batch3", newKey()))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(response.CreatedCount).To(Equal(int32(2)))
+			Expect(response.FailedCount).To(Equal(int32(1)))
+			Expect(response.Results[2].Error).To(ContainSubstring("reached its quota"))
+			Expect(exists("did:batch3")).To(BeFalse())
+			Expect(participantCount()).To(Equal(3))
+		})
+	})
+
+	Describe("partial mode", func() {
+		It("reports the invalid participants in the order of the request and creates the rest", func() {
+			publicKey := newKey()
+			response, err := batch(true,
+				participant("did:batch1", publicKey),
+				participant("did:batch2", ""),
+				participant("did:batch1", newKey()),
+				participant("did:batch3", publicKey),
+				participant("did:batch4", newKey()),
+			)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(response.CreatedCount).To(Equal(int32(2)))
+			Expect(response.FailedCount).To(Equal(int32(3)))
+
+			Expect(response.Results).To(HaveLen(5))
+			for i, result := range response.Results {
+				Expect(result.Index).To(Equal(i))
+			}
+			Expect(response.Results[0].Did).To(Equal("did:batch1"))
+			Expect(response.Results[1].Error).To(ContainSubstring("publicKey"))
+			Expect(response.Results[2].Error).NotTo(BeEmpty())
+			Expect(response.Results[3].Error).To(ContainSubstring("already bound to did:batch1"))
+			Expect(response.Results[4].Did).To(Equal("did:batch4"))
+
+			Expect(exists("did:batch2")).To(BeFalse())
+			Expect(exists("did:batch3")).To(BeFalse())
+			Expect(participantCount()).To(Equal(2))
+		})
+
+		It("creates nothing when every participant is invalid", func() {
+			response, err := batch(true, participant("did:batch1", ""))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(response.CreatedCount).To(BeZero())
+			Expect(response.FailedCount).To(Equal(int32(1)))
+		})
+	})
+})
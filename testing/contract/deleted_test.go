@@ -0,0 +1,177 @@
+package contract_test
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// deletedKey world state key of the tombstone of the DID
+func deletedKey(did string) string {
+	return "\x00" + identity.ObjectTypeParticipantDeleted + "\x00" + identity.Deleted + "\x00" + did + "\x00"
+}
+
+var _ = Describe("Deleted participants", func() {
+	var (
+		l          *ledger
+		org1, org2 *certificate
+	)
+
+	config := func(restoreGraceDays, retentionDays int) map[string]interface{} {
+		return map[string]interface{}{"autogenerateDid": false, "restoreGraceDays": restoreGraceDays, "retentionDays": retentionDays, "encryptPersonalData": true}
+	}
+	did := map[string]interface{}{"did": "did:deleted"}
+
+	BeforeEach(func() {
+		l = newLedger()
+		org1 = newClient("Org1MSP", "admin", true, nil)
+		org2 = newClient("Org2MSP", "admin", true, nil)
+		_, err := l.as(org1).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = l.as(org2).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	// deleteParticipant creates and deletes a participant of the org1 with the retention of the config
+	deleteParticipant := func(restoreGraceDays, retentionDays int) {
+		_, err := l.as(org1).invoke("UpdateConfig", config(restoreGraceDays, retentionDays))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = l.createParticipant(map[string]interface{}{"did": "did:deleted", "publicKey": newKey()})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = l.invoke("DeleteParticipant", map[string]interface{}{"userDid": "did:deleted", "callerDid": "did:deleted"})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	Describe("UpdateConfig", func() {
+		It("requires the ChannelAdmin capability", func() {
+			_, err := l.as(org2).invoke("UpdateConfig", config(1, 2))
+			Expect(err).To(MatchError(ContainSubstring("ChannelAdmin capability")))
+			_, err = l.as(org1).invoke("UpdateConfig", config(1, 2))
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Describe("RestoreParticipant", func() {
+		It("restores the frozen copy within the grace period", func() {
+			deleteParticipant(30, 365)
+			_, err := l.invoke("GetParticipant", did)
+			Expect(err).To(HaveOccurred())
+
+			_, err = l.invoke("RestoreParticipant", did)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = l.invoke("GetParticipant", did)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(l.mock.State).NotTo(HaveKey(deletedKey("did:deleted")))
+		})
+
+		It("rejects a restore after the grace period", func() {
+			deleteParticipant(0, 365)
+			_, err := l.invoke("RestoreParticipant", did)
+			Expect(err).To(MatchError(ContainSubstring("the grace period to restore did:deleted ended")))
+		})
+
+		It("rejects the admins of another org", func() {
+			deleteParticipant(30, 365)
+			_, err := l.as(org2).invoke("RestoreParticipant", did)
+			Expect(err).To(MatchError(ContainSubstring("not authorized to manage an identity deleted by the org Org1MSP")))
+		})
+
+		It("rejects the tombstones without frozen copy", func() {
+			deleteParticipant(30, 365)
+			key := deletedKey("did:deleted")
+			var tombstone map[string]interface{}
+			Expect(json.Unmarshal(l.mock.State[key], &tombstone)).To(Succeed())
+			for _, field := range []string{"did", "participant", "restoreUntil", "purgeAfter", "participantSchemaVersion"} {
+				delete(tombstone, field)
+			}
+			l.mock.State[key], _ = json.Marshal(tombstone)
+
+			_, err := l.invoke("RestoreParticipant", did)
+			Expect(err).To(MatchError(ContainSubstring("without a frozen copy")))
+		})
+	})
+
+	Describe("PurgeParticipant", func() {
+		It("rejects a purge during the retention period", func() {
+			deleteParticipant(0, 365)
+			_, err := l.invoke("PurgeParticipant", did)
+			Expect(err).To(MatchError(ContainSubstring("participant did:deleted is retained until")))
+			Expect(l.mock.PvtState[identity.PersonalDataCollection]).To(HaveKey("did:deleted"))
+		})
+
+		It("removes the tombstone after the retention period", func() {
+			deleteParticipant(0, 0)
+			_, err := l.invoke("PurgeParticipant", did)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = l.invoke("GetDeletedParticipant", did)
+			Expect(err).To(MatchError(ContainSubstring("deleted participant did:deleted does not exist")))
+			// the personal values of the history can not be decrypted anymore
+			Expect(l.mock.PvtState[identity.PersonalDataCollection]).NotTo(HaveKey("did:deleted"))
+			// the audit trail and its indexes are kept
+			for key := range l.mock.State {
+				if !strings.HasPrefix(key, "\x00"+identity.AuditDocType) {
+					Expect(strings.Contains(key, "did:deleted")).To(BeFalse(), key)
+				}
+			}
+		})
+
+		It("rejects the admins of another org", func() {
+			deleteParticipant(0, 0)
+			_, err := l.as(org2).invoke("PurgeParticipant", did)
+			Expect(err).To(MatchError(ContainSubstring("not authorized to manage an identity deleted by the org Org1MSP")))
+		})
+	})
+
+	Describe("GetDeletedParticipants", func() {
+		deleted := func(request map[string]interface{}) *identity.DeletedParticipantsResponse {
+			var response identity.DeletedParticipantsResponse
+			Expect(l.invokeInto(&response, "GetDeletedParticipants", request)).To(Succeed())
+			return &response
+		}
+		dids := func(response *identity.DeletedParticipantsResponse) []string {
+			items := make([]string, 0, len(response.Records))
+			for _, record := range response.Records {
+				items = append(items, record.Did)
+			}
+			return items
+		}
+
+		BeforeEach(func() {
+			for _, item := range []struct {
+				caller *certificate
+				did    string
+			}{{org1, "did:deleted1"}, {org2, "did:deleted2"}, {org1, "did:deleted3"}} {
+				_, err := l.as(item.caller).createParticipant(map[string]interface{}{"did": item.did, "publicKey": newKey()})
+				Expect(err).NotTo(HaveOccurred())
+				_, err = l.invoke("DeleteParticipant", map[string]interface{}{"userDid": item.did, "callerDid": item.did})
+				Expect(err).NotTo(HaveOccurred())
+			}
+		})
+
+		It("returns the pages of the tombstones with their frozen copy", func() {
+			page := deleted(map[string]interface{}{"pageSize": 2})
+			Expect(dids(page)).To(Equal([]string{"did:deleted1", "did:deleted2"}))
+			Expect(page.Records[0].Participant.Did).To(Equal("did:deleted1"))
+			Expect(page.Records[0].PurgeAfter).NotTo(BeEmpty())
+			Expect(page.Bookmark).NotTo(BeEmpty())
+
+			page = deleted(map[string]interface{}{"pageSize": 2, "bookmark": page.Bookmark})
+			Expect(dids(page)).To(Equal([]string{"did:deleted3"}))
+			Expect(page.Bookmark).To(BeEmpty())
+		})
+
+		It("filters the tombstones by org", func() {
+			page := deleted(map[string]interface{}{"pageSize": 10, "filters": []map[string]interface{}{{"field": "mspID", "value": "Org1MSP"}}})
+			Expect(dids(page)).To(Equal([]string{"did:deleted1", "did:deleted3"}))
+		})
+
+		It("skips the restored participants", func() {
+			_, err := l.as(org1).invoke("RestoreParticipant", map[string]interface{}{"did": "did:deleted1"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dids(deleted(map[string]interface{}{"pageSize": 10}))).To(Equal([]string{"did:deleted2", "did:deleted3"}))
+		})
+	})
+})
@@ -0,0 +1,46 @@
+package contract_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/did"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Participant DID", func() {
+	var l *ledger
+
+	BeforeEach(func() {
+		l = newLedger()
+		_, err := l.as(newClient("Org1MSP", "admin", true, nil)).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Describe("organizations without DID method", func() {
+		It("accepts a legacy DID", func() {
+			_, err := l.createParticipant(map[string]interface{}{"did": "did:ab43bdf5", "publicKey": newKey()})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("rejects a DID of an unsupported method", func() {
+			_, err := l.createParticipant(map[string]interface{}{"did": "did:example:123", "publicKey": newKey()})
+			Expect(err).To(MatchError(ContainSubstring("unsupported DID method example")))
+		})
+
+		It("validates a DID with its own method", func() {
+			public, _, _ := ed25519.GenerateKey(rand.Reader)
+			spki, _ := x509.MarshalPKIXPublicKey(public)
+			keyDid, err := did.KeyMethod{}.Generate(did.Params{PublicKey: public})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = l.createParticipant(map[string]interface{}{"did": keyDid, "publicKey": newKey()})
+			Expect(err).To(MatchError(ContainSubstring("is not derived from the public key")))
+			_, err = l.createParticipant(map[string]interface{}{"did": keyDid, "publicKey": base64.StdEncoding.EncodeToString(spki)})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
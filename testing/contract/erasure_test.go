@@ -0,0 +1,62 @@
+package contract_test
+
+import (
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/shred"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Personal data", func() {
+	var (
+		l     *ledger
+		org1  *certificate
+		alice *certificate
+	)
+
+	did := map[string]interface{}{"did": "did:alice"}
+	request := func() map[string]interface{} {
+		return map[string]interface{}{"did": "did:alice", "publicKey": alice.publicKey(), "certPem": alice.certPem()}
+	}
+
+	BeforeEach(func() {
+		l = newLedger()
+		org1 = newClient("Org1MSP", "admin", true, nil)
+		alice = newClient("Org1MSP", "alice", false, nil)
+		_, err := l.as(org1).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("requires the data key by default", func() {
+		_, err := l.invoke("CreateParticipant", request())
+		Expect(err).To(MatchError(ContainSubstring("the data key of the participant must be sent in the transient field dataKey")))
+	})
+
+	It("stores the personal values encrypted", func() {
+		_, err := l.createParticipant(request())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(l.mock.State["\x00"+identity.ParticipantDocType+"\x00did:alice\x00"])).To(ContainSubstring(shred.Prefix))
+
+		var participant model.Participant
+		Expect(l.invokeInto(&participant, "GetParticipant", did)).To(Succeed())
+		Expect(participant.Attrs.Name).To(Equal("alice"))
+	})
+
+	It("purges the data key and redacts the personal values on erasure", func() {
+		_, err := l.createParticipant(request())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(l.mock.PvtState[identity.PersonalDataCollection]).To(HaveKey("did:alice"))
+
+		_, err = l.invoke("EraseParticipant", did)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(l.mock.PvtState[identity.PersonalDataCollection]).NotTo(HaveKey("did:alice"))
+
+		var participant model.Participant
+		Expect(l.invokeInto(&participant, "GetParticipant", did)).To(Succeed())
+		Expect(participant.Attrs.Name).To(Equal(shred.Redacted))
+		var erasure identity.ParticipantErasure
+		Expect(l.invokeInto(&erasure, "GetParticipantErasure", did)).To(Succeed())
+		Expect(erasure.MspID).To(Equal("Org1MSP"))
+	})
+})
@@ -0,0 +1,97 @@
+package contract_test
+
+import (
+	"encoding/base64"
+
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GetParticipantHistory", func() {
+	var l *ledger
+
+	history := func(options map[string]interface{}) identity.ParticipantHistoryResponse {
+		options["did"] = "did:history"
+		var response identity.ParticipantHistoryResponse
+		Expect(l.invokeInto(&response, "GetParticipantHistory", options)).To(Succeed())
+		Expect(response.FetchedRecordsCount).To(BeEquivalentTo(len(response.Records)))
+		return response
+	}
+	// pages returns the records of every page of the history
+	pages := func(pageSize int, patch bool) []identity.ParticipantHistoryRecord {
+		var records []identity.ParticipantHistoryRecord
+		options := map[string]interface{}{"pageSize": pageSize, "patch": patch}
+		for {
+			response := history(options)
+			Expect(len(response.Records)).To(BeNumerically("<=", pageSize))
+			records = append(records, response.Records...)
+			if response.Bookmark == "" {
+				return records
+			}
+			options["bookmark"] = response.Bookmark
+		}
+	}
+
+	BeforeEach(func() {
+		l = newLedger()
+		_, err := l.as(newClient("Org1MSP", "admin", true, nil)).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = l.createParticipant(map[string]interface{}{"did": "did:history", "publicKey": newKey()})
+		Expect(err).NotTo(HaveOccurred())
+		for _, department := range []string{"sales", "support", "legal", "finance"} {
+			_, err = l.invoke("UpdateParticipant", map[string]interface{}{"did": "did:history", "active": true, "attrsExtras": map[string]interface{}{"department": department}})
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
+	It("returns the versions, the newest first", func() {
+		records := history(map[string]interface{}{}).Records
+		Expect(records).To(HaveLen(5))
+		Expect(records[0].Record.AttrsExtras).To(HaveKeyWithValue("department", "finance"))
+		Expect(records[4].Record.AttrsExtras).NotTo(HaveKey("department"))
+		for _, record := range records {
+			Expect(record.Creator).NotTo(BeNil())
+			Expect(record.Creator.MspID).To(Equal("Org1MSP"))
+		}
+	})
+
+	It("pages the versions with the transaction of the last version as bookmark", func() {
+		all := history(map[string]interface{}{}).Records
+
+		first := history(map[string]interface{}{"pageSize": 2})
+		Expect(first.Records).To(Equal(all[:2]))
+		bookmark, err := base64.RawURLEncoding.DecodeString(first.Bookmark)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(bookmark)).To(Equal(all[1].TxID))
+
+		Expect(pages(2, false)).To(Equal(all))
+	})
+
+	It("continues from the bookmark of any transaction of the history", func() {
+		all := history(map[string]interface{}{}).Records
+		response := history(map[string]interface{}{"pageSize": 2, "bookmark": base64.RawURLEncoding.EncodeToString([]byte(all[2].TxID))})
+		Expect(response.Records).To(Equal(all[3:5]))
+		Expect(response.Bookmark).To(BeEmpty())
+	})
+
+	It("computes the patches across the pages", func() {
+		patches := history(map[string]interface{}{"patch": true}).Records
+		Expect(patches).To(HaveLen(5))
+		Expect(patches[0].Record).To(BeNil())
+		Expect(patches[0].Patch).NotTo(BeEmpty())
+
+		for _, pageSize := range []int{1, 2, 3} {
+			Expect(pages(pageSize, true)).To(Equal(patches))
+		}
+		// the last version of a page is patched from the first one of the next page
+		Expect(history(map[string]interface{}{"pageSize": 1, "patch": true}).Records[0].Patch).To(Equal(patches[0].Patch))
+	})
+
+	It("rejects a bookmark that is not in the history", func() {
+		_, err := l.invoke("GetParticipantHistory", map[string]interface{}{"did": "did:history", "pageSize": 2, "bookmark": base64.RawURLEncoding.EncodeToString([]byte("tx-unknown"))})
+		Expect(err).To(MatchError(ContainSubstring("invalid bookmark, the transaction tx-unknown is not in the history of did:history")))
+		_, err = l.invoke("GetParticipantHistory", map[string]interface{}{"did": "did:history", "pageSize": 2, "bookmark": "%%"})
+		Expect(err).To(MatchError(ContainSubstring("invalid bookmark")))
+	})
+})
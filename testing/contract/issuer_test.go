@@ -0,0 +1,253 @@
+package contract_test
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// newCA self-signed CA of the MSP
+func newCA(mspID, name string) *certificate {
+	return newCertificate(certificateOptions{mspID: mspID, name: name, ca: true, maxPathLen: -1}, nil)
+}
+
+// issuerKey world state key of the issuer
+func issuerKey(id string) string {
+	return "\x00" + identity.IssuerDocType + "\x00" + id + "\x00"
+}
+
+// createIssuer registers the certificate as an issuer, returns its ID
+func createIssuer(l *ledger, ca *certificate, parentID string) string {
+	var issuer struct {
+		ID string `json:"id"`
+	}
+	Expect(l.invokeInto(&issuer, "CreateIssuer", map[string]interface{}{"certPem": ca.certPem(), "parentId": parentID})).To(Succeed())
+	return issuer.ID
+}
+
+var _ = Describe("Issuers", func() {
+	var (
+		l            *ledger
+		org1, org2   *certificate
+		root         *certificate
+		rootID       string
+		trustRequest map[string]interface{}
+	)
+
+	BeforeEach(func() {
+		l = newLedger()
+		org1 = newClient("Org1MSP", "admin", true, nil)
+		org2 = newClient("Org2MSP", "admin", true, nil)
+		_, err := l.as(org1).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = l.as(org2).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+
+		root = newCA("Org1MSP", "root")
+		rootID = createIssuer(l.as(org1), root, "")
+		trustRequest = map[string]interface{}{"issuerId": rootID, "policy": map[string]interface{}{"maxValidityDays": 30}}
+	})
+
+	Describe("owner org", func() {
+		It("is the org of the admin that created the issuer", func() {
+			Expect(string(l.mock.State[issuerKey(rootID)])).To(ContainSubstring(`"mspID":"Org1MSP"`))
+		})
+
+		It("rejects the mutations of the admins of another org", func() {
+			l.as(org2)
+			_, err := l.invoke("DeactivateIssuer", map[string]interface{}{"id": rootID})
+			Expect(err).To(MatchError(ContainSubstring("not authorized to manage the issuer")))
+			_, err = l.invoke("RenewIssuer", map[string]interface{}{"id": rootID, "certPem": newCA("Org1MSP", "root").certPem()})
+			Expect(err).To(MatchError(ContainSubstring("not authorized to manage the issuer")))
+			_, err = l.invoke("SetIssuerTrustPolicy", trustRequest)
+			Expect(err).To(MatchError(ContainSubstring("not authorized to manage the issuer")))
+
+			_, err = l.as(org1).invoke("DeactivateIssuer", map[string]interface{}{"id": rootID})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = l.as(org2).invoke("DeleteIssuer", map[string]interface{}{"id": rootID})
+			Expect(err).To(MatchError(ContainSubstring("not authorized to manage the issuer")))
+			_, err = l.as(org1).invoke("DeleteIssuer", map[string]interface{}{"id": rootID})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("accepts the mutations of the admins of the org", func() {
+			_, err := l.as(org1).invoke("SetIssuerTrustPolicy", trustRequest)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = l.invoke("DeactivateIssuer", map[string]interface{}{"id": rootID})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("rejects an intermediate issuer under the issuer of another org", func() {
+			intermediate := newCertificate(certificateOptions{mspID: "Org2MSP", name: "intermediate", ca: true, maxPathLen: -1}, root)
+			_, err := l.as(org2).invoke("CreateIssuer", map[string]interface{}{"certPem": intermediate.certPem(), "parentId": rootID})
+			Expect(err).To(MatchError(ContainSubstring("not authorized to manage the issuer")))
+		})
+	})
+
+	Describe("issuers stored without owner", func() {
+		BeforeEach(func() {
+			key := issuerKey(rootID)
+			l.mock.State[key] = []byte(strings.Replace(string(l.mock.State[key]), `,"mspID":"Org1MSP"`, "", 1))
+		})
+
+		claim := func(caller *certificate, mspID string) error {
+			_, err := l.as(caller).invoke("ClaimIssuer", map[string]interface{}{"id": rootID, "mspID": mspID})
+			return err
+		}
+
+		It("rejects their mutations until they are claimed", func() {
+			_, err := l.as(org1).invoke("DeactivateIssuer", map[string]interface{}{"id": rootID})
+			Expect(err).To(MatchError(ContainSubstring("has no owner org")))
+			_, err = l.as(org2).invoke("SetIssuerTrustPolicy", trustRequest)
+			Expect(err).To(MatchError(ContainSubstring("has no owner org")))
+			Expect(string(l.mock.State[issuerKey(rootID)])).NotTo(ContainSubstring(`"mspID"`))
+		})
+
+		It("are claimed by the org that created them and the claim is audited", func() {
+			Expect(claim(org1, "")).To(Succeed())
+			Expect(string(l.mock.State[issuerKey(rootID)])).To(ContainSubstring(`"mspID":"Org1MSP"`))
+
+			var trail identity.AuditTrailResponse
+			Expect(l.invokeInto(&trail, "GetAuditTrail", map[string]interface{}{"entityType": identity.IssuerDocType, "entityId": rootID, "pageSize": 10})).To(Succeed())
+			last := trail.Records[len(trail.Records)-1]
+			Expect(last.Function).To(Equal("ClaimIssuer"))
+			Expect(last.Action).To(Equal(identity.AuditUpdate))
+
+			_, err := l.invoke("DeactivateIssuer", map[string]interface{}{"id": rootID})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = l.as(org2).invoke("DeactivateIssuer", map[string]interface{}{"id": rootID})
+			Expect(err).To(MatchError(ContainSubstring("not authorized to manage the issuer")))
+		})
+
+		It("are not claimed by another org", func() {
+			Expect(claim(org2, "")).To(MatchError(ContainSubstring("was not created by the org Org2MSP")))
+			Expect(claim(org2, "Org1MSP")).To(MatchError(ContainSubstring("only a ChannelAdmin can assign")))
+		})
+
+		It("are assigned to any org by a channel admin", func() {
+			Expect(claim(org1, "Org2MSP")).To(Succeed())
+			_, err := l.as(org2).invoke("DeactivateIssuer", map[string]interface{}{"id": rootID})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(claim(org1, "")).To(MatchError(ContainSubstring("is already owned by the org Org2MSP")))
+		})
+	})
+
+	Describe("RenewIssuer", func() {
+		renewal := func(name string, notAfter time.Time, parent *certificate) *certificate {
+			return newCertificate(certificateOptions{mspID: "Org1MSP", name: name, ca: true, maxPathLen: -1, notAfter: notAfter}, parent)
+		}
+		renew := func(cert *certificate) error {
+			_, err := l.as(org1).invoke("RenewIssuer", map[string]interface{}{"id": rootID, "certPem": cert.certPem()})
+			return err
+		}
+
+		It("replaces the certificate and keeps the current one", func() {
+			renewed := renewal("root", root.cert.NotAfter.AddDate(1, 0, 0), nil)
+			Expect(renew(renewed)).To(Succeed())
+
+			var issuer identity.IssuerRecord
+			Expect(json.Unmarshal(l.mock.State[issuerKey(rootID)], &issuer)).To(Succeed())
+			Expect(issuer.CertPem).To(Equal(renewed.certPem()))
+			Expect(issuer.PreviousCerts).To(HaveLen(1))
+			Expect(issuer.PreviousCerts[0].CertPem).To(Equal(root.certPem()))
+		})
+
+		It("rejects a certificate of another subject", func() {
+			err := renew(renewal("other", root.cert.NotAfter.AddDate(1, 0, 0), nil))
+			Expect(err).To(MatchError(ContainSubstring("does not match the issuer subject")))
+		})
+
+		It("rejects a certificate of another authority", func() {
+			otherCA := newCA("Org1MSP", "other root")
+			err := renew(renewal("root", root.cert.NotAfter.AddDate(1, 0, 0), otherCA))
+			Expect(err).To(MatchError(ContainSubstring("must be issued by the same authority")))
+		})
+
+		It("rejects a certificate that does not expire later", func() {
+			err := renew(renewal("root", root.cert.NotAfter.AddDate(0, 0, -1), nil))
+			Expect(err).To(MatchError(ContainSubstring("must expire after the current certificate")))
+		})
+	})
+
+	Describe("GetIssuersExpiring", func() {
+		var soonID string
+
+		// expiringPage returns the IDs of a page of the issuers expiring and its bookmark
+		expiringPage := func(request map[string]interface{}) ([]string, string, error) {
+			var response identity.IssuersResponse
+			if err := l.invokeInto(&response, "GetIssuersExpiring", request); err != nil {
+				return nil, "", err
+			}
+			Expect(response.FetchedRecordsCount).To(BeEquivalentTo(len(response.Records)))
+			ids := make([]string, 0, len(response.Records))
+			for _, issuer := range response.Records {
+				ids = append(ids, issuer.ID)
+			}
+			return ids, response.Bookmark, nil
+		}
+		expiring := func(days int) ([]string, error) {
+			ids, bookmark, err := expiringPage(map[string]interface{}{"days": days, "pageSize": 10})
+			Expect(bookmark).To(BeEmpty())
+			return ids, err
+		}
+
+		BeforeEach(func() {
+			soon := newCertificate(certificateOptions{mspID: "Org1MSP", name: "soon", ca: true, maxPathLen: -1, notAfter: time.Now().AddDate(0, 0, 10)}, nil)
+			soonID = createIssuer(l.as(org1), soon, "")
+		})
+
+		It("returns the active issuers expiring within the days, the soonest first", func() {
+			Expect(expiring(30)).To(Equal([]string{soonID}))
+			Expect(expiring(400)).To(Equal([]string{soonID, rootID}))
+			Expect(expiring(1)).To(BeEmpty())
+		})
+
+		It("skips the inactive issuers", func() {
+			_, err := l.invoke("DeactivateIssuer", map[string]interface{}{"id": soonID})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(expiring(400)).To(Equal([]string{rootID}))
+		})
+
+		It("skips the issuers already expired, unless includeExpired", func() {
+			l.clock = l.clock.AddDate(0, 0, 20)
+			Expect(expiring(400)).To(Equal([]string{rootID}))
+
+			ids, _, err := expiringPage(map[string]interface{}{"days": 400, "pageSize": 10, "includeExpired": true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ids).To(Equal([]string{soonID, rootID}))
+		})
+
+		It("pages the issuers with the bookmark", func() {
+			later := newCertificate(certificateOptions{mspID: "Org1MSP", name: "later", ca: true, maxPathLen: -1, notAfter: time.Now().AddDate(0, 0, 20)}, nil)
+			laterID := createIssuer(l.as(org1), later, "")
+
+			ids, bookmark, err := expiringPage(map[string]interface{}{"days": 400, "pageSize": 2})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ids).To(Equal([]string{soonID, laterID}))
+			Expect(bookmark).NotTo(BeEmpty())
+
+			ids, bookmark, err = expiringPage(map[string]interface{}{"days": 400, "pageSize": 2, "bookmark": bookmark})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ids).To(Equal([]string{rootID}))
+			Expect(bookmark).To(BeEmpty())
+		})
+
+		It("filters the issuers", func() {
+			ids, _, err := expiringPage(map[string]interface{}{"days": 400, "pageSize": 10, "filters": []map[string]string{{"field": "id", "value": rootID}}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ids).To(Equal([]string{rootID}))
+		})
+
+		It("rejects negative days and a page out of range", func() {
+			_, err := expiring(-1)
+			Expect(err).To(MatchError(ContainSubstring("days can not be negative")))
+			_, _, err = expiringPage(map[string]interface{}{"days": 30, "pageSize": 0})
+			Expect(err).To(MatchError(ContainSubstring("pageSize must be between 1 and")))
+		})
+	})
+})
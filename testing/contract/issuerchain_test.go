@@ -0,0 +1,126 @@
+package contract_test
+
+import (
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Issuer chains", func() {
+	var (
+		l                      *ledger
+		root, intermediate     *certificate
+		rootID, intermediateID string
+	)
+
+	// leaf certificate of a participant issued by the CA
+	leaf := func(name string, parent *certificate, dnsNames ...string) *certificate {
+		return newCertificate(certificateOptions{mspID: "Org1MSP", name: name, dnsNames: dnsNames}, parent)
+	}
+	createParticipant := func(did string, cert *certificate, issuerID string) error {
+		_, err := l.createParticipant(map[string]interface{}{"did": did, "publicKey": cert.publicKey(), "certPem": cert.certPem(), "issuerID": issuerID})
+		return err
+	}
+
+	BeforeEach(func() {
+		l = newLedger()
+		_, err := l.as(newClient("Org1MSP", "admin", true, nil)).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Describe("chain building", func() {
+		BeforeEach(func() {
+			root = newCA("Org1MSP", "root")
+			rootID = createIssuer(l, root, "")
+			intermediate = newCertificate(certificateOptions{mspID: "Org1MSP", name: "intermediate", ca: true, maxPathLen: -1}, root)
+			intermediateID = createIssuer(l, intermediate, rootID)
+		})
+
+		It("returns the chain from the issuer to the root", func() {
+			var chain []identity.IssuerChainEntry
+			Expect(l.invokeInto(&chain, "GetIssuerChain", map[string]interface{}{"id": intermediateID})).To(Succeed())
+			Expect(chain).To(HaveLen(2))
+			Expect(chain[0].ID).To(Equal(intermediateID))
+			Expect(chain[0].ParentID).To(Equal(rootID))
+			Expect(chain[1].ID).To(Equal(rootID))
+			Expect(chain[1].ParentID).To(BeEmpty())
+		})
+
+		It("verifies the certificates of the participants through every ancestor", func() {
+			Expect(createParticipant("did:alice", leaf("alice", intermediate), intermediateID)).To(Succeed())
+			Expect(createParticipant("did:bob", leaf("bob", root), intermediateID)).To(MatchError(ContainSubstring("was not issued by the issuer " + intermediateID)))
+		})
+
+		It("rejects an intermediate issuer not issued by its parent", func() {
+			other := newCertificate(certificateOptions{mspID: "Org1MSP", name: "other", ca: true, maxPathLen: -1}, newCA("Org1MSP", "other root"))
+			_, err := l.invoke("CreateIssuer", map[string]interface{}{"certPem": other.certPem(), "parentId": rootID})
+			Expect(err).To(MatchError(ContainSubstring("was not issued by the issuer " + rootID)))
+		})
+	})
+
+	Describe("path length", func() {
+		It("rejects the participants below an intermediate of a root without intermediates", func() {
+			root = newCertificate(certificateOptions{mspID: "Org1MSP", name: "root", ca: true, maxPathLen: 0}, nil)
+			rootID = createIssuer(l, root, "")
+			Expect(createParticipant("did:alice", leaf("alice", root), rootID)).To(Succeed())
+
+			intermediate = newCertificate(certificateOptions{mspID: "Org1MSP", name: "intermediate", ca: true, maxPathLen: -1}, root)
+			intermediateID = createIssuer(l, intermediate, rootID)
+			Expect(createParticipant("did:bob", leaf("bob", intermediate), intermediateID)).To(MatchError(ContainSubstring("too many intermediates")))
+		})
+	})
+
+	Describe("name constraints", func() {
+		BeforeEach(func() {
+			root = newCertificate(certificateOptions{mspID: "Org1MSP", name: "root", ca: true, maxPathLen: -1, permitted: []string{"example.com"}}, nil)
+			rootID = createIssuer(l, root, "")
+		})
+
+		It("accepts the names permitted by the issuer", func() {
+			Expect(createParticipant("did:alice", leaf("alice", root, "alice.example.com"), rootID)).To(Succeed())
+		})
+
+		It("rejects the names out of the permitted domains", func() {
+			Expect(createParticipant("did:alice", leaf("alice", root, "alice.example.org"), rootID)).To(MatchError(ContainSubstring("not permitted")))
+		})
+	})
+
+	Describe("UpdateParticipant", func() {
+		var alice *certificate
+
+		update := func(request map[string]interface{}) error {
+			request["did"], request["active"] = "did:alice", true
+			_, err := l.invoke("UpdateParticipant", request)
+			return err
+		}
+
+		BeforeEach(func() {
+			root = newCA("Org1MSP", "root")
+			rootID = createIssuer(l, root, "")
+			intermediate = newCertificate(certificateOptions{mspID: "Org1MSP", name: "intermediate", ca: true, maxPathLen: -1}, root)
+			intermediateID = createIssuer(l, intermediate, rootID)
+			alice = leaf("alice", root)
+			Expect(createParticipant("did:alice", alice, rootID)).To(Succeed())
+		})
+
+		It("requires a certificate of the new issuer", func() {
+			Expect(update(map[string]interface{}{"issuerID": intermediateID})).To(MatchError(ContainSubstring("certPem issued by " + intermediateID + " is required")))
+			Expect(update(map[string]interface{}{"issuerID": intermediateID, "certPem": alice.certPem()})).To(MatchError(ContainSubstring("was not issued by the issuer " + intermediateID)))
+		})
+
+		It("requires the certificate of the key of the participant", func() {
+			err := update(map[string]interface{}{"issuerID": intermediateID, "certPem": leaf("alice", intermediate).certPem()})
+			Expect(err).To(MatchError(ContainSubstring("public key of the participant does not match")))
+		})
+
+		It("changes the issuer with its certificate of the participant", func() {
+			renewed := newCertificate(certificateOptions{mspID: "Org1MSP", name: "alice", key: alice.key}, intermediate)
+			Expect(update(map[string]interface{}{"issuerID": intermediateID, "certPem": renewed.certPem()})).To(Succeed())
+
+			var participant model.Participant
+			Expect(l.invokeInto(&participant, "GetParticipant", map[string]interface{}{"did": "did:alice"})).To(Succeed())
+			Expect(participant.IssuerID).To(Equal(intermediateID))
+		})
+	})
+})
@@ -0,0 +1,110 @@
+package contract_test
+
+import (
+	"encoding/base64"
+
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/keys"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JWKS", func() {
+	var (
+		l      *ledger
+		org1   *certificate
+		ca     *certificate
+		rootID string
+		key    string
+	)
+
+	// thumbprint RFC 7638 thumbprint of a base64 SPKI public key
+	thumbprint := func(publicKey string) string {
+		parsed, err := keys.ParseSPKIBase64(publicKey)
+		Expect(err).NotTo(HaveOccurred())
+		kid, err := keys.Thumbprint(parsed)
+		Expect(err).NotTo(HaveOccurred())
+		return kid
+	}
+	participantJWKS := func(did string) identity.JSONWebKeySet {
+		var set identity.JSONWebKeySet
+		Expect(l.invokeInto(&set, "GetParticipantJWKS", map[string]interface{}{"did": did})).To(Succeed())
+		return set
+	}
+	issuerJWKS := func(id string) identity.JSONWebKeySet {
+		var set identity.JSONWebKeySet
+		Expect(l.invokeInto(&set, "GetIssuerJWKS", map[string]interface{}{"id": id})).To(Succeed())
+		return set
+	}
+
+	BeforeEach(func() {
+		l = newLedger()
+		org1 = newClient("Org1MSP", "admin", true, nil)
+		_, err := l.as(org1).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+
+		ca = newCA("Org1MSP", "root")
+		rootID = createIssuer(l, ca, "")
+		key = newKey()
+		_, err = l.createParticipant(map[string]interface{}{"did": "did:alice", "publicKey": key})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Describe("GetParticipantJWKS", func() {
+		It("returns the public key of the participant with its thumbprint as kid", func() {
+			set := participantJWKS("did:alice")
+			Expect(set.Keys).To(HaveLen(1))
+			Expect(set.Keys[0].Kty).To(Equal("EC"))
+			Expect(set.Keys[0].Kid).To(Equal(thumbprint(key)))
+			Expect(set.Keys[0].Use).To(Equal("sig"))
+			Expect(set.Keys[0].Alg).To(Equal("ES256"))
+			Expect(set.Keys[0].Crv).To(Equal("P-256"))
+			Expect(set.Keys[0].X5c).To(BeEmpty())
+		})
+
+		It("returns only the current key of a rotated participant", func() {
+			rotated := newKey()
+			_, err := l.invoke("UpdateParticipant", map[string]interface{}{"did": "did:alice", "publicKey": rotated, "active": true})
+			Expect(err).NotTo(HaveOccurred())
+
+			set := participantJWKS("did:alice")
+			Expect(set.Keys).To(HaveLen(1))
+			Expect(set.Keys[0].Kid).To(Equal(thumbprint(rotated)))
+			Expect(set.Keys[0].Kid).NotTo(Equal(thumbprint(key)))
+		})
+
+		It("is empty for an inactive participant", func() {
+			_, err := l.invoke("UpdateParticipant", map[string]interface{}{"did": "did:alice", "active": false})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(participantJWKS("did:alice").Keys).To(BeEmpty())
+		})
+
+		It("rejects a deleted participant", func() {
+			_, err := l.invoke("DeleteParticipant", map[string]interface{}{"userDid": "did:alice", "callerDid": "did:alice"})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = l.invoke("GetParticipantJWKS", map[string]interface{}{"did": "did:alice"})
+			Expect(err).To(MatchError(ContainSubstring("did:alice")))
+		})
+	})
+
+	Describe("GetIssuerJWKS", func() {
+		It("returns the public key of the issuer with its certificate in x5c", func() {
+			set := issuerJWKS(rootID)
+			Expect(set.Keys).To(HaveLen(1))
+			Expect(set.Keys[0].Kid).To(Equal(thumbprint(ca.publicKey())))
+			Expect(set.Keys[0].Use).To(Equal("sig"))
+			Expect(set.Keys[0].Alg).To(Equal("ES256"))
+			Expect(set.Keys[0].X5c).To(Equal([]string{base64.StdEncoding.EncodeToString(ca.cert.Raw)}))
+		})
+
+		It("is empty for an inactive issuer", func() {
+			_, err := l.as(org1).invoke("DeactivateIssuer", map[string]interface{}{"id": rootID})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(issuerJWKS(rootID).Keys).To(BeEmpty())
+
+			_, err = l.as(org1).invoke("ReactivateIssuer", map[string]interface{}{"id": rootID})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(issuerJWKS(rootID).Keys).To(HaveLen(1))
+		})
+	})
+})
@@ -0,0 +1,505 @@
+package contract_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/attrmgr"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	"github.com/kmilodenisglez/cc-identity-go/hooks"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/shred"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ledger world state of the identity contract, the transactions are invoked with the
+// hooks and the transaction context of main.go. The history of every key is recorded
+type ledger struct {
+	mock       *shimtest.MockStub
+	chaincode  *contractapi.ContractChaincode
+	history    map[string][]*queryresult.KeyModification
+	clock      time.Time
+	txs        int
+	caller     *certificate
+	transient  map[string][]byte
+	leveldb    bool // the rich queries fail as on a LevelDB state database
+	rangeReads int  // keys returned by the paginated ranges
+}
+
+// chaincode the contract as main.go builds it, built once for the suite, the metadata
+// of the contract takes a while to build
+var chaincode = func() *contractapi.ContractChaincode {
+	contract := new(identity.ContractIdentity)
+	contract.Name = "org.identity"
+	contract.UnknownTransaction = hooks.UnknownTransactionHandler
+	contract.BeforeTransaction = hooks.BeforeTransactionHandler
+	contract.AfterTransaction = hooks.AfterTransactionHandler
+	contract.TransactionContextHandler = new(identity.TransactionContext)
+	chaincode, err := contractapi.NewChaincode(contract)
+	if err != nil {
+		panic(err)
+	}
+	return chaincode
+}()
+
+func newLedger() *ledger {
+	return &ledger{
+		mock:      shimtest.NewMockStub("identity", chaincode),
+		chaincode: chaincode,
+		history:   make(map[string][]*queryresult.KeyModification),
+		clock:     time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// as sets the client that invokes the next transactions
+func (l *ledger) as(caller *certificate) *ledger {
+	l.caller = caller
+	return l
+}
+
+// invoke submits a transaction, the arguments that are not strings are JSON encoded.
+// Every transaction is one second after the previous one
+func (l *ledger) invoke(function string, args ...interface{}) (string, error) {
+	stub := &ledgerStub{MockStub: l.mock, ledger: l, args: [][]byte{[]byte("org.identity:" + function)}}
+	for _, arg := range args {
+		if s, ok := arg.(string); ok {
+			stub.args = append(stub.args, []byte(s))
+		} else {
+			argJE, err := json.Marshal(arg)
+			if err != nil {
+				return "", err
+			}
+			stub.args = append(stub.args, argJE)
+		}
+	}
+	if l.caller != nil {
+		l.mock.Creator = l.caller.creator
+	}
+
+	l.txs++
+	l.clock = l.clock.Add(time.Second)
+	txID := fmt.Sprintf("tx%d", l.txs)
+	before := l.snapshot()
+	l.mock.MockTransactionStart(txID)
+	l.mock.TxTimestamp = timestamppb.New(l.clock)
+	l.mock.TransientMap = l.transient
+	response := l.chaincode.Invoke(stub)
+	l.mock.MockTransactionEnd(txID)
+	l.transient = nil
+
+	after := l.snapshot()
+	for key, value := range after {
+		if previous, ok := before[key]; !ok || previous != value {
+			l.history[key] = append(l.history[key], &queryresult.KeyModification{TxId: txID, Value: []byte(value), Timestamp: timestamppb.New(l.clock)})
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			l.history[key] = append(l.history[key], &queryresult.KeyModification{TxId: txID, Timestamp: timestamppb.New(l.clock), IsDelete: true})
+		}
+	}
+
+	if response.Status != shim.OK {
+		return "", fmt.Errorf("%s", response.Message)
+	}
+	return string(response.Payload), nil
+}
+
+// invokeInto submits a transaction and decodes its JSON result
+func (l *ledger) invokeInto(result interface{}, function string, args ...interface{}) error {
+	payload, err := l.invoke(function, args...)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(payload), result)
+}
+
+// createParticipant submits CreateParticipant with a new data key in the transient map
+func (l *ledger) createParticipant(request map[string]interface{}) (string, error) {
+	l.transient = map[string][]byte{identity.TransientDataKey: newDataKey()}
+	return l.invoke("CreateParticipant", request)
+}
+
+// evaluate invokes a transaction and discards its writes, as a gateway evaluate
+func (l *ledger) evaluate(function string, args ...interface{}) (string, error) {
+	before := l.snapshot()
+	versions := make(map[string]int, len(l.history))
+	for key, modifications := range l.history {
+		versions[key] = len(modifications)
+	}
+	result, err := l.invoke(function, args...)
+
+	l.mock.MockTransactionStart("evaluate")
+	for key := range l.snapshot() {
+		if _, ok := before[key]; !ok {
+			_ = l.mock.DelState(key)
+		}
+	}
+	for key, value := range before {
+		_ = l.mock.PutState(key, []byte(value))
+	}
+	l.mock.MockTransactionEnd("evaluate")
+	for key, modifications := range l.history {
+		if versions[key] == 0 {
+			delete(l.history, key)
+		} else {
+			l.history[key] = modifications[:versions[key]]
+		}
+	}
+	return result, err
+}
+
+// lastTxID ID of the last transaction
+func (l *ledger) lastTxID() string {
+	return fmt.Sprintf("tx%d", l.txs)
+}
+
+func (l *ledger) snapshot() map[string]string {
+	state := make(map[string]string, len(l.mock.State))
+	for key, value := range l.mock.State {
+		state[key] = string(value)
+	}
+	return state
+}
+
+// ledgerStub stub of a transaction, it adds to the mock stub the history of the keys
+type ledgerStub struct {
+	*shimtest.MockStub
+	ledger    *ledger
+	args      [][]byte
+	paginated bool // a paginated query was performed
+}
+
+func (s *ledgerStub) GetArgs() [][]byte {
+	return s.args
+}
+
+func (s *ledgerStub) GetStringArgs() []string {
+	args := make([]string, 0, len(s.args))
+	for _, arg := range s.args {
+		args = append(args, string(arg))
+	}
+	return args
+}
+
+func (s *ledgerStub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	return args[0], args[1:]
+}
+
+// PurgePrivateData removes the key of the private data collection, the mock stub has
+// no private history
+func (s *ledgerStub) PurgePrivateData(collection, key string) error {
+	delete(s.MockStub.PvtState[collection], key)
+	return nil
+}
+
+// GetPrivateDataHash returns the SHA-256 of the value of the private data key, or nil
+func (s *ledgerStub) GetPrivateDataHash(collection, key string) ([]byte, error) {
+	value, ok := s.MockStub.PvtState[collection][key]
+	if !ok {
+		return nil, nil
+	}
+	hash := sha256.Sum256(value)
+	return hash[:], nil
+}
+
+// GetHistoryForKey returns the modifications of the key, the newest first
+func (s *ledgerStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	modifications := s.ledger.history[key]
+	newestFirst := make([]*queryresult.KeyModification, len(modifications))
+	for i, modification := range modifications {
+		newestFirst[len(modifications)-1-i] = modification
+	}
+	return &historyIterator{modifications: newestFirst}, nil
+}
+
+type historyIterator struct {
+	modifications []*queryresult.KeyModification
+	next          int
+}
+
+func (it *historyIterator) HasNext() bool { return it.next < len(it.modifications) }
+func (it *historyIterator) Close() error  { return nil }
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+	it.next++
+	return it.modifications[it.next-1], nil
+}
+
+// GetStateByPartialCompositeKeyWithPagination returns the keys of the partial composite
+// key from the bookmark, the bookmark of the response is the next key. Like the peer,
+// the transaction can not write after a paginated query
+func (s *ledgerStub) GetStateByPartialCompositeKeyWithPagination(objectType string, attributes []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	prefix, err := s.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.paginated = true
+	results := s.sortedState(func(key string, _ []byte) bool {
+		return strings.HasPrefix(key, prefix) && key >= bookmark
+	})
+	metadata := &peer.QueryResponseMetadata{}
+	if len(results) > int(pageSize) {
+		metadata.Bookmark = results[pageSize].Key
+		results = results[:pageSize]
+	}
+	metadata.FetchedRecordsCount = int32(len(results))
+	s.ledger.rangeReads += len(results)
+	return &stateIterator{results: results}, metadata, nil
+}
+
+func (s *ledgerStub) PutState(key string, value []byte) error {
+	if s.paginated {
+		return fmt.Errorf("transaction has already performed a paginated query. Writes are not allowed")
+	}
+	return s.MockStub.PutState(key, value)
+}
+
+func (s *ledgerStub) DelState(key string) error {
+	if s.paginated {
+		return fmt.Errorf("transaction has already performed a paginated query. Writes are not allowed")
+	}
+	return s.MockStub.DelState(key)
+}
+
+// GetQueryResultWithPagination runs the selectors of the queries of the contract on the
+// world state, $eq, $gte, $lt and $elemMatch of $eq, in key order. The bookmark is the
+// base64 of the last key of the page. It fails as on LevelDB when the ledger is leveldb
+func (s *ledgerStub) GetQueryResultWithPagination(queryString string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	if s.ledger.leveldb {
+		return nil, nil, fmt.Errorf("ExecuteQuery not supported for leveldb")
+	}
+	s.paginated = true
+	var request struct {
+		Selector map[string]map[string]interface{} `json:"selector"`
+	}
+	if err := json.Unmarshal([]byte(queryString), &request); err != nil {
+		return nil, nil, err
+	}
+	after, err := base64.StdEncoding.DecodeString(bookmark)
+	if err != nil {
+		return nil, nil, err
+	}
+	results := s.sortedState(func(key string, value []byte) bool {
+		var doc map[string]interface{}
+		if key <= string(after) || json.Unmarshal(value, &doc) != nil {
+			return false
+		}
+		for field, condition := range request.Selector {
+			if !matchesCondition(doc[field], condition) {
+				return false
+			}
+		}
+		return true
+	})
+	metadata := &peer.QueryResponseMetadata{Bookmark: bookmark}
+	if len(results) > int(pageSize) {
+		results = results[:pageSize]
+	}
+	if len(results) > 0 {
+		metadata.Bookmark = base64.StdEncoding.EncodeToString([]byte(results[len(results)-1].Key))
+	}
+	metadata.FetchedRecordsCount = int32(len(results))
+	return &stateIterator{results: results}, metadata, nil
+}
+
+// GetQueryResult runs the selector as GetQueryResultWithPagination, without a page size,
+// the transaction can still write
+func (s *ledgerStub) GetQueryResult(queryString string) (shim.StateQueryIteratorInterface, error) {
+	paginated := s.paginated
+	iterator, _, err := s.GetQueryResultWithPagination(queryString, math.MaxInt32, "")
+	s.paginated = paginated
+	return iterator, err
+}
+
+// matchesCondition returns true if the value of the document meets every operator
+func matchesCondition(value interface{}, condition map[string]interface{}) bool {
+	for op, operand := range condition {
+		switch op {
+		case "$eq":
+			if fmt.Sprint(value) != fmt.Sprint(operand) {
+				return false
+			}
+		case "$gte", "$lt":
+			text, ok := value.(string)
+			if !ok || (op == "$gte" && text < operand.(string)) || (op == "$lt" && text >= operand.(string)) {
+				return false
+			}
+		case "$elemMatch":
+			items, _ := value.([]interface{})
+			found := false
+			for _, item := range items {
+				found = found || matchesCondition(item, operand.(map[string]interface{}))
+			}
+			if !found {
+				return false
+			}
+		default:
+			panic("unsupported operator " + op)
+		}
+	}
+	return true
+}
+
+// stateIterator iterator of a slice of key-values
+type stateIterator struct {
+	results []*queryresult.KV
+	next    int
+}
+
+func (it *stateIterator) HasNext() bool { return it.next < len(it.results) }
+func (it *stateIterator) Close() error  { return nil }
+func (it *stateIterator) Next() (*queryresult.KV, error) {
+	it.next++
+	return it.results[it.next-1], nil
+}
+
+// sortedState key-values of the world state in key order, filtered by match
+func (s *ledgerStub) sortedState(match func(key string, value []byte) bool) []*queryresult.KV {
+	var results []*queryresult.KV
+	for key, value := range s.MockStub.State {
+		if match(key, value) {
+			results = append(results, &queryresult.KV{Key: key, Value: value})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Key < results[j].Key })
+	return results
+}
+
+// certificate client identity of a test, with its private key
+type certificate struct {
+	mspID   string
+	key     *ecdsa.PrivateKey
+	cert    *x509.Certificate
+	pem     []byte
+	creator []byte
+}
+
+// certificateOptions subject and extensions of a test certificate
+type certificateOptions struct {
+	mspID      string
+	name       string
+	admin      bool              // OU=admin
+	attrs      map[string]string // Fabric CA attributes
+	ca         bool
+	maxPathLen int // -1 none
+	notAfter   time.Time
+	permitted  []string // permitted DNS domains of a CA
+	dnsNames   []string
+	key        *ecdsa.PrivateKey // nil a new key
+}
+
+// newCertificate issues a certificate signed by the parent, self-signed without parent
+func newCertificate(options certificateOptions, parent *certificate) *certificate {
+	key := options.key
+	if key == nil {
+		var err error
+		if key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+			panic(err)
+		}
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	subject := pkix.Name{CommonName: options.name, Organization: []string{options.mspID}}
+	if options.admin {
+		subject.OrganizationalUnit = []string{"admin"}
+	} else {
+		subject.OrganizationalUnit = []string{"client"}
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               subject,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              options.notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  options.ca,
+		PermittedDNSDomains:   options.permitted,
+		DNSNames:              options.dnsNames,
+	}
+	if template.NotAfter.IsZero() {
+		template.NotAfter = time.Now().AddDate(1, 0, 0)
+	}
+	if options.ca {
+		template.KeyUsage |= x509.KeyUsageCertSign
+		template.MaxPathLen = options.maxPathLen
+		template.MaxPathLenZero = options.maxPathLen == 0
+	}
+	if len(options.attrs) > 0 {
+		attrsJE, _ := json.Marshal(attrmgr.Attributes{Attrs: options.attrs})
+		template.ExtraExtensions = []pkix.Extension{{Id: asn1.ObjectIdentifier(attrmgr.AttrOID), Value: attrsJE}}
+	}
+
+	signer, parentCert := key, template
+	if parent != nil {
+		signer, parentCert = parent.key, parent.cert
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, signer)
+	if err != nil {
+		panic(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	c := &certificate{
+		mspID: options.mspID,
+		key:   key,
+		cert:  cert,
+		pem:   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+	c.creator, _ = proto.Marshal(&msp.SerializedIdentity{Mspid: options.mspID, IdBytes: c.pem})
+	return c
+}
+
+// newClient self-signed client of the MSP
+func newClient(mspID, name string, admin bool, attrs map[string]string) *certificate {
+	return newCertificate(certificateOptions{mspID: mspID, name: name, admin: admin, attrs: attrs}, nil)
+}
+
+// publicKey base64 SPKI of the certificate key
+func (c *certificate) publicKey() string {
+	der, _ := x509.MarshalPKIXPublicKey(&c.key.PublicKey)
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+// certPem base64 PEM of the certificate, as the requests send it
+func (c *certificate) certPem() string {
+	return base64.StdEncoding.EncodeToString(c.pem)
+}
+
+// clientID identity ID of the client in the contract, x509::subject::issuer
+func (c *certificate) clientID() string {
+	id := fmt.Sprintf("x509::%s::%s", c.cert.Subject.ToRDNSequence().String(), c.cert.Issuer.ToRDNSequence().String())
+	return base64.StdEncoding.EncodeToString([]byte(id))
+}
+
+// newKey base64 SPKI of a new public key
+func newKey() string {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+// newDataKey random data key of a participant
+func newDataKey() []byte {
+	key := make([]byte, shred.KeySize)
+	_, _ = rand.Read(key)
+	return key
+}
@@ -0,0 +1,180 @@
+package contract_test
+
+import (
+	"encoding/base64"
+	"time"
+
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/ocsp"
+)
+
+var _ = Describe("Stapled OCSP responses", func() {
+	var (
+		l      *ledger
+		org1   *certificate
+		ca     *certificate
+		alice  *certificate
+		rootID string
+	)
+
+	// delegated b64 DER OCSP response of the certificate of the issuer, signed by the responder
+	delegated := func(cert, issuer, responder *certificate, status int, thisUpdate, nextUpdate time.Time) string {
+		template := ocsp.Response{Status: status, SerialNumber: cert.cert.SerialNumber, ThisUpdate: thisUpdate, NextUpdate: nextUpdate}
+		if status == ocsp.Revoked {
+			template.RevokedAt = thisUpdate
+		}
+		if responder != issuer {
+			template.Certificate = responder.cert
+		}
+		der, err := ocsp.CreateResponse(issuer.cert, responder.cert, template, responder.key)
+		Expect(err).NotTo(HaveOccurred())
+		return base64.StdEncoding.EncodeToString(der)
+	}
+	// staple b64 DER OCSP response of the certificate signed by the responder as issuer
+	staple := func(cert, responder *certificate, status int, thisUpdate, nextUpdate time.Time) string {
+		return delegated(cert, responder, responder, status, thisUpdate, nextUpdate)
+	}
+	// good response of the certificate signed by its CA, valid at the next transaction
+	good := func(cert *certificate) string {
+		return staple(cert, ca, ocsp.Good, l.clock.Add(-time.Hour), l.clock.Add(time.Hour))
+	}
+	create := func(ocspResponse string) error {
+		_, err := l.as(org1).createParticipant(map[string]interface{}{
+			"did": "did:alice", "publicKey": alice.publicKey(), "certPem": alice.certPem(), "issuerID": rootID, "ocspResponse": ocspResponse,
+		})
+		return err
+	}
+	status := func() (*identity.ParticipantOcspStatus, error) {
+		var status identity.ParticipantOcspStatus
+		if err := l.invokeInto(&status, "GetParticipantOcspStatus", map[string]interface{}{"did": "did:alice"}); err != nil {
+			return nil, err
+		}
+		return &status, nil
+	}
+
+	BeforeEach(func() {
+		l = newLedger()
+		org1 = newClient("Org1MSP", "admin", true, nil)
+		_, err := l.as(org1).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+
+		ca = newCA("Org1MSP", "root")
+		rootID = createIssuer(l, ca, "")
+		alice = newCertificate(certificateOptions{mspID: "Org1MSP", name: "alice"}, ca)
+	})
+
+	Describe("CreateParticipant", func() {
+		It("stores the good status in the participant", func() {
+			Expect(create(good(alice))).To(Succeed())
+			createTx := l.lastTxID()
+
+			verified, err := status()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verified.Status).To(Equal("good"))
+			Expect(verified.IssuerID).To(Equal(rootID))
+			Expect(verified.SerialNumber).To(Equal(alice.cert.SerialNumber.String()))
+			Expect(verified.TxID).To(Equal(createTx))
+			Expect(string(l.mock.State[participantKey("did:alice")])).To(ContainSubstring(`"ocspStatus":{`))
+		})
+
+		It("rejects a revoked certificate", func() {
+			err := create(staple(alice, ca, ocsp.Revoked, l.clock.Add(-time.Hour), l.clock.Add(time.Hour)))
+			Expect(err).To(MatchError(ContainSubstring("was revoked")))
+			Expect(l.mock.State).NotTo(HaveKey(participantKey("did:alice")))
+		})
+
+		It("rejects a stale response", func() {
+			err := create(staple(alice, ca, ocsp.Good, l.clock.Add(-3*time.Hour), l.clock.Add(-time.Hour)))
+			Expect(err).To(MatchError(ContainSubstring("OCSP response expired")))
+		})
+
+		It("rejects a response signed by another CA", func() {
+			other := newCA("Org1MSP", "other")
+			err := create(staple(alice, other, ocsp.Good, l.clock.Add(-time.Hour), l.clock.Add(time.Hour)))
+			Expect(err).To(MatchError(ContainSubstring("invalid OCSP response")))
+			Expect(l.mock.State).NotTo(HaveKey(participantKey("did:alice")))
+		})
+
+		It("rejects a responder without the OCSP signing usage", func() {
+			responder := newCertificate(certificateOptions{mspID: "Org1MSP", name: "responder"}, ca)
+			err := create(delegated(alice, ca, responder, ocsp.Good, l.clock.Add(-time.Hour), l.clock.Add(time.Hour)))
+			Expect(err).To(MatchError(ContainSubstring("is not authorized to sign OCSP responses")))
+			Expect(l.mock.State).NotTo(HaveKey(participantKey("did:alice")))
+		})
+
+		It("has no status without a stapled response", func() {
+			Expect(create("")).To(Succeed())
+			_, err := status()
+			Expect(err).To(MatchError(ContainSubstring("no OCSP status verified for the participant did:alice")))
+		})
+	})
+
+	Describe("UpdateParticipant", func() {
+		update := func(request map[string]interface{}) error {
+			request["did"] = "did:alice"
+			request["active"] = true
+			_, err := l.as(org1).invoke("UpdateParticipant", request)
+			return err
+		}
+
+		BeforeEach(func() {
+			Expect(create(good(alice))).To(Succeed())
+		})
+
+		It("replaces the status with the stapled response", func() {
+			Expect(update(map[string]interface{}{"certPem": alice.certPem(), "ocspResponse": good(alice)})).To(Succeed())
+			updateTx := l.lastTxID()
+
+			verified, err := status()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verified.TxID).To(Equal(updateTx))
+		})
+
+		It("keeps the status of the same key without a stapled response", func() {
+			createStatus, err := status()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(update(map[string]interface{}{})).To(Succeed())
+			Expect(status()).To(Equal(createStatus))
+		})
+
+		It("drops the status of a rotated key", func() {
+			Expect(update(map[string]interface{}{"publicKey": newKey()})).To(Succeed())
+			_, err := status()
+			Expect(err).To(MatchError(ContainSubstring("no OCSP status verified")))
+		})
+
+		It("rejects a revoked or stale response and keeps the previous status", func() {
+			createStatus, err := status()
+			Expect(err).NotTo(HaveOccurred())
+
+			err = update(map[string]interface{}{"certPem": alice.certPem(), "ocspResponse": staple(alice, ca, ocsp.Revoked, l.clock.Add(-time.Hour), l.clock.Add(time.Hour))})
+			Expect(err).To(MatchError(ContainSubstring("was revoked")))
+			err = update(map[string]interface{}{"certPem": alice.certPem(), "ocspResponse": staple(alice, ca, ocsp.Good, l.clock.Add(-3*time.Hour), l.clock.Add(-time.Hour))})
+			Expect(err).To(MatchError(ContainSubstring("OCSP response expired")))
+			Expect(status()).To(Equal(createStatus))
+		})
+
+		It("rejects a response of another certificate", func() {
+			bob := newCertificate(certificateOptions{mspID: "Org1MSP", name: "bob"}, ca)
+			err := update(map[string]interface{}{"certPem": bob.certPem(), "ocspResponse": good(bob)})
+			Expect(err).To(MatchError(ContainSubstring("does not match")))
+		})
+	})
+
+	Describe("GetParticipantOcspStatus", func() {
+		It("rejects a participant that does not exist", func() {
+			_, err := status()
+			Expect(err).To(MatchError(ContainSubstring("did:alice")))
+		})
+
+		It("is removed with the participant", func() {
+			Expect(create(good(alice))).To(Succeed())
+			_, err := l.invoke("DeleteParticipant", map[string]interface{}{"userDid": "did:alice", "callerDid": "did:alice"})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = status()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
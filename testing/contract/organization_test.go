@@ -0,0 +1,88 @@
+package contract_test
+
+import (
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Organizations", func() {
+	var (
+		l          *ledger
+		org1, org2 *certificate
+	)
+
+	status := func(mspID, status string) map[string]interface{} {
+		return map[string]interface{}{"mspID": mspID, "status": status}
+	}
+
+	BeforeEach(func() {
+		l = newLedger()
+		org1 = newClient("Org1MSP", "admin", true, nil)
+		org2 = newClient("Org2MSP", "admin", true, nil)
+		_, err := l.as(org1).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = l.as(org2).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Describe("channel admin", func() {
+		It("is the first admin that runs InitLedger", func() {
+			var role identity.AdminRole
+			Expect(l.invokeInto(&role, "GetChannelAdmins")).To(Succeed())
+			Expect(role.Members).To(Equal([]string{"Org1MSP:" + org1.clientID()}))
+		})
+
+		It("is bootstrapped on the channels initialized before the capability", func() {
+			delete(l.mock.State, "\x00"+identity.AdminDocType+"\x00~channel\x00ChannelAdmin\x00")
+			_, err := l.as(org2).invoke("InitLedger")
+			Expect(err).NotTo(HaveOccurred())
+
+			var role identity.AdminRole
+			Expect(l.invokeInto(&role, "GetChannelAdmins")).To(Succeed())
+			Expect(role.Members).To(Equal([]string{"Org2MSP:" + org2.clientID()}))
+		})
+
+		It("is granted and revoked by the channel admins", func() {
+			grant := map[string]interface{}{"mspID": "Org2MSP", "member": org2.clientID()}
+			_, err := l.as(org2).invoke("GrantChannelAdmin", grant)
+			Expect(err).To(MatchError(ContainSubstring("ChannelAdmin capability")))
+			_, err = l.as(org1).invoke("GrantChannelAdmin", grant)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = l.as(org2).invoke("RevokeChannelAdmin", map[string]interface{}{"mspID": "Org1MSP", "member": org1.clientID()})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = l.invoke("RevokeChannelAdmin", grant)
+			Expect(err).To(MatchError(ContainSubstring("the last ChannelAdmin can not be revoked")))
+		})
+	})
+
+	Describe("SetOrganizationStatus", func() {
+		It("sets the status of the organization of the caller", func() {
+			var organization identity.Organization
+			Expect(l.as(org2).invokeInto(&organization, "SetOrganizationStatus", status("Org2MSP", "suspended"))).To(Succeed())
+			Expect(organization.Status).To(Equal("suspended"))
+
+			_, err := l.createParticipant(map[string]interface{}{"did": "did:org2", "publicKey": newKey()})
+			Expect(err).To(MatchError(ContainSubstring("organization Org2MSP is suspended")))
+		})
+
+		It("rejects the admins of another org", func() {
+			_, err := l.as(org2).invoke("SetOrganizationStatus", status("Org1MSP", "suspended"))
+			Expect(err).To(MatchError(ContainSubstring("not authorized to set the status of the org Org1MSP")))
+		})
+
+		It("rejects the clients without IdentityAdmin in their org", func() {
+			client := newClient("Org2MSP", "client", false, nil)
+			_, err := l.as(client).invoke("SetOrganizationStatus", status("Org2MSP", "suspended"))
+			Expect(err).To(MatchError(ContainSubstring("IdentityAdmin capability")))
+		})
+
+		It("accepts a channel admin for any org", func() {
+			_, err := l.as(org1).invoke("SetOrganizationStatus", status("Org2MSP", "suspended"))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = l.invoke("SetOrganizationStatus", status("Org2MSP", "active"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,99 @@
+package contract_test
+
+import (
+	"fmt"
+
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("List pages", func() {
+	var (
+		l          *ledger
+		org1, org2 *certificate
+	)
+
+	// page returns the DIDs of a page of GetParticipants and its bookmark
+	page := func(request map[string]interface{}) ([]string, string) {
+		var response identity.ParticipantsResponse
+		Expect(l.invokeInto(&response, "GetParticipants", request)).To(Succeed())
+		Expect(response.FetchedRecordsCount).To(BeEquivalentTo(len(response.Records)))
+		dids := make([]string, 0, len(response.Records))
+		for _, participant := range response.Records {
+			dids = append(dids, participant.DID)
+		}
+		return dids, response.Bookmark
+	}
+
+	BeforeEach(func() {
+		l = newLedger()
+		org1 = newClient("Org1MSP", "admin", true, nil)
+		org2 = newClient("Org2MSP", "admin", true, nil)
+		_, err := l.as(org1).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = l.as(org2).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+
+		// did:p00 to did:p09, the even ones of Org1MSP
+		for i := 0; i < 10; i++ {
+			caller := org1
+			if i%2 == 1 {
+				caller = org2
+			}
+			_, err := l.as(caller).createParticipant(map[string]interface{}{"did": fmt.Sprintf("did:p%02d", i), "publicKey": newKey()})
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
+	It("returns the documents in key order from the bookmark", func() {
+		dids, bookmark := page(map[string]interface{}{"pageSize": 4})
+		Expect(dids).To(Equal([]string{"did:p00", "did:p01", "did:p02", "did:p03"}))
+		Expect(bookmark).NotTo(BeEmpty())
+
+		dids, bookmark = page(map[string]interface{}{"pageSize": 4, "bookmark": bookmark})
+		Expect(dids).To(Equal([]string{"did:p04", "did:p05", "did:p06", "did:p07"}))
+
+		dids, bookmark = page(map[string]interface{}{"pageSize": 4, "bookmark": bookmark})
+		Expect(dids).To(Equal([]string{"did:p08", "did:p09"}))
+		Expect(bookmark).To(BeEmpty())
+	})
+
+	It("returns no bookmark when the last page is full", func() {
+		dids, bookmark := page(map[string]interface{}{"pageSize": 5})
+		Expect(dids).To(HaveLen(5))
+		dids, bookmark = page(map[string]interface{}{"pageSize": 5, "bookmark": bookmark})
+		Expect(dids).To(Equal([]string{"did:p05", "did:p06", "did:p07", "did:p08", "did:p09"}))
+		Expect(bookmark).To(BeEmpty())
+	})
+
+	It("starts the range at the bookmark", func() {
+		_, bookmark := page(map[string]interface{}{"pageSize": 8})
+		l.rangeReads = 0
+		dids, _ := page(map[string]interface{}{"pageSize": 2, "bookmark": bookmark})
+		Expect(dids).To(Equal([]string{"did:p08", "did:p09"}))
+		Expect(l.rangeReads).To(Equal(2))
+	})
+
+	It("reads the ranges needed to fill a page with filters", func() {
+		filters := []map[string]interface{}{{"field": "mspID", "value": "Org2MSP"}}
+		dids, bookmark := page(map[string]interface{}{"pageSize": 2, "filters": filters})
+		Expect(dids).To(Equal([]string{"did:p01", "did:p03"}))
+
+		dids, bookmark = page(map[string]interface{}{"pageSize": 2, "filters": filters, "bookmark": bookmark})
+		Expect(dids).To(Equal([]string{"did:p05", "did:p07"}))
+
+		dids, bookmark = page(map[string]interface{}{"pageSize": 2, "filters": filters, "bookmark": bookmark})
+		Expect(dids).To(Equal([]string{"did:p09"}))
+		Expect(bookmark).To(BeEmpty())
+	})
+
+	It("rejects the invalid pages", func() {
+		_, err := l.invoke("GetParticipants", map[string]interface{}{"pageSize": 0})
+		Expect(err).To(MatchError(ContainSubstring("pageSize must be between")))
+		_, err = l.invoke("GetParticipants", map[string]interface{}{"pageSize": 2, "bookmark": "%%"})
+		Expect(err).To(MatchError(ContainSubstring("invalid bookmark")))
+		_, err = l.invoke("GetParticipants", map[string]interface{}{"pageSize": 2, "filters": []map[string]interface{}{{"field": "secret", "value": "x"}}})
+		Expect(err).To(MatchError(ContainSubstring("field secret can not be filtered")))
+	})
+})
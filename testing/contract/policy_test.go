@@ -0,0 +1,32 @@
+package contract_test
+
+import (
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Policies", func() {
+	var l *ledger
+
+	BeforeEach(func() {
+		l = newLedger()
+		_, err := l.as(newClient("Org1MSP", "admin", true, nil)).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("stores the attribute conditions of a policy", func() {
+		expr := map[string]interface{}{"op": "or", "args": []map[string]interface{}{
+			{"op": "attr", "attr": map[string]interface{}{"source": "cert", "name": "Cargo", "value": "Director"}},
+			{"op": "attr", "attr": map[string]interface{}{"source": "msp", "values": []string{"Org1MSP"}}},
+		}}
+		_, err := l.invoke("SetPolicy", map[string]interface{}{"function": "CreateIssuer", "expr": expr})
+		Expect(err).NotTo(HaveOccurred())
+
+		var policy identity.Policy
+		Expect(l.invokeInto(&policy, "GetPolicy", map[string]interface{}{"id": "CreateIssuer"})).To(Succeed())
+		Expect(policy.Expr.Args).To(HaveLen(2))
+		Expect(policy.Expr.Args[0].Attr.Name).To(Equal("Cargo"))
+		Expect(policy.Expr.Args[1].Attr.Values).To(Equal([]string{"Org1MSP"}))
+	})
+})
@@ -0,0 +1,200 @@
+package contract_test
+
+import (
+	"strings"
+
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Public key index", func() {
+	var (
+		l          *ledger
+		org1, org2 *certificate
+		key        string
+	)
+
+	byKey := func(publicKey string) (*model.Participant, error) {
+		var participant model.Participant
+		if err := l.invokeInto(&participant, "GetParticipantByPublicKey", map[string]interface{}{"publicKey": publicKey}); err != nil {
+			return nil, err
+		}
+		return &participant, nil
+	}
+
+	BeforeEach(func() {
+		l = newLedger()
+		org1 = newClient("Org1MSP", "admin", true, nil)
+		org2 = newClient("Org2MSP", "admin", true, nil)
+		_, err := l.as(org1).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = l.as(org2).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+
+		key = newKey()
+		_, err = l.as(org1).createParticipant(map[string]interface{}{"did": "did:alice", "publicKey": key})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Describe("bind", func() {
+		It("binds the public key to the DID", func() {
+			participant, err := byKey(key)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(participant.Did).To(Equal("did:alice"))
+		})
+
+		It("rejects the public key of another DID", func() {
+			_, err := l.createParticipant(map[string]interface{}{"did": "did:bob", "publicKey": key})
+			Expect(err).To(MatchError(ContainSubstring("the public key is already bound to did:alice")))
+		})
+	})
+
+	Describe("unbind", func() {
+		It("frees the public key of a deleted participant", func() {
+			_, err := l.invoke("DeleteParticipant", map[string]interface{}{"userDid": "did:alice", "callerDid": "did:alice"})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = byKey(key)
+			Expect(err).To(MatchError(ContainSubstring("no participant found for the public key")))
+
+			_, err = l.createParticipant(map[string]interface{}{"did": "did:bob", "publicKey": key})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("binds the public key again on restore, unless it was taken", func() {
+			_, err := l.invoke("DeleteParticipant", map[string]interface{}{"userDid": "did:alice", "callerDid": "did:alice"})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = l.createParticipant(map[string]interface{}{"did": "did:bob", "publicKey": key})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = l.invoke("RestoreParticipant", map[string]interface{}{"did": "did:alice"})
+			Expect(err).To(MatchError(ContainSubstring("the public key is already bound to did:bob")))
+		})
+	})
+
+	Describe("rotation", func() {
+		rotate := func(did, publicKey string) error {
+			_, err := l.invoke("UpdateParticipant", map[string]interface{}{"did": did, "publicKey": publicKey, "active": true})
+			return err
+		}
+
+		It("moves the index to the new public key", func() {
+			newPublicKey := newKey()
+			Expect(rotate("did:alice", newPublicKey)).To(Succeed())
+
+			participant, err := byKey(newPublicKey)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(participant.Did).To(Equal("did:alice"))
+			_, err = byKey(key)
+			Expect(err).To(MatchError(ContainSubstring("no participant found for the public key")))
+		})
+
+		It("rejects the public key of another DID", func() {
+			bobKey := newKey()
+			_, err := l.createParticipant(map[string]interface{}{"did": "did:bob", "publicKey": bobKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(rotate("did:alice", bobKey)).To(MatchError(ContainSubstring("the public key is already bound to did:bob")))
+			participant, err := byKey(key)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(participant.Did).To(Equal("did:alice"))
+		})
+
+		It("rejects a public key that can not be parsed", func() {
+			Expect(rotate("did:alice", "my public key")).To(MatchError(ContainSubstring("invalid publicKey")))
+		})
+	})
+
+	Describe("participants created before the index", func() {
+		var bobKey string
+
+		BeforeEach(func() {
+			bobKey = newKey()
+			_, err := l.as(org1).createParticipant(map[string]interface{}{"did": "did:bob", "publicKey": bobKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			// did:carol was stored with the public key of did:alice, and the index is dropped
+			l.mock.MockTransactionStart("legacy")
+			carol := strings.Replace(string(l.mock.State[participantKey("did:alice")]), `"did:alice"`, `"did:carol"`, 1)
+			Expect(l.mock.PutState(participantKey("did:carol"), []byte(carol))).To(Succeed())
+			for key := range l.mock.State {
+				if strings.HasPrefix(key, "\x00"+identity.ObjectTypeParticipantPubKey+"\x00") {
+					Expect(l.mock.DelState(key)).To(Succeed())
+				}
+			}
+			l.mock.MockTransactionEnd("legacy")
+		})
+
+		It("reports the public keys registered under more than one DID", func() {
+			fingerprint, err := lus.PublicKeyFingerprint(key)
+			Expect(err).NotTo(HaveOccurred())
+
+			var duplicates []identity.PublicKeyDuplicate
+			Expect(l.invokeInto(&duplicates, "GetPublicKeyDuplicates")).To(Succeed())
+			Expect(duplicates).To(Equal([]identity.PublicKeyDuplicate{{Fingerprint: fingerprint, Dids: []string{"did:alice", "did:carol"}}}))
+		})
+
+		It("indexes the public keys that are not duplicated", func() {
+			var duplicates []identity.PublicKeyDuplicate
+			Expect(l.as(org1).invokeInto(&duplicates, "IndexParticipantPublicKeys")).To(Succeed())
+			Expect(duplicates).To(HaveLen(1))
+			Expect(duplicates[0].Dids).To(Equal([]string{"did:alice", "did:carol"}))
+
+			participant, err := byKey(bobKey)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(participant.Did).To(Equal("did:bob"))
+			_, err = byKey(key)
+			Expect(err).To(MatchError(ContainSubstring("no participant found for the public key")))
+		})
+
+		It("binds the public key once the duplicate is removed", func() {
+			_, err := l.invoke("DeleteParticipant", map[string]interface{}{"userDid": "did:carol", "callerDid": "did:carol"})
+			Expect(err).NotTo(HaveOccurred())
+
+			var duplicates []identity.PublicKeyDuplicate
+			Expect(l.as(org1).invokeInto(&duplicates, "IndexParticipantPublicKeys")).To(Succeed())
+			Expect(duplicates).To(BeEmpty())
+			participant, err := byKey(key)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(participant.Did).To(Equal("did:alice"))
+		})
+
+		It("are indexed only by an IdentityAdmin", func() {
+			_, err := l.as(newClient("Org1MSP", "client", false, nil)).invoke("IndexParticipantPublicKeys")
+			Expect(err).To(MatchError(ContainSubstring("IdentityAdmin capability")))
+			_, err = byKey(bobKey)
+			Expect(err).To(MatchError(ContainSubstring("no participant found for the public key")))
+		})
+	})
+
+	Describe("callerDid", func() {
+		var carol *certificate
+
+		setStatus := func(client *certificate) error {
+			_, err := l.as(client).invoke("SetOrganizationStatus", map[string]interface{}{"mspID": "Org1MSP", "status": "active"})
+			return err
+		}
+
+		BeforeEach(func() {
+			// did:carol of the Org2MSP is a channel admin
+			_, err := l.as(org1).invoke("GrantChannelAdmin", map[string]interface{}{"mspID": "Org2MSP", "member": "did:carol"})
+			Expect(err).NotTo(HaveOccurred())
+			carol = newClient("Org2MSP", "carol", false, nil)
+		})
+
+		It("is the DID bound to the public key of the certificate", func() {
+			Expect(setStatus(carol)).To(MatchError(ContainSubstring("ChannelAdmin capability")))
+
+			_, err := l.as(org2).createParticipant(map[string]interface{}{"did": "did:carol", "publicKey": carol.publicKey()})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(setStatus(carol)).To(Succeed())
+		})
+
+		It("is the did attribute of the certificate first", func() {
+			dave := newClient("Org2MSP", "dave", false, map[string]string{"did": "did:carol"})
+			Expect(setStatus(dave)).To(Succeed())
+		})
+	})
+})
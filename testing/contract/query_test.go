@@ -0,0 +1,110 @@
+package contract_test
+
+import (
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rich queries", func() {
+	var (
+		l      *ledger
+		org1   *certificate
+		client *certificate
+	)
+
+	// dids returns the DIDs of the participants of a paginated response
+	dids := func(response model.PaginatedQueryResponse) []string {
+		dids := make([]string, 0, len(response.Records))
+		for _, record := range response.Records {
+			dids = append(dids, record.(map[string]interface{})["did"].(string))
+		}
+		return dids
+	}
+	org1Selector := map[string]interface{}{"selector": map[string]interface{}{"docType": map[string]interface{}{"$eq": identity.ParticipantDocType}, "mspID": map[string]interface{}{"$eq": "Org1MSP"}}}
+
+	BeforeEach(func() {
+		l = newLedger()
+		org1 = newClient("Org1MSP", "admin", true, nil)
+		client = newClient("Org1MSP", "client", false, nil)
+		_, err := l.as(org1).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+		for _, did := range []string{"did:alice", "did:bob"} {
+			_, err := l.createParticipant(map[string]interface{}{"did": did, "publicKey": newKey()})
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
+	Describe("QueryAssetsBy", func() {
+		It("requires the QueryAdmin capability", func() {
+			_, err := l.as(client).invoke("QueryAssetsBy", org1Selector)
+			Expect(err).To(MatchError(ContainSubstring("does not hold the QueryAdmin capability in Org1MSP")))
+		})
+
+		It("runs the selector for a query admin", func() {
+			var records []map[string]interface{}
+			Expect(l.as(org1).invokeInto(&records, "QueryAssetsBy", org1Selector)).To(Succeed())
+			Expect(records).To(HaveLen(2))
+			Expect(records[0]["did"]).To(Equal("did:alice"))
+			Expect(records[1]["did"]).To(Equal("did:bob"))
+		})
+	})
+
+	Describe("QueryAssetsWithPagination", func() {
+		It("requires the QueryAdmin capability", func() {
+			_, err := l.as(client).invoke("QueryAssetsWithPagination", map[string]interface{}{"queryString": org1Selector, "pageSize": 10})
+			Expect(err).To(MatchError(ContainSubstring("does not hold the QueryAdmin capability in Org1MSP")))
+		})
+
+		It("runs the selector for a query admin", func() {
+			var response model.PaginatedQueryResponse
+			Expect(l.as(org1).invokeInto(&response, "QueryAssetsWithPagination", map[string]interface{}{"queryString": org1Selector, "pageSize": 10})).To(Succeed())
+			Expect(dids(response)).To(Equal([]string{"did:alice", "did:bob"}))
+		})
+
+		It("requires a selector and a valid page size", func() {
+			_, err := l.as(org1).invoke("QueryAssetsWithPagination", map[string]interface{}{"queryString": map[string]interface{}{}, "pageSize": 10})
+			Expect(err).To(MatchError(ContainSubstring("queryString.selector")))
+			_, err = l.as(org1).invoke("QueryAssetsWithPagination", map[string]interface{}{"queryString": org1Selector, "pageSize": 0})
+			Expect(err).To(MatchError(ContainSubstring("pageSize must be between 1 and")))
+		})
+	})
+
+	Describe("QueryDocuments", func() {
+		query := func(docType string, where ...map[string]interface{}) (*model.PaginatedQueryResponse, error) {
+			var response model.PaginatedQueryResponse
+			if err := l.as(client).invokeInto(&response, "QueryDocuments", map[string]interface{}{"docType": docType, "where": where, "pageSize": 10}); err != nil {
+				return nil, err
+			}
+			return &response, nil
+		}
+
+		It("runs a whitelisted query without a capability", func() {
+			response, err := query(identity.ParticipantDocType, map[string]interface{}{"field": "mspID", "op": "$eq", "value": "Org1MSP"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dids(*response)).To(Equal([]string{"did:alice", "did:bob"}))
+		})
+
+		It("rejects a field that is not whitelisted", func() {
+			_, err := query(identity.ParticipantDocType, map[string]interface{}{"field": "personalData", "op": "$eq", "value": "x"})
+			Expect(err).To(MatchError(ContainSubstring("field personalData is not allowed in did.participant queries")))
+			_, err = query(identity.ParticipantDocType, map[string]interface{}{"field": "docType", "op": "$eq", "value": identity.IssuerDocType})
+			Expect(err).To(MatchError(ContainSubstring("docType can not be filtered")))
+		})
+
+		It("rejects an operator that is not allowed on the field", func() {
+			_, err := query(identity.ParticipantDocType, map[string]interface{}{"field": "publicKey", "op": "$ne", "value": "x"})
+			Expect(err).To(MatchError(ContainSubstring("operator $ne is not allowed on publicKey")))
+			_, err = query(identity.ParticipantDocType, map[string]interface{}{"field": "mspID", "op": "$regex", "value": ".*"})
+			Expect(err).To(MatchError(ContainSubstring("operator $regex is not allowed on mspID")))
+		})
+
+		It("rejects a doc type that can not be queried", func() {
+			for _, docType := range []string{"did.participant.personal", "did.admin", ""} {
+				_, err := query(docType, map[string]interface{}{"field": "id", "op": "$eq", "value": "x"})
+				Expect(err).To(MatchError(ContainSubstring("doc type " + docType + " can not be queried")))
+			}
+		})
+	})
+})
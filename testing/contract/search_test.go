@@ -0,0 +1,362 @@
+package contract_test
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// participantKey world state key of the participant
+func participantKey(did string) string {
+	return "\x00" + identity.ParticipantDocType + "\x00" + did + "\x00"
+}
+
+var _ = Describe("SearchParticipants", func() {
+	var (
+		l               *ledger
+		org1, org2      *certificate
+		rootID, otherID string
+		auditor         string
+	)
+
+	march := time.Date(2027, time.March, 15, 0, 0, 0, 0, time.UTC)
+	may := time.Date(2027, time.May, 10, 0, 0, 0, 0, time.UTC)
+
+	createParticipant := func(caller *certificate, did string, issuer *certificate, issuerID string, notAfter time.Time, roles ...string) {
+		cert := newCertificate(certificateOptions{mspID: caller.mspID, name: strings.TrimPrefix(did, "did:"), notAfter: notAfter}, issuer)
+		request := map[string]interface{}{"did": did, "publicKey": cert.publicKey(), "certPem": cert.certPem()}
+		if len(roles) > 0 {
+			request["roles"] = roles
+		}
+		if issuerID != "" {
+			request["issuerID"] = issuerID
+		}
+		_, err := l.as(caller).createParticipant(request)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	// search returns the DIDs of every page of the search and the state database of the pages
+	search := func(request map[string]interface{}) ([]string, string) {
+		var dids []string
+		var stateDatabase string
+		request["pageSize"] = 2
+		for {
+			var response identity.ParticipantSearchResponse
+			Expect(l.invokeInto(&response, "SearchParticipants", request)).To(Succeed())
+			Expect(len(response.Records)).To(BeNumerically("<=", 2))
+			Expect(response.FetchedRecordsCount).To(BeEquivalentTo(len(response.Records)))
+			stateDatabase = response.StateDatabase
+			for _, participant := range response.Records {
+				dids = append(dids, participant.Did)
+			}
+			if response.Bookmark == "" || len(response.Records) == 0 {
+				return dids, stateDatabase
+			}
+			request["bookmark"] = response.Bookmark
+		}
+	}
+	setStateDatabase := func(stateDatabase string) {
+		_, err := l.as(org1).invoke("UpdateConfig", map[string]interface{}{"autogenerateDid": false, "restoreGraceDays": 30, "retentionDays": 365, "encryptPersonalData": true, "stateDatabase": stateDatabase})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		l = newLedger()
+		org1 = newClient("Org1MSP", "admin", true, nil)
+		org2 = newClient("Org2MSP", "admin", true, nil)
+		_, err := l.as(org1).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = l.as(org2).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+
+		var role struct {
+			ID string `json:"id"`
+		}
+		Expect(l.as(org1).invokeInto(&role, "CreateRole", map[string]interface{}{"name": "auditor", "contractFunctions": []string{"GetRole"}})).To(Succeed())
+		auditor = role.ID
+
+		root := newCA("Org1MSP", "root")
+		rootID = createIssuer(l, root, "")
+		other := newCA("Org1MSP", "other")
+		otherID = createIssuer(l, other, "")
+
+		createParticipant(org1, "did:a1", root, rootID, march, auditor)
+		createParticipant(org1, "did:a2", root, rootID, may)
+		createParticipant(org1, "did:a3", root, rootID, march, auditor)
+		createParticipant(org1, "did:a4", other, otherID, march)
+		createParticipant(org1, "did:a5", root, rootID, may)
+		createParticipant(org2, "did:b1", newCA("Org2MSP", "ca"), "", march)
+		createParticipant(org2, "did:b2", newCA("Org2MSP", "ca"), "", may)
+
+		_, err = l.as(org1).invoke("UpdateParticipant", map[string]interface{}{"did": "did:a3", "active": false})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Describe("on both state databases", func() {
+		for _, filters := range []struct {
+			request  map[string]interface{}
+			expected []string
+		}{
+			{map[string]interface{}{"mspID": "Org1MSP"}, []string{"did:a1", "did:a2", "did:a3", "did:a4", "did:a5"}},
+			{map[string]interface{}{"mspID": "Org2MSP"}, []string{"did:b1", "did:b2"}},
+			{map[string]interface{}{"issuerId": "root"}, []string{"did:a1", "did:a2", "did:a3", "did:a5"}},
+			{map[string]interface{}{"active": "false"}, []string{"did:a3"}},
+			{map[string]interface{}{"mspID": "Org1MSP", "active": "true"}, []string{"did:a1", "did:a2", "did:a4", "did:a5"}},
+			{map[string]interface{}{"expiresMonth": "2027-03"}, []string{"did:a1", "did:a3", "did:a4", "did:b1"}},
+			{map[string]interface{}{"expiresMonth": "2027-04"}, nil},
+			{map[string]interface{}{"role": "auditor"}, []string{"did:a1", "did:a3"}},
+		} {
+			filters := filters
+			It("finds the same participants", func() {
+				request := func() map[string]interface{} {
+					copied := make(map[string]interface{})
+					for name, value := range filters.request {
+						switch {
+						case name == "issuerId":
+							copied[name] = rootID
+						case name == "role":
+							copied[name] = auditor
+						default:
+							copied[name] = value
+						}
+					}
+					return copied
+				}
+
+				couchdb, _ := search(request())
+				l.leveldb = true
+				fallback, stateDatabase := search(request())
+				Expect(stateDatabase).To(Equal(identity.StateDatabaseLevelDB))
+				setStateDatabase(identity.StateDatabaseLevelDB)
+				leveldb, _ := search(request())
+
+				Expect(couchdb).To(ConsistOf(filters.expected))
+				Expect(fallback).To(Equal(leveldb))
+				Expect(leveldb).To(ConsistOf(filters.expected))
+			})
+		}
+
+		It("uses the rich query when CouchDB is available", func() {
+			_, stateDatabase := search(map[string]interface{}{"mspID": "Org1MSP"})
+			Expect(stateDatabase).To(Equal(identity.StateDatabaseCouchDB))
+		})
+	})
+
+	Describe("bookmarks", func() {
+		It("continues a search of the composite keys with its DID bookmark", func() {
+			setStateDatabase(identity.StateDatabaseLevelDB)
+			var page identity.ParticipantSearchResponse
+			Expect(l.invokeInto(&page, "SearchParticipants", map[string]interface{}{"mspID": "Org1MSP", "pageSize": 2})).To(Succeed())
+			Expect(page.Bookmark).To(Equal("did:a2"))
+
+			setStateDatabase(identity.StateDatabaseCouchDB)
+			Expect(l.invokeInto(&page, "SearchParticipants", map[string]interface{}{"mspID": "Org1MSP", "pageSize": 2, "bookmark": page.Bookmark})).To(Succeed())
+			Expect(page.StateDatabase).To(Equal(identity.StateDatabaseLevelDB))
+			Expect(page.Records[0].Did).To(Equal("did:a3"))
+		})
+
+		It("rejects a CouchDB bookmark on the composite keys", func() {
+			var page identity.ParticipantSearchResponse
+			Expect(l.invokeInto(&page, "SearchParticipants", map[string]interface{}{"mspID": "Org1MSP", "pageSize": 2})).To(Succeed())
+			Expect(page.StateDatabase).To(Equal(identity.StateDatabaseCouchDB))
+
+			setStateDatabase(identity.StateDatabaseLevelDB)
+			_, err := l.invoke("SearchParticipants", map[string]interface{}{"mspID": "Org1MSP", "pageSize": 2, "bookmark": page.Bookmark})
+			Expect(err).To(MatchError(ContainSubstring("invalid bookmark")))
+		})
+	})
+
+	Describe("expiry dates", func() {
+		It("are stored in UTC", func() {
+			var participant map[string]interface{}
+			Expect(json.Unmarshal(l.mock.State[participantKey("did:a1")], &participant)).To(Succeed())
+			Expect(participant["expiresTime"]).To(Equal("2027-03-15T00:00:00Z"))
+		})
+
+		It("of the participants stored with an offset are migrated to UTC", func() {
+			// a participant of schema version 1 expiring in April in UTC
+			var participant map[string]interface{}
+			Expect(json.Unmarshal(l.mock.State[participantKey("did:a2")], &participant)).To(Succeed())
+			delete(participant, "schemaVersion")
+			participant["expiresTime"] = "2027-03-31T22:00:00-05:00"
+			l.mock.State[participantKey("did:a2")], _ = json.Marshal(participant)
+
+			var stored model.Participant
+			Expect(l.invokeInto(&stored, "GetParticipant", map[string]interface{}{"did": "did:a2"})).To(Succeed())
+			Expect(stored.ExpiresTime).To(Equal("2027-04-01T03:00:00Z"))
+
+			_, err := l.as(org1).invoke("MigrateBatch", map[string]interface{}{"docType": identity.ParticipantDocType})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(json.Unmarshal(l.mock.State[participantKey("did:a2")], &participant)).To(Succeed())
+			Expect(participant["expiresTime"]).To(Equal("2027-04-01T03:00:00Z"))
+
+			couchdb, _ := search(map[string]interface{}{"expiresMonth": "2027-04"})
+			Expect(couchdb).To(ConsistOf("did:a2"))
+		})
+	})
+
+	Describe("RebuildParticipantIndexes", func() {
+		// the participants were stored before the secondary indexes existed
+		BeforeEach(func() {
+			setStateDatabase(identity.StateDatabaseLevelDB)
+			l.mock.MockTransactionStart("legacy")
+			for key := range l.mock.State {
+				if strings.HasPrefix(key, "\x00"+identity.ObjectTypeParticipantBy+"\x00") {
+					Expect(l.mock.DelState(key)).To(Succeed())
+				}
+			}
+			l.mock.MockTransactionEnd("legacy")
+		})
+
+		It("indexes the participants page by page", func() {
+			found, _ := search(map[string]interface{}{"mspID": "Org1MSP"})
+			Expect(found).To(BeEmpty())
+
+			var bookmarks []string
+			request := map[string]interface{}{"pageSize": 3}
+			for {
+				var response identity.IndexRebuildResponse
+				Expect(l.as(org1).invokeInto(&response, "RebuildParticipantIndexes", request)).To(Succeed())
+				bookmarks = append(bookmarks, response.Bookmark)
+				if response.Bookmark == "" {
+					break
+				}
+				Expect(response.FetchedRecordsCount).To(BeEquivalentTo(3))
+				request["bookmark"] = response.Bookmark
+			}
+			Expect(bookmarks).To(Equal([]string{"did:a3", "did:b1", ""}))
+
+			found, _ = search(map[string]interface{}{"mspID": "Org1MSP", "active": "true"})
+			Expect(found).To(Equal([]string{"did:a1", "did:a2", "did:a4", "did:a5"}))
+			found, _ = search(map[string]interface{}{"role": auditor})
+			Expect(found).To(Equal([]string{"did:a1", "did:a3"}))
+		})
+
+		It("can be run again over the indexed participants", func() {
+			_, err := l.as(org1).invoke("RebuildParticipantIndexes", map[string]interface{}{"pageSize": 10})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = l.as(org1).invoke("RebuildParticipantIndexes", map[string]interface{}{"pageSize": 10})
+			Expect(err).NotTo(HaveOccurred())
+
+			found, _ := search(map[string]interface{}{"mspID": "Org2MSP"})
+			Expect(found).To(Equal([]string{"did:b1", "did:b2"}))
+		})
+
+		It("rejects a page out of range", func() {
+			_, err := l.as(org1).invoke("RebuildParticipantIndexes", map[string]interface{}{"pageSize": 0})
+			Expect(err).To(MatchError(ContainSubstring("pageSize must be between 1 and")))
+		})
+
+		It("is run only by an IdentityAdmin", func() {
+			_, err := l.as(newClient("Org1MSP", "client", false, nil)).invoke("RebuildParticipantIndexes", map[string]interface{}{"pageSize": 10})
+			Expect(err).To(MatchError(ContainSubstring("IdentityAdmin capability")))
+		})
+	})
+})
+
+var _ = Describe("SearchIssuers", func() {
+	var (
+		l    *ledger
+		org1 *certificate
+		ids  map[string]string // issuer IDs by name
+	)
+
+	march := time.Date(2027, time.March, 15, 0, 0, 0, 0, time.UTC)
+	may := time.Date(2027, time.May, 10, 0, 0, 0, 0, time.UTC)
+
+	// names returns the names of the issuers of every page of the search
+	search := func(request map[string]interface{}) []string {
+		names := make(map[string]string, len(ids))
+		for name, id := range ids {
+			names[id] = name
+		}
+		var found []string
+		request["pageSize"] = 1
+		for {
+			var response identity.IssuerSearchResponse
+			Expect(l.invokeInto(&response, "SearchIssuers", request)).To(Succeed())
+			Expect(len(response.Records)).To(BeNumerically("<=", 1))
+			Expect(response.FetchedRecordsCount).To(BeEquivalentTo(len(response.Records)))
+			for _, issuer := range response.Records {
+				found = append(found, names[issuer.ID])
+			}
+			if response.Bookmark == "" {
+				return found
+			}
+			Expect(response.Bookmark).To(Equal(response.Records[0].ID))
+			request["bookmark"] = response.Bookmark
+		}
+	}
+
+	BeforeEach(func() {
+		l = newLedger()
+		org1 = newClient("Org1MSP", "admin", true, nil)
+		_, err := l.as(org1).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+
+		// root and other are roots, a and b are intermediates of root, b is inactive
+		newIssuer := func(name string, notAfter time.Time, parent *certificate) *certificate {
+			return newCertificate(certificateOptions{mspID: "Org1MSP", name: name, ca: true, maxPathLen: -1, notAfter: notAfter}, parent)
+		}
+		root := newIssuer("root", march, nil)
+		ids = map[string]string{"root": createIssuer(l, root, "")}
+		ids["a"] = createIssuer(l, newIssuer("a", may, root), ids["root"])
+		ids["b"] = createIssuer(l, newIssuer("b", march, root), ids["root"])
+		ids["other"] = createIssuer(l, newIssuer("other", may, nil), "")
+		_, err = l.as(org1).invoke("DeactivateIssuer", map[string]interface{}{"id": ids["b"]})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	for _, filters := range []struct {
+		request  map[string]interface{}
+		expected []string
+	}{
+		{map[string]interface{}{}, []string{"root", "a", "b", "other"}},
+		{map[string]interface{}{"active": "true"}, []string{"root", "a", "other"}},
+		{map[string]interface{}{"active": "false"}, []string{"b"}},
+		{map[string]interface{}{"expiresMonth": "2027-03"}, []string{"root", "b"}},
+		{map[string]interface{}{"expiresMonth": "2027-04"}, nil},
+		{map[string]interface{}{"parentId": "root"}, []string{"a", "b"}},
+		{map[string]interface{}{"parentId": "root", "active": "true", "expiresMonth": "2027-05"}, []string{"a"}},
+	} {
+		filters := filters
+		It("finds the issuers of the filters on every page", func() {
+			request := make(map[string]interface{})
+			for name, value := range filters.request {
+				if name == "parentId" {
+					value = ids[value.(string)]
+				}
+				request[name] = value
+			}
+			Expect(search(request)).To(ConsistOf(filters.expected))
+		})
+	}
+
+	It("continues from the bookmark in issuer ID order", func() {
+		var page identity.IssuerSearchResponse
+		Expect(l.invokeInto(&page, "SearchIssuers", map[string]interface{}{"pageSize": 3})).To(Succeed())
+		Expect(page.Records).To(HaveLen(3))
+		Expect(page.Bookmark).To(Equal(page.Records[2].ID))
+		Expect(page.Records[0].ID < page.Records[1].ID && page.Records[1].ID < page.Records[2].ID).To(BeTrue())
+
+		last := page.Records[2].ID
+		Expect(l.invokeInto(&page, "SearchIssuers", map[string]interface{}{"pageSize": 3, "bookmark": page.Bookmark})).To(Succeed())
+		Expect(page.Records).To(HaveLen(1))
+		Expect(page.Records[0].ID > last).To(BeTrue())
+		Expect(page.Bookmark).To(BeEmpty())
+	})
+
+	It("rejects invalid filters and pages out of range", func() {
+		_, err := l.invoke("SearchIssuers", map[string]interface{}{"active": "yes", "pageSize": 1})
+		Expect(err).To(MatchError(ContainSubstring("invalid active yes")))
+		_, err = l.invoke("SearchIssuers", map[string]interface{}{"expiresMonth": "2027-3", "pageSize": 1})
+		Expect(err).To(MatchError(ContainSubstring("invalid expiresMonth 2027-3")))
+		_, err = l.invoke("SearchIssuers", map[string]interface{}{"pageSize": 0})
+		Expect(err).To(MatchError(ContainSubstring("pageSize must be between 1 and")))
+	})
+})
@@ -0,0 +1,124 @@
+package contract_test
+
+import (
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Separation of duty", func() {
+	var (
+		l               *ledger
+		admin, otherOrg *certificate
+		alice, bob      *certificate
+		maker, checker  string
+	)
+
+	BeforeEach(func() {
+		l = newLedger()
+		admin = newClient("Org1MSP", "admin", true, nil)
+		otherOrg = newClient("Org2MSP", "admin", true, nil)
+		alice = newClient("Org1MSP", "alice", false, nil)
+		bob = newClient("Org1MSP", "bob", false, nil)
+
+		_, err := l.as(admin).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = l.as(otherOrg).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+
+		var role struct {
+			ID string `json:"id"`
+		}
+		Expect(l.as(admin).invokeInto(&role, "CreateRole", map[string]interface{}{"name": "maker", "contractFunctions": []string{"GetRole"}})).To(Succeed())
+		maker = role.ID
+		Expect(l.invokeInto(&role, "CreateRole", map[string]interface{}{"name": "checker", "contractFunctions": []string{"GetRole"}})).To(Succeed())
+		checker = role.ID
+		_, err = l.invoke("CreateSodRule", map[string]interface{}{"name": "four eyes", "type": "dynamic", "roles": []string{maker, checker}})
+		Expect(err).NotTo(HaveOccurred())
+
+		for did, client := range map[string]*certificate{"did:alice": alice, "did:bob": bob} {
+			_, err = l.createParticipant(map[string]interface{}{"did": did, "publicKey": client.publicKey(), "roles": []string{maker, checker}})
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
+	activity := func(did, roleID string) map[string]interface{} {
+		return map[string]interface{}{"workflowId": "proposal-1", "did": did, "roleId": roleID}
+	}
+
+	Describe("RecordWorkflowActivity", func() {
+		It("records the activity of the caller", func() {
+			_, err := l.as(alice).invoke("RecordWorkflowActivity", activity("did:alice", maker))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("rejects a caller that is not the participant nor an admin", func() {
+			_, err := l.as(alice).invoke("RecordWorkflowActivity", activity("did:bob", checker))
+			Expect(err).To(MatchError(ContainSubstring("the caller is not the participant did:bob")))
+		})
+
+		It("accepts a role admin of the org of the participant", func() {
+			_, err := l.as(admin).invoke("RecordWorkflowActivity", activity("did:bob", checker))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("rejects a role admin of another org", func() {
+			_, err := l.as(otherOrg).invoke("RecordWorkflowActivity", activity("did:bob", checker))
+			Expect(err).To(MatchError(ContainSubstring("not authorized to record the activity")))
+		})
+
+		It("rejects a conflicting role in the same workflow", func() {
+			_, err := l.as(alice).invoke("RecordWorkflowActivity", activity("did:alice", maker))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = l.invoke("RecordWorkflowActivity", activity("did:alice", checker))
+			Expect(err).To(MatchError(ContainSubstring("proposal-1")))
+
+			_, err = l.as(bob).invoke("RecordWorkflowActivity", activity("did:bob", checker))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("accepts the conflicting role in another workflow", func() {
+			_, err := l.as(alice).invoke("RecordWorkflowActivity", activity("did:alice", maker))
+			Expect(err).NotTo(HaveOccurred())
+			other := activity("did:alice", checker)
+			other["workflowId"] = "proposal-2"
+			_, err = l.invoke("RecordWorkflowActivity", other)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Describe("static rules", func() {
+		It("rejects a participant holding both roles", func() {
+			_, err := l.as(admin).invoke("CreateSodRule", map[string]interface{}{"name": "static four eyes", "type": "static", "roles": []string{maker, checker}})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = l.createParticipant(map[string]interface{}{"did": "did:carol", "publicKey": newKey(), "roles": []string{maker, checker}})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("GetSodConflicts", func() {
+		conflicts := func() []identity.SodConflict {
+			var items []identity.SodConflict
+			Expect(l.as(admin).invokeInto(&items, "GetSodConflicts")).To(Succeed())
+			return items
+		}
+
+		It("ignores the dynamic rules", func() {
+			Expect(conflicts()).To(BeEmpty())
+		})
+
+		It("reports the participants that held both roles before the static rule", func() {
+			var rule identity.SodRule
+			Expect(l.as(admin).invokeInto(&rule, "CreateSodRule", map[string]interface{}{"name": "static four eyes", "type": "static", "roles": []string{maker, checker}})).To(Succeed())
+			_, err := l.createParticipant(map[string]interface{}{"did": "did:carol", "publicKey": newKey(), "roles": []string{maker}})
+			Expect(err).NotTo(HaveOccurred())
+
+			items := conflicts()
+			Expect(items).To(HaveLen(2))
+			Expect([]string{items[0].Did, items[1].Did}).To(ConsistOf("did:alice", "did:bob"))
+			Expect(items[0].RuleID).To(Equal(rule.ID))
+			Expect(items[0].MspID).To(Equal("Org1MSP"))
+			Expect(items[0].Roles).To(ConsistOf(maker, checker))
+		})
+	})
+})
@@ -0,0 +1,156 @@
+package contract_test
+
+import (
+	"time"
+
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Issuer trust policies", func() {
+	var (
+		l               *ledger
+		root, other     *certificate
+		rootID, otherID string
+		alice, bob, eve *certificate
+	)
+
+	createParticipant := func(did string, cert *certificate, issuerID string) error {
+		_, err := l.createParticipant(map[string]interface{}{"did": did, "publicKey": cert.publicKey(), "certPem": cert.certPem(), "issuerID": issuerID})
+		return err
+	}
+	violations := func(issuerID string, policy map[string]interface{}) map[string][]string {
+		var items []identity.TrustPolicyViolation
+		request := map[string]interface{}{"issuerId": issuerID}
+		if policy != nil {
+			request["policy"] = policy
+		}
+		Expect(l.invokeInto(&items, "GetTrustPolicyViolations", request)).To(Succeed())
+		reasons := make(map[string][]string)
+		for _, item := range items {
+			Expect(item.IssuerID).To(Equal(issuerID))
+			reasons[item.Did] = item.Reasons
+		}
+		return reasons
+	}
+
+	BeforeEach(func() {
+		l = newLedger()
+		_, err := l.as(newClient("Org1MSP", "admin", true, nil)).invoke("InitLedger")
+		Expect(err).NotTo(HaveOccurred())
+
+		root = newCA("Org1MSP", "root")
+		rootID = createIssuer(l, root, "")
+		other = newCA("Org1MSP", "other")
+		otherID = createIssuer(l, other, "")
+
+		alice = newCertificate(certificateOptions{mspID: "Org1MSP", name: "alice", notAfter: time.Now().AddDate(0, 0, 90)}, root)
+		bob = newCertificate(certificateOptions{mspID: "Org1MSP", name: "bob", notAfter: time.Now().AddDate(0, 0, 10)}, root)
+		eve = newCertificate(certificateOptions{mspID: "Org1MSP", name: "eve", notAfter: time.Now().AddDate(0, 0, 90)}, other)
+		Expect(createParticipant("did:alice", alice, rootID)).To(Succeed())
+		Expect(createParticipant("did:bob", bob, rootID)).To(Succeed())
+		Expect(createParticipant("did:eve", eve, otherID)).To(Succeed())
+	})
+
+	Describe("GetTrustPolicyViolations", func() {
+		It("reports nothing without a policy", func() {
+			Expect(violations(rootID, nil)).To(BeEmpty())
+		})
+
+		It("reports only the participants of the issuer", func() {
+			reasons := violations(rootID, map[string]interface{}{"maxValidityDays": 0, "allowedMspIDs": []string{"Org2MSP"}})
+			Expect(reasons).To(HaveLen(2))
+			Expect(reasons).To(HaveKey("did:alice"))
+			Expect(reasons).To(HaveKey("did:bob"))
+			Expect(reasons["did:alice"]).To(ConsistOf("organization Org1MSP is not allowed"))
+		})
+
+		It("checks the allowed attributes", func() {
+			reasons := violations(rootID, map[string]interface{}{"maxValidityDays": 0, "allowedAttributes": []string{"name", "company"}})
+			Expect(reasons["did:alice"]).To(ConsistOf("attribute organizationalUnit is not allowed"))
+
+			Expect(violations(rootID, map[string]interface{}{"maxValidityDays": 0, "allowedAttributes": []string{"name", "company", "organizationalUnit"}})).To(BeEmpty())
+		})
+
+		It("checks the allowed DID prefixes", func() {
+			reasons := violations(rootID, map[string]interface{}{"maxValidityDays": 0, "allowedDidPrefixes": []string{"did:al"}})
+			Expect(reasons).To(HaveLen(1))
+			Expect(reasons["did:bob"]).To(ConsistOf("did did:bob does not have an allowed prefix"))
+		})
+
+		It("checks the validity of the certificates", func() {
+			reasons := violations(rootID, map[string]interface{}{"maxValidityDays": 30})
+			Expect(reasons).To(HaveLen(1))
+			Expect(reasons["did:alice"]).To(ConsistOf(ContainSubstring("exceeds 30 days")))
+		})
+
+		It("checks the algorithms of the participant keys", func() {
+			reasons := violations(rootID, map[string]interface{}{"maxValidityDays": 0, "allowedKeyAlgorithms": []string{"EdDSA"}})
+			Expect(reasons).To(HaveLen(2))
+			Expect(reasons["did:bob"]).To(ConsistOf("key algorithms [ES256] are not allowed"))
+
+			Expect(violations(rootID, map[string]interface{}{"maxValidityDays": 0, "allowedKeyAlgorithms": []string{"ES256"}})).To(BeEmpty())
+		})
+
+		It("reports every broken rule of a participant", func() {
+			reasons := violations(rootID, map[string]interface{}{"maxValidityDays": 30, "allowedDidPrefixes": []string{"did:bob"}, "allowedMspIDs": []string{"Org2MSP"}})
+			Expect(reasons["did:alice"]).To(HaveLen(3))
+			Expect(reasons["did:bob"]).To(HaveLen(1))
+		})
+
+		It("reports against the current policy of the issuer", func() {
+			_, err := l.invoke("SetIssuerTrustPolicy", map[string]interface{}{"issuerId": rootID, "policy": map[string]interface{}{"maxValidityDays": 30}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(violations(rootID, nil)).To(HaveKey("did:alice"))
+		})
+
+		It("does not report the participants moved to another issuer", func() {
+			moved := newCertificate(certificateOptions{mspID: "Org1MSP", name: "alice", key: alice.key}, other)
+			_, err := l.invoke("UpdateParticipant", map[string]interface{}{"did": "did:alice", "issuerID": otherID, "certPem": moved.certPem(), "active": true})
+			Expect(err).NotTo(HaveOccurred())
+
+			reasons := violations(rootID, map[string]interface{}{"maxValidityDays": 0, "allowedMspIDs": []string{"Org2MSP"}})
+			Expect(reasons).To(HaveLen(1))
+			Expect(reasons).To(HaveKey("did:bob"))
+		})
+
+		It("rejects the invalid policies", func() {
+			_, err := l.invoke("GetTrustPolicyViolations", map[string]interface{}{"issuerId": rootID, "policy": map[string]interface{}{"maxValidityDays": -1}})
+			Expect(err).To(MatchError(ContainSubstring("maxValidityDays can not be negative")))
+			_, err = l.invoke("GetTrustPolicyViolations", map[string]interface{}{"issuerId": rootID, "policy": map[string]interface{}{"maxValidityDays": 0, "allowedKeyAlgorithms": []string{"HS256"}}})
+			Expect(err).To(MatchError(ContainSubstring("unsupported key algorithm HS256")))
+		})
+	})
+
+	Describe("enforcement", func() {
+		BeforeEach(func() {
+			_, err := l.invoke("SetIssuerTrustPolicy", map[string]interface{}{"issuerId": rootID, "policy": map[string]interface{}{"maxValidityDays": 30}})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("rejects the participants that break the policy of the issuer", func() {
+			carol := newCertificate(certificateOptions{mspID: "Org1MSP", name: "carol", notAfter: time.Now().AddDate(0, 0, 90)}, root)
+			Expect(createParticipant("did:carol", carol, rootID)).To(MatchError(ContainSubstring("the trust policy of the issuer " + rootID + " does not allow did:carol")))
+
+			dave := newCertificate(certificateOptions{mspID: "Org1MSP", name: "dave", notAfter: time.Now().AddDate(0, 0, 10)}, root)
+			Expect(createParticipant("did:dave", dave, rootID)).To(Succeed())
+		})
+
+		It("applies the policies of the ancestors of the issuer", func() {
+			intermediate := newCertificate(certificateOptions{mspID: "Org1MSP", name: "intermediate", ca: true, maxPathLen: -1}, root)
+			intermediateID := createIssuer(l, intermediate, rootID)
+
+			carol := newCertificate(certificateOptions{mspID: "Org1MSP", name: "carol", notAfter: time.Now().AddDate(0, 0, 90)}, intermediate)
+			Expect(createParticipant("did:carol", carol, intermediateID)).To(MatchError(ContainSubstring("the trust policy of the issuer " + rootID)))
+		})
+
+		It("rejects the attestation of attributes that break the policy", func() {
+			_, err := l.invoke("SetIssuerTrustPolicy", map[string]interface{}{"issuerId": rootID, "policy": map[string]interface{}{"maxValidityDays": 0, "allowedAttributes": []string{"name", "company", "organizationalUnit"}}})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = l.invoke("UpdateParticipant", map[string]interface{}{"did": "did:bob", "active": true, "attrsExtras": map[string]interface{}{"department": "sales"}})
+			Expect(err).To(MatchError(ContainSubstring("attribute department is not allowed")))
+		})
+	})
+})
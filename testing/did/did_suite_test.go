@@ -0,0 +1,13 @@
+package did_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestDid(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Did Suite")
+}
@@ -0,0 +1,193 @@
+package did_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/did"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+// ed25519 key of the did:key examples of the W3C CCG specification
+const (
+	specPublicKey = "94966b7c08e405775f8de6cc1c4508f6eb227403e1025b2c8ad2d7477398c5b2"
+	specDid       = "did:key:z6MkpTHR8VNsBxYAAWHut2Geadd9jSwuBV8xRoAnwWsdvktH"
+)
+
+func ecdsaKey(curve elliptic.Curve) crypto.PublicKey {
+	key, _ := ecdsa.GenerateKey(curve, rand.Reader)
+	return &key.PublicKey
+}
+
+var _ = Describe("DID", func() {
+	specKey, _ := hex.DecodeString(specPublicKey)
+
+	Describe("Parse", func() {
+		table.DescribeTable("method and identifier",
+			func(value, method, id string) {
+				parsed, err := did.Parse(value)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*parsed).To(Equal(did.DID{Method: method, ID: id}))
+				Expect(parsed.String()).To(Equal(value))
+			},
+			table.Entry("legacy", "did:ab43bdf5", did.Legacy, "ab43bdf5"),
+			table.Entry("key", specDid, "key", specDid[len("did:key:"):]),
+			table.Entry("fabric", "did:fabric:mychannel:alice", "fabric", "mychannel:alice"),
+		)
+
+		table.DescribeTable("invalid DIDs",
+			func(value string) {
+				_, err := did.Parse(value)
+				Expect(err).To(HaveOccurred())
+			},
+			table.Entry("without prefix", "87081206903"),
+			table.Entry("empty legacy", "did:"),
+			table.Entry("upper case method", "did:Key:z6Mk"),
+			table.Entry("empty identifier", "did:key:"),
+			table.Entry("invalid characters", "did:web:example.com/alice"),
+		)
+	})
+
+	Describe("Validate", func() {
+		It("accepts the legacy DIDs", func() {
+			Expect(did.Validate("did:ab43bdf5", did.Params{})).To(Succeed())
+		})
+
+		It("parses the DIDs with the registered methods", func() {
+			for _, value := range []string{specDid, "did:web:example.com", "did:fabric:mychannel:alice"} {
+				parsed, err := did.Parse(value)
+				Expect(err).NotTo(HaveOccurred())
+				method, err := did.Lookup(parsed.Method)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(method.Parse(value)).To(Equal(parsed))
+			}
+			_, err := did.KeyMethod{}.Parse("did:web:example.com")
+			Expect(err).To(MatchError("did:web:example.com is not a did:key"))
+		})
+
+		It("rejects the unsupported methods", func() {
+			Expect(did.Validate("did:example:123", did.Params{})).To(MatchError(ContainSubstring("unsupported DID method example")))
+		})
+	})
+
+	Describe("did:key", func() {
+		It("encodes the example of the specification", func() {
+			generated, err := did.KeyMethod{}.Generate(did.Params{PublicKey: ed25519.PublicKey(specKey)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generated).To(Equal(specDid))
+
+			publicKey, err := did.ParseMultibase(specDid[len("did:key:"):])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(publicKey).To(Equal(ed25519.PublicKey(specKey)))
+		})
+
+		table.DescribeTable("round trip of the supported keys",
+			func(publicKey crypto.PublicKey, prefix string) {
+				generated, err := did.KeyMethod{}.Generate(did.Params{PublicKey: publicKey})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(generated).To(HavePrefix("did:key:" + prefix))
+				Expect(did.Validate(generated, did.Params{PublicKey: publicKey})).To(Succeed())
+
+				parsed, err := did.ParseMultibase(generated[len("did:key:"):])
+				Expect(err).NotTo(HaveOccurred())
+				Expect(parsed).To(Equal(publicKey))
+			},
+			table.Entry("Ed25519", ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)), "z6Mk"),
+			table.Entry("P-256", ecdsaKey(elliptic.P256()), "zDn"),
+			table.Entry("P-384", ecdsaKey(elliptic.P384()), "z82"),
+			table.Entry("P-521", ecdsaKey(elliptic.P521()), "z2J9"),
+			table.Entry("RSA", func() crypto.PublicKey { key, _ := rsa.GenerateKey(rand.Reader, 2048); return &key.PublicKey }(), "z4MX"),
+		)
+
+		It("rejects a DID of another public key", func() {
+			err := did.Validate(specDid, did.Params{PublicKey: ecdsaKey(elliptic.P256())})
+			Expect(err).To(MatchError(ContainSubstring("is not derived from the public key")))
+		})
+
+		It("rejects the unsupported multibase encodings and multicodecs", func() {
+			_, err := did.ParseMultibase("f" + specPublicKey)
+			Expect(err).To(MatchError(ContainSubstring("expected base58btc")))
+			_, err = did.ParseMultibase("z2NEpo7TZRRrLZSi2U") // "Hello World!"
+			Expect(err).To(MatchError(ContainSubstring("unsupported multicodec")))
+		})
+	})
+
+	Describe("base58", func() {
+		It("rejects the characters out of the bitcoin alphabet", func() {
+			for _, c := range []string{"0", "O", "I", "l", "+"} {
+				_, err := did.ParseMultibase("z6Mk" + c)
+				Expect(err).To(MatchError(ContainSubstring("invalid base58 character")), c)
+			}
+		})
+
+		It("decodes every leading 1 as a zero byte", func() {
+			// 0x00 is not the multicodec of a key, the zero byte must not be dropped
+			_, err := did.ParseMultibase("z1" + specDid[len("did:key:z"):])
+			Expect(err).To(MatchError("unsupported multicodec 0x0"))
+		})
+
+		It("encodes the leading zero bytes of the key", func() {
+			generated, err := did.KeyMethod{}.Generate(did.Params{PublicKey: ed25519.PublicKey(make([]byte, ed25519.PublicKeySize))})
+			Expect(err).NotTo(HaveOccurred())
+			publicKey, err := did.ParseMultibase(generated[len("did:key:"):])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(publicKey).To(Equal(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize))))
+		})
+	})
+
+	Describe("did:web", func() {
+		It("generates the DID of the participant under the domain of the organization", func() {
+			generated, err := did.WebMethod{}.Generate(did.Params{Domain: "localhost:8443", Name: "alice"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generated).To(Equal("did:web:localhost%3A8443:participants:alice"))
+			Expect(did.Validate(generated, did.Params{Domain: "localhost:8443"})).To(Succeed())
+		})
+
+		It("rejects a DID of another domain", func() {
+			err := did.Validate("did:web:example.com:participants:alice", did.Params{Domain: "org1.example.com"})
+			Expect(err).To(MatchError(ContainSubstring("does not belong to the domain org1.example.com")))
+		})
+
+		It("requires the domain", func() {
+			_, err := did.WebMethod{}.Generate(did.Params{Name: "alice"})
+			Expect(err).To(MatchError(ContainSubstring("requires the domain")))
+		})
+
+		It("rejects a DID without domain", func() {
+			for _, value := range []string{"did:web::participants:alice", "did:web:%3A8443:participants:alice"} {
+				Expect(did.Validate(value, did.Params{})).To(MatchError(ContainSubstring("expected did:web:<domain>[:<path>]")), value)
+			}
+		})
+	})
+
+	Describe("did:fabric", func() {
+		It("generates the DID from the hash of the public key without name", func() {
+			generated, err := did.FabricMethod{}.Generate(did.Params{Channel: "mychannel", PublicKey: ed25519.PublicKey(specKey)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generated).To(MatchRegexp(`^did:fabric:mychannel:[0-9a-f]{32}$`))
+			Expect(did.Validate(generated, did.Params{Channel: "mychannel"})).To(Succeed())
+		})
+
+		It("rejects a DID of another channel", func() {
+			err := did.Validate("did:fabric:other:alice", did.Params{Channel: "mychannel"})
+			Expect(err).To(MatchError(ContainSubstring("does not belong to the channel mychannel")))
+		})
+
+		It("rejects a DID without local identifier", func() {
+			err := did.Validate("did:fabric:mychannel", did.Params{})
+			Expect(err).To(MatchError(ContainSubstring("expected did:fabric:<channel>:<id>")))
+		})
+
+		It("rejects an invalid name", func() {
+			_, err := did.FabricMethod{}.Generate(did.Params{Channel: "mychannel", Name: "alice:admin"})
+			Expect(err).To(MatchError("invalid name alice:admin"))
+		})
+	})
+})
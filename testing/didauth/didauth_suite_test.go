@@ -0,0 +1,13 @@
+package didauth_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestDidauth(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Didauth Suite")
+}
@@ -0,0 +1,122 @@
+package didauth_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"time"
+
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/didauth"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/keys"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// submitter records the transactions of the client and answers them
+type submitter struct {
+	submitted []string
+	evaluated []string
+	answers   map[string]interface{}
+}
+
+func (s *submitter) SubmitTransaction(name string, args ...string) ([]byte, error) {
+	s.submitted = append(s.submitted, name)
+	return json.Marshal(s.answers[name])
+}
+
+func (s *submitter) EvaluateTransaction(name string, args ...string) ([]byte, error) {
+	s.evaluated = append(s.evaluated, name)
+	return json.Marshal(s.answers[name])
+}
+
+// assertion signs the claims with the key
+func assertion(claims didauth.AssertionClaims, key crypto.Signer) string {
+	payload, err := json.Marshal(claims)
+	Expect(err).NotTo(HaveOccurred())
+	jws, err := didauth.Sign(payload, key)
+	Expect(err).NotTo(HaveOccurred())
+	return jws
+}
+
+var _ = Describe("didauth", func() {
+	var (
+		chaincodeKey crypto.Signer
+		claims       didauth.AssertionClaims
+	)
+
+	BeforeEach(func() {
+		_, chaincodeKey, _ = ed25519.GenerateKey(rand.Reader)
+		claims = didauth.AssertionClaims{
+			Issuer:      "mychannel",
+			Subject:     "did:example:1",
+			Audience:    "https://app.example.com",
+			ChallengeID: "tx1",
+			IssuedAt:    time.Now().Unix(),
+			ExpiresAt:   time.Now().Add(time.Minute).Unix(),
+		}
+	})
+
+	Describe("SignResponse", func() {
+		It("signs the challenge with the participant key", func() {
+			key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			challenge := &didauth.Challenge{ID: "tx1", Did: "did:example:1", Audience: "https://app.example.com", Challenge: "abc"}
+			jws, err := didauth.SignResponse(challenge, key)
+			Expect(err).NotTo(HaveOccurred())
+
+			payload, err := keys.VerifyJWS(jws, key.Public())
+			Expect(err).NotTo(HaveOccurred())
+			var response didauth.ResponsePayload
+			Expect(json.Unmarshal(payload, &response)).To(Succeed())
+			Expect(response).To(Equal(didauth.ResponsePayload{ChallengeID: "tx1", Challenge: "abc", Did: "did:example:1", Audience: "https://app.example.com"}))
+		})
+	})
+
+	Describe("Client", func() {
+		It("submits the challenge and the response, then evaluates the assertion", func() {
+			key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			contract := &submitter{answers: map[string]interface{}{
+				didauth.TxCreateAuthChallenge: didauth.Challenge{ID: "tx1", Did: "did:example:1", Audience: "aud", Challenge: "abc"},
+				didauth.TxVerifyAuthResponse:  didauth.Challenge{ID: "tx1", Did: "did:example:1", Audience: "aud", Challenge: "abc"},
+				didauth.TxGetAuthAssertion:    didauth.Assertion{Did: "did:example:1", Audience: "aud", Jws: "jws"},
+			}}
+			result, err := didauth.NewClient(contract).Login("did:example:1", "aud", key)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Jws).To(Equal("jws"))
+			Expect(contract.submitted).To(Equal([]string{didauth.TxCreateAuthChallenge, didauth.TxVerifyAuthResponse}))
+			Expect(contract.evaluated).To(Equal([]string{didauth.TxGetAuthAssertion}))
+		})
+	})
+
+	Describe("VerifyAssertion", func() {
+		It("returns the claims of a valid assertion", func() {
+			verified, err := didauth.VerifyAssertion(assertion(claims, chaincodeKey), chaincodeKey.Public(), "mychannel", "https://app.example.com")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*verified).To(Equal(claims))
+		})
+
+		It("rejects an assertion expired", func() {
+			claims.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+			_, err := didauth.VerifyAssertion(assertion(claims, chaincodeKey), chaincodeKey.Public(), "mychannel", "https://app.example.com")
+			Expect(err).To(MatchError("assertion for did:example:1 expired"))
+		})
+
+		It("rejects an assertion of another channel", func() {
+			_, err := didauth.VerifyAssertion(assertion(claims, chaincodeKey), chaincodeKey.Public(), "otherchannel", "https://app.example.com")
+			Expect(err).To(MatchError("assertion issued by mychannel, expected otherchannel"))
+		})
+
+		It("rejects an assertion for another audience", func() {
+			_, err := didauth.VerifyAssertion(assertion(claims, chaincodeKey), chaincodeKey.Public(), "mychannel", "https://other.example.com")
+			Expect(err).To(MatchError("assertion for the audience https://app.example.com, expected https://other.example.com"))
+		})
+
+		It("rejects an assertion signed by another key", func() {
+			_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+			_, err := didauth.VerifyAssertion(assertion(claims, otherKey), chaincodeKey.Public(), "mychannel", "https://app.example.com")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -221,7 +221,7 @@ var _ = ginkgo.Describe("Identity Smart Contract", func() {
 		// begin: publicKey
 		parsedKey, ok := cert.PublicKey.(*ecdsa.PublicKey)
 		if !ok {
-			fmt.Errorf("wanted an ECDSA public key but found: %#v", parsedKey)
+			panic(fmt.Sprintf("wanted an ECDSA public key but found: %#v", cert.PublicKey))
 		}
 		parsedPKBytes, err := x509.MarshalPKIXPublicKey(parsedKey)
 		if err != nil {
@@ -230,9 +230,11 @@ var _ = ginkgo.Describe("Identity Smart Contract", func() {
 		PublicKey := base64.StdEncoding.EncodeToString(parsedPKBytes)
 		// end
 		gomega.Expect(err).To(gomega.BeNil())
-		issuerRequest := model.IssuerCreateRequest{
-			Name:    "Autoridad de Certificación Tecnomática",
-			CertPem: b64RootCertTecnomatica,
+		issuerRequest := identity.IssuerCreateRequest{
+			IssuerCreateRequest: model.IssuerCreateRequest{
+				Name:    "Autoridad de Certificación Tecnomática",
+				CertPem: b64RootCertTecnomatica,
+			},
 		}
 
 		// using client with admin cert
@@ -291,7 +293,7 @@ var _ = ginkgo.Describe("Identity Smart Contract", func() {
 
 	ginkgo.It("get identity", func() {
 		expected := model.ParticipantResponse{
-			Did:     testing.Did1,
+			DID:     testing.Did1,
 			Roles:   []string{},
 			Creator: nil,
 		}
@@ -368,11 +370,11 @@ var _ = ginkgo.Describe("Identity Smart Contract", func() {
 		chaincodeStub.GetTxTimestampReturns(testing.Timestamp, nil)
 		chaincodeStub.GetStateByPartialCompositeKeyReturns(iterator, nil)
 
-		actual, err := sc.CreateParticipant(ctx, identRequest)
+		actual, err := sc.CreateParticipant(ctx, identity.StapledParticipantCreateRequest{ParticipantCreateRequest: identRequest})
 		gomega.Expect(err).To(gomega.BeNil())
 		actualJSON, err := json.Marshal(actual)
 		expected := model.ParticipantResponse{
-			Did:     testing.Did1,
+			DID:     testing.Did1,
 			Roles:   []string{},
 			Creator: nil,
 		}
@@ -428,8 +430,8 @@ var _ = ginkgo.Describe("Identity Smart Contract", func() {
 		iterator.NextReturnsOnCall(2, &queryresult.KeyModification{TxId: "TxId2", Timestamp: testing.Timestamp, IsDelete: false, Value: history3JSON}, nil)
 
 		chaincodeStub.GetHistoryForKeyReturns(iterator, nil)
-		issuerRequest := model.GetRequest{
-			ID: testing.ID1,
+		issuerRequest := identity.IssuerHistoryRequest{
+			GetRequest: model.GetRequest{ID: testing.ID1},
 		}
 		histories, _ := sc.GetIssuerHistory(ctx, issuerRequest)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
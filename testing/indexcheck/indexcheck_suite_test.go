@@ -0,0 +1,13 @@
+package indexcheck_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestIndexcheck(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Indexcheck Suite")
+}
@@ -0,0 +1,92 @@
+package indexcheck_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// indexes definitions shipped with the chaincode
+const indexes = "../../META-INF/statedb/couchdb/indexes"
+
+// bin indexcheck command built for the suite
+var bin string
+
+var _ = BeforeSuite(func() {
+	tmp, err := ioutil.TempDir("", "indexcheck")
+	Expect(err).NotTo(HaveOccurred())
+	bin = filepath.Join(tmp, "indexcheck")
+	output, err := exec.Command("go", "build", "-o", bin, "github.com/kmilodenisglez/cc-identity-go/tools/indexcheck").CombinedOutput()
+	Expect(err).NotTo(HaveOccurred(), string(output))
+})
+
+var _ = AfterSuite(func() {
+	_ = os.RemoveAll(filepath.Dir(bin))
+})
+
+var _ = Describe("indexcheck", func() {
+	var dir string // copy of the shipped definitions
+
+	// run runs indexcheck on the copy, returns its output and exit code
+	run := func() (string, int) {
+		output, err := exec.Command(bin, "-dir", dir).CombinedOutput()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return string(output), exitErr.ExitCode()
+		}
+		Expect(err).NotTo(HaveOccurred())
+		return string(output), 0
+	}
+	remove := func(name string) {
+		Expect(os.Remove(filepath.Join(dir, name+".json"))).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "indexes")
+		Expect(err).NotTo(HaveOccurred())
+		files, err := filepath.Glob(filepath.Join(indexes, "*.json"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).NotTo(BeEmpty())
+		for _, file := range files {
+			content, err := ioutil.ReadFile(file)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(dir, filepath.Base(file)), content, 0644)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	It("passes with the shipped definitions", func() {
+		output, code := run()
+		Expect(code).To(Equal(0), output)
+		Expect(output).To(Equal("indexes OK\n"))
+	})
+
+	It("fails when an index of a collection has no definition", func() {
+		remove("indexIssuerName")
+		output, code := run()
+		Expect(code).To(Equal(1))
+		Expect(output).To(ContainSubstring("index indexIssuerName of did.issuer has no definition"))
+	})
+
+	It("fails when the index of a query of a transaction has no definition", func() {
+		remove("indexParticipantMsp")
+		output, code := run()
+		Expect(code).To(Equal(1))
+		Expect(output).To(ContainSubstring("query did.participant {mspID $eq}: index indexParticipantMsp has no definition"))
+	})
+
+	It("fails when a definition is not declared by any collection", func() {
+		Expect(ioutil.WriteFile(filepath.Join(dir, "indexParticipantName.json"),
+			[]byte(`{"index":{"fields":["docType","name"]},"ddoc":"indexParticipantNameDoc","name":"indexParticipantName","type":"json"}`), 0644)).To(Succeed())
+		output, code := run()
+		Expect(code).To(Equal(1))
+		Expect(output).To(ContainSubstring("index indexParticipantName [docType name] is not declared by any collection"))
+	})
+})
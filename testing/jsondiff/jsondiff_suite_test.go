@@ -0,0 +1,13 @@
+package jsondiff_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestJsondiff(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Jsondiff Suite")
+}
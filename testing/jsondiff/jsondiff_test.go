@@ -0,0 +1,76 @@
+package jsondiff_test
+
+import (
+	"encoding/json"
+
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/jsondiff"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	"github.com/onsi/gomega"
+)
+
+var before = []byte(`{"did":"did:a","active":true,"roles":["r1","r2"],"attrs":{"name":"Ana","a/b":"x"},"count":1}`)
+
+var _ = ginkgo.Describe("JSON diff", func() {
+	ginkgo.It("returns the field-level operations in member order", func() {
+		after := []byte(`{"did":"did:a","active":false,"roles":["r1","r3"],"attrs":{"name":"Ana","company":"ACME"},"count":1}`)
+		patch, err := jsondiff.Diff(before, after)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		patchJE, err := json.Marshal(patch)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(string(patchJE)).To(gomega.MatchJSON(`[
+			{"op":"replace","path":"/active","value":false},
+			{"op":"remove","path":"/attrs/a~1b"},
+			{"op":"add","path":"/attrs/company","value":"ACME"},
+			{"op":"replace","path":"/roles/1","value":"r3"}
+		]`))
+	})
+
+	ginkgo.It("replaces an array whose length changes", func() {
+		patch, err := jsondiff.Diff([]byte(`{"roles":["r1"]}`), []byte(`{"roles":["r1","r2"]}`))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(patch).To(gomega.HaveLen(1))
+		gomega.Expect(patch[0].Op).To(gomega.Equal(jsondiff.OpReplace))
+		gomega.Expect(patch[0].Path).To(gomega.Equal("/roles"))
+	})
+
+	ginkgo.It("adds and removes whole documents at the root", func() {
+		patch, err := jsondiff.Diff(nil, before)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(patch).To(gomega.HaveLen(1))
+		gomega.Expect(patch[0].Op).To(gomega.Equal(jsondiff.OpAdd))
+		gomega.Expect(patch[0].Path).To(gomega.Equal(""))
+
+		patch, err = jsondiff.Diff(before, nil)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(patch).To(gomega.Equal([]jsondiff.Operation{{Op: jsondiff.OpRemove, Path: ""}}))
+	})
+
+	ginkgo.It("writes the null value of a replace", func() {
+		patch, err := jsondiff.Diff([]byte(`{"a":1}`), []byte(`{"a":null}`))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		patchJE, err := json.Marshal(patch)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(string(patchJE)).To(gomega.Equal(`[{"op":"replace","path":"/a","value":null}]`))
+	})
+
+	table.DescribeTable("applies the diff to the first document",
+		func(after string) {
+			patch, err := jsondiff.Diff(before, []byte(after))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			patched, err := jsondiff.Apply(before, patch)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(string(patched)).To(gomega.MatchJSON(after))
+		},
+		table.Entry("same document", string(before)),
+		table.Entry("changed members", `{"did":"did:a","active":false,"roles":["r2","r1"],"attrs":{"name":"Eva"},"count":2}`),
+		table.Entry("different types", `{"did":["did:a"],"active":"yes","roles":{},"attrs":null,"count":1.5}`),
+		table.Entry("other document", `{"id":"x"}`),
+	)
+
+	ginkgo.It("rejects a patch of a member that does not exist", func() {
+		_, err := jsondiff.Apply(before, []jsondiff.Operation{{Op: jsondiff.OpReplace, Path: "/missing/name", Value: "x"}})
+		gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("does not exist")))
+	})
+})
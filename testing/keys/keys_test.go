@@ -0,0 +1,184 @@
+package keys_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/keys"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	"github.com/onsi/gomega"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// selfSignedCert b64 PEM of a self signed certificate of the key, signed with the
+// given x509 signature algorithm
+func selfSignedCert(signer crypto.Signer, sigAlg x509.SignatureAlgorithm) string {
+	template := &x509.Certificate{
+		SerialNumber:       big.NewInt(1),
+		Subject:            pkix.Name{CommonName: "user1"},
+		NotBefore:          time.Now().Add(-time.Hour),
+		NotAfter:           time.Now().Add(time.Hour),
+		SignatureAlgorithm: sigAlg,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, signer.Public(), signer)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	return base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func ecdsaKey(curve elliptic.Curve) crypto.Signer {
+	key, _ := ecdsa.GenerateKey(curve, rand.Reader)
+	return key
+}
+
+func rsaKey(bits int) crypto.Signer {
+	key, _ := rsa.GenerateKey(rand.Reader, bits)
+	return key
+}
+
+func ed25519Key() crypto.Signer {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	return key
+}
+
+var _ = ginkgo.Describe("Public keys", func() {
+	table.DescribeTable("supported certificate keys",
+		func(signer crypto.Signer, sigAlg x509.SignatureAlgorithm, signAlg jose.SignatureAlgorithm, kty string) {
+			cert, err := lus.GetX509CertFromPem(selfSignedCert(signer, sigAlg))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			// SPKI round trip
+			spki, err := lus.GetPublicKey(cert)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			publicKey, err := keys.ParseSPKIBase64(spki)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			again, err := keys.SPKIBase64(publicKey)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(again).To(gomega.Equal(spki))
+
+			// JWK
+			jwk, err := keys.JWK(publicKey)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(jwk.Use).To(gomega.Equal("sig"))
+			gomega.Expect(jwk.Valid()).To(gomega.BeTrue())
+			raw, err := jwk.MarshalJSON()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(string(raw)).To(gomega.ContainSubstring(`"kty":"` + kty + `"`))
+
+			// a JWS of a permitted algorithm is verified
+			gomega.Expect(keys.Allows(publicKey, string(signAlg))).To(gomega.Succeed())
+			joseSigner, err := jose.NewSigner(jose.SigningKey{Algorithm: signAlg, Key: signer}, nil)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			object, err := joseSigner.Sign([]byte("payload"))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			jws, err := object.CompactSerialize()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			payload, err := lus.VerifySignature(jws, spki)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(string(payload)).To(gomega.Equal("payload"))
+		},
+		table.Entry("ECDSA P-256", ecdsaKey(elliptic.P256()), x509.ECDSAWithSHA256, jose.ES256, "EC"),
+		table.Entry("ECDSA P-384", ecdsaKey(elliptic.P384()), x509.ECDSAWithSHA384, jose.ES384, "EC"),
+		table.Entry("ECDSA P-521", ecdsaKey(elliptic.P521()), x509.ECDSAWithSHA512, jose.ES512, "EC"),
+		table.Entry("RSA PKCS #1 v1.5", rsaKey(2048), x509.SHA256WithRSA, jose.RS256, "RSA"),
+		table.Entry("RSA PSS", rsaKey(2048), x509.SHA256WithRSAPSS, jose.PS256, "RSA"),
+		table.Entry("Ed25519", ed25519Key(), x509.PureEd25519, jose.EdDSA, "OKP"),
+	)
+
+	table.DescribeTable("algorithms permitted per key",
+		func(signer crypto.Signer, allowed []jose.SignatureAlgorithm, denied jose.SignatureAlgorithm) {
+			algorithms, err := keys.Algorithms(signer.Public())
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(algorithms).To(gomega.Equal(allowed))
+			gomega.Expect(keys.Allows(signer.Public(), string(denied))).NotTo(gomega.Succeed())
+		},
+		table.Entry("P-256 only ES256", ecdsaKey(elliptic.P256()), []jose.SignatureAlgorithm{jose.ES256}, jose.ES384),
+		table.Entry("P-384 only ES384", ecdsaKey(elliptic.P384()), []jose.SignatureAlgorithm{jose.ES384}, jose.ES256),
+		table.Entry("RSA not ECDSA", rsaKey(2048), []jose.SignatureAlgorithm{jose.RS256, jose.RS384, jose.RS512, jose.PS256, jose.PS384, jose.PS512}, jose.ES256),
+		table.Entry("Ed25519 not HMAC", ed25519Key(), []jose.SignatureAlgorithm{jose.EdDSA}, jose.HS256),
+	)
+
+	ginkgo.It("accepts an Ed25519 key by pointer", func() {
+		publicKey := ed25519Key().Public().(ed25519.PublicKey)
+		normalized, err := keys.Normalize(&publicKey)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(normalized).To(gomega.Equal(publicKey))
+	})
+
+	ginkgo.It("parses the SPKI of an RSA key with the id-RSASSA-PSS algorithm", func() {
+		signer := rsaKey(2048)
+		pkcs1 := x509.MarshalPKCS1PublicKey(signer.Public().(*rsa.PublicKey))
+		der, err := asn1.Marshal(struct {
+			Algorithm pkix.AlgorithmIdentifier
+			PublicKey asn1.BitString
+		}{pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}}, asn1.BitString{Bytes: pkcs1, BitLength: len(pkcs1) * 8}})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		_, err = x509.ParsePKIXPublicKey(der)
+		gomega.Expect(err).To(gomega.HaveOccurred())
+
+		publicKey, err := keys.ParseSPKIBase64(base64.StdEncoding.EncodeToString(der))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(publicKey).To(gomega.Equal(signer.Public()))
+
+		// the same key of an rsaEncryption SPKI has the same fingerprint
+		rsaEncryption, err := x509.MarshalPKIXPublicKey(signer.Public())
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		fingerprint, err := lus.PublicKeyFingerprint(base64.StdEncoding.EncodeToString(der))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(lus.PublicKeyFingerprint(base64.StdEncoding.EncodeToString(rsaEncryption))).To(gomega.Equal(fingerprint))
+
+		ps256, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.PS256, Key: signer}, nil)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		object, err := ps256.Sign([]byte("payload"))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		jws, err := object.CompactSerialize()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(keys.VerifyJWS(jws, publicKey)).To(gomega.Equal([]byte("payload")))
+	})
+
+	ginkgo.It("rejects RSA keys under 2048 bits", func() {
+		cert, err := lus.GetX509CertFromPem(selfSignedCert(rsaKey(1024), x509.SHA256WithRSA))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		_, err = lus.GetPublicKey(cert)
+		gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("weak RSA public key")))
+	})
+
+	ginkgo.It("rejects unsupported curves", func() {
+		_, err := keys.Normalize(&ecdsaKey(elliptic.P224()).(*ecdsa.PrivateKey).PublicKey)
+		gomega.Expect(err).To(gomega.MatchError(keys.ErrUnsupportedKey))
+	})
+
+	ginkgo.It("rejects a JWS signed with an algorithm of another key type", func() {
+		signer := ecdsaKey(elliptic.P256())
+		hmac, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: []byte("0123456789abcdef0123456789abcdef")}, nil)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		object, err := hmac.Sign([]byte("payload"))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		jws, err := object.CompactSerialize()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		_, err = keys.VerifyJWS(jws, signer.Public())
+		gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("is not allowed")))
+	})
+
+	ginkgo.It("uses the RFC 7638 thumbprint as kid", func() {
+		// example key of RFC 7638, section 3.1
+		jwk, err := keys.LoadJSONWebKey([]byte(`{"kty":"RSA","e":"AQAB","alg":"RS256","kid":"2011-04-29",`+
+			`"n":"0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw"}`), true)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		kid, err := keys.Thumbprint(jwk)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(kid).To(gomega.Equal("NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"))
+	})
+})
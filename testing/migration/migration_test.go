@@ -0,0 +1,118 @@
+package migration_test
+
+import (
+	"fmt"
+
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/migration"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+const docType = "did.participant"
+
+var _ = ginkgo.Describe("Schema migration", func() {
+	var registry *migration.Registry
+
+	ginkgo.BeforeEach(func() {
+		registry = migration.NewRegistry()
+		// version 2 renames did to id, version 3 adds the status
+		registry.Register(docType,
+			func(doc map[string]interface{}) error {
+				doc["id"] = doc["did"]
+				delete(doc, "did")
+				return nil
+			},
+			func(doc map[string]interface{}) error {
+				if doc["id"] == nil {
+					return fmt.Errorf("id is required")
+				}
+				doc["status"] = "active"
+				return nil
+			},
+		)
+	})
+
+	ginkgo.It("counts the versions from the registered migrations", func() {
+		gomega.Expect(registry.Version(docType)).To(gomega.Equal(3))
+		gomega.Expect(registry.Version("did.role")).To(gomega.Equal(1))
+	})
+
+	ginkgo.It("migrates the documents written before the versioning from version 1", func() {
+		migrated, changed, err := registry.Migrate(docType, []byte(`{"did":"did:a","count":12345678901234567890}`))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(changed).To(gomega.BeTrue())
+		gomega.Expect(string(migrated)).To(gomega.MatchJSON(`{"schemaVersion":3,"id":"did:a","status":"active","count":12345678901234567890}`))
+		gomega.Expect(string(migrated)).To(gomega.HavePrefix(`{"schemaVersion":3,`))
+	})
+
+	ginkgo.It("migrates from the stored version", func() {
+		migrated, changed, err := registry.Migrate(docType, []byte(`{"schemaVersion":2,"id":"did:a"}`))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(changed).To(gomega.BeTrue())
+		gomega.Expect(string(migrated)).To(gomega.MatchJSON(`{"schemaVersion":3,"id":"did:a","status":"active"}`))
+	})
+
+	ginkgo.It("keeps the current documents", func() {
+		current := []byte(`{"schemaVersion":3,"id":"did:a","status":"active"}`)
+		migrated, changed, err := registry.Migrate(docType, current)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(changed).To(gomega.BeFalse())
+		gomega.Expect(migrated).To(gomega.Equal(current))
+
+		outdated, err := registry.Outdated(docType, current)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(outdated).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("only stamps the documents of a doc type without migrations", func() {
+		outdated, err := registry.Outdated("did.role", []byte(`{"id":"r1"}`))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(outdated).To(gomega.BeTrue())
+
+		migrated, changed, err := registry.Migrate("did.role", []byte(`{"id":"r1"}`))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(changed).To(gomega.BeTrue())
+		gomega.Expect(string(migrated)).To(gomega.Equal(`{"schemaVersion":1,"id":"r1"}`))
+
+		migrated, _, err = registry.Migrate("did.role", []byte(`{}`))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(string(migrated)).To(gomega.Equal(`{"schemaVersion":1}`))
+	})
+
+	ginkgo.It("stamps the documents written by the current code without migrating them", func() {
+		stamped, err := registry.Stamp(docType, []byte(`{"id":"did:a","status":"active"}`))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(string(stamped)).To(gomega.Equal(`{"schemaVersion":3,"id":"did:a","status":"active"}`))
+
+		stamped, err = registry.Stamp(docType, []byte(`{"schemaVersion":2,"id":"did:a"}`))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(string(stamped)).To(gomega.MatchJSON(`{"schemaVersion":3,"id":"did:a","status":"active"}`))
+	})
+
+	ginkgo.It("migrates a copy from the version it was written with", func() {
+		copyJE, err := migration.WithVersion([]byte(`{"did":"did:a"}`), 0)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(string(copyJE)).To(gomega.Equal(`{"schemaVersion":1,"did":"did:a"}`))
+
+		migrated, _, err := registry.Migrate(docType, copyJE)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(string(migrated)).To(gomega.MatchJSON(`{"schemaVersion":3,"id":"did:a","status":"active"}`))
+
+		_, err = migration.WithVersion([]byte(`{"schemaVersion":1}`), 2)
+		gomega.Expect(err).To(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("rejects the documents of a newer or invalid version", func() {
+		_, _, err := registry.Migrate(docType, []byte(`{"schemaVersion":4,"id":"did:a"}`))
+		gomega.Expect(err).To(gomega.HaveOccurred())
+		_, err = registry.Outdated(docType, []byte(`{"schemaVersion":0}`))
+		gomega.Expect(err).To(gomega.HaveOccurred())
+		_, _, err = registry.Migrate(docType, []byte(`null`))
+		gomega.Expect(err).To(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("returns the error of a migration with its version", func() {
+		_, _, err := registry.Migrate(docType, []byte(`{"schemaVersion":2}`))
+		gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("from schema version 2: id is required")))
+	})
+})
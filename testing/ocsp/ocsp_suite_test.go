@@ -0,0 +1,13 @@
+package ocsp_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestOcsp(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "OCSP Suite")
+}
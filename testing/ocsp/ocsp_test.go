@@ -0,0 +1,137 @@
+package ocsp_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"time"
+
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"golang.org/x/crypto/ocsp"
+)
+
+// txTime transaction time of the tests
+var txTime = time.Date(2022, 10, 20, 12, 0, 0, 0, time.UTC)
+
+// newCert certificate of a new key signed by the parent, self signed if parent is nil
+func newCert(serial int64, template *x509.Certificate, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	template.SerialNumber = big.NewInt(serial)
+	template.NotBefore = txTime.Add(-24 * time.Hour)
+	template.NotAfter = txTime.Add(24 * time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	return cert, key
+}
+
+// staple b64 DER OCSP response of the certificate signed by the responder
+func staple(responder *x509.Certificate, responderKey crypto.Signer, template ocsp.Response) string {
+	der, err := ocsp.CreateResponse(responder, responder, template, responderKey)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+var _ = ginkgo.Describe("Stapled OCSP responses", func() {
+	var (
+		issuer    *x509.Certificate
+		issuerKey crypto.Signer
+		cert      *x509.Certificate
+	)
+
+	ginkgo.BeforeEach(func() {
+		issuer, issuerKey = newCert(1, &x509.Certificate{
+			Subject:               pkix.Name{CommonName: "issuer"},
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		}, nil, nil)
+		cert, _ = newCert(2, &x509.Certificate{Subject: pkix.Name{CommonName: "user1"}}, issuer, issuerKey)
+	})
+
+	good := func() ocsp.Response {
+		return ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: cert.SerialNumber,
+			ThisUpdate:   txTime.Add(-time.Hour),
+			NextUpdate:   txTime.Add(time.Hour),
+		}
+	}
+
+	ginkgo.It("accepts a good response signed by the issuer", func() {
+		response, err := lus.VerifyOCSPResponse(staple(issuer, issuerKey, good()), cert, issuer, txTime)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(lus.OCSPStatus(response.Status)).To(gomega.Equal("good"))
+	})
+
+	ginkgo.It("accepts a good response of a delegated responder", func() {
+		responder, responderKey := newCert(3, &x509.Certificate{
+			Subject:     pkix.Name{CommonName: "ocsp"},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+		}, issuer, issuerKey)
+		template := good()
+		template.Certificate = responder
+		der, err := ocsp.CreateResponse(issuer, responder, template, responderKey)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		_, err = lus.VerifyOCSPResponse(base64.StdEncoding.EncodeToString(der), cert, issuer, txTime)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("rejects a responder without the OCSP signing usage", func() {
+		responder, responderKey := newCert(3, &x509.Certificate{Subject: pkix.Name{CommonName: "ocsp"}}, issuer, issuerKey)
+		template := good()
+		template.Certificate = responder
+		der, err := ocsp.CreateResponse(issuer, responder, template, responderKey)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		_, err = lus.VerifyOCSPResponse(base64.StdEncoding.EncodeToString(der), cert, issuer, txTime)
+		gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("not authorized")))
+	})
+
+	ginkgo.It("rejects a response signed by another issuer", func() {
+		other, otherKey := newCert(4, &x509.Certificate{
+			Subject:               pkix.Name{CommonName: "other"},
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+		}, nil, nil)
+		_, err := lus.VerifyOCSPResponse(staple(other, otherKey, good()), cert, issuer, txTime)
+		gomega.Expect(err).To(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("rejects revoked and unknown statuses", func() {
+		revoked := good()
+		revoked.Status = ocsp.Revoked
+		revoked.RevokedAt = txTime.Add(-2 * time.Hour)
+		_, err := lus.VerifyOCSPResponse(staple(issuer, issuerKey, revoked), cert, issuer, txTime)
+		gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("revoked")))
+
+		unknown := good()
+		unknown.Status = ocsp.Unknown
+		_, err = lus.VerifyOCSPResponse(staple(issuer, issuerKey, unknown), cert, issuer, txTime)
+		gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("unknown")))
+	})
+
+	ginkgo.It("checks thisUpdate and nextUpdate against the transaction time", func() {
+		response := staple(issuer, issuerKey, good())
+		_, err := lus.VerifyOCSPResponse(response, cert, issuer, txTime.Add(2*time.Hour))
+		gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("expired")))
+		_, err = lus.VerifyOCSPResponse(response, cert, issuer, txTime.Add(-2*time.Hour))
+		gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("not valid before")))
+
+		withoutNext := good()
+		withoutNext.NextUpdate = time.Time{}
+		_, err = lus.VerifyOCSPResponse(staple(issuer, issuerKey, withoutNext), cert, issuer, txTime.Add(lus.OCSPMaxAge))
+		gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("older than")))
+	})
+})
@@ -0,0 +1,158 @@
+package query_test
+
+import (
+	"encoding/json"
+
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/query"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	"github.com/onsi/gomega"
+)
+
+var participants = &query.Collection{
+	DocType: "did.participant",
+	Fields: map[string]query.Field{
+		"did":         {Kind: query.String, Ops: []string{query.OpEq, query.OpIn}},
+		"mspID":       {Kind: query.String, Ops: []string{query.OpEq}},
+		"active":      {Kind: query.Bool, Ops: []string{query.OpEq}},
+		"roles":       {Kind: query.StringArray, Ops: []string{query.OpElemMatch}},
+		"expiresTime": {Kind: query.String, Ops: []string{query.OpLt, query.OpGte}, Sortable: true},
+		"creator":     {Kind: query.String},
+	},
+	Indexes: []query.Index{
+		{DesignDoc: "indexParticipantMspDoc", Name: "indexParticipantMsp", Fields: []string{"docType", "mspID"}},
+		{DesignDoc: "indexParticipantMspActiveDoc", Name: "indexParticipantMspActive", Fields: []string{"docType", "mspID", "active"}},
+		{DesignDoc: "indexParticipantExpiresDoc", Name: "indexParticipantExpires", Fields: []string{"docType", "expiresTime"}},
+	},
+}
+
+// mango compiles the query and decodes the Mango query
+func mango(q query.Query) (map[string]interface{}, error) {
+	compiled, err := participants.Compile(q)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	gomega.Expect(json.Unmarshal([]byte(compiled.QueryString), &m)).To(gomega.Succeed())
+	return m, nil
+}
+
+var _ = ginkgo.Describe("Typed queries", func() {
+	ginkgo.It("compiles to Mango with the most selective covering index", func() {
+		m, err := mango(query.Query{
+			DocType: "did.participant",
+			Where: []query.Predicate{
+				{Field: "mspID", Op: query.OpEq, Value: "Org1MSP"},
+				{Field: "active", Op: query.OpEq, Value: "true"},
+				{Field: "roles", Op: query.OpElemMatch, Value: "admin"},
+			},
+			Fields:   []string{"did", "mspID"},
+			PageSize: 10,
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(m["selector"]).To(gomega.Equal(map[string]interface{}{
+			"docType": map[string]interface{}{"$eq": "did.participant"},
+			"mspID":   map[string]interface{}{"$eq": "Org1MSP"},
+			"active":  map[string]interface{}{"$eq": true},
+			"roles":   map[string]interface{}{"$elemMatch": map[string]interface{}{"$eq": "admin"}},
+		}))
+		gomega.Expect(m["use_index"]).To(gomega.Equal([]interface{}{"_design/indexParticipantMspActiveDoc", "indexParticipantMspActive"}))
+		gomega.Expect(m["fields"]).To(gomega.Equal([]interface{}{"did", "mspID"}))
+	})
+
+	ginkgo.It("returns only the fields of the collection by default", func() {
+		m, err := mango(query.Query{
+			DocType:  "did.participant",
+			Where:    []query.Predicate{{Field: "mspID", Op: query.OpEq, Value: "Org1MSP"}},
+			PageSize: 10,
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(m["fields"]).To(gomega.Equal([]interface{}{"docType", "active", "creator", "did", "expiresTime", "mspID", "roles"}))
+	})
+
+	ginkgo.It("uses the index of the sort field", func() {
+		m, err := mango(query.Query{
+			DocType:  "did.participant",
+			Sort:     []query.SortField{{Field: "expiresTime", Desc: true}},
+			PageSize: 10,
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(m["selector"]).To(gomega.HaveKeyWithValue("expiresTime", map[string]interface{}{"$exists": true}))
+		gomega.Expect(m["sort"]).To(gomega.Equal([]interface{}{
+			map[string]interface{}{"docType": "desc"},
+			map[string]interface{}{"expiresTime": "desc"},
+		}))
+		gomega.Expect(m["use_index"]).To(gomega.Equal([]interface{}{"_design/indexParticipantExpiresDoc", "indexParticipantExpires"}))
+	})
+
+	table.DescribeTable("disallowed query shapes",
+		func(q query.Query, message string) {
+			_, err := participants.Compile(q)
+			gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring(message)))
+		},
+		table.Entry("rejects another doc type", query.Query{DocType: "did.issuer", PageSize: 10}, "can not be run on"),
+		table.Entry("rejects a field that is not whitelisted", query.Query{
+			DocType:  "did.participant",
+			Where:    []query.Predicate{{Field: "attrs.dni", Op: query.OpEq, Value: "1"}},
+			PageSize: 10,
+		}, "is not allowed"),
+		table.Entry("rejects a field that can only be read", query.Query{
+			DocType:  "did.participant",
+			Where:    []query.Predicate{{Field: "creator", Op: query.OpEq, Value: "x"}},
+			PageSize: 10,
+		}, "operator $eq is not allowed"),
+		table.Entry("rejects an operator that is not whitelisted", query.Query{
+			DocType:  "did.participant",
+			Where:    []query.Predicate{{Field: "did", Op: "$regex", Value: ".*"}},
+			PageSize: 10,
+		}, "operator $regex is not allowed"),
+		table.Entry("rejects a query without a covering index", query.Query{
+			DocType:  "did.participant",
+			Where:    []query.Predicate{{Field: "did", Op: query.OpEq, Value: "did:x"}},
+			PageSize: 10,
+		}, "no index"),
+		table.Entry("rejects a sort field that is not sortable", query.Query{
+			DocType:  "did.participant",
+			Where:    []query.Predicate{{Field: "mspID", Op: query.OpEq, Value: "Org1MSP"}},
+			Sort:     []query.SortField{{Field: "did"}},
+			PageSize: 10,
+		}, "can not be sorted"),
+		table.Entry("rejects a field that can not be read", query.Query{
+			DocType:  "did.participant",
+			Where:    []query.Predicate{{Field: "mspID", Op: query.OpEq, Value: "Org1MSP"}},
+			Fields:   []string{"attrsExtras"},
+			PageSize: 10,
+		}, "can not be read"),
+		table.Entry("rejects an invalid value", query.Query{
+			DocType:  "did.participant",
+			Where:    []query.Predicate{{Field: "mspID", Op: query.OpEq, Value: "Org1MSP"}, {Field: "active", Op: query.OpEq, Value: "yes"}},
+			PageSize: 10,
+		}, "invalid value of active"),
+		table.Entry("rejects a page size out of range", query.Query{DocType: "did.participant", PageSize: query.MaxPageSize + 1}, "pageSize"),
+	)
+
+	ginkgo.It("lists one query per filterable field and sort key", func() {
+		var shapes []string
+		for _, q := range participants.Shapes() {
+			if len(q.Where) > 0 {
+				shapes = append(shapes, q.Where[0].Field+" "+q.Where[0].Op)
+			} else {
+				shapes = append(shapes, "sort "+q.Sort[0].Field)
+			}
+			gomega.Expect(q.DocType).To(gomega.Equal("did.participant"))
+		}
+		// roles is an array, creator can not be filtered
+		gomega.Expect(shapes).To(gomega.Equal([]string{"active $eq", "did $eq", "expiresTime $lt", "sort expiresTime", "mspID $eq"}))
+	})
+
+	ginkgo.It("finds the shapes that no index covers", func() {
+		var uncovered []string
+		for _, q := range participants.Shapes() {
+			if _, err := participants.Compile(q); err != nil {
+				gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("no index")))
+				uncovered = append(uncovered, q.Where[0].Field)
+			}
+		}
+		gomega.Expect(uncovered).To(gomega.Equal([]string{"active", "did"}))
+	})
+})
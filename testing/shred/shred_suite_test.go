@@ -0,0 +1,13 @@
+package shred_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestShred(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Shred Suite")
+}
@@ -0,0 +1,74 @@
+package shred_test
+
+import (
+	"bytes"
+
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/shred"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("shred", func() {
+	key := bytes.Repeat([]byte{1}, shred.KeySize)
+	otherKey := bytes.Repeat([]byte{2}, shred.KeySize)
+
+	Describe("Encrypt", func() {
+		It("returns a prefixed value that decrypts with the key", func() {
+			encrypted, err := shred.Encrypt(key, "tx1attrs.name", "alice")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(shred.IsEncrypted(encrypted)).To(BeTrue())
+			Expect(encrypted).NotTo(ContainSubstring("alice"))
+
+			plain, err := shred.Decrypt(key, encrypted)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plain).To(Equal("alice"))
+		})
+
+		It("is deterministic for the key, the seed and the value", func() {
+			first, _ := shred.Encrypt(key, "tx1attrs.name", "alice")
+			second, _ := shred.Encrypt(key, "tx1attrs.name", "alice")
+			Expect(first).To(Equal(second))
+
+			otherSeed, _ := shred.Encrypt(key, "tx2attrs.name", "alice")
+			Expect(otherSeed).NotTo(Equal(first))
+			otherKeyValue, _ := shred.Encrypt(otherKey, "tx1attrs.name", "alice")
+			Expect(otherKeyValue).NotTo(Equal(first))
+		})
+
+		It("returns the empty and the encrypted values as is", func() {
+			Expect(shred.Encrypt(key, "seed", "")).To(Equal(""))
+			encrypted, _ := shred.Encrypt(key, "seed", "alice")
+			Expect(shred.Encrypt(otherKey, "seed", encrypted)).To(Equal(encrypted))
+		})
+
+		It("rejects a key of another size", func() {
+			_, err := shred.Encrypt(key[:16], "seed", "alice")
+			Expect(err).To(MatchError("the data key must have 32 bytes"))
+		})
+	})
+
+	Describe("Decrypt", func() {
+		It("returns the plain values as is", func() {
+			Expect(shred.Decrypt(key, "alice")).To(Equal("alice"))
+		})
+
+		It("fails with another key", func() {
+			encrypted, _ := shred.Encrypt(key, "seed", "alice")
+			_, err := shred.Decrypt(otherKey, encrypted)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("fails with a truncated value", func() {
+			_, err := shred.Decrypt(key, shred.Prefix+"AAAA")
+			Expect(err).To(MatchError("invalid encrypted value"))
+		})
+	})
+
+	Describe("Redact", func() {
+		It("redacts the encrypted values only", func() {
+			encrypted, _ := shred.Encrypt(key, "seed", "alice")
+			Expect(shred.Redact(encrypted)).To(Equal(shred.Redacted))
+			Expect(shred.Redact("alice")).To(Equal("alice"))
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package statecache_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestStatecache(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Statecache Suite")
+}
@@ -0,0 +1,138 @@
+package statecache_test
+
+import (
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/statecache"
+	"github.com/kmilodenisglez/cc-identity-go/testing/mocks"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// multipleStatesStub stub of a peer that reads several keys in one request
+type multipleStatesStub struct {
+	*mocks.ChaincodeStub
+	calls [][]string
+}
+
+func (s *multipleStatesStub) GetMultipleStates(keys ...string) ([][]byte, error) {
+	s.calls = append(s.calls, keys)
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i], _ = s.ChaincodeStub.GetState(key)
+	}
+	return values, nil
+}
+
+var _ = ginkgo.Describe("State cache", func() {
+	var (
+		stub  *mocks.ChaincodeStub
+		state map[string][]byte
+		cache *statecache.Stub
+	)
+
+	ginkgo.BeforeEach(func() {
+		state = map[string][]byte{"a": []byte("1"), "b": []byte("2")}
+		stub = &mocks.ChaincodeStub{}
+		stub.GetStateStub = func(key string) ([]byte, error) {
+			return state[key], nil
+		}
+		cache = statecache.New(stub)
+	})
+
+	ginkgo.It("reads every key from the peer once", func() {
+		for i := 0; i < 3; i++ {
+			value, err := cache.GetState("a")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(value).To(gomega.Equal([]byte("1")))
+
+			value, err = cache.GetState("missing")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(value).To(gomega.BeNil())
+		}
+		gomega.Expect(stub.GetStateCallCount()).To(gomega.Equal(2))
+	})
+
+	ginkgo.It("returns the buffered writes and keeps the committed values", func() {
+		gomega.Expect(cache.PutState("a", []byte("3"))).To(gomega.Succeed())
+		gomega.Expect(cache.DelState("b")).To(gomega.Succeed())
+		gomega.Expect(cache.PutState("c", []byte("4"))).To(gomega.Succeed())
+
+		value, err := cache.GetState("a")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(value).To(gomega.Equal([]byte("3")))
+		value, err = cache.GetState("b")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(value).To(gomega.BeNil())
+
+		value, err = statecache.GetCommittedState(cache, "a")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(value).To(gomega.Equal([]byte("1")))
+		value, err = statecache.GetCommittedState(cache, "b")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(value).To(gomega.Equal([]byte("2")))
+
+		gomega.Expect(cache.Pending()).To(gomega.Equal(3))
+		gomega.Expect(stub.PutStateCallCount()).To(gomega.BeZero())
+		gomega.Expect(stub.DelStateCallCount()).To(gomega.BeZero())
+	})
+
+	ginkgo.It("deletes the key written with an empty value", func() {
+		gomega.Expect(cache.PutState("a", nil)).To(gomega.Succeed())
+		value, err := cache.GetState("a")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(value).To(gomega.BeNil())
+
+		gomega.Expect(cache.PutState("", []byte("1"))).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("flushes the writes once, in key order", func() {
+		gomega.Expect(cache.PutState("c", []byte("4"))).To(gomega.Succeed())
+		gomega.Expect(cache.PutState("a", []byte("2"))).To(gomega.Succeed())
+		gomega.Expect(cache.PutState("a", []byte("3"))).To(gomega.Succeed())
+		gomega.Expect(cache.DelState("b")).To(gomega.Succeed())
+		gomega.Expect(cache.Flush()).To(gomega.Succeed())
+
+		gomega.Expect(stub.PutStateCallCount()).To(gomega.Equal(2))
+		key, value := stub.PutStateArgsForCall(0)
+		gomega.Expect(key).To(gomega.Equal("a"))
+		gomega.Expect(value).To(gomega.Equal([]byte("3")))
+		key, value = stub.PutStateArgsForCall(1)
+		gomega.Expect(key).To(gomega.Equal("c"))
+		gomega.Expect(value).To(gomega.Equal([]byte("4")))
+		gomega.Expect(stub.DelStateCallCount()).To(gomega.Equal(1))
+		gomega.Expect(stub.DelStateArgsForCall(0)).To(gomega.Equal("b"))
+		gomega.Expect(cache.Pending()).To(gomega.BeZero())
+
+		// the flushed values are the committed values of the transaction
+		value, err := statecache.GetCommittedState(cache, "a")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(value).To(gomega.Equal([]byte("3")))
+
+		gomega.Expect(cache.Flush()).To(gomega.Succeed())
+		gomega.Expect(stub.PutStateCallCount()).To(gomega.Equal(2))
+	})
+
+	ginkgo.It("reads the keys that are not cached in one request", func() {
+		batchStub := &multipleStatesStub{ChaincodeStub: stub}
+		cache = statecache.New(batchStub)
+
+		_, err := cache.GetState("a")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(cache.PutState("c", []byte("4"))).To(gomega.Succeed())
+
+		values, err := cache.GetMultipleStates("a", "b", "c", "missing")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(values).To(gomega.Equal([][]byte{[]byte("1"), []byte("2"), []byte("4"), nil}))
+		gomega.Expect(batchStub.calls).To(gomega.Equal([][]string{{"b", "missing"}}))
+
+		_, err = cache.GetMultipleStates("a", "b", "missing")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(batchStub.calls).To(gomega.HaveLen(1))
+	})
+
+	ginkgo.It("reads the keys one by one when the peer can not batch them", func() {
+		values, err := statecache.GetMultipleStates(stub, "a", "b")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(values).To(gomega.Equal([][]byte{[]byte("1"), []byte("2")}))
+		gomega.Expect(stub.GetStateCallCount()).To(gomega.Equal(2))
+	})
+})
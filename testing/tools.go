@@ -2,7 +2,7 @@ package testing
 
 import (
 	"encoding/json"
-	"google.golang.org/protobuf/proto"
+	"github.com/golang/protobuf/proto"
 	"strings"
 )
 
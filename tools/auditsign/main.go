@@ -0,0 +1,187 @@
+// Command auditsign signs and verifies the JSON Lines exported by ExportAuditTrail.
+// The chaincode signs every page with its assertion key, the organization that exports
+// the audit trail countersigns the whole file with the key of its certificate. The
+// signature is a detached compact JWS of the file, written next to it.
+//
+// Usage:
+//
+//	go run ./tools/auditsign -key org-key.pem -in audit.jsonl
+//	go run ./tools/auditsign -verify -cert org-cert.pem -in audit.jsonl
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func main() {
+	in := flag.String("in", "", "JSON Lines file of the audit records")
+	sig := flag.String("sig", "", "detached JWS file, by default the input file with the .jws extension")
+	keyFile := flag.String("key", "", "PEM private key, to sign")
+	certFile := flag.String("cert", "", "PEM certificate of the signer, to verify")
+	verify := flag.Bool("verify", false, "verify the signature instead of signing")
+	flag.Parse()
+
+	if *in == "" {
+		fail(fmt.Errorf("-in is required"))
+	}
+	if *sig == "" {
+		*sig = *in + ".jws"
+	}
+	payload, err := ioutil.ReadFile(*in)
+	if err != nil {
+		fail(err)
+	}
+	lines, err := checkLines(payload)
+	if err != nil {
+		fail(err)
+	}
+
+	if *verify {
+		if err := verifyFile(payload, *sig, *certFile); err != nil {
+			fail(err)
+		}
+		fmt.Printf("%s: %d audit records, signature OK\n", *in, lines)
+		return
+	}
+	if err := signFile(payload, *sig, *keyFile); err != nil {
+		fail(err)
+	}
+	fmt.Printf("%s: %d audit records, signature written to %s\n", *in, lines, *sig)
+}
+
+// checkLines every line is a JSON object, returns the number of lines
+func checkLines(payload []byte) (int, error) {
+	content := strings.TrimSuffix(string(payload), "\n")
+	if content == "" {
+		return 0, fmt.Errorf("no audit records")
+	}
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return 0, fmt.Errorf("line %d: %v", i+1, err)
+		}
+	}
+	return len(lines), nil
+}
+
+func signFile(payload []byte, sigFile, keyFile string) error {
+	if keyFile == "" {
+		return fmt.Errorf("-key is required")
+	}
+	keyPem, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return err
+	}
+	key, err := parsePrivateKey(keyPem)
+	if err != nil {
+		return err
+	}
+	algorithm, err := signatureAlgorithm(key.Public())
+	if err != nil {
+		return err
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: algorithm, Key: key}, &jose.SignerOptions{
+		ExtraHeaders: map[jose.HeaderKey]interface{}{jose.HeaderContentType: "application/jsonl"},
+	})
+	if err != nil {
+		return err
+	}
+	object, err := signer.Sign(payload)
+	if err != nil {
+		return err
+	}
+	compact, err := object.DetachedCompactSerialize()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(sigFile, []byte(compact+"\n"), 0644)
+}
+
+func verifyFile(payload []byte, sigFile, certFile string) error {
+	if certFile == "" {
+		return fmt.Errorf("-cert is required")
+	}
+	compact, err := ioutil.ReadFile(sigFile)
+	if err != nil {
+		return err
+	}
+	certPem, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return err
+	}
+	cert, err := lus.GetX509CertFromPemByte(certPem)
+	if err != nil {
+		return err
+	}
+	object, err := jose.ParseDetached(strings.TrimSpace(string(compact)), payload)
+	if err != nil {
+		return err
+	}
+	if _, err := object.Verify(cert.PublicKey); err != nil {
+		return fmt.Errorf("invalid signature: %v", err)
+	}
+	return nil
+}
+
+// parsePrivateKey parses a PKCS #8, SEC 1 (EC) or PKCS #1 (RSA) PEM private key
+func parsePrivateKey(keyPem []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPem)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM private key")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, fmt.Errorf("unsupported private key %T", key)
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported private key %s", block.Type)
+}
+
+// signatureAlgorithm JWS algorithm of the public key
+func signatureAlgorithm(publicKey crypto.PublicKey) (jose.SignatureAlgorithm, error) {
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return jose.ES256, nil
+		case elliptic.P384():
+			return jose.ES384, nil
+		case elliptic.P521():
+			return jose.ES512, nil
+		}
+		return "", fmt.Errorf("unsupported curve %s", key.Curve.Params().Name)
+	case *rsa.PublicKey:
+		return jose.RS256, nil
+	case ed25519.PublicKey:
+		return jose.EdDSA, nil
+	}
+	return "", fmt.Errorf("unsupported public key %T", publicKey)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
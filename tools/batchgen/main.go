@@ -0,0 +1,251 @@
+// Command batchgen converts a roster of participants, CSV or JSON, and the folder of their
+// certificates into the payloads of CreateParticipantsBatch. Every entry is validated
+// offline as the chaincode does, the public key is taken from the certificate when the
+// roster does not have it.
+//
+// The CSV roster has a header with the columns did, publicKey, cert, issuerID and roles,
+// in any order, the roles are separated by ';'. The JSON roster is an array of objects
+// with the same fields, roles is an array. cert is the name of the PEM file in -certs.
+//
+// With -datakeys a random data key is generated for every participant, the keys of a
+// batch are written to its .transient.json file, ready for the --transient flag of peer.
+//
+// Usage:
+//
+//	go run ./tools/batchgen -roster employees.csv -certs ./certs -out ./batches [-size 100] [-partial] [-datakeys]
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	lus "github.com/kmilodenisglez/cc-identity-go/lib-utils"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/keys"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/shred"
+	model "github.com/kmilodenisglez/model-identity-go/model"
+)
+
+// entry participant of the roster
+type entry struct {
+	Did       string   `json:"did"`
+	PublicKey string   `json:"publicKey"`
+	Cert      string   `json:"cert"`
+	IssuerID  string   `json:"issuerID"`
+	Roles     []string `json:"roles"`
+}
+
+func main() {
+	roster := flag.String("roster", "", "CSV or JSON roster of the participants")
+	certs := flag.String("certs", ".", "folder of the PEM certificates referenced by the roster")
+	out := flag.String("out", ".", "folder of the batch payloads")
+	prefix := flag.String("prefix", "batch", "name prefix of the batch payloads")
+	size := flag.Int("size", identity.MaxParticipantsBatch, "participants per batch")
+	partial := flag.Bool("partial", false, "create the batches in partial mode")
+	dataKeys := flag.Bool("datakeys", false, "generate the data key of every participant")
+	flag.Parse()
+
+	if *roster == "" {
+		fail(fmt.Errorf("-roster is required"))
+	}
+	if *size < 1 || *size > identity.MaxParticipantsBatch {
+		fail(fmt.Errorf("-size must be between 1 and %d", identity.MaxParticipantsBatch))
+	}
+	entries, err := readRoster(*roster)
+	if err != nil {
+		fail(err)
+	}
+	if len(entries) == 0 {
+		fail(fmt.Errorf("%s: no participants", *roster))
+	}
+
+	requests := make([]identity.StapledParticipantCreateRequest, 0, len(entries))
+	var problems []string
+	dids := make(map[string]int)
+	publicKeys := make(map[string]int)
+	for i, e := range entries {
+		request, err := participantRequest(e, *certs)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("entry %d (%s): %v", i+1, e.Did, err))
+			continue
+		}
+		if first, ok := dids[request.DID]; ok && request.DID != "" {
+			problems = append(problems, fmt.Sprintf("entry %d: did %s is repeated, see entry %d", i+1, request.DID, first))
+			continue
+		}
+		if first, ok := publicKeys[request.PublicKey]; ok {
+			problems = append(problems, fmt.Sprintf("entry %d (%s): the public key is repeated, see entry %d", i+1, e.Did, first))
+			continue
+		}
+		dids[request.DID], publicKeys[request.PublicKey] = i+1, i+1
+		requests = append(requests, *request)
+	}
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, problem)
+		}
+		os.Exit(1)
+	}
+
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		fail(err)
+	}
+	for n, start := 1, 0; start < len(requests); n, start = n+1, start+*size {
+		end := start + *size
+		if end > len(requests) {
+			end = len(requests)
+		}
+		name := filepath.Join(*out, fmt.Sprintf("%s-%03d", *prefix, n))
+		batch := identity.ParticipantsBatchRequest{Participants: requests[start:end], Partial: *partial}
+		if err := writeJSON(name+".json", batch); err != nil {
+			fail(err)
+		}
+		if *dataKeys {
+			transient, err := batchDataKeys(end - start)
+			if err != nil {
+				fail(err)
+			}
+			if err := writeJSON(name+".transient.json", transient); err != nil {
+				fail(err)
+			}
+		}
+		fmt.Printf("%s.json: %d participants\n", name, end-start)
+	}
+}
+
+// readRoster reads a JSON roster, or a CSV roster for any other extension
+func readRoster(path string) ([]entry, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var entries []entry
+		if err := json.Unmarshal(content, &entries); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return entries, nil
+	}
+
+	reader := csv.NewReader(strings.NewReader(string(content)))
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["publickey"]; !ok {
+		if _, ok := columns["cert"]; !ok {
+			return nil, fmt.Errorf("%s: the header needs a publicKey or a cert column", path)
+		}
+	}
+	value := func(record []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var entries []entry
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		e := entry{
+			Did:       value(record, "did"),
+			PublicKey: value(record, "publickey"),
+			Cert:      value(record, "cert"),
+			IssuerID:  value(record, "issuerid"),
+		}
+		for _, role := range strings.Split(value(record, "roles"), ";") {
+			if role = strings.TrimSpace(role); role != "" {
+				e.Roles = append(e.Roles, role)
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// participantRequest builds and validates the request of an entry
+func participantRequest(e entry, certs string) (*identity.StapledParticipantCreateRequest, error) {
+	request := &identity.StapledParticipantCreateRequest{
+		ParticipantCreateRequest: model.ParticipantCreateRequest{
+			DID:       e.Did,
+			PublicKey: e.PublicKey,
+			IssuerID:  e.IssuerID,
+			Roles:     e.Roles,
+		},
+	}
+	if e.Cert != "" {
+		certPem, err := ioutil.ReadFile(filepath.Join(certs, e.Cert))
+		if err != nil {
+			return nil, err
+		}
+		request.CertPem = base64.StdEncoding.EncodeToString(certPem)
+		cert, err := lus.GetX509CertFromPem(request.CertPem)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", e.Cert, err)
+		}
+		if err := lus.HasExpired(cert); err != nil {
+			return nil, fmt.Errorf("%s: %v", e.Cert, err)
+		}
+		certPublicKey, err := lus.GetPublicKey(cert)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", e.Cert, err)
+		}
+		if request.PublicKey == "" {
+			request.PublicKey = certPublicKey
+		} else if request.PublicKey != certPublicKey {
+			return nil, fmt.Errorf("the public key does not match the one of %s", e.Cert)
+		}
+	}
+	if request.PublicKey == "" {
+		return nil, fmt.Errorf(lus.ErrorRequiredParameter, "publicKey")
+	}
+	if _, err := keys.ParseSPKIBase64(request.PublicKey); err != nil {
+		return nil, fmt.Errorf("invalid publicKey: %v", err)
+	}
+	return request, nil
+}
+
+// batchDataKeys random data keys of the participants of a batch, by transient field
+func batchDataKeys(count int) (map[string]string, error) {
+	transient := make(map[string]string, count)
+	for i := 0; i < count; i++ {
+		key := make([]byte, shred.KeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		transient[identity.BatchDataKeyField(i)] = base64.StdEncoding.EncodeToString(key)
+	}
+	return transient, nil
+}
+
+func writeJSON(path string, value interface{}) error {
+	content, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(content, '\n'), 0644)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
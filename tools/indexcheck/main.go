@@ -0,0 +1,242 @@
+// Command indexcheck checks the CouchDB indexes shipped with the chaincode. It reads the
+// query collections and the queries built by the transactions, and the index definitions
+// of META-INF/statedb/couchdb/indexes, and reports:
+//
+//	the indexes declared by a collection without a definition, or with other fields
+//	the definitions that no collection declares, QueryDocuments never uses them
+//	the queries that no index covers, or whose index has no definition
+//
+// With -generate the missing definitions are written to the indexes directory, the
+// indexes of the uncovered queries must also be declared in their collection.
+//
+// Usage: go run ./tools/indexcheck [-dir META-INF/statedb/couchdb/indexes] [-generate]
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kmilodenisglez/cc-identity-go/contracts/identity"
+	"github.com/kmilodenisglez/cc-identity-go/lib-utils/query"
+)
+
+// definition CouchDB index definition file
+type definition struct {
+	Index struct {
+		Fields []string `json:"fields"`
+	} `json:"index"`
+	Ddoc string `json:"ddoc"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type checker struct {
+	dir         string
+	generate    bool
+	definitions map[string]*definition
+	problems    int
+}
+
+func main() {
+	dir := flag.String("dir", "META-INF/statedb/couchdb/indexes", "directory of the index definitions")
+	generate := flag.Bool("generate", false, "write the missing index definitions")
+	flag.Parse()
+
+	c := &checker{dir: *dir, generate: *generate}
+	if err := c.load(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	collections := identity.QueryCollections()
+	docTypes := make([]string, 0, len(collections))
+	for docType := range collections {
+		docTypes = append(docTypes, docType)
+	}
+	sort.Strings(docTypes)
+
+	declared := make(map[string]bool)
+	for _, docType := range docTypes {
+		for _, index := range collections[docType].Indexes {
+			declared[index.Name] = true
+			c.checkDeclared(docType, index)
+		}
+	}
+	c.checkUndeclared(declared)
+
+	for _, docType := range docTypes {
+		for _, q := range collections[docType].Shapes() {
+			c.checkQuery(collections[docType], q)
+		}
+	}
+	for _, q := range identity.QueryShapes() {
+		collection, ok := collections[q.DocType]
+		if !ok {
+			c.report("query %s: doc type without collection", describe(q))
+			continue
+		}
+		c.checkQuery(collection, q)
+	}
+
+	if c.problems > 0 {
+		fmt.Printf("%d problems\n", c.problems)
+		os.Exit(1)
+	}
+	fmt.Println("indexes OK")
+}
+
+// load reads the index definitions of the directory
+func (c *checker) load() error {
+	files, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	c.definitions = make(map[string]*definition)
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var def definition
+		if err := json.Unmarshal(content, &def); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		switch {
+		case def.Name == "" || def.Ddoc == "":
+			c.report("%s: name and ddoc are required", file)
+		case def.Type != "json":
+			c.report("%s: type %q, expected json", file, def.Type)
+		case len(def.Index.Fields) == 0 || def.Index.Fields[0] != "docType":
+			c.report("%s: the first field must be docType", file)
+		case c.definitions[def.Name] != nil:
+			c.report("%s: index %s is defined twice", file, def.Name)
+		}
+		if strings.TrimSuffix(filepath.Base(file), ".json") != def.Name {
+			c.report("%s: the file name is not the index name %s", file, def.Name)
+		}
+		c.definitions[def.Name] = &def
+	}
+	return nil
+}
+
+// checkDeclared the declared index has a definition with the same fields
+func (c *checker) checkDeclared(docType string, index query.Index) {
+	def, ok := c.definitions[index.Name]
+	if !ok {
+		c.report("index %s of %s has no definition", index.Name, docType)
+		c.write(index)
+		return
+	}
+	if def.Ddoc != index.DesignDoc || strings.Join(def.Index.Fields, ",") != strings.Join(index.Fields, ",") {
+		c.report("index %s of %s is declared as %s %v, defined as %s %v", index.Name, docType, index.DesignDoc, index.Fields, def.Ddoc, def.Index.Fields)
+	}
+}
+
+// checkUndeclared every definition is declared by a collection
+func (c *checker) checkUndeclared(declared map[string]bool) {
+	names := make([]string, 0, len(c.definitions))
+	for name := range c.definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !declared[name] {
+			c.report("index %s %v is not declared by any collection", name, c.definitions[name].Index.Fields)
+		}
+	}
+}
+
+// checkQuery an index of the collection covers the query and it is defined
+func (c *checker) checkQuery(collection *query.Collection, q query.Query) {
+	compiled, err := collection.Compile(q)
+	if err != nil {
+		c.report("query %s: %v", describe(q), err)
+		if len(q.Where) > 0 || len(q.Sort) > 0 {
+			index := indexFor(q)
+			if c.write(index) {
+				fmt.Printf("\tdeclare in the %s collection: {DesignDoc: %q, Name: %q, Fields: %#v},\n", q.DocType, index.DesignDoc, index.Name, index.Fields)
+			}
+		}
+		return
+	}
+	if c.definitions[compiled.Index.Name] == nil {
+		c.report("query %s: index %s has no definition", describe(q), compiled.Index.Name)
+	}
+}
+
+// write writes the definition of the index if -generate is set and it is not defined
+func (c *checker) write(index query.Index) bool {
+	if !c.generate || c.definitions[index.Name] != nil {
+		return false
+	}
+	def := &definition{Ddoc: index.DesignDoc, Name: index.Name, Type: "json"}
+	def.Index.Fields = index.Fields
+	content, err := json.MarshalIndent(def, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	file := filepath.Join(c.dir, index.Name+".json")
+	if err := ioutil.WriteFile(file, append(content, '\n'), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	c.definitions[index.Name] = def
+	fmt.Printf("\twrote %s\n", file)
+	return true
+}
+
+func (c *checker) report(format string, args ...interface{}) {
+	c.problems++
+	fmt.Printf(format+"\n", args...)
+}
+
+// indexFor the index of the query: docType, the filtered fields and the sort fields
+func indexFor(q query.Query) query.Index {
+	fields := []string{"docType"}
+	add := func(field string) {
+		for _, f := range fields {
+			if f == field {
+				return
+			}
+		}
+		fields = append(fields, field)
+	}
+	for _, cond := range q.Where {
+		if cond.Op != query.OpElemMatch {
+			add(cond.Field)
+		}
+	}
+	for _, s := range q.Sort {
+		add(s.Field)
+	}
+
+	name := "index" + title(q.DocType[strings.LastIndex(q.DocType, ".")+1:])
+	for _, field := range fields[1:] {
+		name += title(field)
+	}
+	return query.Index{DesignDoc: name + "Doc", Name: name, Fields: fields}
+}
+
+func describe(q query.Query) string {
+	var parts []string
+	for _, cond := range q.Where {
+		parts = append(parts, cond.Field+" "+cond.Op)
+	}
+	for _, s := range q.Sort {
+		parts = append(parts, "sort "+s.Field)
+	}
+	return fmt.Sprintf("%s {%s}", q.DocType, strings.Join(parts, ", "))
+}
+
+func title(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}